@@ -1,9 +1,17 @@
 package main
 
-import "github.com/voltavpn/volta-client/internal/gui"
+import (
+	"os"
 
-// main wires the executable to the GUI layer.
-// All UI details live in the internal/gui package.
+	"github.com/voltavpn/volta-client/internal/cli"
+	"github.com/voltavpn/volta-client/internal/gui"
+)
+
+// main wires the executable to the GUI layer, or to the headless CLI when
+// a subcommand is given. All UI details live in the internal/gui package.
 func main() {
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	gui.Run()
 }
@@ -15,12 +15,17 @@ import (
 
 // APIClient описывает минимальный контракт для общения с backend API VoltaVPN.
 type APIClient interface {
-	Activate(ctx context.Context, token string) (*ActivateResponse, error)
+	Activate(ctx context.Context, req ActivateRequest) (*ActivateResponse, error)
+	// Revoke отзывает сессию на сервере; после него токен недействителен.
+	Revoke(ctx context.Context, sessionToken string) error
 }
 
 // ActivateRequest — тело запроса на активацию opaque-токена.
 type ActivateRequest struct {
 	Token string `json:"token"`
+	// DeviceID — идентификатор установки, выведенный из ключа устройства;
+	// сам ключ на сервер не передаётся.
+	DeviceID string `json:"device_id,omitempty"`
 }
 
 // ActivateResponse — ответ сервера с сессионным токеном и VPN-профилем.
@@ -122,21 +127,19 @@ func sameHostHTTPS(u *url.URL, base *url.URL) bool {
 	return u.Scheme == "https" && strings.EqualFold(u.Hostname(), base.Hostname())
 }
 
-func (c *HTTPClient) Activate(ctx context.Context, token string) (*ActivateResponse, error) {
+func (c *HTTPClient) Activate(ctx context.Context, activate ActivateRequest) (*ActivateResponse, error) {
 	if c == nil || c.client == nil || c.baseURL == nil {
 		return nil, errors.New("uninitialized HTTP client")
 	}
 
-	if token == "" {
+	if activate.Token == "" {
 		return nil, errors.New("empty token")
 	}
 
 	u := *c.baseURL
 	u.Path = strings.TrimRight(u.Path, "/") + "/v1/activate"
 
-	body, err := json.Marshal(ActivateRequest{
-		Token: token,
-	})
+	body, err := json.Marshal(activate)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +182,47 @@ func (c *HTTPClient) Activate(ctx context.Context, token string) (*ActivateRespo
 	return &out, nil
 }
 
+// Revoke отзывает сессию. Токен передаётся в заголовке Authorization,
+// тела у запроса нет.
+func (c *HTTPClient) Revoke(ctx context.Context, sessionToken string) error {
+	if c == nil || c.client == nil || c.baseURL == nil {
+		return errors.New("uninitialized HTTP client")
+	}
+
+	if sessionToken == "" {
+		return errors.New("empty session token")
+	}
+
+	u := *c.baseURL
+	u.Path = strings.TrimRight(u.Path, "/") + "/v1/session/revoke"
+
+	reqCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+sessionToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBodyBytes))
+
+	// Уже отозванная или истёкшая сессия — тот же результат.
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("unexpected status code from API")
+	}
+	return nil
+}
+
 type MockClient struct{}
 
 func NewClientFromEnv() (APIClient, error) {
@@ -193,8 +237,8 @@ func NewClientFromEnv() (APIClient, error) {
 	return NewHTTPClient(baseURL)
 }
 
-func (m *MockClient) Activate(ctx context.Context, token string) (*ActivateResponse, error) {
-	if strings.TrimSpace(token) == "" {
+func (m *MockClient) Activate(ctx context.Context, req ActivateRequest) (*ActivateResponse, error) {
+	if strings.TrimSpace(req.Token) == "" {
 		return nil, errors.New("empty token")
 	}
 
@@ -203,3 +247,10 @@ func (m *MockClient) Activate(ctx context.Context, token string) (*ActivateRespo
 		VPNProfile:   "mock-vpn-profile",
 	}, nil
 }
+
+func (m *MockClient) Revoke(ctx context.Context, sessionToken string) error {
+	if strings.TrimSpace(sessionToken) == "" {
+		return errors.New("empty session token")
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+// Package cli implements the headless command-line front end. It drives the
+// same core.Connection model as the GUI and never prints secrets.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/api"
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/killswitch"
+	"github.com/voltavpn/volta-client/internal/netmon"
+	"github.com/voltavpn/volta-client/internal/routing"
+	"github.com/voltavpn/volta-client/internal/secretstore"
+	"github.com/voltavpn/volta-client/internal/settings"
+	"github.com/voltavpn/volta-client/internal/tun"
+	"github.com/voltavpn/volta-client/internal/xray"
+)
+
+const (
+	activateTimeout   = 15 * time.Second
+	disconnectTimeout = 10 * time.Second
+)
+
+// IsCommand сообщает, что аргументы запуска адресованы CLI, а не GUI.
+func IsCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "connect", "route", "keys", "help", "-h", "--help":
+		return true
+	default:
+		return false
+	}
+}
+
+// Run выполняет команду и возвращает код выхода процесса.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	switch args[0] {
+	case "connect":
+		return runConnect(args[1:], stdout, stderr)
+	case "route":
+		return runRoute(args[1:], stdout, stderr)
+	case "keys":
+		return runKeys(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		usage(stdout)
+		return 0
+	default:
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  voltavpn                 start the desktop app")
+	fmt.Fprintln(w, "  voltavpn connect [key]   connect and stay connected until Ctrl+C;")
+	fmt.Fprintln(w, "                           without a key the active saved key is used")
+	fmt.Fprintln(w, "  voltavpn keys            list saved access keys")
+	fmt.Fprintln(w, "  voltavpn keys use <name>             make a saved key active")
+	fmt.Fprintln(w, "  voltavpn keys rename <name> <new>    rename a saved key")
+	fmt.Fprintln(w, "  voltavpn keys remove <name>          remove a saved key")
+	fmt.Fprintln(w, "  voltavpn route <host>    explain which routing rule applies to a host or IP")
+}
+
+func runRoute(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		usage(stderr)
+		return 2
+	}
+	dest, err := routing.ParseDestination(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, "Некорректный адрес назначения.")
+		return 2
+	}
+	rules := settings.LoadOrDefault().Routing
+	matcher, err := routing.Compile(rules, nil)
+	if err != nil {
+		fmt.Fprintln(stderr, "Некорректные правила маршрутизации:", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, matcher.Explain(dest))
+	if err := xray.CheckRouting(rules); err != nil {
+		fmt.Fprintln(stderr, "Подключение с этими правилами невозможно:", err)
+	}
+	return 0
+}
+
+func runConnect(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 1 {
+		usage(stderr)
+		return 2
+	}
+
+	appSettings := settings.LoadOrDefault()
+	// Без баз geoip/geosite ядро не запустится: сообщаем до входа.
+	if err := xray.CheckRouting(appSettings.Routing); err != nil {
+		fmt.Fprintln(stderr, "Правило маршрутизации требует geoip.dat или geosite.dat рядом с программой:", err)
+		return 1
+	}
+	sessions := core.NewSessionCache(secretstore.OpenDefault())
+	_ = sessions.SetPersistent(appSettings.Privacy.RememberDevice)
+
+	auto := core.NewAutoStrategy(core.HandshakeProber{}, 0)
+	// Монитор сети есть не на всех платформах; без него не будет только
+	// переподключения по смене сети.
+	var monitor *core.NetworkMonitor
+	if source, err := netmon.New(); err == nil {
+		monitor = core.NewNetworkMonitor(source, 0)
+		defer monitor.Close()
+		auto.SetNetworkID(monitor.Fingerprint())
+	}
+	var profiles []core.Profile
+	if len(args) == 1 {
+		client, err := api.NewClientFromEnv()
+		if err != nil {
+			fmt.Fprintln(stderr, "Сервис временно недоступен. Повторите попытку позже.")
+			return 1
+		}
+
+		activateCtx, cancelActivate := context.WithTimeout(context.Background(), activateTimeout)
+		deviceID, _ := sessions.DeviceID(appSettings.Privacy.RememberDevice)
+		result, message, ok := core.ActivateAccess(activateCtx, client, args[0], deviceID)
+		cancelActivate()
+		if !ok {
+			fmt.Fprintln(stderr, message)
+			return 1
+		}
+		if profile, err := sessions.AddProfile("", result); err == nil {
+			_ = sessions.Select(profile.ID)
+			if appSettings.Privacy.RememberDevice {
+				appSettings.Access.ActiveProfile = profile.ID
+				_ = settings.Save(appSettings)
+				fmt.Fprintln(stdout, "Ключ сохранён как", profile.Name)
+			}
+		}
+
+		profiles, err = core.ParseProfiles(result.VPNProfile)
+		if err != nil {
+			fmt.Fprintln(stderr, "Профиль подключения недоступен.")
+			return 1
+		}
+	} else {
+		plan := core.PlanLaunch(sessions, appSettings)
+		if plan.Screen != core.LaunchMain {
+			if plan.Err != nil {
+				fmt.Fprintln(stderr, plan.FallbackReason, plan.Err)
+			} else if plan.FallbackReason != "" {
+				fmt.Fprintln(stderr, plan.FallbackReason)
+			} else {
+				fmt.Fprintln(stderr, "Нет сохранённой сессии. Укажите ключ доступа.")
+			}
+			return 1
+		}
+		profiles = plan.Profiles
+		if plan.PreferredTransport != "" {
+			auto.RememberTransport(auto.NetworkID(), plan.PreferredTransport)
+		}
+	}
+
+	if _, err := core.ProfileForMode(profiles, appSettings.Connection.Mode); err != nil {
+		fmt.Fprintln(stderr, "Профиль не поддерживает выбранный режим подключения.")
+		return 1
+	}
+
+	// Правила и маршруты TUN, оставшиеся после аварийного завершения.
+	_ = tun.Recover()
+	conn := core.NewConnection(core.NewTUNEngine(core.NewInProcessEngine(xray.New), tun.Open))
+	conn.SetProfileSelector(auto)
+	supervisor := core.NewSupervisor(conn, core.ReconnectPolicyFromSettings(appSettings.Connection))
+	defer supervisor.Close()
+	if monitor != nil {
+		stopFollow := core.FollowNetwork(monitor, supervisor, auto, nil)
+		defer stopFollow()
+	}
+	health := core.NewHealthMonitor(conn, nil, core.HealthPolicyFromSettings(appSettings.Connection))
+	defer health.Close()
+	stopFollowHealth := core.FollowHealth(health, supervisor)
+	defer stopFollowHealth()
+	killSwitch := core.NewKillSwitch(conn, killswitch.New(), appSettings.Privacy.KillSwitch)
+	defer killSwitch.Close()
+	if appSettings.Privacy.DNSLeakProtection {
+		stub, err := core.NewDNSStub(conn, appSettings.Privacy, appSettings.DNS)
+		if err == nil {
+			err = stub.Start()
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, "Не удалось запустить локальный DNS:", err)
+			return 1
+		}
+		defer stub.Close()
+		fmt.Fprintln(stdout, "Локальный DNS:", stub.Addr())
+	}
+	events, unsubscribe := conn.Subscribe()
+	defer unsubscribe()
+	go func() {
+		for t := range events {
+			printTransition(stdout, t)
+			if t.To == core.StateConnected {
+				if active, ok := conn.ActiveProfile(); ok {
+					_ = sessions.MarkProfileGood(active)
+				}
+			}
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts, err := core.NewEngineOptions(appSettings)
+	if err != nil {
+		fmt.Fprintln(stderr, "Не удалось подготовить подключение:", err)
+		return 1
+	}
+	var checker core.ConnectivityChecker
+	if report := checker.Check(ctx, nil); report.BlocksConnect() {
+		fmt.Fprintln(stderr, connectivityMessage(report))
+		return 1
+	}
+	if err := conn.Connect(ctx, profiles, opts, core.ReasonUserRequest); err != nil {
+		// Пока kill switch блокирует трафик, проверка увидела бы «нет сети».
+		if killSwitch.Status().State != core.KillSwitchBlocking {
+			if message := connectivityMessage(checker.Check(ctx, profiles)); message != "" {
+				fmt.Fprintln(stderr, message)
+			}
+		}
+		return 1
+	}
+	if proxies, ok := core.LocalProxies(opts); ok && appSettings.Connection.Mode == settings.ConnectionModeProxyOnly {
+		fmt.Fprintln(stdout, "SOCKS5:", proxies.SOCKS, " HTTP:", proxies.HTTP)
+		if proxies.Auth != nil {
+			// Пароль в вывод не попадает: он лежит в файле, доступном только
+			// текущему пользователю, пока подключение активно.
+			path, err := writeProxyCredentials(*proxies.Auth)
+			if err != nil {
+				fmt.Fprintln(stderr, "Не удалось сохранить учётные данные прокси:", err)
+			} else {
+				defer os.Remove(path)
+				fmt.Fprintln(stdout, "Логин прокси:", proxies.Auth.Username, " пароль в файле", path)
+			}
+		}
+	}
+
+	<-ctx.Done()
+
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	if err := conn.Disconnect(disconnectCtx, core.ReasonUserRequest); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// writeProxyCredentials сохраняет учётные данные прокси текущего
+// подключения в файл с правами 0600 рядом с настройками.
+func writeProxyCredentials(creds core.ProxyCredentials) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "VoltaVPN")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "proxy-credentials")
+	data := "username=" + creds.Username + "\npassword=" + creds.Password + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func printTransition(w io.Writer, t core.Transition) {
+	line := fmt.Sprintf("%s  %s -> %s (%s)", t.At.Format(time.TimeOnly), t.From, t.To, t.Reason)
+	if t.Err != nil {
+		line += ": " + t.Err.Error()
+	}
+	fmt.Fprintln(w, line)
+}
+
+// connectivityMessage описывает проблему сети; пустая строка, если её нет.
+func connectivityMessage(r core.ConnectivityReport) string {
+	switch r.Status {
+	case core.ConnectivityNoNetwork:
+		return "Нет подключения к сети."
+	case core.ConnectivityCaptivePortal:
+		return "Сеть требует входа на странице авторизации: " + r.PortalURL
+	case core.ConnectivityDNSBroken:
+		return "DNS в этой сети не отвечает."
+	case core.ConnectivityServerUnreachable:
+		return "Интернет работает, но сервер VPN недоступен."
+	default:
+		return ""
+	}
+}
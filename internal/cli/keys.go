@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/secretstore"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// runKeys управляет сохранёнными ключами доступа. Ключи выбираются по
+// имени; сессии и профили серверов не печатаются.
+func runKeys(args []string, stdout, stderr io.Writer) int {
+	appSettings := settings.LoadOrDefault()
+	sessions := core.NewSessionCache(secretstore.OpenDefault())
+	profiles, err := sessions.Profiles()
+	if err != nil {
+		fmt.Fprintln(stderr, "Сохранённые ключи недоступны:", err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		if len(profiles) == 0 {
+			fmt.Fprintln(stdout, "Нет сохранённых ключей.")
+			return 0
+		}
+		for i, p := range profiles {
+			marker := " "
+			if p.ID == appSettings.Access.ActiveProfile || (i == 0 && !hasProfile(profiles, appSettings.Access.ActiveProfile)) {
+				marker = "*"
+			}
+			fmt.Fprintln(stdout, marker, p.Name)
+		}
+		return 0
+	}
+
+	var want int
+	switch args[0] {
+	case "use", "remove":
+		want = 2
+	case "rename":
+		want = 3
+	default:
+		usage(stderr)
+		return 2
+	}
+	if len(args) != want {
+		usage(stderr)
+		return 2
+	}
+	profile, ok := findProfile(profiles, args[1])
+	if !ok {
+		fmt.Fprintln(stderr, "Ключ не найден:", args[1])
+		return 1
+	}
+
+	switch args[0] {
+	case "use":
+		appSettings.Access.ActiveProfile = profile.ID
+		err = settings.Save(appSettings)
+	case "rename":
+		err = sessions.RenameProfile(profile.ID, args[2])
+	case "remove":
+		err = sessions.RemoveProfile(profile.ID)
+		if err == nil && appSettings.Access.ActiveProfile == profile.ID {
+			appSettings.Access.ActiveProfile = ""
+			err = settings.Save(appSettings)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, keysErrorText(err))
+		return 1
+	}
+	return 0
+}
+
+func findProfile(profiles []core.AccessProfile, name string) (core.AccessProfile, bool) {
+	for _, p := range profiles {
+		if strings.EqualFold(p.Name, strings.TrimSpace(name)) {
+			return p, true
+		}
+	}
+	return core.AccessProfile{}, false
+}
+
+func hasProfile(profiles []core.AccessProfile, id string) bool {
+	for _, p := range profiles {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func keysErrorText(err error) string {
+	switch {
+	case errors.Is(err, core.ErrInvalidProfileName):
+		return "Имя ключа не может быть пустым или длиннее 64 символов."
+	case errors.Is(err, core.ErrDuplicateProfileName):
+		return "Ключ с таким именем уже есть."
+	default:
+		return "Не удалось изменить ключи: " + err.Error()
+	}
+}
@@ -27,7 +27,9 @@ type ActivateResult struct {
 	ProfileURL   string
 }
 
-func ActivateAccess(ctx context.Context, client api.APIClient, raw string) (ActivateResult, string, bool) {
+// ActivateAccess активирует ключ доступа. deviceID (см. SessionCache.DeviceID)
+// может быть пустым.
+func ActivateAccess(ctx context.Context, client api.APIClient, raw, deviceID string) (ActivateResult, string, bool) {
 	var empty ActivateResult
 
 	normalized := authlink.NormalizeInput(raw)
@@ -44,7 +46,7 @@ func ActivateAccess(ctx context.Context, client api.APIClient, raw string) (Acti
 		return empty, "Сервис временно недоступен. Повторите попытку позже.", false
 	}
 
-	resp, err := client.Activate(ctx, token)
+	resp, err := client.Activate(ctx, api.ActivateRequest{Token: token, DeviceID: deviceID})
 	if err != nil || resp == nil {
 		// Сообщение умышленно общее, без раскрытия деталей сетевой ошибки.
 		return empty, "Не удалось связаться с сервером. Повторите попытку позже.", false
@@ -0,0 +1,393 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+const (
+	defaultRaceStagger  = 300 * time.Millisecond
+	defaultProbeTimeout = 5 * time.Second
+)
+
+var ErrAllTransportsFailed = errors.New("all transports failed")
+
+// FailureKind — класс ошибки транспорта, важный для выбора запасного пути.
+type FailureKind string
+
+const (
+	FailureNone      FailureKind = ""
+	FailureRefused   FailureKind = "refused"
+	FailureReset     FailureKind = "reset"
+	FailureTimeout   FailureKind = "timeout"
+	FailureHandshake FailureKind = "handshake"
+	FailureCancelled FailureKind = "cancelled"
+	FailureOther     FailureKind = "other"
+)
+
+// ClassifyTransportError относит ошибку подключения к одному из классов.
+// Сброс соединения или обрыв посреди рукопожатия — типичный след DPI.
+func ClassifyTransportError(err error) FailureKind {
+	var netErr net.Error
+	var alert tls.AlertError
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+
+	switch {
+	case err == nil:
+		return FailureNone
+	case errors.Is(err, context.Canceled):
+		return FailureCancelled
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return FailureReset
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FailureTimeout
+	case errors.As(err, &alert), errors.As(err, &recordErr), errors.As(err, &certErr):
+		return FailureHandshake
+	default:
+		return FailureOther
+	}
+}
+
+// TransportProber проверяет, проходит ли рукопожатие с сервером профиля.
+type TransportProber interface {
+	Probe(ctx context.Context, p Profile) error
+}
+
+// HandshakeProber выполняет TCP‑подключение и TLS‑рукопожатие с SNI
+// профиля. Для Reality неавторизованное рукопожатие проксируется на
+// сайт‑маскировку, поэтому его успех означает, что путь не режется DPI.
+// Данные пользователя по этому соединению не передаются. У цепочки
+// проверяется вход: к остальным серверам устройство не подключается.
+type HandshakeProber struct {
+	// RootCAs — доверенные корни; nil означает системные.
+	RootCAs *x509.CertPool
+	Timeout time.Duration
+}
+
+func (h HandshakeProber) Probe(ctx context.Context, p Profile) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, _, err := measureHandshake(ctx, p, h.RootCAs)
+	return err
+}
+
+// measureHandshake подключается к серверу профиля и выполняет TLS‑рукопожатие,
+// возвращая время TCP‑подключения и время рукопожатия по отдельности.
+func measureHandshake(ctx context.Context, p Profile, rootCAs *x509.CertPool) (connect, handshake time.Duration, err error) {
+	started := time.Now()
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.Address, strconv.Itoa(p.Port)))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer raw.Close()
+	connect = time.Since(started)
+
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName = p.Address
+	}
+	cfg := &tls.Config{
+		ServerName: serverName,
+		RootCAs:    rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	switch {
+	case p.Network == NetworkGRPC:
+		cfg.NextProtos = []string{"h2"}
+	case p.Network == NetworkWS:
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+	clientHelloFor(p.Fingerprint).apply(cfg)
+
+	started = time.Now()
+	if err := tls.Client(raw, cfg).HandshakeContext(ctx); err != nil {
+		return connect, 0, err
+	}
+	return connect, time.Since(started), nil
+}
+
+// CandidateResult — итог проверки одного кандидата в гонке.
+type CandidateResult struct {
+	Profile  Profile
+	Err      error
+	Failure  FailureKind
+	Duration time.Duration
+}
+
+// RaceResult — итог гонки транспортов.
+type RaceResult struct {
+	Winner   Profile
+	Attempts []CandidateResult
+}
+
+// ProfileSelector выбирает профиль из кандидатов перед запуском движка.
+type ProfileSelector interface {
+	SelectProfile(ctx context.Context, candidates []Profile, opts EngineOptions) (Profile, error)
+}
+
+// AutoStrategy реализует режим Auto: сначала VLESS Reality, затем резервные
+// транспорты, запускаемые со сдвигом по времени (в духе Happy Eyeballs).
+// Победивший транспорт запоминается для сети и в следующий раз пробуется первым.
+type AutoStrategy struct {
+	prober  TransportProber
+	stagger time.Duration
+
+	mu        sync.Mutex
+	networkID string
+	winners   map[string]string
+	lastRace  RaceResult
+	ranking   *ServerRanking
+}
+
+// NewAutoStrategy создаёт стратегию. stagger <= 0 означает значение по умолчанию.
+func NewAutoStrategy(prober TransportProber, stagger time.Duration) *AutoStrategy {
+	if stagger <= 0 {
+		stagger = defaultRaceStagger
+	}
+	return &AutoStrategy{
+		prober:  prober,
+		stagger: stagger,
+		winners: make(map[string]string),
+	}
+}
+
+// SetNetworkID задаёт идентификатор текущей сети, к которому привязывается
+// запомненный транспорт.
+func (a *AutoStrategy) SetNetworkID(id string) {
+	a.mu.Lock()
+	a.networkID = id
+	a.mu.Unlock()
+}
+
+// NetworkID возвращает идентификатор текущей сети.
+func (a *AutoStrategy) NetworkID() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.networkID
+}
+
+// RememberedTransport возвращает ключ транспорта, победившего в сети.
+func (a *AutoStrategy) RememberedTransport(networkID string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key, ok := a.winners[networkID]
+	return key, ok
+}
+
+// SetServerRanking подключает замеры задержек: среди транспортов одного
+// класса первым пробуется ближайший сервер.
+func (a *AutoStrategy) SetServerRanking(r *ServerRanking) {
+	a.mu.Lock()
+	a.ranking = r
+	a.mu.Unlock()
+}
+
+// RememberTransport запоминает транспорт для сети, например удачный
+// транспорт прошлого запуска.
+func (a *AutoStrategy) RememberTransport(networkID, key string) {
+	a.mu.Lock()
+	a.winners[networkID] = key
+	a.mu.Unlock()
+}
+
+// Forget забывает победившие транспорты и последнюю гонку, например при
+// сбросе ключа: они относятся к серверам прежнего профиля.
+func (a *AutoStrategy) Forget() {
+	a.mu.Lock()
+	clear(a.winners)
+	a.lastRace = RaceResult{}
+	a.mu.Unlock()
+}
+
+// LastRace возвращает результат последней гонки (для диагностики).
+func (a *AutoStrategy) LastRace() RaceResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastRace
+}
+
+// SelectProfile реализует ProfileSelector: в режимах Auto и ProxyOnly
+// запускает гонку, в остальных выбирает первый допустимый профиль без проверок.
+func (a *AutoStrategy) SelectProfile(ctx context.Context, candidates []Profile, opts EngineOptions) (Profile, error) {
+	// Проба должна выглядеть так же, как будущее подключение.
+	candidates = withFingerprint(candidates, opts.Settings.Connection.Fingerprint)
+	if mode := opts.Settings.Connection.Mode; mode != settings.ConnectionModeAuto && mode != settings.ConnectionModeProxyOnly {
+		return ProfileForMode(candidates, opts.Settings.Connection.Mode)
+	}
+
+	a.mu.Lock()
+	networkID := a.networkID
+	a.mu.Unlock()
+
+	result, err := a.Race(ctx, networkID, candidates)
+	if err != nil {
+		return Profile{}, err
+	}
+	return result.Winner, nil
+}
+
+// TransportKey идентифицирует транспорт профиля без учётных данных; у
+// цепочки — транспорты всех её серверов через ">".
+func TransportKey(p Profile) string {
+	key := p.Network + "+" + p.Security + "@" + net.JoinHostPort(p.Address, strconv.Itoa(p.Port))
+	for _, hop := range p.Chain {
+		key += ">" + TransportKey(hop)
+	}
+	return key
+}
+
+// Race проверяет кандидатов и возвращает первого успешного. Кандидаты
+// стартуют по очереди с интервалом stagger; провал текущего кандидата
+// сразу запускает следующего.
+func (a *AutoStrategy) Race(ctx context.Context, networkID string, candidates []Profile) (RaceResult, error) {
+	if len(candidates) == 0 {
+		return RaceResult{}, ErrEmptyProfile
+	}
+	if a.prober == nil {
+		return RaceResult{Winner: candidates[0]}, nil
+	}
+
+	a.mu.Lock()
+	remembered := a.winners[networkID]
+	ranking := a.ranking
+	a.mu.Unlock()
+	var rank func(Profile) int
+	if ranking != nil {
+		if cached, ok := ranking.Cached(networkID); ok {
+			rank = latencyOrder(cached)
+		}
+	}
+	ordered := orderCandidates(candidates, remembered, rank)
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type probeResult struct {
+		index int
+		err   error
+		took  time.Duration
+	}
+	// Буфер на всех кандидатов: опоздавшие горутины не блокируются.
+	results := make(chan probeResult, len(ordered))
+	launch := func(i int) {
+		go func() {
+			started := time.Now()
+			err := a.prober.Probe(raceCtx, ordered[i])
+			results <- probeResult{index: i, err: err, took: time.Since(started)}
+		}()
+	}
+
+	var race RaceResult
+	next, running := 0, 0
+	launchNext := func() {
+		launch(next)
+		next++
+		running++
+	}
+	launchNext()
+
+	timer := time.NewTimer(a.stagger)
+	defer timer.Stop()
+
+	for {
+		select {
+		case r := <-results:
+			running--
+			race.Attempts = append(race.Attempts, CandidateResult{
+				Profile:  ordered[r.index],
+				Err:      r.err,
+				Failure:  ClassifyTransportError(r.err),
+				Duration: r.took,
+			})
+			if r.err == nil {
+				race.Winner = ordered[r.index]
+				a.finishRace(networkID, race, true)
+				return race, nil
+			}
+			if next < len(ordered) {
+				launchNext()
+				resetTimer(timer, a.stagger)
+			} else if running == 0 {
+				a.finishRace(networkID, race, false)
+				return race, ErrAllTransportsFailed
+			}
+		case <-timer.C:
+			if next < len(ordered) {
+				launchNext()
+				timer.Reset(a.stagger)
+			}
+		case <-ctx.Done():
+			a.finishRace(networkID, race, false)
+			return race, ctx.Err()
+		}
+	}
+}
+
+func (a *AutoStrategy) finishRace(networkID string, race RaceResult, won bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastRace = race
+	if won {
+		a.winners[networkID] = TransportKey(race.Winner)
+	} else {
+		delete(a.winners, networkID)
+	}
+}
+
+// orderCandidates ставит запомненный транспорт первым, затем Reality,
+// затем остальные. Внутри группы порядок задаёт rank (меньше — раньше);
+// без rank сохраняется исходный порядок.
+func orderCandidates(candidates []Profile, remembered string, rank func(Profile) int) []Profile {
+	var first, reality, others []Profile
+	for _, p := range candidates {
+		switch {
+		case remembered != "" && TransportKey(p) == remembered:
+			first = append(first, p)
+		case p.IsReality():
+			reality = append(reality, p)
+		default:
+			others = append(others, p)
+		}
+	}
+	if rank != nil {
+		byRank := func(a, b Profile) int { return cmp.Compare(rank(a), rank(b)) }
+		slices.SortStableFunc(reality, byRank)
+		slices.SortStableFunc(others, byRank)
+	}
+	ordered := make([]Profile, 0, len(candidates))
+	ordered = append(ordered, first...)
+	ordered = append(ordered, reality...)
+	return append(ordered, others...)
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// standIn — локальная точка, которая ведёт себя заданным образом.
+type standIn struct {
+	addr  *net.TCPAddr
+	close func()
+}
+
+// newResetStandIn принимает соединение и сразу сбрасывает его (RST),
+// как это делает DPI‑оборудование.
+func newResetStandIn(t *testing.T) standIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*net.TCPConn).SetLinger(0)
+			_ = conn.Close()
+		}
+	}()
+	return standIn{addr: ln.Addr().(*net.TCPAddr), close: func() { _ = ln.Close() }}
+}
+
+// newBlackholeStandIn принимает соединения и молчит.
+func newBlackholeStandIn(t *testing.T) standIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	return standIn{addr: ln.Addr().(*net.TCPAddr), close: func() {
+		_ = ln.Close()
+		mu.Lock()
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		mu.Unlock()
+	}}
+}
+
+// newTLSStandIn завершает TLS‑рукопожатие с сертификатом для example.com.
+func newTLSStandIn(t *testing.T) (standIn, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+	return standIn{addr: addr, close: srv.Close}, pool
+}
+
+func realityAt(t *testing.T, addr *net.TCPAddr) Profile {
+	t.Helper()
+	p := testProfile(t)
+	p.Address = addr.IP.String()
+	p.Port = addr.Port
+	p.ServerName = "example.com"
+	return p
+}
+
+func fallbackAt(t *testing.T, addr *net.TCPAddr, network string) Profile {
+	t.Helper()
+	p, err := ParseProfile(testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	p.Address = addr.IP.String()
+	p.Port = addr.Port
+	p.ServerName = "example.com"
+	if network == NetworkGRPC {
+		p.Network = NetworkGRPC
+		p.ServiceName = "tun"
+		p.Path = ""
+	}
+	return p
+}
+
+// countingProber считает пробы по адресу.
+type countingProber struct {
+	inner TransportProber
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingProber) Probe(ctx context.Context, p Profile) error {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[strconv.Itoa(p.Port)]++
+	c.mu.Unlock()
+	return c.inner.Probe(ctx, p)
+}
+
+func (c *countingProber) count(port int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[strconv.Itoa(port)]
+}
+
+func TestAutoStrategy_FallsBackOnReset(t *testing.T) {
+	reset := newResetStandIn(t)
+	defer reset.close()
+	good, pool := newTLSStandIn(t)
+	defer good.close()
+
+	reality := realityAt(t, reset.addr)
+	ws := fallbackAt(t, good.addr, NetworkWS)
+
+	auto := NewAutoStrategy(HandshakeProber{RootCAs: pool, Timeout: 2 * time.Second}, time.Second)
+	// Запасной транспорт первым в списке, но Reality всё равно пробуется раньше.
+	result, err := auto.Race(context.Background(), "wifi-1", []Profile{ws, reality})
+	if err != nil {
+		t.Fatalf("Race: %v", err)
+	}
+	if result.Winner.Port != ws.Port {
+		t.Fatalf("winner = %s, want ws fallback", result.Winner)
+	}
+	if len(result.Attempts) != 2 || result.Attempts[0].Profile.Port != reality.Port {
+		t.Fatalf("attempts = %+v", result.Attempts)
+	}
+	if got := result.Attempts[0].Failure; got != FailureReset {
+		t.Fatalf("reality failure = %q, want %q (err %v)", got, FailureReset, result.Attempts[0].Err)
+	}
+	if key, ok := auto.RememberedTransport("wifi-1"); !ok || key != TransportKey(ws) {
+		t.Fatalf("remembered = %q, %v", key, ok)
+	}
+}
+
+func TestAutoStrategy_StaggeredStartBeatsHungCandidate(t *testing.T) {
+	hung := newBlackholeStandIn(t)
+	defer hung.close()
+	good, pool := newTLSStandIn(t)
+	defer good.close()
+
+	reality := realityAt(t, hung.addr)
+	grpc := fallbackAt(t, good.addr, NetworkGRPC)
+
+	auto := NewAutoStrategy(HandshakeProber{RootCAs: pool, Timeout: 10 * time.Second}, 50*time.Millisecond)
+	started := time.Now()
+	result, err := auto.Race(context.Background(), "", []Profile{reality, grpc})
+	if err != nil {
+		t.Fatalf("Race: %v", err)
+	}
+	if result.Winner.Network != NetworkGRPC {
+		t.Fatalf("winner = %s, want grpc fallback", result.Winner)
+	}
+	if took := time.Since(started); took > 5*time.Second {
+		t.Fatalf("race waited for the hung candidate: %v", took)
+	}
+}
+
+func TestAutoStrategy_RemembersWinnerPerNetwork(t *testing.T) {
+	reset := newResetStandIn(t)
+	defer reset.close()
+	good, pool := newTLSStandIn(t)
+	defer good.close()
+
+	reality := realityAt(t, reset.addr)
+	ws := fallbackAt(t, good.addr, NetworkWS)
+	prober := &countingProber{inner: HandshakeProber{RootCAs: pool, Timeout: 2 * time.Second}}
+	auto := NewAutoStrategy(prober, time.Second)
+
+	if _, err := auto.Race(context.Background(), "wifi-1", []Profile{reality, ws}); err != nil {
+		t.Fatalf("first Race: %v", err)
+	}
+	if _, err := auto.Race(context.Background(), "wifi-1", []Profile{reality, ws}); err != nil {
+		t.Fatalf("second Race: %v", err)
+	}
+	if got := prober.count(reality.Port); got != 1 {
+		t.Fatalf("reality probed %d times, want 1 (remembered winner goes first)", got)
+	}
+
+	// В другой сети снова начинаем с Reality.
+	if _, err := auto.Race(context.Background(), "ethernet", []Profile{reality, ws}); err != nil {
+		t.Fatalf("third Race: %v", err)
+	}
+	if got := prober.count(reality.Port); got != 2 {
+		t.Fatalf("reality probed %d times on a new network, want 2", got)
+	}
+}
+
+func TestAutoStrategy_AllFail(t *testing.T) {
+	reset := newResetStandIn(t)
+	defer reset.close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	refusedAddr := ln.Addr().(*net.TCPAddr)
+	_ = ln.Close()
+
+	auto := NewAutoStrategy(HandshakeProber{Timeout: time.Second}, 20*time.Millisecond)
+	result, err := auto.Race(context.Background(), "", []Profile{
+		realityAt(t, reset.addr),
+		fallbackAt(t, refusedAddr, NetworkWS),
+	})
+	if !errors.Is(err, ErrAllTransportsFailed) {
+		t.Fatalf("Race error = %v, want ErrAllTransportsFailed", err)
+	}
+	kinds := map[FailureKind]bool{}
+	for _, a := range result.Attempts {
+		kinds[a.Failure] = true
+	}
+	if !kinds[FailureReset] || !kinds[FailureRefused] {
+		t.Fatalf("failures = %v, want reset and refused", kinds)
+	}
+}
+
+func TestAutoStrategy_SelectProfileHonoursMode(t *testing.T) {
+	reset := newResetStandIn(t)
+	defer reset.close()
+
+	auto := NewAutoStrategy(HandshakeProber{Timeout: time.Second}, 0)
+	opts := testOptions()
+	opts.Settings.Connection.Mode = settings.ConnectionModeVLESSRealityOnly
+
+	reality := realityAt(t, reset.addr)
+	// Вне режима Auto гонка не запускается, даже если сервер недоступен.
+	got, err := auto.SelectProfile(context.Background(), []Profile{reality}, opts)
+	if err != nil || got.Port != reality.Port {
+		t.Fatalf("SelectProfile = %s, %v", got, err)
+	}
+}
+
+func TestConnection_UsesProfileSelector(t *testing.T) {
+	good, pool := newTLSStandIn(t)
+	defer good.close()
+	reset := newResetStandIn(t)
+	defer reset.close()
+
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	conn.SetProfileSelector(NewAutoStrategy(HandshakeProber{RootCAs: pool, Timeout: time.Second}, time.Second))
+
+	ws := fallbackAt(t, good.addr, NetworkWS)
+	if err := conn.Connect(context.Background(), []Profile{realityAt(t, reset.addr), ws}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if active, ok := conn.ActiveProfile(); !ok || active.Port != ws.Port {
+		t.Fatalf("active profile = %s, %v", active, ok)
+	}
+	if starts := engine.Starts(); len(starts) != 1 || starts[0].Profile.Port != ws.Port {
+		t.Fatalf("engine starts = %+v", starts)
+	}
+}
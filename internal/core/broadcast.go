@@ -0,0 +1,60 @@
+package core
+
+import "sync"
+
+const subscriberBuffer = 16
+
+// broadcaster рассылает значения подписчикам, никогда не блокируя
+// отправителя: медленный подписчик теряет самые старые значения.
+// Нулевое значение готово к использованию.
+type broadcaster[T any] struct {
+	mu     sync.Mutex
+	subs   map[int]chan T
+	nextID int
+}
+
+func (b *broadcaster[T]) subscribe() (<-chan T, func()) {
+	ch := make(chan T, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[int]chan T)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+func (b *broadcaster[T]) publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subs {
+		select {
+		case ch <- v:
+			continue
+		default:
+		}
+		// Буфер переполнен: выбрасываем самое старое значение.
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
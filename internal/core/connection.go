@@ -0,0 +1,406 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConnectionState описывает состояние VPN‑подключения.
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnecting
+	StateConnected
+	StateReconnecting
+	StateDisconnecting
+	StateFailed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateDisconnecting:
+		return "disconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// TransitionReason — машинно-читаемая причина смены состояния.
+type TransitionReason string
+
+const (
+	ReasonUserRequest TransitionReason = "user_request"
+	ReasonEngineReady TransitionReason = "engine_ready"
+	ReasonEngineError TransitionReason = "engine_error"
+	ReasonEngineStop  TransitionReason = "engine_stopped"
+	ReasonCancelled   TransitionReason = "cancelled"
+	ReasonNoEngine    TransitionReason = "no_engine"
+	ReasonNoRoute     TransitionReason = "no_route"
+)
+
+// Transition — запись о смене состояния, которую получают подписчики.
+type Transition struct {
+	From   ConnectionState
+	To     ConnectionState
+	Reason TransitionReason
+	// Err заполняется только для переходов, вызванных ошибкой.
+	// Текст ошибки не должен содержать секретов профиля.
+	Err error
+	At  time.Time
+}
+
+var (
+	ErrInvalidTransition = errors.New("invalid connection state transition")
+	ErrNoEngine          = errors.New("tunnel engine is not configured")
+	ErrConnectSuperseded = errors.New("connect attempt superseded")
+)
+
+// engineStopTimeout ограничивает остановку движка после отменённой попытки.
+const engineStopTimeout = 10 * time.Second
+
+var allowedTransitions = map[ConnectionState][]ConnectionState{
+	StateDisconnected:  {StateConnecting},
+	StateConnecting:    {StateConnected, StateFailed, StateDisconnecting},
+	StateConnected:     {StateReconnecting, StateDisconnecting, StateFailed},
+	StateReconnecting:  {StateConnected, StateFailed, StateDisconnecting},
+	StateDisconnecting: {StateDisconnected},
+	StateFailed:        {StateConnecting, StateReconnecting, StateDisconnecting, StateDisconnected},
+}
+
+// CanTransition сообщает, разрешён ли переход from -> to.
+func CanTransition(from, to ConnectionState) bool {
+	for _, next := range allowedTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Connection — единая модель подключения, которой управляют GUI, трей и CLI.
+// Все методы безопасны для конкурентного вызова.
+type Connection struct {
+	engine TunnelEngine
+
+	mu    sync.Mutex
+	state ConnectionState
+	last  Transition
+	// candidates — профили, из которых выбирается сервер при каждом запуске.
+	candidates []Profile
+	active     Profile
+	opts       EngineOptions
+	selector   ProfileSelector
+	// attempt увеличивается при каждом Connect/Reconnect/Disconnect, чтобы
+	// результат устаревшей попытки не перезаписал текущее состояние.
+	attempt uint64
+	cancel  context.CancelFunc
+
+	transitions broadcaster[Transition]
+}
+
+// NewConnection создаёт модель подключения поверх движка туннеля.
+// engine может быть nil: тогда любая попытка подключения завершится ErrNoEngine.
+func NewConnection(engine TunnelEngine) *Connection {
+	c := &Connection{
+		engine: engine,
+		state:  StateDisconnected,
+	}
+	if engine != nil {
+		go c.watchEngine(engine.Events())
+	}
+	return c
+}
+
+// SetProfileSelector задаёт стратегию выбора профиля из кандидатов
+// (например, AutoStrategy). nil возвращает выбор первого допустимого.
+func (c *Connection) SetProfileSelector(selector ProfileSelector) {
+	c.mu.Lock()
+	c.selector = selector
+	c.mu.Unlock()
+}
+
+// Candidates возвращает профили последнего вызова Connect.
+func (c *Connection) Candidates() []Profile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Profile(nil), c.candidates...)
+}
+
+// Options возвращает параметры движка последнего вызова Connect.
+func (c *Connection) Options() EngineOptions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts
+}
+
+// ActiveProfile возвращает профиль, с которым запущен движок.
+func (c *Connection) ActiveProfile() (Profile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != StateConnected {
+		return Profile{}, false
+	}
+	return c.active, true
+}
+
+// ForgetProfiles забывает кандидатов и активный профиль, чтобы Reconnect
+// не поднял туннель с ними снова. Допустим только в Disconnected и Failed.
+func (c *Connection) ForgetProfiles() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != StateDisconnected && c.state != StateFailed {
+		return fmt.Errorf("%w: tunnel is %s", ErrInvalidTransition, c.state)
+	}
+	c.candidates = nil
+	c.active = Profile{}
+	return nil
+}
+
+// Engine возвращает движок, которым управляет подключение.
+func (c *Connection) Engine() TunnelEngine {
+	return c.engine
+}
+
+// watchEngine переводит подключение в Failed, если движок сообщил
+// об обрыве туннеля.
+func (c *Connection) watchEngine(events <-chan EngineEvent) {
+	for ev := range events {
+		if ev.Kind == EngineEventFailed {
+			_ = c.Fail(ReasonEngineStop, ev.Err)
+		}
+	}
+}
+
+// State возвращает текущее состояние.
+func (c *Connection) State() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// LastTransition возвращает последний совершённый переход.
+func (c *Connection) LastTransition() Transition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Subscribe регистрирует наблюдателя. Возвращённая функция отписывает его
+// и закрывает канал. Медленный подписчик теряет самые старые события,
+// но никогда не блокирует машину состояний.
+func (c *Connection) Subscribe() (<-chan Transition, func()) {
+	return c.transitions.subscribe()
+}
+
+// Connect выбирает профиль из candidates, поднимает туннель и блокируется
+// до результата. Отмена ctx или вызов Disconnect прерывают попытку.
+func (c *Connection) Connect(ctx context.Context, candidates []Profile, opts EngineOptions, reason TransitionReason) error {
+	c.mu.Lock()
+	if c.state != StateDisconnected && c.state != StateFailed {
+		from := c.state
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, StateConnecting)
+	}
+	c.setStateLocked(StateConnecting, reason, nil)
+	c.candidates = append([]Profile(nil), candidates...)
+	c.opts = opts
+	selector := c.selector
+	attempt, attemptCtx := c.beginAttemptLocked(ctx)
+	c.mu.Unlock()
+
+	return c.runStart(attemptCtx, attempt, selector, candidates, opts)
+}
+
+// Reconnect перезапускает туннель с последними кандидатами; профиль
+// выбирается заново.
+// Допустим из состояний Connected и Failed.
+func (c *Connection) Reconnect(ctx context.Context, reason TransitionReason) error {
+	return c.reconnect(ctx, nil, reason)
+}
+
+// SwitchProfiles перезапускает туннель с другими кандидатами, например
+// при смене ключа доступа. Туннель проходит через Reconnecting, а не через
+// Disconnected, поэтому kill switch не снимается и трафик не уходит мимо
+// туннеля. Допустим из тех же состояний, что и Reconnect.
+func (c *Connection) SwitchProfiles(ctx context.Context, candidates []Profile, reason TransitionReason) error {
+	if len(candidates) == 0 {
+		return ErrEmptyProfile
+	}
+	return c.reconnect(ctx, candidates, reason)
+}
+
+// reconnect перезапускает туннель; непустые candidates заменяют прежних.
+func (c *Connection) reconnect(ctx context.Context, replace []Profile, reason TransitionReason) error {
+	c.mu.Lock()
+	if !CanTransition(c.state, StateReconnecting) {
+		from := c.state
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, StateReconnecting)
+	}
+	if len(replace) > 0 {
+		// До публикации перехода: kill switch берёт адреса серверов из
+		// Candidates, когда видит Reconnecting.
+		c.candidates = append([]Profile(nil), replace...)
+	}
+	c.setStateLocked(StateReconnecting, reason, nil)
+	candidates, opts, selector := c.candidates, c.opts, c.selector
+	attempt, attemptCtx := c.beginAttemptLocked(ctx)
+	c.mu.Unlock()
+
+	if c.engine != nil {
+		_ = c.engine.Stop(attemptCtx)
+	}
+	return c.runStart(attemptCtx, attempt, selector, candidates, opts)
+}
+
+// Disconnect останавливает туннель. Незавершённая попытка подключения
+// отменяется. Вызов в состоянии Disconnected ничего не делает.
+func (c *Connection) Disconnect(ctx context.Context, reason TransitionReason) error {
+	c.mu.Lock()
+	switch c.state {
+	case StateDisconnected, StateDisconnecting:
+		c.mu.Unlock()
+		return nil
+	}
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	c.attempt++
+	attempt := c.attempt
+	c.setStateLocked(StateDisconnecting, reason, nil)
+	c.mu.Unlock()
+
+	var stopErr error
+	if c.engine != nil {
+		stopErr = c.engine.Stop(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.attempt == attempt {
+		c.setStateLocked(StateDisconnected, reason, stopErr)
+	}
+	return stopErr
+}
+
+// Fail переводит установленное подключение в Failed по внешнему сигналу
+// (например, движок сообщил об обрыве). Движок при этом не останавливается:
+// сигнал означает, что туннель уже не работает.
+func (c *Connection) Fail(reason TransitionReason, err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != StateConnected {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, c.state, StateFailed)
+	}
+	c.attempt++
+	c.setStateLocked(StateFailed, reason, err)
+	return nil
+}
+
+func (c *Connection) beginAttemptLocked(ctx context.Context) (uint64, context.Context) {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	attemptCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.attempt++
+	return c.attempt, attemptCtx
+}
+
+func (c *Connection) runStart(ctx context.Context, attempt uint64, selector ProfileSelector, candidates []Profile, opts EngineOptions) error {
+	var (
+		err     error
+		profile Profile
+	)
+	reason := ReasonEngineError
+	switch {
+	case c.engine == nil:
+		err = ErrNoEngine
+		reason = ReasonNoEngine
+	case selector != nil:
+		profile, err = selector.SelectProfile(ctx, candidates, opts)
+		if err != nil {
+			reason = ReasonNoRoute
+		}
+	default:
+		profile, err = ProfileForMode(candidates, opts.Settings.Connection.Mode)
+		if err != nil {
+			reason = ReasonNoRoute
+		}
+	}
+	started := false
+	if err == nil {
+		err = c.engine.Start(ctx, profile, opts)
+		started = err == nil
+	}
+	if err == nil && ctx.Err() != nil {
+		// Движок успел стартовать, но попытку уже отменили.
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.attempt != attempt {
+		// Попытку вытеснил Disconnect/Reconnect/Fail; остановку движка
+		// выполняет тот, кто её вытеснил.
+		return ErrConnectSuperseded
+	}
+	// ctx попытки нужен только на время Start.
+	c.cancel()
+	c.cancel = nil
+
+	if started && err != nil {
+		// Отменённая попытка не должна оставить работающий туннель. Движок
+		// останавливается под блокировкой: иначе следующая попытка могла бы
+		// стартовать раньше и быть остановлена вместо этой.
+		stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), engineStopTimeout)
+		_ = c.engine.Stop(stopCtx)
+		cancel()
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			reason = ReasonCancelled
+		}
+		c.setStateLocked(StateFailed, reason, err)
+		return err
+	}
+
+	c.active = profile
+	c.setStateLocked(StateConnected, ReasonEngineReady, nil)
+	return nil
+}
+
+func (c *Connection) setStateLocked(to ConnectionState, reason TransitionReason, err error) {
+	from := c.state
+	if !CanTransition(from, to) {
+		// Внутренние переходы проверяются заранее; сюда попадать не должны.
+		panic(fmt.Sprintf("core: invalid transition %s -> %s", from, to))
+	}
+
+	t := Transition{
+		From:   from,
+		To:     to,
+		Reason: reason,
+		Err:    err,
+		At:     time.Now(),
+	}
+	c.state = to
+	c.last = t
+	c.transitions.publish(t)
+}
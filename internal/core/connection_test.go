@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+func testProfile(t *testing.T) Profile {
+	t.Helper()
+	p, err := ParseProfile(testRealityLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	return p
+}
+
+func testOptions() EngineOptions {
+	return EngineOptions{Settings: settings.Default()}
+}
+
+func collect(t *testing.T, ch <-chan Transition, n int) []Transition {
+	t.Helper()
+	out := make([]Transition, 0, n)
+	timeout := time.After(2 * time.Second)
+	for len(out) < n {
+		select {
+		case tr := <-ch:
+			out = append(out, tr)
+		case <-timeout:
+			t.Fatalf("got %d transitions, want %d: %+v", len(out), n, out)
+		}
+	}
+	return out
+}
+
+func TestConnection_ConnectDisconnect(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	events, unsubscribe := conn.Subscribe()
+	defer unsubscribe()
+
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if got := conn.State(); got != StateConnected {
+		t.Fatalf("state = %s, want connected", got)
+	}
+	if err := conn.Disconnect(context.Background(), ReasonUserRequest); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	got := collect(t, events, 4)
+	want := []struct {
+		to     ConnectionState
+		reason TransitionReason
+	}{
+		{StateConnecting, ReasonUserRequest},
+		{StateConnected, ReasonEngineReady},
+		{StateDisconnecting, ReasonUserRequest},
+		{StateDisconnected, ReasonUserRequest},
+	}
+	for i, w := range want {
+		if got[i].To != w.to || got[i].Reason != w.reason {
+			t.Fatalf("transition %d = %s/%s, want %s/%s", i, got[i].To, got[i].Reason, w.to, w.reason)
+		}
+		if got[i].At.IsZero() {
+			t.Fatalf("transition %d has zero timestamp", i)
+		}
+	}
+	if engine.Running() {
+		t.Fatal("engine still running after Disconnect")
+	}
+}
+
+func TestConnection_StartFailure(t *testing.T) {
+	startErr := errors.New("handshake failed")
+	engine := NewFakeEngine(startErr)
+	conn := NewConnection(engine)
+
+	err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest)
+	if !errors.Is(err, startErr) {
+		t.Fatalf("Connect error = %v, want %v", err, startErr)
+	}
+	last := conn.LastTransition()
+	if last.To != StateFailed || last.Reason != ReasonEngineError || !errors.Is(last.Err, startErr) {
+		t.Fatalf("last transition = %+v", last)
+	}
+
+	// Из Failed можно снова подключаться.
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect after failure: %v", err)
+	}
+}
+
+func TestConnection_NoEngine(t *testing.T) {
+	conn := NewConnection(nil)
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); !errors.Is(err, ErrNoEngine) {
+		t.Fatalf("Connect error = %v, want ErrNoEngine", err)
+	}
+	if last := conn.LastTransition(); last.Reason != ReasonNoEngine {
+		t.Fatalf("reason = %s, want %s", last.Reason, ReasonNoEngine)
+	}
+}
+
+func TestConnection_ContextCancel(t *testing.T) {
+	engine := NewFakeEngine()
+	release := engine.HoldStart()
+	defer release()
+	conn := NewConnection(engine)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- conn.Connect(ctx, []Profile{testProfile(t)}, testOptions(), ReasonUserRequest) }()
+
+	waitState(t, conn, StateConnecting)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Connect error = %v, want context.Canceled", err)
+	}
+	if last := conn.LastTransition(); last.To != StateFailed || last.Reason != ReasonCancelled {
+		t.Fatalf("last transition = %+v", last)
+	}
+}
+
+// cancelAfterStartEngine отменяет попытку сразу после удачного Start,
+// как если бы пользователь нажал «Отмена» в момент подъёма туннеля.
+type cancelAfterStartEngine struct {
+	*FakeEngine
+	cancel context.CancelFunc
+}
+
+func (e cancelAfterStartEngine) Start(ctx context.Context, profile Profile, opts EngineOptions) error {
+	err := e.FakeEngine.Start(ctx, profile, opts)
+	e.cancel()
+	return err
+}
+
+func TestConnection_CancelAfterStartStopsEngine(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	engine := NewFakeEngine()
+	conn := NewConnection(cancelAfterStartEngine{FakeEngine: engine, cancel: cancel})
+
+	err := conn.Connect(ctx, []Profile{testProfile(t)}, testOptions(), ReasonUserRequest)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Connect error = %v, want context.Canceled", err)
+	}
+	if last := conn.LastTransition(); last.To != StateFailed || last.Reason != ReasonCancelled {
+		t.Fatalf("last transition = %+v", last)
+	}
+	if engine.Running() || engine.Stops() != 1 {
+		t.Fatalf("engine left running after cancelled attempt: running=%v stops=%d", engine.Running(), engine.Stops())
+	}
+}
+
+func TestConnection_DisconnectWhileConnecting(t *testing.T) {
+	engine := NewFakeEngine()
+	release := engine.HoldStart()
+	defer release()
+	conn := NewConnection(engine)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest)
+	}()
+	waitState(t, conn, StateConnecting)
+
+	if err := conn.Disconnect(context.Background(), ReasonUserRequest); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if err := <-done; !errors.Is(err, ErrConnectSuperseded) {
+		t.Fatalf("Connect error = %v, want ErrConnectSuperseded", err)
+	}
+	if got := conn.State(); got != StateDisconnected {
+		t.Fatalf("state = %s, want disconnected", got)
+	}
+}
+
+func TestConnection_Reconnect(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+
+	if err := conn.Reconnect(context.Background(), ReasonUserRequest); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Reconnect from disconnected = %v, want ErrInvalidTransition", err)
+	}
+
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := conn.Fail(ReasonEngineStop, errors.New("tunnel dropped")); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	if err := conn.Reconnect(context.Background(), ReasonUserRequest); err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+	if got := conn.State(); got != StateConnected {
+		t.Fatalf("state = %s, want connected", got)
+	}
+	starts := engine.Starts()
+	if len(starts) != 2 || !reflect.DeepEqual(starts[1].Profile, starts[0].Profile) {
+		t.Fatalf("starts = %+v", starts)
+	}
+}
+
+func TestConnection_RejectsInvalidTransitions(t *testing.T) {
+	conn := NewConnection(NewFakeEngine())
+	if err := conn.Fail(ReasonEngineStop, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Fail from disconnected = %v, want ErrInvalidTransition", err)
+	}
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("second Connect = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestConnection_EngineFailureEvent(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	engine.Fail(errors.New("connection reset"))
+	waitState(t, conn, StateFailed)
+	if last := conn.LastTransition(); last.Reason != ReasonEngineStop {
+		t.Fatalf("reason = %s, want %s", last.Reason, ReasonEngineStop)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	if CanTransition(StateDisconnected, StateConnected) {
+		t.Fatal("disconnected -> connected must be rejected")
+	}
+	if !CanTransition(StateConnected, StateReconnecting) {
+		t.Fatal("connected -> reconnecting must be allowed")
+	}
+}
+
+func waitState(t *testing.T, conn *Connection, want ConnectionState) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %s, want %s", conn.State(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
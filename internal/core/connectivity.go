@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPortalProbeURL отвечает 204 без тела; любой другой ответ
+	// означает, что запрос перехватила страница авторизации сети.
+	DefaultPortalProbeURL = "http://connectivitycheck.gstatic.com/generate_204"
+	// DefaultNetworkProbeAddr — адрес, доступный без DNS: по нему отличаем
+	// сломанный DNS от отсутствия сети.
+	DefaultNetworkProbeAddr = "1.1.1.1:443"
+
+	defaultConnectivityTimeout = 5 * time.Second
+)
+
+// ConnectivityStatus — итог проверки сети перед подключением или после
+// неудачного подключения.
+type ConnectivityStatus string
+
+const (
+	// ConnectivityUnknown — проверка не выполнена (отменена или неверно
+	// настроена); подключению она не мешает.
+	ConnectivityUnknown           ConnectivityStatus = "unknown"
+	ConnectivityOK                ConnectivityStatus = "ok"
+	ConnectivityNoNetwork         ConnectivityStatus = "no_network"
+	ConnectivityCaptivePortal     ConnectivityStatus = "captive_portal"
+	ConnectivityDNSBroken         ConnectivityStatus = "dns_broken"
+	ConnectivityServerUnreachable ConnectivityStatus = "server_unreachable"
+)
+
+// ConnectivityReport — результат ConnectivityChecker.Check.
+type ConnectivityReport struct {
+	Status ConnectivityStatus
+	// PortalURL — страница входа, на которую перенаправила проверка;
+	// заполняется для ConnectivityCaptivePortal.
+	PortalURL string
+	// Err — ошибка, по которой определён статус.
+	Err error
+}
+
+// BlocksConnect сообщает, что подключение заведомо не пройдёт, пока
+// пользователь не исправит сеть. При сломанном DNS туннель ещё может
+// подняться: адреса серверов в профиле обычно заданы IP.
+func (r ConnectivityReport) BlocksConnect() bool {
+	return r.Status == ConnectivityNoNetwork || r.Status == ConnectivityCaptivePortal
+}
+
+// ConnectivityChecker определяет, почему сеть не даёт подключиться:
+// сети нет, запросы перехватывает captive portal, не работает DNS или
+// недоступны серверы VPN. Все поля необязательны.
+type ConnectivityChecker struct {
+	// ProbeURL — HTTP‑адрес, отвечающий 204; по умолчанию DefaultPortalProbeURL.
+	// Его имя хоста заодно проверяет DNS.
+	ProbeURL string
+	// NetworkAddr — TCP‑адрес host:port с IP; по умолчанию DefaultNetworkProbeAddr.
+	NetworkAddr string
+	// Resolver разрешает имена и для проверки DNS, и для HTTP; nil — системный.
+	Resolver *net.Resolver
+	// Server проверяет серверы профиля; nil — HandshakeProber.
+	Server  TransportProber
+	Timeout time.Duration
+}
+
+// Check проверяет сеть. Серверы VPN проверяются, только если переданы
+// profiles; их недоступность не мешает подключению (см. BlocksConnect),
+// а лишь объясняет пользователю, в чём дело.
+func (c ConnectivityChecker) Check(ctx context.Context, profiles []Profile) ConnectivityReport {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultConnectivityTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probeURL := c.ProbeURL
+	if probeURL == "" {
+		probeURL = DefaultPortalProbeURL
+	}
+	u, err := url.Parse(probeURL)
+	if err != nil {
+		return ConnectivityReport{Status: ConnectivityUnknown, Err: err}
+	}
+
+	if _, err := netip.ParseAddr(u.Hostname()); err != nil {
+		if _, err := c.resolver().LookupHost(ctx, u.Hostname()); err != nil {
+			return c.withoutDNS(ctx, err)
+		}
+	}
+
+	portal, err := c.probePortal(ctx, u)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ConnectivityReport{Status: ConnectivityUnknown, Err: ctx.Err()}
+	case err != nil:
+		if !c.networkReachable(ctx) {
+			return ConnectivityReport{Status: ConnectivityNoNetwork, Err: err}
+		}
+		// Сеть есть, но адрес проверки закрыт: о портале судить нельзя.
+	case portal != "":
+		return ConnectivityReport{Status: ConnectivityCaptivePortal, PortalURL: portal}
+	}
+
+	if len(profiles) == 0 {
+		return ConnectivityReport{Status: ConnectivityOK}
+	}
+	if err := c.probeServers(ctx, profiles); err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return ConnectivityReport{Status: ConnectivityUnknown, Err: ctx.Err()}
+		}
+		return ConnectivityReport{Status: ConnectivityServerUnreachable, Err: err}
+	}
+	return ConnectivityReport{Status: ConnectivityOK}
+}
+
+// withoutDNS отличает сломанный DNS от отсутствия сети.
+func (c ConnectivityChecker) withoutDNS(ctx context.Context, dnsErr error) ConnectivityReport {
+	if ctx.Err() != nil {
+		return ConnectivityReport{Status: ConnectivityUnknown, Err: ctx.Err()}
+	}
+	if c.networkReachable(ctx) {
+		return ConnectivityReport{Status: ConnectivityDNSBroken, Err: dnsErr}
+	}
+	return ConnectivityReport{Status: ConnectivityNoNetwork, Err: dnsErr}
+}
+
+// probePortal возвращает адрес страницы входа, если ответ не 204.
+func (c ConnectivityChecker) probePortal(ctx context.Context, u *url.URL) (string, error) {
+	dialer := &net.Dialer{Resolver: c.resolver()}
+	client := &http.Client{
+		Transport: &http.Transport{
+			// Прокси из окружения исказил бы проверку самой сети.
+			Proxy:             nil,
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return "", nil
+	}
+	if location, err := resp.Location(); err == nil {
+		return location.String(), nil
+	}
+	// Портал может отдать страницу входа вместо ответа (200 или 511).
+	return u.String(), nil
+}
+
+func (c ConnectivityChecker) networkReachable(ctx context.Context) bool {
+	addr := c.NetworkAddr
+	if addr == "" {
+		addr = DefaultNetworkProbeAddr
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// probeServers возвращает nil, если доступен хотя бы один транспорт,
+// иначе — последнюю ошибку.
+func (c ConnectivityChecker) probeServers(ctx context.Context, profiles []Profile) error {
+	prober := c.Server
+	if prober == nil {
+		prober = HandshakeProber{}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var unique []Profile
+	seen := make(map[string]bool)
+	for _, p := range profiles {
+		if key := TransportKey(p); !seen[key] {
+			seen[key] = true
+			unique = append(unique, p)
+		}
+	}
+
+	errs := make(chan error, len(unique))
+	var wg sync.WaitGroup
+	for _, p := range unique {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- prober.Probe(ctx, p)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
+
+	lastErr := ErrAllTransportsFailed
+	for err := range errs {
+		if err == nil {
+			cancel()
+			return nil
+		}
+		if !errors.Is(err, context.Canceled) {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (c ConnectivityChecker) resolver() *net.Resolver {
+	if c.Resolver != nil {
+		return c.Resolver
+	}
+	return net.DefaultResolver
+}
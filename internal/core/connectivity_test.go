@@ -0,0 +1,213 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDNSStandIn отвечает 127.0.0.1 на любой запрос A.
+func newDNSStandIn(t *testing.T) *net.Resolver {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+				continue
+			}
+			msg.Header.Response = true
+			q := msg.Questions[0]
+			if q.Type == dnsmessage.TypeA {
+				msg.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			}
+			out, err := msg.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = pc.WriteTo(out, from)
+		}
+	}()
+	return resolverAt(pc.LocalAddr().String())
+}
+
+// resolverAt отправляет все DNS‑запросы на addr.
+func resolverAt(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", addr)
+		},
+	}
+}
+
+// closedAddr — адрес, на котором никто не слушает.
+func closedAddr(t *testing.T, network string) string {
+	t.Helper()
+	if network == "udp" {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		addr := pc.LocalAddr().String()
+		_ = pc.Close()
+		return addr
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+// newProbeStandIn отвечает на проверку captive portal обработчиком h и
+// возвращает адрес проверки с именем хоста, чтобы задействовать DNS.
+func newProbeStandIn(t *testing.T, h http.HandlerFunc) string {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	return "http://probe.test:" + strconv.Itoa(port) + "/generate_204"
+}
+
+func noContent(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestConnectivity_OK(t *testing.T) {
+	checker := ConnectivityChecker{
+		ProbeURL: newProbeStandIn(t, noContent),
+		Resolver: newDNSStandIn(t),
+	}
+	report := checker.Check(context.Background(), nil)
+	if report.Status != ConnectivityOK {
+		t.Fatalf("status = %s (%v), want ok", report.Status, report.Err)
+	}
+	if report.BlocksConnect() {
+		t.Fatal("ok report blocks connect")
+	}
+}
+
+func TestConnectivity_CaptivePortalRedirect(t *testing.T) {
+	checker := ConnectivityChecker{
+		ProbeURL: newProbeStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://portal.test/login?next=1", http.StatusFound)
+		}),
+		Resolver: newDNSStandIn(t),
+	}
+	report := checker.Check(context.Background(), nil)
+	if report.Status != ConnectivityCaptivePortal {
+		t.Fatalf("status = %s (%v), want captive_portal", report.Status, report.Err)
+	}
+	if report.PortalURL != "http://portal.test/login?next=1" {
+		t.Fatalf("portal = %q", report.PortalURL)
+	}
+	if !report.BlocksConnect() {
+		t.Fatal("captive portal must block connect")
+	}
+}
+
+func TestConnectivity_CaptivePortalPage(t *testing.T) {
+	probeURL := newProbeStandIn(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<html>Sign in to hotel Wi-Fi</html>"))
+	})
+	checker := ConnectivityChecker{ProbeURL: probeURL, Resolver: newDNSStandIn(t)}
+	report := checker.Check(context.Background(), nil)
+	if report.Status != ConnectivityCaptivePortal || report.PortalURL != probeURL {
+		t.Fatalf("report = %+v, want captive portal at probe URL", report)
+	}
+}
+
+func TestConnectivity_DNSBroken(t *testing.T) {
+	network := newBlackholeStandIn(t)
+	defer network.close()
+	checker := ConnectivityChecker{
+		ProbeURL:    newProbeStandIn(t, noContent),
+		Resolver:    resolverAt(closedAddr(t, "udp")),
+		NetworkAddr: network.addr.String(),
+	}
+	report := checker.Check(context.Background(), nil)
+	if report.Status != ConnectivityDNSBroken {
+		t.Fatalf("status = %s (%v), want dns_broken", report.Status, report.Err)
+	}
+	if report.BlocksConnect() {
+		t.Fatal("broken DNS must not block connect")
+	}
+}
+
+func TestConnectivity_NoNetwork(t *testing.T) {
+	checker := ConnectivityChecker{
+		ProbeURL:    newProbeStandIn(t, noContent),
+		Resolver:    resolverAt(closedAddr(t, "udp")),
+		NetworkAddr: closedAddr(t, "tcp"),
+	}
+	report := checker.Check(context.Background(), nil)
+	if report.Status != ConnectivityNoNetwork {
+		t.Fatalf("status = %s (%v), want no_network", report.Status, report.Err)
+	}
+}
+
+func TestConnectivity_ServerUnreachable(t *testing.T) {
+	reset := newResetStandIn(t)
+	defer reset.close()
+	checker := ConnectivityChecker{
+		ProbeURL: newProbeStandIn(t, noContent),
+		Resolver: newDNSStandIn(t),
+	}
+	report := checker.Check(context.Background(), []Profile{realityAt(t, reset.addr)})
+	if report.Status != ConnectivityServerUnreachable {
+		t.Fatalf("status = %s (%v), want server_unreachable", report.Status, report.Err)
+	}
+	if report.Err == nil {
+		t.Fatal("server_unreachable without error")
+	}
+}
+
+func TestConnectivity_ServerReachableByAnyTransport(t *testing.T) {
+	reset := newResetStandIn(t)
+	defer reset.close()
+	good, pool := newTLSStandIn(t)
+	defer good.close()
+	checker := ConnectivityChecker{
+		ProbeURL: newProbeStandIn(t, noContent),
+		Resolver: newDNSStandIn(t),
+		Server:   HandshakeProber{RootCAs: pool},
+	}
+	profiles := []Profile{realityAt(t, reset.addr), realityAt(t, good.addr)}
+	if report := checker.Check(context.Background(), profiles); report.Status != ConnectivityOK {
+		t.Fatalf("status = %s (%v), want ok", report.Status, report.Err)
+	}
+}
+
+func TestConnectivity_CancelledIsUnknown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checker := ConnectivityChecker{
+		ProbeURL: newProbeStandIn(t, noContent),
+		Resolver: newDNSStandIn(t),
+	}
+	report := checker.Check(ctx, nil)
+	if report.Status != ConnectivityUnknown || report.BlocksConnect() {
+		t.Fatalf("report = %+v, want unknown", report)
+	}
+}
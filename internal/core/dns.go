@@ -0,0 +1,99 @@
+package core
+
+import (
+	"net/netip"
+
+	"github.com/voltavpn/volta-client/internal/dnsstub"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// NewDNSStub создаёт локальную DNS‑заглушку, которая пересылает запросы
+// резолверам из настроек DNS (по умолчанию — встроенному DoH) через
+// туннель conn. В строгом режиме без туннеля запросы отклоняются, иначе
+// уходят к тем же резолверам напрямую. Если IPv6 заблокирован, на запросы
+// AAAA заглушка отвечает сама, пустым ответом.
+func NewDNSStub(conn *Connection, privacy settings.PrivacySettings, dns settings.DNSSettings) (*dnsstub.Server, error) {
+	cfg, err := dnsStubConfig(conn, privacy, dns)
+	if err != nil {
+		return nil, err
+	}
+	return dnsstub.NewServer(cfg), nil
+}
+
+func dnsStubConfig(conn *Connection, privacy settings.PrivacySettings, dns settings.DNSSettings) (dnsstub.Config, error) {
+	if err := settings.ValidateDNS(dns); err != nil {
+		return dnsstub.Config{}, err
+	}
+	dial := dnsstub.SOCKSDialer(func() (dnsstub.SOCKSEndpoint, bool) {
+		proxies, ok := LocalProxies(conn.Options())
+		if !ok {
+			return dnsstub.SOCKSEndpoint{}, false
+		}
+		endpoint := dnsstub.SOCKSEndpoint{Address: proxies.SOCKS}
+		if proxies.Auth != nil {
+			endpoint.Username = proxies.Auth.Username
+			endpoint.Password = proxies.Auth.Password
+		}
+		return endpoint, true
+	})
+	cfg, err := dnsstub.TunnelConfig(dial, privacy.StrictDNS, func() bool {
+		return conn.State() == StateConnected
+	})
+	if err != nil {
+		return dnsstub.Config{}, err
+	}
+	if len(dns.Servers) > 0 {
+		if cfg.Upstreams, cfg.Fallback, err = dnsUpstreams(dns.Servers, dial); err != nil {
+			return dnsstub.Config{}, err
+		}
+	}
+	for _, rule := range dns.Domains {
+		viaTunnel, direct, err := dnsUpstreams(rule.Servers, dial)
+		if err != nil {
+			return dnsstub.Config{}, err
+		}
+		cfg.Domains = append(cfg.Domains, dnsstub.DomainUpstreams{Domain: rule.Domain, Upstreams: viaTunnel, Fallback: direct})
+	}
+	if len(dns.Hosts) > 0 {
+		cfg.Hosts = make(map[string][]netip.Addr, len(dns.Hosts))
+		for _, host := range dns.Hosts {
+			for _, addr := range host.Addresses {
+				cfg.Hosts[host.Name] = append(cfg.Hosts[host.Name], netip.MustParseAddr(addr).Unmap())
+			}
+		}
+	}
+	cfg.FilterAAAA = privacy.IPv6 == settings.IPv6Block
+	return cfg, nil
+}
+
+// dnsUpstreams создаёт апстримы для серверов из настроек: через туннель и
+// напрямую, для работы до подключения.
+func dnsUpstreams(servers []string, tunnel dnsstub.DialFunc) (viaTunnel, direct []dnsstub.Upstream, err error) {
+	for _, raw := range servers {
+		server, err := settings.ParseDNSServer(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		t, err := dnsUpstream(server, tunnel)
+		if err != nil {
+			return nil, nil, err
+		}
+		d, err := dnsUpstream(server, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		viaTunnel, direct = append(viaTunnel, t), append(direct, d)
+	}
+	return viaTunnel, direct, nil
+}
+
+func dnsUpstream(server settings.DNSServer, dial dnsstub.DialFunc) (dnsstub.Upstream, error) {
+	switch server.Protocol {
+	case settings.DNSHTTPS:
+		return dnsstub.NewDoH(server.URL, dial, nil)
+	case settings.DNSTLS:
+		return dnsstub.NewDoT(server.Address(), server.Host, dial, nil)
+	default:
+		return dnsstub.NewPlain(server.Address(), dial)
+	}
+}
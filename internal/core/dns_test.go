@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/dnsstub"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+func TestNewDNSStub_UsesDNSSettings(t *testing.T) {
+	conn := NewConnection(NewFakeEngine())
+	privacy := settings.Default().Privacy
+	privacy.IPv6 = settings.IPv6Tunnel
+	dns := settings.DNSSettings{
+		Servers: []string{"tls://dns.example"},
+		Domains: []settings.DNSDomainRule{{Domain: "corp.example", Servers: []string{"10.0.0.53"}}},
+		Hosts:   []settings.DNSHost{{Name: "git.corp.example", Addresses: []string{"10.0.0.7", "fd00::7"}}},
+	}
+	cfg, err := dnsStubConfig(conn, privacy, dns)
+	if err != nil {
+		t.Fatalf("dnsStubConfig: %v", err)
+	}
+	if len(cfg.Upstreams) != 1 || cfg.Upstreams[0].String() != "tls://dns.example:853" || len(cfg.Fallback) != 1 {
+		t.Fatalf("upstreams = %v, fallback = %v", cfg.Upstreams, cfg.Fallback)
+	}
+	if len(cfg.Domains) != 1 || cfg.Domains[0].Domain != "corp.example" || cfg.Domains[0].Upstreams[0].String() != "tcp://10.0.0.53:53" {
+		t.Fatalf("domains = %+v", cfg.Domains)
+	}
+	cfg.Addr = "127.0.0.1:0"
+	stub := dnsstub.NewServer(cfg)
+	if err := stub.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer stub.Close()
+
+	resolver := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, stub.Addr())
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, "git.corp.example")
+	slices.Sort(addrs)
+	if err != nil || !slices.Equal(addrs, []string{"10.0.0.7", "fd00::7"}) {
+		t.Fatalf("static host = %v, %v", addrs, err)
+	}
+
+	dns.Domains[0].Servers = []string{"https://10.0.0.53:0/dns-query"}
+	if _, err := NewDNSStub(conn, privacy, dns); err == nil {
+		t.Fatal("malformed domain server accepted")
+	}
+}
@@ -1,5 +1,4 @@
-// Package core will contain the core business logic for VoltaVPN.
-// It is intentionally empty at this stage and should not contain
-// any direct GUI or OS-specific code.
+// Package core contains the core business logic for VoltaVPN: access
+// activation and the connection state machine shared by the GUI, tray and CLI.
+// It should not contain any direct GUI or OS-specific code.
 package core
-
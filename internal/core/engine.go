@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// EngineOptions — параметры запуска движка, не входящие в профиль сервера.
+type EngineOptions struct {
+	Settings settings.Settings
+	// Inbound — способ подачи трафика в ядро; пустое значение означает InboundProxy.
+	Inbound InboundKind
+	// ProxyAuth — учётные данные локальных прокси; nil — без аутентификации.
+	ProxyAuth *ProxyCredentials
+}
+
+// TunnelStats — снимок счётчиков движка.
+type TunnelStats struct {
+	BytesUp   uint64
+	BytesDown uint64
+	// StartedAt — момент успешного запуска; нулевой, если движок остановлен.
+	StartedAt time.Time
+}
+
+// EngineEventKind — тип события движка.
+type EngineEventKind int
+
+const (
+	EngineEventStarted EngineEventKind = iota
+	EngineEventStopped
+	// EngineEventFailed — туннель перестал работать без вызова Stop.
+	EngineEventFailed
+)
+
+func (k EngineEventKind) String() string {
+	switch k {
+	case EngineEventStarted:
+		return "started"
+	case EngineEventStopped:
+		return "stopped"
+	case EngineEventFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// EngineEvent — асинхронное уведомление движка.
+type EngineEvent struct {
+	Kind EngineEventKind
+	Err  error
+	At   time.Time
+}
+
+// TunnelEngine поднимает и останавливает туннель.
+// Start должен уважать отмену ctx, а Stop — быть идемпотентным и
+// прерывать в том числе ещё не завершённый Start.
+// Events возвращает один и тот же канал на всё время жизни движка;
+// движок не блокируется, если события никто не читает.
+type TunnelEngine interface {
+	Start(ctx context.Context, profile Profile, opts EngineOptions) error
+	Stop(ctx context.Context) error
+	Stats() TunnelStats
+	Events() <-chan EngineEvent
+}
+
+const engineEventBuffer = 16
+
+// sendEngineEvent отправляет событие без блокировки; при переполнении
+// буфера событие теряется.
+func sendEngineEvent(ch chan EngineEvent, kind EngineEventKind, err error) {
+	select {
+	case ch <- EngineEvent{Kind: kind, Err: err, At: time.Now()}:
+	default:
+	}
+}
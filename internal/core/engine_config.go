@@ -0,0 +1,608 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/voltavpn/volta-client/internal/routing"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+var ErrProfileModeMismatch = errors.New("profile is not allowed in the selected connection mode")
+
+// InboundKind — способ, которым трафик попадает во встроенное ядро.
+type InboundKind string
+
+const (
+	// InboundProxy — локальные SOCKS5/HTTP‑прокси на loopback.
+	InboundProxy InboundKind = "proxy"
+	// InboundTUN — виртуальный сетевой интерфейс для всего устройства:
+	// пользовательский сетевой стек клиента принимает потоки с интерфейса и
+	// передаёт их ядру через внутренний SOCKS5‑вход (см. TUNEngine).
+	InboundTUN InboundKind = "tun"
+)
+
+const (
+	localProxyListen = "127.0.0.1"
+	localSOCKSPort   = 10808
+	localHTTPPort    = 10809
+	// localTUNSOCKSPort — вход ядра только для потоков из TUN.
+	localTUNSOCKSPort = 10807
+
+	tunInterfaceName = "volta0"
+	tunMTU           = 1500
+	// tunBypassMark — метка пакетов приложений из Routing.BypassApps.
+	tunBypassMark = 0x7575
+
+	// Резолвер внутри туннеля; запросы к нему маршрутизируются через proxy.
+	tunnelDNSServer = "https://1.1.1.1/dns-query"
+
+	redactedValue = "<redacted>"
+)
+
+const (
+	outboundProxy  = "proxy"
+	outboundDirect = "direct"
+	outboundBlock  = "block"
+	outboundDNS    = "dns-out"
+	// outboundHopPrefix — префикс тегов серверов цепочки перед выходом:
+	// hop-1 — вход.
+	outboundHopPrefix = "hop-"
+)
+
+// Структуры ниже повторяют подмножество формата конфигурации xray.
+// Порядок полей фиксирован, поэтому вывод детерминирован.
+type engineConfig struct {
+	Log       logConfig        `json:"log"`
+	DNS       dnsConfig        `json:"dns"`
+	Inbounds  []inboundConfig  `json:"inbounds"`
+	Outbounds []outboundConfig `json:"outbounds"`
+	Routing   routingConfig    `json:"routing"`
+}
+
+type logConfig struct {
+	Access   string `json:"access"`
+	LogLevel string `json:"loglevel"`
+}
+
+type dnsConfig struct {
+	Hosts map[string][]string `json:"hosts,omitempty"`
+	// Servers — адреса строкой или dnsServerConfig.
+	Servers         []any  `json:"servers"`
+	QueryStrategy   string `json:"queryStrategy"`
+	DisableFallback bool   `json:"disableFallback"`
+}
+
+type dnsServerConfig struct {
+	Address      string   `json:"address"`
+	Port         int      `json:"port,omitempty"`
+	Domains      []string `json:"domains,omitempty"`
+	SkipFallback bool     `json:"skipFallback,omitempty"`
+}
+
+type inboundConfig struct {
+	Tag      string          `json:"tag"`
+	Protocol string          `json:"protocol"`
+	Listen   string          `json:"listen,omitempty"`
+	Port     int             `json:"port,omitempty"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+	Sniffing *sniffingConfig `json:"sniffing,omitempty"`
+}
+
+type sniffingConfig struct {
+	Enabled      bool     `json:"enabled"`
+	DestOverride []string `json:"destOverride"`
+}
+
+type outboundConfig struct {
+	Tag            string          `json:"tag"`
+	Protocol       string          `json:"protocol"`
+	Settings       *vlessSettings  `json:"settings,omitempty"`
+	StreamSettings *streamSettings `json:"streamSettings,omitempty"`
+}
+
+type vlessSettings struct {
+	Vnext []vlessServer `json:"vnext"`
+}
+
+type vlessServer struct {
+	Address string      `json:"address"`
+	Port    int         `json:"port"`
+	Users   []vlessUser `json:"users"`
+}
+
+type vlessUser struct {
+	ID         string `json:"id"`
+	Encryption string `json:"encryption"`
+	Flow       string `json:"flow,omitempty"`
+}
+
+type streamSettings struct {
+	Network         string           `json:"network"`
+	Security        string           `json:"security"`
+	RealitySettings *realitySettings `json:"realitySettings,omitempty"`
+	TLSSettings     *tlsSettings     `json:"tlsSettings,omitempty"`
+	GRPCSettings    *grpcSettings    `json:"grpcSettings,omitempty"`
+	WSSettings      *wsSettings      `json:"wsSettings,omitempty"`
+	Sockopt         *sockoptConfig   `json:"sockopt,omitempty"`
+}
+
+// sockoptConfig.DialerProxy — тег исходящего, через который подключается
+// этот исходящий; так строится цепочка серверов.
+type sockoptConfig struct {
+	DialerProxy string `json:"dialerProxy"`
+}
+
+type realitySettings struct {
+	ServerName  string `json:"serverName"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	ShortID     string `json:"shortId"`
+	SpiderX     string `json:"spiderX,omitempty"`
+}
+
+type tlsSettings struct {
+	ServerName  string `json:"serverName,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type grpcSettings struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type wsSettings struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type routingConfig struct {
+	DomainStrategy string        `json:"domainStrategy"`
+	Rules          []routingRule `json:"rules"`
+}
+
+type routingRule struct {
+	Type        string   `json:"type"`
+	InboundTag  []string `json:"inboundTag,omitempty"`
+	Port        string   `json:"port,omitempty"`
+	Network     string   `json:"network,omitempty"`
+	Domain      []string `json:"domain,omitempty"`
+	IP          []string `json:"ip,omitempty"`
+	OutboundTag string   `json:"outboundTag"`
+}
+
+// BuildEngineConfig собирает полную JSON‑конфигурацию встроенного ядра
+// (формат xray): входы, исходящий прокси, маршрутизацию и DNS.
+// Режим подключения определяет, какие профили допустимы: VLESSRealityOnly
+// принимает только Reality, Auto — также резервные транспорты поверх TLS.
+// Вывод детерминирован, чтобы конфигурации можно было сравнивать.
+func BuildEngineConfig(profile Profile, opts EngineOptions) ([]byte, error) {
+	cfg, err := buildEngineConfig(profile, opts)
+	if err != nil {
+		return nil, err
+	}
+	return marshalEngineConfig(cfg)
+}
+
+// RedactedEngineConfig возвращает ту же конфигурацию, что BuildEngineConfig,
+// но без UUID, ключей и паролей — её можно прикладывать к отчётам об ошибках.
+func RedactedEngineConfig(profile Profile, opts EngineOptions) ([]byte, error) {
+	if opts.ProxyAuth != nil {
+		opts.ProxyAuth = &ProxyCredentials{Username: opts.ProxyAuth.Username, Password: redactedValue}
+	}
+	cfg, err := buildEngineConfig(profile, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cfg.Outbounds {
+		redactOutbound(&cfg.Outbounds[i])
+	}
+	return marshalEngineConfig(cfg)
+}
+
+func buildEngineConfig(profile Profile, opts EngineOptions) (engineConfig, error) {
+	if err := profile.Validate(); err != nil {
+		return engineConfig{}, err
+	}
+
+	switch opts.Settings.Connection.Mode {
+	case settings.ConnectionModeVLESSRealityOnly:
+		if !profile.IsReality() {
+			return engineConfig{}, ErrProfileModeMismatch
+		}
+	case settings.ConnectionModeProxyOnly:
+		if opts.Inbound == InboundTUN {
+			return engineConfig{}, errors.New("proxy-only mode does not use a TUN interface")
+		}
+	case settings.ConnectionModeAuto:
+	default:
+		return engineConfig{}, errors.New("invalid connection mode")
+	}
+	if fp := opts.Settings.Connection.Fingerprint; !isValidFingerprint(fp) {
+		return engineConfig{}, errInvalidFingerprint
+	} else if fp != "" {
+		profile = profile.withFingerprint(string(fp))
+	}
+
+	routing := opts.Settings.Routing
+	if routing.Final == "" {
+		routing.Final = settings.RuleActionProxy
+	}
+	if err := settings.ValidateRouting(routing); err != nil {
+		return engineConfig{}, err
+	}
+
+	if err := settings.ValidateDNS(opts.Settings.DNS); err != nil {
+		return engineConfig{}, err
+	}
+
+	inbounds, err := buildInbounds(opts.Inbound, opts.ProxyAuth)
+	if err != nil {
+		return engineConfig{}, err
+	}
+
+	return engineConfig{
+		Log:      logConfig{Access: "none", LogLevel: "warning"},
+		DNS:      buildDNS(opts.Settings.DNS, opts.Settings.Privacy.IPv6),
+		Inbounds: inbounds,
+		Outbounds: append(buildChainOutbounds(profile),
+			outboundConfig{Tag: outboundDirect, Protocol: "freedom"},
+			outboundConfig{Tag: outboundBlock, Protocol: "blackhole"},
+			outboundConfig{Tag: outboundDNS, Protocol: "dns"},
+		),
+		Routing: buildRouting(profile, opts.Inbound, routing),
+	}, nil
+}
+
+func marshalEngineConfig(cfg engineConfig) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func buildInbounds(kind InboundKind, auth *ProxyCredentials) ([]inboundConfig, error) {
+	sniffing := &sniffingConfig{Enabled: true, DestOverride: []string{"http", "tls", "quic"}}
+
+	switch kind {
+	case InboundProxy, "":
+		socksSettings := json.RawMessage(`{"auth":"noauth","udp":true}`)
+		var httpSettings json.RawMessage
+		if auth != nil {
+			var err error
+			if socksSettings, httpSettings, err = proxyAuthSettings(*auth); err != nil {
+				return nil, err
+			}
+		}
+		return []inboundConfig{
+			{
+				Tag:      "socks-in",
+				Protocol: "socks",
+				Listen:   localProxyListen,
+				Port:     localSOCKSPort,
+				Settings: socksSettings,
+				Sniffing: sniffing,
+			},
+			{
+				Tag:      "http-in",
+				Protocol: "http",
+				Listen:   localProxyListen,
+				Port:     localHTTPPort,
+				Settings: httpSettings,
+				Sniffing: sniffing,
+			},
+		}, nil
+	case InboundTUN:
+		socksSettings := json.RawMessage(`{"auth":"noauth","udp":true}`)
+		if auth != nil {
+			var err error
+			if socksSettings, _, err = proxyAuthSettings(*auth); err != nil {
+				return nil, err
+			}
+		}
+		return []inboundConfig{
+			{
+				Tag:      "tun-in",
+				Protocol: "socks",
+				Listen:   localProxyListen,
+				Port:     localTUNSOCKSPort,
+				Settings: socksSettings,
+				Sniffing: sniffing,
+			},
+		}, nil
+	default:
+		return nil, errors.New("unsupported inbound kind")
+	}
+}
+
+type proxyAccount struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+}
+
+// proxyAuthSettings — настройки SOCKS5 (с UDP ASSOCIATE) и HTTP‑входов,
+// принимающих только указанные логин и пароль.
+func proxyAuthSettings(auth ProxyCredentials) (socks, http json.RawMessage, err error) {
+	accounts := []proxyAccount{{User: auth.Username, Pass: auth.Password}}
+	socks, err = json.Marshal(struct {
+		Auth     string         `json:"auth"`
+		Accounts []proxyAccount `json:"accounts"`
+		UDP      bool           `json:"udp"`
+	}{Auth: "password", Accounts: accounts, UDP: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	http, err = json.Marshal(struct {
+		Accounts         []proxyAccount `json:"accounts"`
+		AllowTransparent bool           `json:"allowTransparent"`
+	}{Accounts: accounts})
+	return socks, http, err
+}
+
+// buildChainOutbounds строит исходящие для серверов профиля. Выход
+// получает тег proxy и идёт первым, остальные серверы — теги hop-1…
+// от входа. Каждый сервер после входа подключается через предыдущий
+// (dialerProxy), так что напрямую ядро соединяется только со входом.
+func buildChainOutbounds(p Profile) []outboundConfig {
+	hops := p.Hops()
+	exit := len(hops) - 1
+	out := make([]outboundConfig, 0, len(hops))
+	var prev string
+	for i, hop := range hops {
+		tag := outboundProxy
+		if i < exit {
+			tag = outboundHopPrefix + strconv.Itoa(i+1)
+		}
+		o := buildVLESSOutbound(tag, hop)
+		if prev != "" {
+			o.StreamSettings.Sockopt = &sockoptConfig{DialerProxy: prev}
+		}
+		out = append(out, o)
+		prev = tag
+	}
+	return append([]outboundConfig{out[exit]}, out[:exit]...)
+}
+
+func buildVLESSOutbound(tag string, p Profile) outboundConfig {
+	stream := &streamSettings{
+		Network:  p.Network,
+		Security: p.Security,
+	}
+	switch p.Security {
+	case SecurityReality:
+		stream.RealitySettings = &realitySettings{
+			ServerName:  p.ServerName,
+			Fingerprint: fingerprintOrDefault(p.Fingerprint),
+			PublicKey:   p.PublicKey,
+			ShortID:     p.ShortID,
+			SpiderX:     p.SpiderX,
+		}
+	case SecurityTLS:
+		stream.TLSSettings = &tlsSettings{
+			ServerName:  p.ServerName,
+			Fingerprint: fingerprintOrDefault(p.Fingerprint),
+		}
+	}
+	switch p.Network {
+	case NetworkGRPC:
+		stream.GRPCSettings = &grpcSettings{ServiceName: p.ServiceName}
+	case NetworkWS:
+		ws := &wsSettings{Path: p.Path}
+		if p.Host != "" {
+			ws.Headers = map[string]string{"Host": p.Host}
+		}
+		stream.WSSettings = ws
+	}
+
+	return outboundConfig{
+		Tag:      tag,
+		Protocol: "vless",
+		Settings: &vlessSettings{
+			Vnext: []vlessServer{{
+				Address: p.Address,
+				Port:    p.Port,
+				Users: []vlessUser{{
+					ID:         p.UUID,
+					Encryption: "none",
+					Flow:       p.Flow,
+				}},
+			}},
+		},
+		StreamSettings: stream,
+	}
+}
+
+// buildDNS переводит настройки DNS в конфигурацию ядра. DoT ядро не
+// поддерживает: такие серверы обслуживает только DNS‑заглушка, а если
+// других не задано, ядро использует встроенный DoH. Общие серверы идут
+// первыми: при disableFallback запрос без совпадения домена уходит первому
+// серверу списка. Серверы доменов не получают остальных запросов
+// (skipFallback). Записи AAAA ядро запрашивает, только если IPv6 не
+// заблокирован политикой ipv6.
+func buildDNS(d settings.DNSSettings, ipv6 settings.IPv6Policy) dnsConfig {
+	cfg := dnsConfig{QueryStrategy: "UseIP", DisableFallback: true}
+	if ipv6 == settings.IPv6Block {
+		cfg.QueryStrategy = "UseIPv4"
+	}
+	for _, raw := range d.Servers {
+		server, ok := engineDNSServer(raw)
+		switch {
+		case !ok:
+		case server.Port == 0:
+			cfg.Servers = append(cfg.Servers, server.Address)
+		default:
+			cfg.Servers = append(cfg.Servers, server)
+		}
+	}
+	if len(cfg.Servers) == 0 {
+		cfg.Servers = []any{tunnelDNSServer}
+	}
+	for _, rule := range d.Domains {
+		for _, raw := range rule.Servers {
+			if server, ok := engineDNSServer(raw); ok {
+				server.Domains = []string{"domain:" + rule.Domain}
+				server.SkipFallback = true
+				cfg.Servers = append(cfg.Servers, server)
+			}
+		}
+	}
+	if len(d.Hosts) > 0 {
+		cfg.Hosts = make(map[string][]string, len(d.Hosts))
+		for _, host := range d.Hosts {
+			cfg.Hosts[host.Name] = host.Addresses
+		}
+	}
+	return cfg
+}
+
+// engineDNSServer — сервер в формате ядра; порт указывается, только если
+// он не стандартный. ok == false для DoT.
+func engineDNSServer(raw string) (server dnsServerConfig, ok bool) {
+	parsed, err := settings.ParseDNSServer(raw)
+	if err != nil {
+		return dnsServerConfig{}, false
+	}
+	switch parsed.Protocol {
+	case settings.DNSHTTPS:
+		return dnsServerConfig{Address: parsed.URL}, true
+	case settings.DNSPlain:
+		server = dnsServerConfig{Address: parsed.Host}
+		if parsed.Port != 53 {
+			server.Port = int(parsed.Port)
+		}
+		return server, true
+	default:
+		return dnsServerConfig{}, false
+	}
+}
+
+func buildRouting(p Profile, kind InboundKind, user settings.RoutingSettings) routingConfig {
+	var rules []routingRule
+
+	if kind == InboundTUN {
+		// В режиме TUN перехватываем системный DNS и отдаём встроенному резолверу.
+		rules = append(rules, routingRule{
+			Type:        "field",
+			InboundTag:  []string{"tun-in"},
+			Port:        "53",
+			OutboundTag: outboundDNS,
+		})
+	}
+
+	// Трафик до самого VPN‑сервера не должен заворачиваться в туннель. У
+	// цепочки это вход: остальные серверы достижимы только через него.
+	serverRule := routingRule{Type: "field", OutboundTag: outboundDirect}
+	if ip := net.ParseIP(p.Address); ip != nil {
+		serverRule.IP = []string{ip.String()}
+	} else {
+		serverRule.Domain = []string{"full:" + strings.ToLower(p.Address)}
+	}
+	rules = append(rules, serverRule)
+	rules = append(rules, buildUserRules(user.Rules)...)
+	rules = append(rules,
+		routingRule{Type: "field", IP: geoIPs("private"), OutboundTag: outboundDirect},
+		routingRule{Type: "field", Network: "tcp,udp", OutboundTag: ruleOutbound(user.Final)},
+	)
+
+	return routingConfig{
+		DomainStrategy: "IPIfNonMatch",
+		Rules:          rules,
+	}
+}
+
+// buildUserRules переводит пользовательские правила в правила ядра.
+// Соседние правила одного типа (домен или IP) с одинаковым действием
+// объединяются: порядок срабатывания от этого не меняется.
+func buildUserRules(user []settings.RoutingRule) []routingRule {
+	var rules []routingRule
+	for _, r := range user {
+		var domain string
+		var ips []string
+		switch r.Kind {
+		case settings.RuleDomainSuffix:
+			domain = "domain:" + strings.TrimPrefix(strings.ToLower(r.Value), ".")
+		case settings.RuleDomainKeyword:
+			domain = "keyword:" + strings.ToLower(r.Value)
+		case settings.RuleDomainRegex:
+			domain = "regexp:" + r.Value
+		case settings.RuleGeoSite:
+			domain = "geosite:" + r.Value
+		case settings.RuleCIDR:
+			ips = []string{r.Value}
+		case settings.RuleGeoIP:
+			ips = geoIPs(r.Value)
+		default:
+			continue
+		}
+
+		outbound := ruleOutbound(r.Action)
+		if n := len(rules); n > 0 && rules[n-1].OutboundTag == outbound &&
+			(domain != "") == (len(rules[n-1].Domain) > 0) {
+			if domain != "" {
+				rules[n-1].Domain = append(rules[n-1].Domain, domain)
+			} else {
+				rules[n-1].IP = append(rules[n-1].IP, ips...)
+			}
+			continue
+		}
+		rule := routingRule{Type: "field", OutboundTag: outbound}
+		if domain != "" {
+			rule.Domain = []string{domain}
+		} else {
+			rule.IP = ips
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// geoIPs возвращает адреса набора GeoIP для правила ядра. Во встроенное
+// ядро базы GeoIP не входят, поэтому набор private, нужный всегда,
+// передаётся подсетями; для стран ядру нужен файл geoip.dat.
+func geoIPs(code string) []string {
+	if code != "private" {
+		return []string{"geoip:" + code}
+	}
+	prefixes := routing.PrivatePrefixes()
+	out := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.String()
+	}
+	return out
+}
+
+// ruleOutbound сопоставляет действие правила исходящему ядра.
+func ruleOutbound(action settings.RuleAction) string {
+	switch action {
+	case settings.RuleActionDirect:
+		return outboundDirect
+	case settings.RuleActionBlock:
+		return outboundBlock
+	default:
+		return outboundProxy
+	}
+}
+
+func redactOutbound(o *outboundConfig) {
+	if o.Settings != nil {
+		for i := range o.Settings.Vnext {
+			for j := range o.Settings.Vnext[i].Users {
+				o.Settings.Vnext[i].Users[j].ID = redactedValue
+			}
+		}
+	}
+	if o.StreamSettings != nil && o.StreamSettings.RealitySettings != nil {
+		o.StreamSettings.RealitySettings.PublicKey = redactedValue
+		o.StreamSettings.RealitySettings.ShortID = redactedValue
+	}
+}
+
+func fingerprintOrDefault(fp string) string {
+	if fp == "" {
+		return "chrome"
+	}
+	return fp
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s mismatch (run with -update to regenerate):\n%s", name, got)
+	}
+}
+
+func TestBuildEngineConfig_Golden(t *testing.T) {
+	reality := testProfile(t)
+	ws, err := ParseProfile(testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+
+	cases := []struct {
+		golden  string
+		profile Profile
+		mode    settings.ConnectionMode
+		inbound InboundKind
+	}{
+		{"config_auto_reality.golden.json", reality, settings.ConnectionModeAuto, InboundProxy},
+		{"config_auto_ws.golden.json", ws, settings.ConnectionModeAuto, InboundProxy},
+		{"config_reality_only.golden.json", reality, settings.ConnectionModeVLESSRealityOnly, InboundProxy},
+		{"config_reality_only_tun.golden.json", reality, settings.ConnectionModeVLESSRealityOnly, InboundTUN},
+	}
+	for _, tc := range cases {
+		t.Run(tc.golden, func(t *testing.T) {
+			opts := testOptions()
+			opts.Settings.Connection.Mode = tc.mode
+			opts.Inbound = tc.inbound
+
+			got, err := BuildEngineConfig(tc.profile, opts)
+			if err != nil {
+				t.Fatalf("BuildEngineConfig: %v", err)
+			}
+			again, _ := BuildEngineConfig(tc.profile, opts)
+			if !bytes.Equal(got, again) {
+				t.Fatal("output is not deterministic")
+			}
+			checkGolden(t, tc.golden, got)
+		})
+	}
+}
+
+func TestBuildEngineConfig_TranslatesRoutingRules(t *testing.T) {
+	opts := testOptions()
+	opts.Settings.Routing = settings.RoutingSettings{
+		Rules: []settings.RoutingRule{
+			{Kind: settings.RuleDomainSuffix, Value: "corp.example", Action: settings.RuleActionDirect},
+			{Kind: settings.RuleDomainKeyword, Value: "intranet", Action: settings.RuleActionDirect},
+			{Kind: settings.RuleCIDR, Value: "10.20.0.0/16", Action: settings.RuleActionDirect},
+			{Kind: settings.RuleGeoIP, Value: "private", Action: settings.RuleActionDirect},
+			{Kind: settings.RuleGeoSite, Value: "category-ads", Action: settings.RuleActionBlock},
+			{Kind: settings.RuleDomainRegex, Value: `^git\.`, Action: settings.RuleActionProxy},
+		},
+		Final: settings.RuleActionDirect,
+	}
+
+	got, err := BuildEngineConfig(testProfile(t), opts)
+	if err != nil {
+		t.Fatalf("BuildEngineConfig: %v", err)
+	}
+	checkGolden(t, "config_split_routing.golden.json", got)
+
+	opts.Settings.Routing.Rules[2].Value = "10.20.0.0/99"
+	if _, err := BuildEngineConfig(testProfile(t), opts); err == nil {
+		t.Fatal("expected error for an invalid routing rule")
+	}
+}
+
+func TestBuildEngineConfig_CustomDNS(t *testing.T) {
+	opts := testOptions()
+	opts.Settings.DNS = settings.DNSSettings{
+		Servers: []string{"tls://dns.example", "https://dns.example/dns-query", "9.9.9.9"},
+		Domains: []settings.DNSDomainRule{
+			{Domain: "corp.example", Servers: []string{"10.0.0.53", "10.0.0.54:5353"}},
+			{Domain: "dot.example", Servers: []string{"tls://10.0.0.55"}},
+		},
+		Hosts: []settings.DNSHost{{Name: "git.corp.example", Addresses: []string{"10.0.0.7", "fd00::7"}}},
+	}
+
+	got, err := BuildEngineConfig(testProfile(t), opts)
+	if err != nil {
+		t.Fatalf("BuildEngineConfig: %v", err)
+	}
+	checkGolden(t, "config_custom_dns.golden.json", got)
+
+	// Только DoT: ядро остаётся на встроенном резолвере.
+	opts.Settings.DNS = settings.DNSSettings{Servers: []string{"tls://dns.example"}}
+	if cfg, err := buildEngineConfig(testProfile(t), opts); err != nil || len(cfg.DNS.Servers) != 1 || cfg.DNS.Servers[0] != tunnelDNSServer {
+		t.Fatalf("DoT-only servers = %v, %v", cfg.DNS.Servers, err)
+	}
+
+	for _, server := range []string{"https://dns.example:0/", "tls://dns.example/path", "dns.example", "udp://10.0.0.53"} {
+		opts.Settings.DNS = settings.DNSSettings{Servers: []string{server}}
+		if _, err := BuildEngineConfig(testProfile(t), opts); err == nil {
+			t.Errorf("server %q accepted", server)
+		}
+	}
+	opts.Settings.DNS = settings.DNSSettings{Hosts: []settings.DNSHost{{Name: "git.corp.example", Addresses: []string{"10.0.0.300"}}}}
+	if _, err := BuildEngineConfig(testProfile(t), opts); err == nil {
+		t.Error("malformed host address accepted")
+	}
+}
+
+func TestBuildEngineConfig_DNSQueryStrategyFollowsIPv6Policy(t *testing.T) {
+	cases := map[settings.IPv6Policy]string{
+		settings.IPv6Block:  "UseIPv4",
+		settings.IPv6Tunnel: "UseIP",
+		settings.IPv6Allow:  "UseIP",
+	}
+	for policy, want := range cases {
+		opts := testOptions()
+		opts.Settings.Privacy.IPv6 = policy
+		cfg, err := buildEngineConfig(testProfile(t), opts)
+		if err != nil {
+			t.Fatalf("%s: buildEngineConfig: %v", policy, err)
+		}
+		if cfg.DNS.QueryStrategy != want {
+			t.Errorf("%s: queryStrategy = %q, want %q", policy, cfg.DNS.QueryStrategy, want)
+		}
+	}
+}
+
+func TestBuildEngineConfig_Chain(t *testing.T) {
+	ws, err := ParseProfile(testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	middle := testProfile(t)
+	middle.Address = "198.51.100.20"
+	chain := testProfile(t)
+	chain.Chain = []Profile{middle, ws}
+
+	opts := testOptions()
+	opts.Inbound = InboundTUN
+	opts.Settings.Connection.Fingerprint = settings.FingerprintFirefox
+	got, err := BuildEngineConfig(chain, opts)
+	if err != nil {
+		t.Fatalf("BuildEngineConfig: %v", err)
+	}
+	checkGolden(t, "config_chain.golden.json", got)
+	if chain.Chain[0].Fingerprint != "chrome" {
+		t.Fatalf("fingerprint override changed the caller's chain: %q", chain.Chain[0].Fingerprint)
+	}
+
+	// Reality-only требует Reality на всех серверах цепочки.
+	opts.Inbound = InboundProxy
+	opts.Settings.Connection.Mode = settings.ConnectionModeVLESSRealityOnly
+	if _, err := BuildEngineConfig(chain, opts); !errors.Is(err, ErrProfileModeMismatch) {
+		t.Fatalf("reality-only error = %v, want ErrProfileModeMismatch", err)
+	}
+
+	chain.Chain = []Profile{testProfile(t)}
+	if _, err := BuildEngineConfig(chain, testOptions()); !errors.Is(err, ErrDuplicateHop) {
+		t.Fatalf("duplicate hop error = %v, want ErrDuplicateHop", err)
+	}
+}
+
+func TestBuildEngineConfig_ModeSelectsProfiles(t *testing.T) {
+	ws, err := ParseProfile(testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+
+	opts := testOptions()
+	opts.Settings.Connection.Mode = settings.ConnectionModeVLESSRealityOnly
+	if _, err := BuildEngineConfig(ws, opts); !errors.Is(err, ErrProfileModeMismatch) {
+		t.Fatalf("reality-only error = %v, want ErrProfileModeMismatch", err)
+	}
+
+	opts.Settings.Connection.Mode = "bogus"
+	if _, err := BuildEngineConfig(testProfile(t), opts); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+}
+
+func TestRedactedEngineConfig(t *testing.T) {
+	p := testProfile(t)
+	exit := testProfile(t)
+	exit.Address = "198.51.100.20"
+	exit.UUID = "66666666-7777-8888-9999-000000000000"
+	p.Chain = []Profile{exit}
+	got, err := RedactedEngineConfig(p, testOptions())
+	if err != nil {
+		t.Fatalf("RedactedEngineConfig: %v", err)
+	}
+	for _, secret := range []string{p.UUID, exit.UUID, p.PublicKey, `"` + p.ShortID + `"`} {
+		if strings.Contains(string(got), secret) {
+			t.Fatalf("redacted config contains secret %q", secret)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FakeEngine — детерминированный TunnelEngine для тестов.
+// Результаты Start задаются очередью StartResults; пустая очередь
+// означает успех. Трафик и события задаются явно из теста.
+type FakeEngine struct {
+	events chan EngineEvent
+
+	mu           sync.Mutex
+	startResults []error
+	running      bool
+	stats        TunnelStats
+	starts       []FakeStart
+	stops        int
+	// gate, если задан, удерживает Start до закрытия канала или отмены ctx.
+	gate chan struct{}
+}
+
+// FakeStart — параметры одного вызова Start.
+type FakeStart struct {
+	Profile Profile
+	Options EngineOptions
+}
+
+func NewFakeEngine(startResults ...error) *FakeEngine {
+	return &FakeEngine{
+		events:       make(chan EngineEvent, engineEventBuffer),
+		startResults: startResults,
+	}
+}
+
+// HoldStart заставляет следующие Start ждать; возвращённая функция их отпускает.
+func (e *FakeEngine) HoldStart() (release func()) {
+	gate := make(chan struct{})
+	e.mu.Lock()
+	e.gate = gate
+	e.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			e.mu.Lock()
+			if e.gate == gate {
+				e.gate = nil
+			}
+			e.mu.Unlock()
+			close(gate)
+		})
+	}
+}
+
+// QueueStartResults добавляет результаты для следующих вызовов Start.
+func (e *FakeEngine) QueueStartResults(results ...error) {
+	e.mu.Lock()
+	e.startResults = append(e.startResults, results...)
+	e.mu.Unlock()
+}
+
+func (e *FakeEngine) Start(ctx context.Context, profile Profile, opts EngineOptions) error {
+	e.mu.Lock()
+	e.starts = append(e.starts, FakeStart{Profile: profile, Options: opts})
+	var result error
+	if len(e.startResults) > 0 {
+		result = e.startResults[0]
+		e.startResults = e.startResults[1:]
+	}
+	gate := e.gate
+	e.mu.Unlock()
+
+	if gate != nil {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if result != nil {
+		return result
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.running = true
+	e.stats = TunnelStats{StartedAt: time.Unix(0, 0)}
+	e.mu.Unlock()
+	sendEngineEvent(e.events, EngineEventStarted, nil)
+	return nil
+}
+
+func (e *FakeEngine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	e.stops++
+	wasRunning := e.running
+	e.running = false
+	e.stats = TunnelStats{}
+	e.mu.Unlock()
+
+	if wasRunning {
+		sendEngineEvent(e.events, EngineEventStopped, nil)
+	}
+	return nil
+}
+
+func (e *FakeEngine) Stats() TunnelStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+func (e *FakeEngine) Events() <-chan EngineEvent {
+	return e.events
+}
+
+// AddTraffic увеличивает счётчики работающего движка.
+func (e *FakeEngine) AddTraffic(up, down uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running {
+		return
+	}
+	e.stats.BytesUp += up
+	e.stats.BytesDown += down
+}
+
+// Fail имитирует обрыв туннеля без вызова Stop.
+func (e *FakeEngine) Fail(err error) {
+	e.mu.Lock()
+	e.running = false
+	e.mu.Unlock()
+	sendEngineEvent(e.events, EngineEventFailed, err)
+}
+
+// Running сообщает, запущен ли движок.
+func (e *FakeEngine) Running() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.running
+}
+
+// Starts возвращает параметры всех вызовов Start.
+func (e *FakeEngine) Starts() []FakeStart {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]FakeStart(nil), e.starts...)
+}
+
+// Stops возвращает число вызовов Stop.
+func (e *FakeEngine) Stops() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stops
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCoreUnavailable = errors.New("embedded tunnel core is not linked into this build")
+
+// EmbeddedCore — экземпляр встроенного ядра (xray/sing-box), собранный
+// из JSON‑конфигурации. Ядро работает внутри процесса клиента.
+type EmbeddedCore interface {
+	Start() error
+	Close() error
+	// Traffic возвращает накопленные счётчики байт исходящего прокси.
+	Traffic() (uplink, downlink uint64)
+}
+
+// CoreFactory создаёт ядро из конфигурации BuildEngineConfig.
+type CoreFactory func(config []byte) (EmbeddedCore, error)
+
+// InProcessEngine — TunnelEngine поверх встроенного ядра.
+type InProcessEngine struct {
+	factory CoreFactory
+	events  chan EngineEvent
+
+	mu        sync.Mutex
+	core      EmbeddedCore
+	startedAt time.Time
+	// generation отличает текущий запуск от прерванного Stop.
+	generation uint64
+}
+
+// NewInProcessEngine создаёт движок. factory может быть nil, если ядро
+// не слинковано в сборку: тогда Start возвращает ErrCoreUnavailable.
+func NewInProcessEngine(factory CoreFactory) *InProcessEngine {
+	return &InProcessEngine{
+		factory: factory,
+		events:  make(chan EngineEvent, engineEventBuffer),
+	}
+}
+
+func (e *InProcessEngine) Start(ctx context.Context, profile Profile, opts EngineOptions) error {
+	if e.factory == nil {
+		return ErrCoreUnavailable
+	}
+
+	config, err := BuildEngineConfig(profile, opts)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	if e.core != nil {
+		e.mu.Unlock()
+		return errors.New("engine is already running")
+	}
+	generation := e.generation
+	e.mu.Unlock()
+
+	instance, err := e.factory(config)
+	if err != nil {
+		return err
+	}
+
+	// Запуск ядра синхронный; ctx проверяем до и после, так как
+	// прервать сам Start ядра нельзя.
+	if err := ctx.Err(); err != nil {
+		_ = instance.Close()
+		return err
+	}
+	if err := instance.Start(); err != nil {
+		_ = instance.Close()
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := ctx.Err(); err != nil || e.generation != generation {
+		_ = instance.Close()
+		if err == nil {
+			err = context.Canceled
+		}
+		return err
+	}
+	e.core = instance
+	e.startedAt = time.Now()
+	sendEngineEvent(e.events, EngineEventStarted, nil)
+	return nil
+}
+
+func (e *InProcessEngine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	e.generation++
+	instance := e.core
+	e.core = nil
+	e.startedAt = time.Time{}
+	e.mu.Unlock()
+
+	if instance == nil {
+		return nil
+	}
+	err := instance.Close()
+	sendEngineEvent(e.events, EngineEventStopped, err)
+	return err
+}
+
+func (e *InProcessEngine) Stats() TunnelStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.core == nil {
+		return TunnelStats{}
+	}
+	up, down := e.core.Traffic()
+	return TunnelStats{
+		BytesUp:   up,
+		BytesDown: down,
+		StartedAt: e.startedAt,
+	}
+}
+
+func (e *InProcessEngine) Events() <-chan EngineEvent {
+	return e.events
+}
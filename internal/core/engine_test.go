@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type stubCore struct {
+	config   []byte
+	startErr error
+	started  bool
+	closed   bool
+	up, down uint64
+}
+
+func (c *stubCore) Start() error {
+	if c.startErr != nil {
+		return c.startErr
+	}
+	c.started = true
+	return nil
+}
+
+func (c *stubCore) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *stubCore) Traffic() (uint64, uint64) {
+	return c.up, c.down
+}
+
+func TestInProcessEngine_Lifecycle(t *testing.T) {
+	var created *stubCore
+	engine := NewInProcessEngine(func(config []byte) (EmbeddedCore, error) {
+		created = &stubCore{config: config, up: 10, down: 20}
+		return created, nil
+	})
+
+	if err := engine.Start(context.Background(), testProfile(t), testOptions()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !created.started || !json.Valid(created.config) {
+		t.Fatalf("core not started with valid config")
+	}
+	if ev := <-engine.Events(); ev.Kind != EngineEventStarted {
+		t.Fatalf("event = %s, want started", ev.Kind)
+	}
+	if stats := engine.Stats(); stats.BytesUp != 10 || stats.BytesDown != 20 || stats.StartedAt.IsZero() {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !created.closed {
+		t.Fatal("core not closed on Stop")
+	}
+	if stats := engine.Stats(); stats != (TunnelStats{}) {
+		t.Fatalf("stats after Stop = %+v", stats)
+	}
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+}
+
+func TestInProcessEngine_StartErrors(t *testing.T) {
+	if err := NewInProcessEngine(nil).Start(context.Background(), testProfile(t), testOptions()); !errors.Is(err, ErrCoreUnavailable) {
+		t.Fatalf("nil factory error = %v, want ErrCoreUnavailable", err)
+	}
+
+	startErr := errors.New("bind failed")
+	var created *stubCore
+	engine := NewInProcessEngine(func(config []byte) (EmbeddedCore, error) {
+		created = &stubCore{startErr: startErr}
+		return created, nil
+	})
+	if err := engine.Start(context.Background(), testProfile(t), testOptions()); !errors.Is(err, startErr) {
+		t.Fatalf("Start error = %v, want %v", err, startErr)
+	}
+	if !created.closed {
+		t.Fatal("core not closed after failed Start")
+	}
+}
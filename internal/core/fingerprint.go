@@ -0,0 +1,143 @@
+package core
+
+import (
+	"crypto/tls"
+	"errors"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+var errInvalidFingerprint = errors.New("invalid TLS fingerprint")
+
+// clientHello — то, чем отпечатки различаются в ClientHello, собранном
+// crypto/tls: набор групп, набор шифров TLS 1.2 и ALPN. Порядок групп и
+// шифров crypto/tls выбирает сам; шифры TLS 1.3 не настраиваются.
+type clientHello struct {
+	curves []tls.CurveID
+	suites []uint16
+	alpn   []string
+}
+
+var (
+	// chromeSuites — шифры TLS 1.2 Chrome: без CBC для ECDSA и без 3DES.
+	chromeSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	}
+	// firefoxSuites добавляет CBC для ECDSA.
+	firefoxSuites = append([]uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	}, chromeSuites...)
+	// safariSuites добавляет ещё и 3DES.
+	safariSuites = append([]uint16{
+		tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+		tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	}, firefoxSuites...)
+
+	browserALPN = []string{"h2", "http/1.1"}
+)
+
+// clientHelloFor возвращает параметры ClientHello для отпечатка fp.
+// Отпечатки из ссылок, которых нет в настройках (ios, edge, …), ближе
+// всего к Chrome. randomized каждый раз даёт новый набор.
+func clientHelloFor(fp string) clientHello {
+	switch settings.TLSFingerprint(fp) {
+	case settings.FingerprintFirefox:
+		return clientHello{
+			curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521},
+			suites: firefoxSuites,
+			alpn:   browserALPN,
+		}
+	case settings.FingerprintSafari:
+		return clientHello{
+			curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521},
+			suites: safariSuites,
+			alpn:   browserALPN,
+		}
+	case settings.FingerprintRandomized:
+		return randomClientHello()
+	default:
+		return clientHello{
+			curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+			suites: chromeSuites,
+			alpn:   browserALPN,
+		}
+	}
+}
+
+// randomClientHello выбирает случайные подмножества групп и шифров.
+// X25519 и шифры с GCM остаются всегда, чтобы сервер было чем выбрать.
+func randomClientHello() clientHello {
+	hello := clientHello{curves: []tls.CurveID{tls.X25519}}
+	for _, c := range []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521} {
+		if rand.IntN(2) == 0 {
+			hello.curves = append(hello.curves, c)
+		}
+	}
+	for _, s := range safariSuites {
+		// Первые четыре шифра Chrome — ECDHE с AES‑GCM.
+		if slices.Contains(chromeSuites[:4], s) || rand.IntN(2) == 0 {
+			hello.suites = append(hello.suites, s)
+		}
+	}
+	alpns := [][]string{browserALPN, {"http/1.1"}, {"h2"}}
+	hello.alpn = alpns[rand.IntN(len(alpns))]
+	return hello
+}
+
+// apply переносит параметры в cfg. ALPN транспорта, если он задан, важнее
+// ALPN отпечатка: gRPC без h2 не заработает.
+func (h clientHello) apply(cfg *tls.Config) {
+	cfg.CurvePreferences = h.curves
+	cfg.CipherSuites = h.suites
+	if cfg.NextProtos == nil {
+		cfg.NextProtos = h.alpn
+	}
+}
+
+// isValidFingerprint сообщает, знает ли движок отпечаток из настроек.
+// Пустой отпечаток означает отпечаток профиля.
+func isValidFingerprint(fp settings.TLSFingerprint) bool {
+	switch fp {
+	case "", settings.FingerprintChrome, settings.FingerprintFirefox,
+		settings.FingerprintSafari, settings.FingerprintRandomized:
+		return true
+	}
+	return false
+}
+
+// withFingerprint заменяет отпечатки профилей отпечатком из настроек.
+func withFingerprint(profiles []Profile, fp settings.TLSFingerprint) []Profile {
+	if fp == "" {
+		return profiles
+	}
+	out := make([]Profile, len(profiles))
+	for i, p := range profiles {
+		out[i] = p.withFingerprint(string(fp))
+	}
+	return out
+}
+
+// withFingerprint заменяет отпечаток всех серверов цепочки; цепочка
+// копируется, чтобы не менять исходный профиль.
+func (p Profile) withFingerprint(fp string) Profile {
+	p.Fingerprint = fp
+	p.Chain = slices.Clone(p.Chain)
+	for i := range p.Chain {
+		p.Chain[i].Fingerprint = fp
+	}
+	return p
+}
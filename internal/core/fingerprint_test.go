@@ -0,0 +1,283 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// capturedHello — то, что видно в ClientHello наблюдателю на пути.
+type capturedHello struct {
+	serverName string
+	suites     []uint16
+	groups     []tls.CurveID
+	alpn       []string
+}
+
+func (h capturedHello) key() string {
+	return fmt.Sprint(h.suites, h.groups, h.alpn)
+}
+
+// captureClientHello выполняет пробу рукопожатия профиля p с локальным
+// слушателем и возвращает разобранный ClientHello. Слушатель закрывает
+// соединение, не отвечая: проба при этом завершается ошибкой.
+func captureClientHello(t *testing.T, p Profile) capturedHello {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	type result struct {
+		hello capturedHello
+		err   error
+	}
+	got := make(chan result, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		hello, err := readClientHello(conn)
+		got <- result{hello, err}
+	}()
+
+	p.Address = "127.0.0.1"
+	p.Port = ln.Addr().(*net.TCPAddr).Port
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, _ = measureHandshake(ctx, p, nil)
+
+	r := <-got
+	if r.err != nil {
+		t.Fatalf("read ClientHello: %v", r.err)
+	}
+	return r.hello
+}
+
+// readClientHello собирает сообщение ClientHello из записей TLS и
+// разбирает шифры, SNI, supported_groups и ALPN.
+func readClientHello(r io.Reader) (capturedHello, error) {
+	var msg []byte
+	for len(msg) < 4 || len(msg) < 4+int(msg[1])<<16|int(msg[2])<<8|int(msg[3]) {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return capturedHello{}, err
+		}
+		if header[0] != 22 {
+			return capturedHello{}, fmt.Errorf("record type %d, want handshake", header[0])
+		}
+		body := make([]byte, binary.BigEndian.Uint16(header[3:]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return capturedHello{}, err
+		}
+		msg = append(msg, body...)
+	}
+	if msg[0] != 1 {
+		return capturedHello{}, fmt.Errorf("handshake type %d, want ClientHello", msg[0])
+	}
+	s := helloReader(msg[4:])
+
+	var hello capturedHello
+	s.skip(2 + 32)      // версия и random
+	s.skip(int(s.u8())) // session id
+	suites := s.bytes(int(s.u16()))
+	for i := 0; i+1 < len(suites); i += 2 {
+		hello.suites = append(hello.suites, binary.BigEndian.Uint16(suites[i:]))
+	}
+	s.skip(int(s.u8())) // методы сжатия
+	exts := helloReader(s.bytes(int(s.u16())))
+	for len(exts) > 0 {
+		typ := exts.u16()
+		data := helloReader(exts.bytes(int(exts.u16())))
+		switch typ {
+		case 0: // server_name
+			data.skip(2 + 1)
+			hello.serverName = string(data.bytes(int(data.u16())))
+		case 10: // supported_groups
+			groups := data.bytes(int(data.u16()))
+			for i := 0; i+1 < len(groups); i += 2 {
+				hello.groups = append(hello.groups, tls.CurveID(binary.BigEndian.Uint16(groups[i:])))
+			}
+		case 16: // ALPN
+			list := helloReader(data.bytes(int(data.u16())))
+			for len(list) > 0 {
+				hello.alpn = append(hello.alpn, string(list.bytes(int(list.u8()))))
+			}
+		}
+	}
+	if s == nil || exts == nil {
+		return capturedHello{}, errors.New("truncated ClientHello")
+	}
+	return hello, nil
+}
+
+// helloReader читает поля ClientHello; после выхода за границу становится nil.
+type helloReader []byte
+
+func (r *helloReader) bytes(n int) []byte {
+	if *r == nil || n > len(*r) {
+		*r = nil
+		return nil
+	}
+	out := (*r)[:n]
+	*r = (*r)[n:]
+	return out
+}
+
+func (r *helloReader) skip(n int) { r.bytes(n) }
+
+func (r *helloReader) u8() int {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return int(b[0])
+}
+
+func (r *helloReader) u16() int {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func fingerprintProfile(fp string) Profile {
+	return Profile{ServerName: "www.example.com", Fingerprint: fp}
+}
+
+func hasSuites(hello capturedHello, suites ...uint16) bool {
+	for _, s := range suites {
+		if !slices.Contains(hello.suites, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClientHello_Fingerprints(t *testing.T) {
+	ecdsaCBC := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA}
+	tripleDES := []uint16{tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}
+
+	cases := []struct {
+		fp       settings.TLSFingerprint
+		p521     bool
+		ecdsaCBC bool
+		des      bool
+	}{
+		{fp: settings.FingerprintChrome},
+		{fp: settings.FingerprintFirefox, p521: true, ecdsaCBC: true},
+		{fp: settings.FingerprintSafari, p521: true, ecdsaCBC: true, des: true},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.fp), func(t *testing.T) {
+			hello := captureClientHello(t, fingerprintProfile(string(tc.fp)))
+			if hello.serverName != "www.example.com" {
+				t.Errorf("SNI = %q", hello.serverName)
+			}
+			if !slices.Equal(hello.alpn, []string{"h2", "http/1.1"}) {
+				t.Errorf("ALPN = %q", hello.alpn)
+			}
+			if !slices.Contains(hello.groups, tls.X25519) || !slices.Contains(hello.groups, tls.CurveP256) {
+				t.Errorf("groups = %v, want X25519 and P-256", hello.groups)
+			}
+			if got := slices.Contains(hello.groups, tls.CurveP521); got != tc.p521 {
+				t.Errorf("P-521 offered = %v, want %v (groups %v)", got, tc.p521, hello.groups)
+			}
+			if got := hasSuites(hello, ecdsaCBC...); got != tc.ecdsaCBC {
+				t.Errorf("ECDSA CBC offered = %v, want %v", got, tc.ecdsaCBC)
+			}
+			if got := hasSuites(hello, tripleDES...); got != tc.des {
+				t.Errorf("3DES offered = %v, want %v", got, tc.des)
+			}
+		})
+	}
+}
+
+func TestClientHello_RandomizedVaries(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 8 && len(seen) < 2; i++ {
+		hello := captureClientHello(t, fingerprintProfile(string(settings.FingerprintRandomized)))
+		if !slices.Contains(hello.groups, tls.X25519) || !hasSuites(hello, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) {
+			t.Fatalf("randomized hello lacks a baseline: groups %v, suites %v", hello.groups, hello.suites)
+		}
+		seen[hello.key()] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("randomized fingerprint produced identical ClientHellos")
+	}
+}
+
+func TestClientHello_TransportALPNWins(t *testing.T) {
+	p := fingerprintProfile(string(settings.FingerprintFirefox))
+	p.Network = NetworkGRPC
+	if hello := captureClientHello(t, p); !slices.Equal(hello.alpn, []string{"h2"}) {
+		t.Fatalf("gRPC ALPN = %q, want h2 only", hello.alpn)
+	}
+}
+
+// fingerprintProber запоминает отпечатки проверенных профилей.
+type fingerprintProber struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (f *fingerprintProber) Probe(_ context.Context, p Profile) error {
+	f.mu.Lock()
+	f.seen = append(f.seen, p.Fingerprint)
+	f.mu.Unlock()
+	return nil
+}
+
+func TestAutoStrategy_ProbesWithSettingsFingerprint(t *testing.T) {
+	prober := &fingerprintProber{}
+	auto := NewAutoStrategy(prober, time.Millisecond)
+	opts := testOptions()
+	opts.Settings.Connection.Fingerprint = settings.FingerprintSafari
+	p := testProfile(t)
+	p.Fingerprint = "chrome"
+
+	if _, err := auto.SelectProfile(context.Background(), []Profile{p}, opts); err != nil {
+		t.Fatalf("SelectProfile: %v", err)
+	}
+	prober.mu.Lock()
+	defer prober.mu.Unlock()
+	if !slices.Equal(prober.seen, []string{"safari"}) {
+		t.Fatalf("probed fingerprints = %q, want safari", prober.seen)
+	}
+}
+
+func TestBuildEngineConfig_SettingsFingerprint(t *testing.T) {
+	p := testProfile(t)
+	p.Fingerprint = "chrome"
+	opts := testOptions()
+	opts.Settings.Connection.Fingerprint = settings.FingerprintFirefox
+
+	cfg, err := buildEngineConfig(p, opts)
+	if err != nil {
+		t.Fatalf("buildEngineConfig: %v", err)
+	}
+	if got := cfg.Outbounds[0].StreamSettings.RealitySettings.Fingerprint; got != "firefox" {
+		t.Fatalf("outbound fingerprint = %q, want firefox", got)
+	}
+
+	opts.Settings.Connection.Fingerprint = "netscape"
+	if _, err := buildEngineConfig(p, opts); !errors.Is(err, errInvalidFingerprint) {
+		t.Fatalf("unknown fingerprint: err = %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+const (
+	// DefaultHealthProbeURL отвечает 204 без тела; через туннель его
+	// запрос почти ничего не стоит.
+	DefaultHealthProbeURL = DefaultPortalProbeURL
+
+	defaultHealthInterval      = 30 * time.Second
+	defaultHealthProbeTimeout  = 5 * time.Second
+	defaultHealthDegradedRTT   = 1500 * time.Millisecond
+	defaultHealthStallFailures = 3
+)
+
+// HealthPolicy — параметры проверки туннеля. Нулевые значения заменяются
+// значениями по умолчанию.
+type HealthPolicy struct {
+	Enabled  bool
+	Interval time.Duration
+	// ProbeTimeout — сколько ждать ответа на одну пробу.
+	ProbeTimeout time.Duration
+	// DegradedRTT — ответ медленнее этого считается деградацией.
+	DegradedRTT time.Duration
+	// StallFailures — столько неудачных проб подряд означают, что туннель
+	// завис; меньшее число неудач — деградация.
+	StallFailures int
+}
+
+// HealthPolicyFromSettings строит политику из пользовательских настроек.
+func HealthPolicyFromSettings(s settings.ConnectionSettings) HealthPolicy {
+	return HealthPolicy{
+		Enabled:       s.HealthCheck,
+		Interval:      time.Duration(s.HealthIntervalSecs) * time.Second,
+		DegradedRTT:   time.Duration(s.HealthDegradedRTTMs) * time.Millisecond,
+		StallFailures: s.HealthStallFailures,
+	}
+}
+
+func (p HealthPolicy) withDefaults() HealthPolicy {
+	if p.Interval <= 0 {
+		p.Interval = defaultHealthInterval
+	}
+	if p.ProbeTimeout <= 0 {
+		p.ProbeTimeout = defaultHealthProbeTimeout
+	}
+	if p.ProbeTimeout > p.Interval {
+		p.ProbeTimeout = p.Interval
+	}
+	if p.DegradedRTT <= 0 {
+		p.DegradedRTT = defaultHealthDegradedRTT
+	}
+	if p.StallFailures <= 0 {
+		p.StallFailures = defaultHealthStallFailures
+	}
+	return p
+}
+
+// HealthState — состояние поднятого туннеля по результатам проб.
+type HealthState string
+
+const (
+	// HealthUnknown — туннель не поднят, проверка выключена или проб
+	// ещё не было.
+	HealthUnknown  HealthState = "unknown"
+	HealthOK       HealthState = "ok"
+	HealthDegraded HealthState = "degraded"
+	// HealthStalled — туннель «подключён», но трафик не проходит.
+	HealthStalled HealthState = "stalled"
+)
+
+// HealthStatus — результат последних проб для UI.
+type HealthStatus struct {
+	State HealthState
+	// RTT — время ответа последней удачной пробы.
+	RTT time.Duration
+	// Failures — число неудачных проб подряд.
+	Failures  int
+	LastError error
+	CheckedAt time.Time
+}
+
+// HealthProber выполняет одну пробу через туннель с параметрами opts.
+type HealthProber interface {
+	Probe(ctx context.Context, opts EngineOptions) error
+}
+
+// HTTPHealthProber запрашивает URL через туннель и ждёт ответа 2xx.
+type HTTPHealthProber struct {
+	// URL — адрес пробы; по умолчанию DefaultHealthProbeURL.
+	URL string
+}
+
+func (p HTTPHealthProber) Probe(ctx context.Context, opts EngineOptions) error {
+	probeURL := p.URL
+	if probeURL == "" {
+		probeURL = DefaultHealthProbeURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := TunnelHTTPClient(opts).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health probe: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// HealthMonitor, пока туннель поднят, периодически отправляет через него
+// пробы и по порогам политики объявляет его деградировавшим или зависшим.
+// Реагирует на зависание тот, кто подписан на статус, — см. FollowHealth.
+type HealthMonitor struct {
+	conn   *Connection
+	prober HealthProber
+
+	policyCh chan HealthPolicy
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	status HealthStatus
+
+	updates broadcaster[HealthStatus]
+}
+
+// NewHealthMonitor запускает проверку туннеля conn. prober == nil означает
+// HTTPHealthProber. Close останавливает проверку.
+func NewHealthMonitor(conn *Connection, prober HealthProber, policy HealthPolicy) *HealthMonitor {
+	if prober == nil {
+		prober = HTTPHealthProber{}
+	}
+	m := &HealthMonitor{
+		conn:     conn,
+		prober:   prober,
+		policyCh: make(chan HealthPolicy, 1),
+		done:     make(chan struct{}),
+		status:   HealthStatus{State: HealthUnknown},
+	}
+
+	events, unsubscribe := conn.Subscribe()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer unsubscribe()
+		m.run(events, policy.withDefaults())
+	}()
+	return m
+}
+
+// Close останавливает проверку и ждёт завершения текущей пробы.
+func (m *HealthMonitor) Close() {
+	m.stopOnce.Do(func() { close(m.done) })
+	m.wg.Wait()
+}
+
+// UpdatePolicy применяет новую политику без перезапуска.
+func (m *HealthMonitor) UpdatePolicy(policy HealthPolicy) {
+	policy = policy.withDefaults()
+	// Канал на одно значение: более новая политика вытесняет старую.
+	for {
+		select {
+		case m.policyCh <- policy:
+			return
+		default:
+		}
+		select {
+		case <-m.policyCh:
+		default:
+		}
+	}
+}
+
+// Status возвращает результат последних проб.
+func (m *HealthMonitor) Status() HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Subscribe подписывает на изменения HealthStatus.
+func (m *HealthMonitor) Subscribe() (<-chan HealthStatus, func()) {
+	return m.updates.subscribe()
+}
+
+func (m *HealthMonitor) run(events <-chan Transition, policy HealthPolicy) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-m.done
+		cancel()
+	}()
+
+	var ticker *time.Ticker
+	var tickC <-chan time.Time
+	stop := func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+		ticker, tickC = nil, nil
+	}
+	defer stop()
+	// restart начинает проверку заново: статус сбрасывается, первая проба —
+	// через интервал.
+	restart := func() {
+		stop()
+		m.set(HealthStatus{State: HealthUnknown})
+		if policy.Enabled && m.conn.State() == StateConnected {
+			ticker = time.NewTicker(policy.Interval)
+			tickC = ticker.C
+		}
+	}
+	restart()
+
+	for {
+		select {
+		case <-m.done:
+			return
+
+		case t, ok := <-events:
+			if !ok {
+				return
+			}
+			if t.To == StateConnected || t.From == StateConnected {
+				restart()
+			}
+
+		case <-tickC:
+			m.probe(ctx, policy)
+
+		case p := <-m.policyCh:
+			// Настройки сохраняются целиком: без изменений проверка идёт дальше.
+			if p != policy {
+				policy = p
+				restart()
+			}
+		}
+	}
+}
+
+// probe выполняет одну пробу и обновляет статус по порогам policy.
+func (m *HealthMonitor) probe(ctx context.Context, policy HealthPolicy) {
+	opts := m.conn.Options()
+	probeCtx, cancel := context.WithTimeout(ctx, policy.ProbeTimeout)
+	defer cancel()
+	started := time.Now()
+	err := m.prober.Probe(probeCtx, opts)
+	finished := time.Now()
+	// Туннель могли опустить во время пробы: такой результат ничего не говорит.
+	if ctx.Err() != nil || m.conn.State() != StateConnected {
+		return
+	}
+
+	st := m.Status()
+	st.CheckedAt = finished
+	if err != nil {
+		st.Failures++
+		st.LastError = err
+		st.State = HealthDegraded
+		if st.Failures >= policy.StallFailures {
+			st.State = HealthStalled
+		}
+	} else {
+		st.Failures = 0
+		st.LastError = nil
+		st.RTT = finished.Sub(started)
+		st.State = HealthOK
+		if st.RTT > policy.DegradedRTT {
+			st.State = HealthDegraded
+		}
+	}
+	m.set(st)
+}
+
+func (m *HealthMonitor) set(st HealthStatus) {
+	m.mu.Lock()
+	// Ошибки не сравниваем: не каждую можно сравнить, а новая ошибка
+	// всегда приходит с новым CheckedAt.
+	prev := m.status
+	changed := prev.State != st.State || prev.RTT != st.RTT ||
+		prev.Failures != st.Failures || !prev.CheckedAt.Equal(st.CheckedAt)
+	m.status = st
+	m.mu.Unlock()
+	if changed {
+		m.updates.publish(st)
+	}
+}
+
+// FollowHealth передаёт супервизору зависание туннеля: он переподключает
+// туннель, если автопереподключение включено. Возвращает функцию, которая
+// прекращает слежение.
+func FollowHealth(m *HealthMonitor, supervisor *Supervisor) func() {
+	updates, unsubscribe := m.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stalled := false
+		for st := range updates {
+			// Одно зависание — одно переподключение, сколько бы проб
+			// ни провалилось подряд.
+			if st.State == HealthStalled && !stalled {
+				supervisor.NotifyStalled()
+			}
+			stalled = st.State == HealthStalled
+		}
+	}()
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
+
+// FollowEndToEnd записывает в ranking время ответа удачных проб как
+// задержку через поднятый сервер или цепочку: в отличие от замеров
+// LatencyProber, у цепочки она включает все звенья. networkID возвращает
+// текущую сеть. Возвращает функцию, которая прекращает слежение.
+func FollowEndToEnd(m *HealthMonitor, conn *Connection, ranking *ServerRanking, networkID func() string) func() {
+	updates, unsubscribe := m.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for st := range updates {
+			if st.Failures > 0 || st.RTT <= 0 || (st.State != HealthOK && st.State != HealthDegraded) {
+				continue
+			}
+			if active, ok := conn.ActiveProfile(); ok {
+				ranking.RecordEndToEnd(networkID(), active, st.RTT)
+			}
+		}
+	}()
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHealthProber возвращает результаты из очереди; последний повторяется.
+type fakeHealthProber struct {
+	mu      sync.Mutex
+	results []error
+	delay   time.Duration
+	calls   int
+}
+
+func (p *fakeHealthProber) Probe(ctx context.Context, _ EngineOptions) error {
+	p.mu.Lock()
+	p.calls++
+	err := p.results[0]
+	if len(p.results) > 1 {
+		p.results = p.results[1:]
+	}
+	delay := p.delay
+	p.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+func (p *fakeHealthProber) set(delay time.Duration, results ...error) {
+	p.mu.Lock()
+	p.delay = delay
+	p.results = results
+	p.mu.Unlock()
+}
+
+func (p *fakeHealthProber) probes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func testHealthPolicy() HealthPolicy {
+	return HealthPolicy{
+		Enabled:       true,
+		Interval:      5 * time.Millisecond,
+		ProbeTimeout:  time.Second,
+		DegradedRTT:   20 * time.Millisecond,
+		StallFailures: 3,
+	}
+}
+
+func waitHealth(t *testing.T, m *HealthMonitor, want HealthState) HealthStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := m.Status()
+		if st.State == want {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health = %+v, want %s", st, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHealthMonitor_Thresholds(t *testing.T) {
+	conn := NewConnection(NewFakeEngine())
+	prober := &fakeHealthProber{results: []error{nil}}
+	m := NewHealthMonitor(conn, prober, testHealthPolicy())
+	defer m.Close()
+
+	connectForTest(t, conn)
+	if st := waitHealth(t, m, HealthOK); st.RTT <= 0 || st.CheckedAt.IsZero() {
+		t.Fatalf("ok status = %+v", st)
+	}
+
+	// Проба не может длиться дольше интервала.
+	policy := testHealthPolicy()
+	policy.Interval = 60 * time.Millisecond
+	m.UpdatePolicy(policy)
+	prober.set(40*time.Millisecond, nil)
+	if st := waitHealth(t, m, HealthDegraded); st.Failures != 0 || st.RTT <= 20*time.Millisecond {
+		t.Fatalf("slow status = %+v", st)
+	}
+
+	probeErr := errors.New("probe timed out")
+	prober.set(0, probeErr)
+	st := waitHealth(t, m, HealthStalled)
+	if st.Failures != 3 || !errors.Is(st.LastError, probeErr) {
+		t.Fatalf("stalled status = %+v", st)
+	}
+
+	prober.set(0, nil)
+	if st := waitHealth(t, m, HealthOK); st.Failures != 0 || st.LastError != nil {
+		t.Fatalf("recovered status = %+v", st)
+	}
+}
+
+func TestHealthMonitor_SingleFailureIsDegraded(t *testing.T) {
+	conn := NewConnection(NewFakeEngine())
+	prober := &fakeHealthProber{results: []error{errors.New("reset"), nil}}
+	m := NewHealthMonitor(conn, prober, testHealthPolicy())
+	defer m.Close()
+	updates, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	connectForTest(t, conn)
+	for st := range updates {
+		if st.State == HealthUnknown {
+			continue
+		}
+		if st.State != HealthDegraded || st.Failures != 1 {
+			t.Fatalf("first result = %+v, want degraded after one failure", st)
+		}
+		break
+	}
+	waitHealth(t, m, HealthOK)
+}
+
+func TestHealthMonitor_ProbesOnlyWhileConnected(t *testing.T) {
+	conn := NewConnection(NewFakeEngine())
+	prober := &fakeHealthProber{results: []error{nil}}
+	m := NewHealthMonitor(conn, prober, testHealthPolicy())
+	defer m.Close()
+
+	time.Sleep(30 * time.Millisecond)
+	if n := prober.probes(); n != 0 {
+		t.Fatalf("probes before connect = %d", n)
+	}
+
+	connectForTest(t, conn)
+	waitHealth(t, m, HealthOK)
+	if err := conn.Disconnect(context.Background(), ReasonUserRequest); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	waitHealth(t, m, HealthUnknown)
+	// Проба, начатая до отключения, может ещё закончиться.
+	time.Sleep(10 * time.Millisecond)
+	before := prober.probes()
+	time.Sleep(30 * time.Millisecond)
+	if n := prober.probes(); n != before {
+		t.Fatalf("probes after disconnect: %d, then %d", before, n)
+	}
+
+	policy := testHealthPolicy()
+	policy.Enabled = false
+	m.UpdatePolicy(policy)
+	connectForTest(t, conn)
+	time.Sleep(30 * time.Millisecond)
+	if n := prober.probes(); n != before {
+		t.Fatalf("probes with health check disabled: %d, was %d", n, before)
+	}
+}
+
+func TestFollowHealth_ReconnectsStalledTunnel(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	sup := NewSupervisor(conn, testPolicy(time.Hour, 5))
+	defer sup.Close()
+	prober := &fakeHealthProber{results: []error{errors.New("dropped by middlebox")}}
+	m := NewHealthMonitor(conn, prober, testHealthPolicy())
+	defer m.Close()
+	stop := FollowHealth(m, sup)
+	defer stop()
+	transitions, unsubscribe := conn.Subscribe()
+	defer unsubscribe()
+
+	connectForTest(t, conn)
+	for tr := range transitions {
+		if tr.To == StateReconnecting {
+			if tr.Reason != ReasonTunnelStalled {
+				t.Fatalf("reconnect reason = %s", tr.Reason)
+			}
+			break
+		}
+	}
+	waitState(t, conn, StateConnected)
+	if n := len(engine.Starts()); n < 2 {
+		t.Fatalf("engine starts = %d, want a restart", n)
+	}
+}
+
+func TestFollowHealth_RespectsDisabledAutoReconnect(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	policy := testPolicy(time.Hour, 5)
+	policy.Enabled = false
+	sup := NewSupervisor(conn, policy)
+	defer sup.Close()
+	prober := &fakeHealthProber{results: []error{errors.New("dropped by middlebox")}}
+	m := NewHealthMonitor(conn, prober, testHealthPolicy())
+	defer m.Close()
+	stop := FollowHealth(m, sup)
+	defer stop()
+
+	connectForTest(t, conn)
+	waitHealth(t, m, HealthStalled)
+	time.Sleep(30 * time.Millisecond)
+	if conn.State() != StateConnected || len(engine.Starts()) != 1 {
+		t.Fatalf("state %s, starts %d: stalled tunnel restarted with auto-reconnect off", conn.State(), len(engine.Starts()))
+	}
+}
+
+func TestFollowEndToEnd_RecordsProbeRTTForActiveChain(t *testing.T) {
+	conn := NewConnection(NewFakeEngine())
+	prober := &fakeHealthProber{results: []error{nil}}
+	m := NewHealthMonitor(conn, prober, testHealthPolicy())
+	defer m.Close()
+	ranking := NewServerRanking(LatencyProber{}, time.Minute)
+	stop := FollowEndToEnd(m, conn, ranking, func() string { return "wifi-1" })
+	defer stop()
+
+	chain := testProfile(t)
+	chain.Address = "entry.example.com"
+	exit := testProfile(t)
+	exit.Address = "exit.example.com"
+	chain.Chain = []Profile{exit}
+	if err := conn.Connect(context.Background(), []Profile{chain}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	waitHealth(t, m, HealthOK)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, ok := ranking.Latency("wifi-1", chain)
+		if ok && got.EndToEnd > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("end-to-end latency not recorded: %+v", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := ranking.Latency("wifi-1", exit); ok {
+		t.Fatal("chain latency recorded for its exit alone")
+	}
+}
+
+func TestHTTPHealthProber_RequiresSuccess(t *testing.T) {
+	ok := newProbeStandIn(t, noContent)
+	ok = strings.Replace(ok, "probe.test", "127.0.0.1", 1)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	// В режиме TUN проба идёт по маршрутам, без локального прокси.
+	opts := EngineOptions{Inbound: InboundTUN}
+
+	if err := (HTTPHealthProber{URL: ok}).Probe(context.Background(), opts); err != nil {
+		t.Fatalf("Probe(204) = %v", err)
+	}
+	if err := (HTTPHealthProber{URL: failing.URL}).Probe(context.Background(), opts); err == nil {
+		t.Fatal("Probe(502) = nil, want error")
+	}
+}
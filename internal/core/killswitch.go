@@ -0,0 +1,268 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+const killSwitchResolveTimeout = 5 * time.Second
+
+var ErrFirewallUnsupported = errors.New("kill switch is not supported on this platform")
+
+// KillSwitchRules — что разрешено, пока включён kill switch. Остальной
+// трафик, кроме loopback, блокируется.
+type KillSwitchRules struct {
+	// TunnelInterface — интерфейс туннеля; пусто в режиме прокси.
+	TunnelInterface string
+	// Endpoints — адреса VPN‑серверов, к которым разрешены подключения.
+	Endpoints []netip.AddrPort
+	// IPv6 — политика IPv6: IPv6Block запрещает IPv6 и в туннеле,
+	// IPv6Allow пропускает его мимо туннеля. Пустое значение — как
+	// IPv6Tunnel: IPv6 разрешён только через интерфейс туннеля.
+	IPv6 settings.IPv6Policy
+	// BypassMark — метка пакетов приложений, которые по настройкам идут
+	// мимо туннеля; такие пакеты тоже разрешены. 0 — таких приложений нет.
+	BypassMark uint32
+}
+
+// Firewall применяет правила kill switch средствами ОС. Apply заменяет
+// ранее установленные правила атомарно, Remove идемпотентен.
+type Firewall interface {
+	Apply(rules KillSwitchRules) error
+	Remove() error
+}
+
+// InstalledFirewall — Firewall, который видит правила, оставшиеся в ОС
+// после аварийного завершения прошлого запуска.
+type InstalledFirewall interface {
+	Firewall
+	Installed() (bool, error)
+}
+
+// KillSwitchState — состояние kill switch для UI.
+type KillSwitchState int
+
+const (
+	// KillSwitchOff — правила не установлены.
+	KillSwitchOff KillSwitchState = iota
+	// KillSwitchArmed — туннель поднят, правила готовы сработать.
+	KillSwitchArmed
+	// KillSwitchBlocking — туннеля нет, трафик вне VPN заблокирован.
+	KillSwitchBlocking
+	// KillSwitchError — правила установить не удалось; трафик не защищён.
+	KillSwitchError
+)
+
+func (s KillSwitchState) String() string {
+	switch s {
+	case KillSwitchOff:
+		return "off"
+	case KillSwitchArmed:
+		return "armed"
+	case KillSwitchBlocking:
+		return "blocking"
+	case KillSwitchError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// KillSwitchStatus — текущее состояние kill switch.
+type KillSwitchStatus struct {
+	Enabled bool
+	State   KillSwitchState
+	Err     error
+}
+
+// KillSwitch держит правила брандмауэра, пока подключение не отключено
+// пользователем: при обрыве туннеля трафик не уходит в обычную сеть.
+// Чистое отключение снимает правила.
+type KillSwitch struct {
+	conn    *Connection
+	fw      Firewall
+	resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	mu        sync.Mutex
+	enabled   bool
+	installed bool
+	// resolved — последние адреса серверов по имени хоста: после установки
+	// правил DNS вне туннеля недоступен.
+	resolved map[string][]netip.Addr
+	status   KillSwitchStatus
+
+	updates     broadcaster[KillSwitchStatus]
+	unsubscribe func()
+	done        chan struct{}
+}
+
+// NewKillSwitch подписывается на подключение. Close снимает правила.
+// Правила, оставшиеся после аварийного завершения, kill switch принимает
+// как свои и сразу приводит к состоянию подключения: без туннеля они
+// снимаются.
+func NewKillSwitch(conn *Connection, fw Firewall, enabled bool) *KillSwitch {
+	k := &KillSwitch{
+		conn: conn,
+		fw:   fw,
+		resolve: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		enabled:  enabled,
+		resolved: make(map[string][]netip.Addr),
+		status:   KillSwitchStatus{Enabled: enabled},
+		done:     make(chan struct{}),
+	}
+	if probe, ok := fw.(InstalledFirewall); ok {
+		if installed, err := probe.Installed(); err == nil && installed {
+			k.installed = true
+			k.handle(conn.State())
+		}
+	}
+	events, unsubscribe := conn.Subscribe()
+	k.unsubscribe = unsubscribe
+	go func() {
+		defer close(k.done)
+		for t := range events {
+			k.handle(t.To)
+		}
+	}()
+	return k
+}
+
+// Close отписывается от подключения и снимает правила.
+func (k *KillSwitch) Close() error {
+	k.unsubscribe()
+	<-k.done
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.removeLocked()
+}
+
+// SetEnabled включает или выключает kill switch без переподключения.
+func (k *KillSwitch) SetEnabled(enabled bool) {
+	k.mu.Lock()
+	k.enabled = enabled
+	k.status.Enabled = enabled
+	k.mu.Unlock()
+	k.handle(k.conn.State())
+}
+
+// Status возвращает текущее состояние.
+func (k *KillSwitch) Status() KillSwitchStatus {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.status
+}
+
+// Subscribe подписывает на изменения KillSwitchStatus.
+func (k *KillSwitch) Subscribe() (<-chan KillSwitchStatus, func()) {
+	return k.updates.subscribe()
+}
+
+func (k *KillSwitch) handle(state ConnectionState) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// В режиме ProxyOnly системная сеть не трогается: правила брандмауэра
+	// требуют прав администратора, а трафик вне прокси и так идёт мимо туннеля.
+	proxyOnly := k.conn.Options().Settings.Connection.Mode == settings.ConnectionModeProxyOnly
+	if !k.enabled || proxyOnly || state == StateDisconnected {
+		err := k.removeLocked()
+		k.setStatusLocked(KillSwitchOff, err)
+		return
+	}
+
+	switch state {
+	case StateConnecting, StateReconnecting, StateConnected, StateFailed:
+		// Правила ставим заново при каждой попытке: набор серверов мог измениться.
+		if state != StateFailed || !k.installed {
+			if err := k.applyLocked(); err != nil {
+				k.setStatusLocked(KillSwitchError, err)
+				return
+			}
+		}
+		if state == StateConnected {
+			k.setStatusLocked(KillSwitchArmed, nil)
+		} else {
+			k.setStatusLocked(KillSwitchBlocking, nil)
+		}
+	case StateDisconnecting:
+		// Правила держим до окончания отключения.
+	}
+}
+
+func (k *KillSwitch) applyLocked() error {
+	opts := k.conn.Options()
+	rules := KillSwitchRules{
+		Endpoints: k.endpointsLocked(k.conn.Candidates()),
+		IPv6:      opts.Settings.Privacy.IPv6,
+	}
+	if opts.Inbound == InboundTUN {
+		rules.TunnelInterface = tunInterfaceName
+		if len(opts.Settings.Routing.BypassApps) > 0 {
+			rules.BypassMark = tunBypassMark
+		}
+	}
+	if err := k.fw.Apply(rules); err != nil {
+		return err
+	}
+	k.installed = true
+	return nil
+}
+
+func (k *KillSwitch) removeLocked() error {
+	if !k.installed {
+		return nil
+	}
+	if err := k.fw.Remove(); err != nil {
+		return err
+	}
+	k.installed = false
+	return nil
+}
+
+// endpointsLocked переводит адреса профилей в IP и порт. Если имя не
+// резолвится (например, правила уже блокируют DNS), используется прошлый
+// результат.
+func (k *KillSwitch) endpointsLocked(profiles []Profile) []netip.AddrPort {
+	var out []netip.AddrPort
+	for _, p := range profiles {
+		port := uint16(p.Port)
+		if addr, err := netip.ParseAddr(p.Address); err == nil {
+			out = append(out, netip.AddrPortFrom(addr.Unmap(), port))
+			continue
+		}
+		addrs, ok := k.resolved[p.Address]
+		if !ok || !k.installed {
+			ctx, cancel := context.WithTimeout(context.Background(), killSwitchResolveTimeout)
+			fresh, err := k.resolve(ctx, p.Address)
+			cancel()
+			if err == nil && len(fresh) > 0 {
+				addrs = fresh
+				k.resolved[p.Address] = fresh
+			}
+		}
+		for _, addr := range addrs {
+			out = append(out, netip.AddrPortFrom(addr.Unmap(), port))
+		}
+	}
+	slices.SortFunc(out, func(a, b netip.AddrPort) int { return a.Compare(b) })
+	return slices.Compact(out)
+}
+
+func (k *KillSwitch) setStatusLocked(state KillSwitchState, err error) {
+	next := KillSwitchStatus{Enabled: k.enabled, State: state, Err: err}
+	if next.State == k.status.State && next.Enabled == k.status.Enabled && next.Err == nil && k.status.Err == nil {
+		return
+	}
+	k.status = next
+	k.updates.publish(next)
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// fakeFirewall записывает применённые правила.
+type fakeFirewall struct {
+	mu       sync.Mutex
+	applied  []KillSwitchRules
+	removes  int
+	active   bool
+	applyErr error
+}
+
+func (f *fakeFirewall) Apply(rules KillSwitchRules) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.applyErr != nil {
+		return f.applyErr
+	}
+	f.applied = append(f.applied, rules)
+	f.active = true
+	return nil
+}
+
+func (f *fakeFirewall) Remove() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removes++
+	f.active = false
+	return nil
+}
+
+func (f *fakeFirewall) Installed() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active, nil
+}
+
+func (f *fakeFirewall) snapshot() (rules []KillSwitchRules, removes int, active bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]KillSwitchRules(nil), f.applied...), f.removes, f.active
+}
+
+func waitKillSwitch(t *testing.T, k *KillSwitch, want KillSwitchState) KillSwitchStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := k.Status()
+		if st.State == want {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("kill switch state = %v, want %v (err %v)", st.State, want, st.Err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKillSwitch_HoldsRulesUntilCleanDisconnect(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	fw := &fakeFirewall{}
+	ks := NewKillSwitch(conn, fw, true)
+	defer ks.Close()
+
+	profile := testProfile(t)
+	profile.Address = "203.0.113.7"
+	if err := conn.Connect(context.Background(), []Profile{profile}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	waitKillSwitch(t, ks, KillSwitchArmed)
+
+	rules, _, _ := fw.snapshot()
+	want := netip.MustParseAddrPort("203.0.113.7:443")
+	if len(rules) == 0 || len(rules[0].Endpoints) != 1 || rules[0].Endpoints[0] != want || rules[0].IPv6 != settings.IPv6Block {
+		t.Fatalf("applied rules = %+v", rules)
+	}
+
+	// Обрыв туннеля не снимает правила.
+	engine.Fail(errors.New("tunnel dropped"))
+	waitKillSwitch(t, ks, KillSwitchBlocking)
+	if _, removes, active := fw.snapshot(); removes != 0 || !active {
+		t.Fatalf("rules removed on failure: removes=%d active=%v", removes, active)
+	}
+
+	if err := conn.Disconnect(context.Background(), ReasonUserRequest); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	waitKillSwitch(t, ks, KillSwitchOff)
+	if _, removes, active := fw.snapshot(); removes != 1 || active {
+		t.Fatalf("after disconnect: removes=%d active=%v", removes, active)
+	}
+}
+
+// Правила, оставшиеся после аварийного завершения, снимаются при запуске:
+// без подключения блокировать сеть нечему.
+func TestKillSwitch_RemovesStaleRules(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		fw := &fakeFirewall{active: true}
+		ks := NewKillSwitch(NewConnection(NewFakeEngine()), fw, enabled)
+		if _, removes, active := fw.snapshot(); removes != 1 || active {
+			t.Fatalf("enabled=%v: stale rules kept: removes=%d active=%v", enabled, removes, active)
+		}
+		if st := ks.Status(); st.State != KillSwitchOff {
+			t.Fatalf("enabled=%v: status = %+v", enabled, st)
+		}
+		ks.Close()
+	}
+}
+
+func TestKillSwitch_DisabledAndToggled(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	fw := &fakeFirewall{}
+	ks := NewKillSwitch(conn, fw, false)
+	defer ks.Close()
+
+	connectForTest(t, conn)
+	time.Sleep(20 * time.Millisecond)
+	if rules, _, _ := fw.snapshot(); len(rules) != 0 {
+		t.Fatalf("disabled kill switch applied rules: %+v", rules)
+	}
+
+	ks.SetEnabled(true)
+	if st := ks.Status(); st.State != KillSwitchArmed || !st.Enabled {
+		t.Fatalf("status after enable = %+v", st)
+	}
+	ks.SetEnabled(false)
+	if _, removes, active := fw.snapshot(); removes != 1 || active {
+		t.Fatalf("after disable: removes=%d active=%v", removes, active)
+	}
+}
+
+func TestKillSwitch_AllowsBypassAppsInTUN(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	fw := &fakeFirewall{}
+	ks := NewKillSwitch(conn, fw, true)
+	defer ks.Close()
+
+	opts := tunOptions(t)
+	opts.Settings.Routing.BypassApps = []string{"/usr/bin/apt"}
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, opts, ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	waitKillSwitch(t, ks, KillSwitchArmed)
+
+	rules, _, _ := fw.snapshot()
+	if len(rules) == 0 || rules[0].TunnelInterface != tunInterfaceName || rules[0].BypassMark != tunBypassMark {
+		t.Fatalf("applied rules = %+v", rules)
+	}
+}
+
+func TestKillSwitch_ResolvesHostOnceAndReportsErrors(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	fw := &fakeFirewall{}
+	ks := NewKillSwitch(conn, fw, false)
+	defer ks.Close()
+
+	lookups := 0
+	ks.resolve = func(_ context.Context, host string) ([]netip.Addr, error) {
+		lookups++
+		if lookups > 1 {
+			return nil, errors.New("dns blocked")
+		}
+		return []netip.Addr{netip.MustParseAddr("198.51.100.1")}, nil
+	}
+
+	profile := testProfile(t)
+	profile.Address = "vpn.example.com"
+	if err := conn.Connect(context.Background(), []Profile{profile}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	ks.SetEnabled(true)
+	engine.Fail(errors.New("tunnel dropped"))
+	waitState(t, conn, StateFailed)
+	if err := conn.Reconnect(context.Background(), ReasonAutoReconnect); err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+	waitKillSwitch(t, ks, KillSwitchArmed)
+
+	rules, _, _ := fw.snapshot()
+	last := rules[len(rules)-1]
+	if len(last.Endpoints) != 1 || last.Endpoints[0].Addr() != netip.MustParseAddr("198.51.100.1") {
+		t.Fatalf("endpoints after reconnect = %v (lookups %d)", last.Endpoints, lookups)
+	}
+
+	fw.mu.Lock()
+	fw.applyErr = ErrFirewallUnsupported
+	fw.mu.Unlock()
+	_ = conn.Disconnect(context.Background(), ReasonUserRequest)
+	waitKillSwitch(t, ks, KillSwitchOff)
+	connectForTest(t, conn)
+	st := waitKillSwitch(t, ks, KillSwitchError)
+	if !errors.Is(st.Err, ErrFirewallUnsupported) {
+		t.Fatalf("status = %+v", st)
+	}
+}
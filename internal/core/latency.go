@@ -0,0 +1,381 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"crypto/x509"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLatencySamples     = 3
+	defaultLatencyParallelism = 4
+	defaultLatencyTimeout     = 3 * time.Second
+	defaultLatencyCacheTTL    = 10 * time.Minute
+)
+
+// LatencyProber измеряет время TCP‑подключения и TLS/Reality‑рукопожатия
+// до серверов каталога. Серверы проверяются параллельно (не больше
+// Parallelism одновременно), замеры одного сервера — последовательно.
+//
+// У цепочки замеряется только вход, как и в HandshakeProber: прямое
+// подключение к следующим серверам раскрыло бы им адрес устройства, ради
+// сокрытия которого цепочка и нужна. Задержку всей цепочки дают пробы
+// через поднятый туннель — см. ServerRanking.RecordEndToEnd.
+type LatencyProber struct {
+	// RootCAs — доверенные корни; nil означает системные.
+	RootCAs *x509.CertPool
+	// Timeout ограничивает один замер.
+	Timeout     time.Duration
+	Samples     int
+	Parallelism int
+}
+
+// ServerLatency — итог замеров одного транспорта сервера.
+type ServerLatency struct {
+	Profile Profile
+	// Connect, Handshake и RTT — медианы по успешным замерам; у цепочки
+	// это задержка до входа.
+	Connect   time.Duration
+	Handshake time.Duration
+	RTT       time.Duration
+	// EndToEnd — время ответа пробы через поднятый туннель: у цепочки оно
+	// включает все её звенья. 0 — через сервер в этой сети не подключались.
+	EndToEnd time.Duration
+	// Jitter — среднее отклонение RTT соседних успешных замеров.
+	Jitter time.Duration
+	// Loss — доля неудачных замеров, от 0 до 1.
+	Loss     float64
+	Sent     int
+	Received int
+	// LastErr и Failure описывают последнюю неудачу, если она была.
+	LastErr error
+	Failure FailureKind
+}
+
+// Reachable сообщает, что хотя бы один замер был успешным.
+func (l ServerLatency) Reachable() bool {
+	return l.Received > 0
+}
+
+// Measure замеряет все уникальные транспорты и возвращает их в порядке
+// ранжирования (см. RankLatencies).
+func (lp LatencyProber) Measure(ctx context.Context, profiles []Profile) []ServerLatency {
+	samples := lp.Samples
+	if samples <= 0 {
+		samples = defaultLatencySamples
+	}
+	parallelism := lp.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultLatencyParallelism
+	}
+
+	var unique []Profile
+	seen := make(map[string]bool)
+	for _, p := range profiles {
+		key := TransportKey(p)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, p)
+		}
+	}
+
+	results := make([]ServerLatency, len(unique))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, p := range unique {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = ServerLatency{Profile: p, Loss: 1, LastErr: ctx.Err(), Failure: FailureCancelled}
+				return
+			}
+			defer func() { <-sem }()
+			results[i] = lp.measureOne(ctx, p, samples)
+		}()
+	}
+	wg.Wait()
+
+	RankLatencies(results)
+	return results
+}
+
+func (lp LatencyProber) measureOne(ctx context.Context, p Profile, samples int) ServerLatency {
+	timeout := lp.Timeout
+	if timeout <= 0 {
+		timeout = defaultLatencyTimeout
+	}
+
+	result := ServerLatency{Profile: p}
+	var connects, handshakes, rtts []time.Duration
+	for i := 0; i < samples && ctx.Err() == nil; i++ {
+		sampleCtx, cancel := context.WithTimeout(ctx, timeout)
+		connect, handshake, err := measureHandshake(sampleCtx, p, lp.RootCAs)
+		cancel()
+
+		result.Sent++
+		if err != nil {
+			result.LastErr = err
+			result.Failure = ClassifyTransportError(err)
+			// Отказ в подключении не изменится от повторов.
+			if result.Failure == FailureRefused {
+				break
+			}
+			continue
+		}
+		connects = append(connects, connect)
+		handshakes = append(handshakes, handshake)
+		rtts = append(rtts, connect+handshake)
+	}
+
+	result.Received = len(rtts)
+	if result.Sent > 0 {
+		result.Loss = float64(result.Sent-result.Received) / float64(result.Sent)
+	} else {
+		result.Loss = 1
+	}
+	result.Connect = medianDuration(connects)
+	result.Handshake = medianDuration(handshakes)
+	result.RTT = medianDuration(rtts)
+	result.Jitter = jitter(rtts)
+	return result
+}
+
+// RankLatencies упорядочивает результаты: сначала доступные, среди них —
+// с меньшими потерями, затем с меньшим RTT с учётом джиттера.
+func RankLatencies(results []ServerLatency) {
+	slices.SortStableFunc(results, func(a, b ServerLatency) int {
+		switch {
+		case a.Reachable() != b.Reachable():
+			if a.Reachable() {
+				return -1
+			}
+			return 1
+		case a.Loss != b.Loss:
+			if a.Loss < b.Loss {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.RTT+a.Jitter, b.RTT+b.Jitter)
+	})
+}
+
+// BestPerServer оставляет для каждого сервера или цепочки
+// (Profile.ServerID) лучший транспорт, сохраняя порядок ранжирования.
+func BestPerServer(ranked []ServerLatency) []ServerLatency {
+	var out []ServerLatency
+	seen := make(map[string]bool)
+	for _, l := range ranked {
+		if seen[l.Profile.ServerID()] {
+			continue
+		}
+		seen[l.Profile.ServerID()] = true
+		out = append(out, l)
+	}
+	return out
+}
+
+func medianDuration(values []time.Duration) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func jitter(rtts []time.Duration) time.Duration {
+	if len(rtts) < 2 {
+		return 0
+	}
+	var sum time.Duration
+	for i := 1; i < len(rtts); i++ {
+		d := rtts[i] - rtts[i-1]
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return sum / time.Duration(len(rtts)-1)
+}
+
+// ServerRanking хранит результаты замеров по сетям: в другой сети
+// ближайший сервер может быть другим.
+type ServerRanking struct {
+	prober LatencyProber
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	byNetwork map[string]rankingEntry
+	endToEnd  map[endToEndKey]endToEndEntry
+}
+
+type rankingEntry struct {
+	results    []ServerLatency
+	measuredAt time.Time
+}
+
+// endToEndKey — сервер или цепочка (Profile.ServerID) в сети.
+type endToEndKey struct {
+	network string
+	server  string
+}
+
+type endToEndEntry struct {
+	rtt        time.Duration
+	measuredAt time.Time
+}
+
+// NewServerRanking создаёт кэш замеров. ttl <= 0 означает значение по умолчанию.
+func NewServerRanking(prober LatencyProber, ttl time.Duration) *ServerRanking {
+	if ttl <= 0 {
+		ttl = defaultLatencyCacheTTL
+	}
+	return &ServerRanking{
+		prober:    prober,
+		ttl:       ttl,
+		now:       time.Now,
+		byNetwork: make(map[string]rankingEntry),
+		endToEnd:  make(map[endToEndKey]endToEndEntry),
+	}
+}
+
+// Rank возвращает ранжированные замеры для сети, выполняя их заново, если
+// в кэше нет свежих результатов для всех профилей.
+func (r *ServerRanking) Rank(ctx context.Context, networkID string, profiles []Profile) []ServerLatency {
+	if cached, ok := r.Cached(networkID); ok && coversProfiles(cached, profiles) {
+		return cached
+	}
+	results := r.prober.Measure(ctx, profiles)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ctx.Err() == nil {
+		r.byNetwork[networkID] = rankingEntry{results: results, measuredAt: r.now()}
+	}
+	return r.withEndToEndLocked(networkID, results)
+}
+
+// Cached возвращает свежие результаты для сети без новых замеров.
+func (r *ServerRanking) Cached(networkID string) ([]ServerLatency, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.byNetwork[networkID]
+	if !ok || r.now().Sub(entry.measuredAt) > r.ttl {
+		return nil, false
+	}
+	return r.withEndToEndLocked(networkID, entry.results), true
+}
+
+// Latency возвращает замеры сервера или цепочки p в сети: задержку до
+// транспорта p, если она свежая, и задержку через туннель, если через p
+// подключались.
+func (r *ServerRanking) Latency(networkID string, p Profile) (ServerLatency, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := ServerLatency{Profile: p}
+	found := false
+	if entry, ok := r.byNetwork[networkID]; ok && r.now().Sub(entry.measuredAt) <= r.ttl {
+		for _, l := range entry.results {
+			if TransportKey(l.Profile) == TransportKey(p) {
+				result, found = l, true
+				break
+			}
+		}
+	}
+	if rtt, ok := r.endToEndLocked(networkID, p); ok {
+		result.EndToEnd, found = rtt, true
+	}
+	return result, found
+}
+
+// RecordEndToEnd запоминает время ответа пробы через туннель, поднятый к
+// серверу или цепочке p в сети networkID (см. FollowEndToEnd).
+func (r *ServerRanking) RecordEndToEnd(networkID string, p Profile, rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.endToEnd[endToEndKey{network: networkID, server: p.ServerID()}] = endToEndEntry{rtt: rtt, measuredAt: r.now()}
+	r.mu.Unlock()
+}
+
+func (r *ServerRanking) endToEndLocked(networkID string, p Profile) (time.Duration, bool) {
+	entry, ok := r.endToEnd[endToEndKey{network: networkID, server: p.ServerID()}]
+	if !ok || r.now().Sub(entry.measuredAt) > r.ttl {
+		return 0, false
+	}
+	return entry.rtt, true
+}
+
+// withEndToEndLocked возвращает копию results с задержками через туннель.
+func (r *ServerRanking) withEndToEndLocked(networkID string, results []ServerLatency) []ServerLatency {
+	out := slices.Clone(results)
+	for i := range out {
+		out[i].EndToEnd, _ = r.endToEndLocked(networkID, out[i].Profile)
+	}
+	return out
+}
+
+// Invalidate забывает результаты для сети.
+func (r *ServerRanking) Invalidate(networkID string) {
+	r.mu.Lock()
+	delete(r.byNetwork, networkID)
+	for key := range r.endToEnd {
+		if key.network == networkID {
+			delete(r.endToEnd, key)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// Clear забывает результаты для всех сетей.
+func (r *ServerRanking) Clear() {
+	r.mu.Lock()
+	clear(r.byNetwork)
+	clear(r.endToEnd)
+	r.mu.Unlock()
+}
+
+func coversProfiles(results []ServerLatency, profiles []Profile) bool {
+	measured := make(map[string]bool, len(results))
+	for _, l := range results {
+		measured[TransportKey(l.Profile)] = true
+	}
+	for _, p := range profiles {
+		if !measured[TransportKey(p)] {
+			return false
+		}
+	}
+	return true
+}
+
+// latencyOrder возвращает позицию транспорта в ранжировании;
+// неизмеренные идут после доступных, недоступные — в конце.
+func latencyOrder(results []ServerLatency) func(Profile) int {
+	rank := make(map[string]int, len(results))
+	for i, l := range results {
+		if l.Reachable() {
+			rank[TransportKey(l.Profile)] = i
+		} else {
+			rank[TransportKey(l.Profile)] = 2*len(results) + i
+		}
+	}
+	unknown := len(results)
+	return func(p Profile) int {
+		if i, ok := rank[TransportKey(p)]; ok {
+			return i
+		}
+		return unknown
+	}
+}
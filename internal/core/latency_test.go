@@ -0,0 +1,316 @@
+package core
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// delayTracker считает соединения, одновременно находящиеся в рукопожатии.
+type delayTracker struct {
+	active  atomic.Int32
+	peak    atomic.Int32
+	accepts atomic.Int32
+}
+
+// delayListener задерживает первое чтение каждого соединения, имитируя
+// удалённый сервер: TLS‑рукопожатие заканчивается не раньше delay.
+type delayListener struct {
+	net.Listener
+	delay   time.Duration
+	tracker *delayTracker
+}
+
+func (l delayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.tracker.accepts.Add(1)
+	return &delayConn{Conn: conn, delay: l.delay, tracker: l.tracker}, nil
+}
+
+type delayConn struct {
+	net.Conn
+	delay   time.Duration
+	tracker *delayTracker
+	once    sync.Once
+}
+
+func (c *delayConn) Read(b []byte) (int, error) {
+	c.once.Do(func() {
+		n := c.tracker.active.Add(1)
+		for {
+			peak := c.tracker.peak.Load()
+			if n <= peak || c.tracker.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(c.delay)
+		c.tracker.active.Add(-1)
+	})
+	return c.Conn.Read(b)
+}
+
+// newDelayedTLSStandIn — TLS‑сервер, отвечающий на рукопожатие с задержкой.
+func newDelayedTLSStandIn(t *testing.T, delay time.Duration, tracker *delayTracker, pool *x509.CertPool) standIn {
+	t.Helper()
+	return newDelayedTLSStandInAt(t, "127.0.0.1", delay, tracker, pool)
+}
+
+// newDelayedTLSStandInAt слушает на адресе host: у звеньев цепочки адреса
+// должны различаться.
+func newDelayedTLSStandInAt(t *testing.T, host string, delay time.Duration, tracker *delayTracker, pool *x509.CertPool) standIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.Listener = delayListener{Listener: ln, delay: delay, tracker: tracker}
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	pool.AddCert(srv.Certificate())
+	return standIn{addr: ln.Addr().(*net.TCPAddr), close: srv.Close}
+}
+
+func TestLatencyProber_RanksByHandshakeTime(t *testing.T) {
+	pool := x509.NewCertPool()
+	tracker := &delayTracker{}
+	slow := newDelayedTLSStandIn(t, 150*time.Millisecond, tracker, pool)
+	defer slow.close()
+	fast := newDelayedTLSStandIn(t, 0, tracker, pool)
+	defer fast.close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	refused := ln.Addr().(*net.TCPAddr)
+	_ = ln.Close()
+
+	prober := LatencyProber{RootCAs: pool, Timeout: 2 * time.Second, Samples: 3}
+	results := prober.Measure(context.Background(), []Profile{
+		realityAt(t, refused),
+		realityAt(t, slow.addr),
+		realityAt(t, fast.addr),
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("results = %d, want 3", len(results))
+	}
+	if results[0].Profile.Port != fast.addr.Port || results[1].Profile.Port != slow.addr.Port {
+		t.Fatalf("order = %d, %d, %d", results[0].Profile.Port, results[1].Profile.Port, results[2].Profile.Port)
+	}
+	if results[1].Handshake < 150*time.Millisecond {
+		t.Fatalf("slow handshake = %v, want >= 150ms", results[1].Handshake)
+	}
+	if results[0].Loss != 0 || results[0].Received != 3 {
+		t.Fatalf("fast server: loss %v, received %d", results[0].Loss, results[0].Received)
+	}
+	last := results[2]
+	if last.Reachable() || last.Loss != 1 || last.Failure != FailureRefused {
+		t.Fatalf("refused server = %+v", last)
+	}
+}
+
+func TestLatencyProber_LimitsParallelism(t *testing.T) {
+	pool := x509.NewCertPool()
+	tracker := &delayTracker{}
+	var profiles []Profile
+	for i := 0; i < 5; i++ {
+		s := newDelayedTLSStandIn(t, 80*time.Millisecond, tracker, pool)
+		defer s.close()
+		profiles = append(profiles, realityAt(t, s.addr))
+	}
+
+	prober := LatencyProber{RootCAs: pool, Timeout: 2 * time.Second, Samples: 1, Parallelism: 2}
+	results := prober.Measure(context.Background(), profiles)
+	for _, r := range results {
+		if !r.Reachable() {
+			t.Fatalf("server unreachable: %v", r.LastErr)
+		}
+	}
+	if peak := tracker.peak.Load(); peak > 2 {
+		t.Fatalf("peak concurrent handshakes = %d, want <= 2", peak)
+	}
+}
+
+func TestLatencyProber_TimeoutCountsAsLoss(t *testing.T) {
+	hung := newBlackholeStandIn(t)
+	defer hung.close()
+
+	prober := LatencyProber{Timeout: 50 * time.Millisecond, Samples: 2}
+	results := prober.Measure(context.Background(), []Profile{realityAt(t, hung.addr)})
+	if got := results[0]; got.Loss != 1 || got.Sent != 2 || got.Failure != FailureTimeout {
+		t.Fatalf("result = %+v", got)
+	}
+}
+
+// Следующие серверы цепочки не должны видеть подключений устройства:
+// замеряется только вход.
+func TestLatencyProber_MeasuresOnlyChainEntry(t *testing.T) {
+	pool := x509.NewCertPool()
+	entry := newDelayedTLSStandIn(t, 0, &delayTracker{}, pool)
+	defer entry.close()
+	exitTracker := &delayTracker{}
+	exit := newDelayedTLSStandInAt(t, "127.0.0.2", 0, exitTracker, pool)
+	defer exit.close()
+
+	chain := realityAt(t, entry.addr)
+	chain.Chain = []Profile{realityAt(t, exit.addr)}
+	// На выходе никто не слушает, но вход отвечает: без подключения к
+	// выходу это не видно, и цепочка считается доступной.
+	unreachableExit := realityAt(t, entry.addr)
+	unreachableExit.Chain = []Profile{realityAt(t, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 3), Port: exit.addr.Port})}
+	for _, p := range []Profile{chain, unreachableExit} {
+		if err := p.Validate(); err != nil {
+			t.Fatalf("chain fixture %s: %v", p.ServerID(), err)
+		}
+	}
+
+	prober := LatencyProber{RootCAs: pool, Timeout: 500 * time.Millisecond, Samples: 2}
+	results := prober.Measure(context.Background(), []Profile{chain, unreachableExit, realityAt(t, entry.addr)})
+	if len(results) != 3 {
+		t.Fatalf("results = %d, want 3 (chains measured separately from their entry)", len(results))
+	}
+	for _, got := range results {
+		if !got.Reachable() || got.Sent != 2 || got.EndToEnd != 0 {
+			t.Fatalf("result for %s = %+v, want reachable entry without end-to-end latency", got.Profile.ServerID(), got)
+		}
+	}
+	if n := exitTracker.accepts.Load(); n != 0 {
+		t.Fatalf("exit server got %d direct connections", n)
+	}
+	// Две цепочки и их общий вход — три разных сервера в списке.
+	if got := BestPerServer(results); len(got) != 3 {
+		t.Fatalf("best per server = %d, want 3", len(got))
+	}
+}
+
+func TestServerRanking_EndToEndPerChain(t *testing.T) {
+	pool := x509.NewCertPool()
+	entry := newDelayedTLSStandIn(t, 0, &delayTracker{}, pool)
+	defer entry.close()
+	exit := newDelayedTLSStandInAt(t, "127.0.0.2", 0, &delayTracker{}, pool)
+	defer exit.close()
+	direct := realityAt(t, entry.addr)
+	chain := realityAt(t, entry.addr)
+	chain.Chain = []Profile{realityAt(t, exit.addr)}
+
+	ranking := NewServerRanking(LatencyProber{RootCAs: pool, Timeout: time.Second, Samples: 1}, time.Minute)
+	ranking.RecordEndToEnd("wifi-1", chain, 180*time.Millisecond)
+	ranking.RecordEndToEnd("ethernet", chain, 90*time.Millisecond)
+
+	for _, l := range ranking.Rank(context.Background(), "wifi-1", []Profile{direct, chain}) {
+		want := time.Duration(0)
+		if l.Profile.ServerID() == chain.ServerID() {
+			want = 180 * time.Millisecond
+		}
+		if l.EndToEnd != want || !l.Reachable() {
+			t.Fatalf("%s: end-to-end %v, want %v (entry %v)", l.Profile.ServerID(), l.EndToEnd, want, l.RTT)
+		}
+	}
+	got, ok := ranking.Latency("wifi-1", chain)
+	if !ok || got.EndToEnd != 180*time.Millisecond || got.RTT <= 0 {
+		t.Fatalf("Latency(chain) = %+v, %v; want entry and end-to-end", got, ok)
+	}
+	// В сети без замеров входа известна только задержка через туннель.
+	if got, ok := ranking.Latency("ethernet", chain); !ok || got.EndToEnd != 90*time.Millisecond || got.Reachable() {
+		t.Fatalf("Latency(ethernet) = %+v, %v", got, ok)
+	}
+
+	ranking.Invalidate("wifi-1")
+	if got, ok := ranking.Latency("wifi-1", chain); ok {
+		t.Fatalf("invalidated network still has %+v", got)
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	if got := medianDuration([]time.Duration{30 * ms, 10 * ms, 20 * ms}); got != 20*ms {
+		t.Fatalf("median = %v", got)
+	}
+	if got := medianDuration([]time.Duration{10 * ms, 20 * ms}); got != 15*ms {
+		t.Fatalf("even median = %v", got)
+	}
+	if got := jitter([]time.Duration{10 * ms, 30 * ms, 20 * ms}); got != 15*ms {
+		t.Fatalf("jitter = %v", got)
+	}
+
+	results := []ServerLatency{
+		{Profile: Profile{Address: "a"}, RTT: 10 * ms, Loss: 0.5, Sent: 2, Received: 1},
+		{Profile: Profile{Address: "b"}, Loss: 1, Sent: 2},
+		{Profile: Profile{Address: "c"}, RTT: 40 * ms, Sent: 2, Received: 2},
+		{Profile: Profile{Address: "d"}, RTT: 20 * ms, Sent: 2, Received: 2},
+	}
+	RankLatencies(results)
+	var order string
+	for _, r := range results {
+		order += r.Profile.Address
+	}
+	if order != "dcab" {
+		t.Fatalf("rank order = %q, want dcab", order)
+	}
+}
+
+func TestServerRanking_CachesPerNetwork(t *testing.T) {
+	pool := x509.NewCertPool()
+	tracker := &delayTracker{}
+	srv := newDelayedTLSStandIn(t, 0, tracker, pool)
+	defer srv.close()
+	profiles := []Profile{realityAt(t, srv.addr)}
+
+	ranking := NewServerRanking(LatencyProber{RootCAs: pool, Timeout: time.Second, Samples: 1}, time.Minute)
+	ranking.Rank(context.Background(), "wifi-1", profiles)
+	ranking.Rank(context.Background(), "wifi-1", profiles)
+	if got := tracker.accepts.Load(); got != 1 {
+		t.Fatalf("accepts = %d, want 1 (second call cached)", got)
+	}
+
+	ranking.Rank(context.Background(), "ethernet", profiles)
+	if got := tracker.accepts.Load(); got != 2 {
+		t.Fatalf("accepts = %d, want 2 (new network measured)", got)
+	}
+
+	ranking.Invalidate("wifi-1")
+	if _, ok := ranking.Cached("wifi-1"); ok {
+		t.Fatal("invalidated network still cached")
+	}
+	ranking.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, ok := ranking.Cached("ethernet"); ok {
+		t.Fatal("expired results still cached")
+	}
+}
+
+func TestAutoStrategy_PrefersNearestServer(t *testing.T) {
+	pool := x509.NewCertPool()
+	tracker := &delayTracker{}
+	slow := newDelayedTLSStandIn(t, 150*time.Millisecond, tracker, pool)
+	defer slow.close()
+	fast := newDelayedTLSStandIn(t, 0, tracker, pool)
+	defer fast.close()
+
+	candidates := []Profile{realityAt(t, slow.addr), realityAt(t, fast.addr)}
+	ranking := NewServerRanking(LatencyProber{RootCAs: pool, Timeout: 2 * time.Second, Samples: 1}, 0)
+	ranking.Rank(context.Background(), "", candidates)
+
+	auto := NewAutoStrategy(HandshakeProber{RootCAs: pool, Timeout: 2 * time.Second}, time.Second)
+	auto.SetServerRanking(ranking)
+	result, err := auto.Race(context.Background(), "", candidates)
+	if err != nil {
+		t.Fatalf("Race: %v", err)
+	}
+	if result.Winner.Port != fast.addr.Port || result.Attempts[0].Profile.Port != fast.addr.Port {
+		t.Fatalf("winner = %s, want nearest server first", result.Winner)
+	}
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// Адреса проверки утечек по умолчанию.
+const (
+	// DefaultLeakEgressURL отвечает адресом клиента в теле ответа.
+	DefaultLeakEgressURL = "https://leaktest.voltavpn.com/ip"
+	// DefaultLeakEgressV6URL — то же, но доступен только по IPv6.
+	DefaultLeakEgressV6URL = "https://ipv6.leaktest.voltavpn.com/ip"
+	// DefaultLeakDNSZone обслуживает авторитетный сервер, который
+	// запоминает, какие резолверы спрашивали имена в зоне.
+	DefaultLeakDNSZone = "dns.leaktest.voltavpn.com"
+	// DefaultLeakDNSReportURL отдаёт резолверы, спросившие метку:
+	// GET ?name=<метка> → {"resolvers": ["192.0.2.1", ...]}.
+	DefaultLeakDNSReportURL = "https://leaktest.voltavpn.com/dns"
+
+	defaultLeakTestTimeout = 10 * time.Second
+	// leakReplyLimit — ответ адреса больше этого считается ошибкой сервера.
+	leakReplyLimit = 4 << 10
+)
+
+var (
+	ErrLeakPathUnavailable = errors.New("leak test path is not configured")
+	ErrLeakProbeUnanswered = errors.New("no resolver asked for the probe name")
+)
+
+// LeakVerdict — итог одной проверки утечек.
+type LeakVerdict string
+
+const (
+	// LeakUnknown — проверка не удалась или сравнить не с чем.
+	LeakUnknown  LeakVerdict = "unknown"
+	LeakNone     LeakVerdict = "none"
+	LeakDetected LeakVerdict = "detected"
+)
+
+// LeakTestEndpoints — адреса серверов проверки. Пустые поля заменяются
+// адресами по умолчанию.
+type LeakTestEndpoints struct {
+	EgressURL    string
+	EgressV6URL  string
+	DNSZone      string
+	DNSReportURL string
+}
+
+// LeakPath — путь, которым проверка выходит в сеть: как обычные
+// приложения (через туннель) или в обход него.
+type LeakPath struct {
+	HTTP     *http.Client
+	Resolver *net.Resolver
+}
+
+func (p LeakPath) usable() bool {
+	return p.HTTP != nil
+}
+
+func (p LeakPath) resolver() *net.Resolver {
+	if p.Resolver != nil {
+		return p.Resolver
+	}
+	return net.DefaultResolver
+}
+
+// LeakReport — результат LeakTester.Run. Err‑поля объясняют LeakUnknown.
+type LeakReport struct {
+	// TunnelIP и DirectIP — внешний адрес через туннель и в обход него.
+	TunnelIP, DirectIP netip.Addr
+	IP                 LeakVerdict
+	IPErr              error
+
+	// Resolvers спрашивали пробное имя, разрешённое как у приложений;
+	// DirectResolvers — имя, разрешённое в обход туннеля. LeakedResolvers
+	// встречаются в обоих списках: DNS уходит мимо туннеля.
+	Resolvers, DirectResolvers, LeakedResolvers []netip.Addr
+	DNS                                         LeakVerdict
+	DNSErr                                      error
+
+	// TunnelIPv6 — адрес, с которым приложения выходят в сеть по IPv6;
+	// пустой, если IPv6 недоступен. DirectIPv6 — адрес IPv6 без туннеля.
+	TunnelIPv6, DirectIPv6 netip.Addr
+	IPv6                   LeakVerdict
+	IPv6Err                error
+	// IPv6Policy — политика IPv6, при которой шла проверка.
+	IPv6Policy settings.IPv6Policy
+}
+
+// IPv6Blocked сообщает, что IPv6 заблокирован политикой и приложения
+// действительно не выходят по нему в сеть.
+func (r LeakReport) IPv6Blocked() bool {
+	return r.IPv6Policy == settings.IPv6Block && r.IPv6 == LeakNone && !r.TunnelIPv6.IsValid()
+}
+
+// Leaking сообщает, что хотя бы одна проверка нашла утечку. IPv6 мимо
+// туннеля при политике IPv6Allow утечкой не считается: пользователь
+// разрешил его сам.
+func (r LeakReport) Leaking() bool {
+	ipv6 := r.IPv6 == LeakDetected && r.IPv6Policy != settings.IPv6Allow
+	return r.IP == LeakDetected || r.DNS == LeakDetected || ipv6
+}
+
+// LeakTester проверяет, что адрес, DNS и IPv6 не уходят мимо туннеля.
+// Каждая проверка выполняется дважды — путём Tunnel и путём Direct — и
+// сравнивает результаты; без Direct утечку определить нельзя, и вердикт
+// остаётся LeakUnknown.
+type LeakTester struct {
+	Endpoints LeakTestEndpoints
+	Tunnel    LeakPath
+	Direct    LeakPath
+	Timeout   time.Duration
+	// IPv6Policy переносится в отчёт: от неё зависит, как читать
+	// результат проверки IPv6.
+	IPv6Policy settings.IPv6Policy
+}
+
+// Run выполняет три проверки параллельно.
+func (t LeakTester) Run(ctx context.Context) LeakReport {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = defaultLeakTestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := LeakReport{IPv6Policy: t.IPv6Policy}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		t.checkIP(ctx, &report)
+	}()
+	go func() {
+		defer wg.Done()
+		t.checkDNS(ctx, &report)
+	}()
+	go func() {
+		defer wg.Done()
+		t.checkIPv6(ctx, &report)
+	}()
+	wg.Wait()
+	return report
+}
+
+func (t LeakTester) endpoints() LeakTestEndpoints {
+	e := t.Endpoints
+	if e.EgressURL == "" {
+		e.EgressURL = DefaultLeakEgressURL
+	}
+	if e.EgressV6URL == "" {
+		e.EgressV6URL = DefaultLeakEgressV6URL
+	}
+	if e.DNSZone == "" {
+		e.DNSZone = DefaultLeakDNSZone
+	}
+	if e.DNSReportURL == "" {
+		e.DNSReportURL = DefaultLeakDNSReportURL
+	}
+	return e
+}
+
+func (t LeakTester) checkIP(ctx context.Context, report *LeakReport) {
+	report.IP = LeakUnknown
+	egressURL := t.endpoints().EgressURL
+	tunnelIP, err := t.egress(ctx, t.Tunnel, egressURL)
+	if err != nil {
+		report.IPErr = err
+		return
+	}
+	report.TunnelIP = tunnelIP
+	directIP, err := t.egress(ctx, t.Direct, egressURL)
+	if err != nil {
+		report.IPErr = err
+		return
+	}
+	report.DirectIP = directIP
+	report.IP = LeakNone
+	if tunnelIP == directIP {
+		report.IP = LeakDetected
+	}
+}
+
+// checkIPv6 ищет выход по IPv6 мимо туннеля. Если приложения не могут
+// выйти по IPv6 вовсе, утечки нет: IPv6 заблокирован или его нет в сети.
+func (t LeakTester) checkIPv6(ctx context.Context, report *LeakReport) {
+	report.IPv6 = LeakUnknown
+	egressURL := t.endpoints().EgressV6URL
+	tunnelIP, err := t.egress(ctx, t.Tunnel, egressURL)
+	switch {
+	case errors.Is(err, ErrLeakPathUnavailable) || ctx.Err() != nil:
+		report.IPv6Err = err
+		return
+	case err != nil:
+		report.IPv6 = LeakNone
+		return
+	}
+	report.TunnelIPv6 = tunnelIP
+	directIP, err := t.egress(ctx, t.Direct, egressURL)
+	if err != nil {
+		report.IPv6Err = err
+		return
+	}
+	report.DirectIPv6 = directIP
+	report.IPv6 = LeakNone
+	if tunnelIP == directIP {
+		report.IPv6 = LeakDetected
+	}
+}
+
+func (t LeakTester) checkDNS(ctx context.Context, report *LeakReport) {
+	report.DNS = LeakUnknown
+	resolvers, err := t.probeResolvers(ctx, t.Tunnel)
+	if err != nil {
+		report.DNSErr = err
+		return
+	}
+	report.Resolvers = resolvers
+	direct, err := t.probeResolvers(ctx, t.Direct)
+	if err != nil {
+		report.DNSErr = err
+		return
+	}
+	report.DirectResolvers = direct
+	for _, addr := range resolvers {
+		if slices.Contains(direct, addr) {
+			report.LeakedResolvers = append(report.LeakedResolvers, addr)
+		}
+	}
+	report.DNS = LeakNone
+	if len(report.LeakedResolvers) > 0 {
+		report.DNS = LeakDetected
+	}
+}
+
+// egress запрашивает внешний адрес, под которым path виден серверу.
+func (t LeakTester) egress(ctx context.Context, path LeakPath, rawURL string) (netip.Addr, error) {
+	if !path.usable() {
+		return netip.Addr{}, ErrLeakPathUnavailable
+	}
+	body, err := leakGet(ctx, path.HTTP, rawURL)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("egress reply: %w", err)
+	}
+	return addr.Unmap(), nil
+}
+
+// probeResolvers разрешает уникальное имя в зоне проверки резолвером path
+// и спрашивает у сервера проверки, какие резолверы за ним приходили.
+func (t LeakTester) probeResolvers(ctx context.Context, path LeakPath) ([]netip.Addr, error) {
+	if !path.usable() {
+		return nil, ErrLeakPathUnavailable
+	}
+	e := t.endpoints()
+	label, err := leakProbeLabel()
+	if err != nil {
+		return nil, err
+	}
+	// Ответ не важен: сервер запоминает вопрос, даже если имени нет.
+	_, _ = path.resolver().LookupHost(ctx, label+"."+strings.TrimSuffix(e.DNSZone, "."))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(e.DNSReportURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("name", label)
+	u.RawQuery = q.Encode()
+	body, err := leakGet(ctx, path.HTTP, u.String())
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Resolvers []string `json:"resolvers"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("resolver report: %w", err)
+	}
+	var out []netip.Addr
+	for _, raw := range reply.Resolvers {
+		addr, err := netip.ParseAddr(raw)
+		if err != nil {
+			return nil, fmt.Errorf("resolver report: %w", err)
+		}
+		// Резолвер спрашивает имя и для A, и для AAAA.
+		if addr = addr.Unmap(); !slices.Contains(out, addr) {
+			out = append(out, addr)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrLeakProbeUnanswered
+	}
+	return out, nil
+}
+
+func leakGet(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", req.URL.Host, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, leakReplyLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > leakReplyLimit {
+		return nil, fmt.Errorf("%s: reply too large", req.URL.Host)
+	}
+	return body, nil
+}
+
+// leakProbeLabel — случайная метка DNS: кэш резолвера не ответит на неё
+// вместо авторитетного сервера.
+func leakProbeLabel() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "lt-" + hex.EncodeToString(b), nil
+}
+
+// DirectLeakPath — путь в обход туннеля через dialer; для TUN нужен
+// Dialer, привязанный к физическому интерфейсу. Имена тоже разрешаются
+// в обход туннеля.
+func DirectLeakPath(dialer *net.Dialer) LeakPath {
+	resolver := &net.Resolver{PreferGo: true, Dial: dialer.DialContext}
+	resolving := *dialer
+	resolving.Resolver = resolver
+	return LeakPath{
+		HTTP:     probeHTTPClient(resolving.DialContext, nil),
+		Resolver: resolver,
+	}
+}
+
+// TunnelLeakPath — путь, которым ходят приложения при параметрах opts.
+// dnsAddr — адрес DNS‑заглушки; пустой — системный резолвер.
+func TunnelLeakPath(opts EngineOptions, dnsAddr string) LeakPath {
+	path := LeakPath{HTTP: TunnelHTTPClient(opts)}
+	if dnsAddr != "" {
+		var dialer net.Dialer
+		path.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, dnsAddr)
+			},
+		}
+	}
+	return path
+}
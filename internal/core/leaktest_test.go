@@ -0,0 +1,272 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// leakStandIn заменяет серверы проверки: эхо адреса клиента по IPv4 и
+// IPv6 и авторитетный DNS, который запоминает, с каких адресов спрашивали
+// пробные имена. Пути проверки различаются адресом источника: «туннель»
+// выходит с 127.0.0.1, «без туннеля» — с 127.0.0.2.
+type leakStandIn struct {
+	endpoints LeakTestEndpoints
+	dnsAddr   string
+
+	mu   sync.Mutex
+	seen map[string][]string
+}
+
+const leakTestZone = "leak.test"
+
+func newLeakStandIn(t *testing.T) *leakStandIn {
+	t.Helper()
+	s := &leakStandIn{seen: make(map[string][]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ip", func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		_, _ = w.Write([]byte(host + "\n"))
+	})
+	mux.HandleFunc("/dns", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		resolvers := append([]string{}, s.seen[r.URL.Query().Get("name")]...)
+		s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string][]string{"resolvers": resolvers})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ln6, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	srv6 := httptest.NewUnstartedServer(mux)
+	srv6.Listener = ln6
+	srv6.Start()
+	t.Cleanup(srv6.Close)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+	go s.serveDNS(pc)
+
+	s.dnsAddr = pc.LocalAddr().String()
+	s.endpoints = LeakTestEndpoints{
+		EgressURL:    srv.URL + "/ip",
+		EgressV6URL:  srv6.URL + "/ip",
+		DNSZone:      leakTestZone,
+		DNSReportURL: srv.URL + "/dns",
+	}
+	return s
+}
+
+// serveDNS отвечает NXDOMAIN и запоминает, кто спрашивал метку.
+func (s *leakStandIn) serveDNS(pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+		name := msg.Questions[0].Name.String()
+		if label, ok := strings.CutSuffix(name, "."+leakTestZone+"."); ok {
+			host, _, _ := net.SplitHostPort(from.String())
+			s.mu.Lock()
+			s.seen[label] = append(s.seen[label], host)
+			s.mu.Unlock()
+		}
+		msg.Header.Response = true
+		msg.Header.RCode = dnsmessage.RCodeNameError
+		out, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+		_, _ = pc.WriteTo(out, from)
+	}
+}
+
+// pathFrom — путь проверки с адресом источника source. На адреса IPv6
+// такой путь не выходит, как туннель без IPv6.
+func (s *leakStandIn) pathFrom(source string) LeakPath {
+	ip := net.ParseIP(source)
+	tcp := &net.Dialer{LocalAddr: &net.TCPAddr{IP: ip}}
+	udp := &net.Dialer{LocalAddr: &net.UDPAddr{IP: ip}}
+	return LeakPath{
+		HTTP: probeHTTPClient(tcp.DialContext, nil),
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return udp.DialContext(ctx, "udp", s.dnsAddr)
+			},
+		},
+	}
+}
+
+// unboundPath — путь без привязки источника: выходит и по IPv6.
+func (s *leakStandIn) unboundPath() LeakPath {
+	var d net.Dialer
+	return LeakPath{
+		HTTP: probeHTTPClient(d.DialContext, nil),
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "udp", s.dnsAddr)
+			},
+		},
+	}
+}
+
+func TestLeakTester_NoLeaks(t *testing.T) {
+	s := newLeakStandIn(t)
+	report := LeakTester{
+		Endpoints: s.endpoints,
+		Tunnel:    s.pathFrom("127.0.0.1"),
+		Direct:    s.pathFrom("127.0.0.2"),
+		Timeout:   5 * time.Second,
+	}.Run(context.Background())
+
+	if report.IP != LeakNone || report.TunnelIP != netip.MustParseAddr("127.0.0.1") || report.DirectIP != netip.MustParseAddr("127.0.0.2") {
+		t.Fatalf("IP = %s (%s vs %s), %v", report.IP, report.TunnelIP, report.DirectIP, report.IPErr)
+	}
+	if report.DNS != LeakNone || len(report.Resolvers) != 1 || report.Resolvers[0] != netip.MustParseAddr("127.0.0.1") {
+		t.Fatalf("DNS = %s, resolvers %v, %v", report.DNS, report.Resolvers, report.DNSErr)
+	}
+	if report.IPv6 != LeakNone || report.TunnelIPv6.IsValid() {
+		t.Fatalf("IPv6 = %s (%s), %v", report.IPv6, report.TunnelIPv6, report.IPv6Err)
+	}
+	if report.Leaking() {
+		t.Fatal("Leaking = true")
+	}
+}
+
+func TestLeakTester_DetectsLeaks(t *testing.T) {
+	s := newLeakStandIn(t)
+	// Приложения ходят тем же путём, что и без туннеля.
+	report := LeakTester{
+		Endpoints: s.endpoints,
+		Tunnel:    s.unboundPath(),
+		Direct:    s.unboundPath(),
+		Timeout:   5 * time.Second,
+	}.Run(context.Background())
+
+	if report.IP != LeakDetected {
+		t.Fatalf("IP = %s (%s vs %s), %v", report.IP, report.TunnelIP, report.DirectIP, report.IPErr)
+	}
+	if report.DNS != LeakDetected || len(report.LeakedResolvers) != 1 {
+		t.Fatalf("DNS = %s, leaked %v, %v", report.DNS, report.LeakedResolvers, report.DNSErr)
+	}
+	if report.IPv6 != LeakDetected || report.TunnelIPv6 != netip.IPv6Loopback() {
+		t.Fatalf("IPv6 = %s (%s), %v", report.IPv6, report.TunnelIPv6, report.IPv6Err)
+	}
+	if !report.Leaking() {
+		t.Fatal("Leaking = false")
+	}
+}
+
+func TestLeakTester_IPv6BypassingIPv4Tunnel(t *testing.T) {
+	s := newLeakStandIn(t)
+	tunnel := s.unboundPath()
+	tunnel.Resolver = s.pathFrom("127.0.0.1").Resolver
+	report := LeakTester{
+		Endpoints: s.endpoints,
+		Tunnel:    tunnel,
+		Direct:    s.pathFrom("127.0.0.2"),
+		Timeout:   5 * time.Second,
+	}.Run(context.Background())
+
+	if report.IP != LeakNone || report.DNS != LeakNone {
+		t.Fatalf("IP = %s, DNS = %s", report.IP, report.DNS)
+	}
+	// Путь «без туннеля» по IPv6 не выходит: сравнить не с чем.
+	if report.IPv6 != LeakUnknown || report.TunnelIPv6 != netip.IPv6Loopback() || report.IPv6Err == nil {
+		t.Fatalf("IPv6 = %s (%s), %v", report.IPv6, report.TunnelIPv6, report.IPv6Err)
+	}
+}
+
+func TestLeakTester_IPv6Policy(t *testing.T) {
+	s := newLeakStandIn(t)
+	// Путь «без туннеля» выходит и по IPv4 с тем же адресом; вердикты
+	// IPv4 и DNS здесь не проверяются, Leaking считается только по IPv6.
+	run := func(policy settings.IPv6Policy, tunnel LeakPath) LeakReport {
+		report := LeakTester{
+			Endpoints:  s.endpoints,
+			Tunnel:     tunnel,
+			Direct:     s.unboundPath(),
+			Timeout:    5 * time.Second,
+			IPv6Policy: policy,
+		}.Run(context.Background())
+		report.IP, report.DNS = LeakNone, LeakNone
+		return report
+	}
+	// «Туннель» без IPv6 — как при политике блокировки.
+	blocked := s.pathFrom("127.0.0.1")
+	bypassing := s.unboundPath()
+
+	if report := run(settings.IPv6Block, blocked); !report.IPv6Blocked() || report.Leaking() {
+		t.Fatalf("block: IPv6 = %s, blocked %v, leaking %v", report.IPv6, report.IPv6Blocked(), report.Leaking())
+	}
+	if report := run(settings.IPv6Tunnel, blocked); report.IPv6Blocked() || report.IPv6 != LeakNone {
+		t.Fatalf("tunnel without IPv6: IPv6 = %s, blocked %v", report.IPv6, report.IPv6Blocked())
+	}
+	if report := run(settings.IPv6Allow, bypassing); report.IPv6 != LeakDetected || report.IPv6Policy != settings.IPv6Allow || report.Leaking() {
+		t.Fatalf("allow: IPv6 = %s, policy %s, leaking %v", report.IPv6, report.IPv6Policy, report.Leaking())
+	}
+	if report := run(settings.IPv6Block, bypassing); !report.Leaking() || report.IPv6Blocked() {
+		t.Fatalf("block not enforced: IPv6 = %s, leaking %v", report.IPv6, report.Leaking())
+	}
+}
+
+func TestLeakTester_WithoutDirectPathIsUnknown(t *testing.T) {
+	s := newLeakStandIn(t)
+	report := LeakTester{
+		Endpoints: s.endpoints,
+		Tunnel:    s.pathFrom("127.0.0.1"),
+		Timeout:   5 * time.Second,
+	}.Run(context.Background())
+
+	if report.IP != LeakUnknown || !errors.Is(report.IPErr, ErrLeakPathUnavailable) || !report.TunnelIP.IsValid() {
+		t.Fatalf("IP = %s (%s), %v", report.IP, report.TunnelIP, report.IPErr)
+	}
+	if report.DNS != LeakUnknown || len(report.Resolvers) != 1 {
+		t.Fatalf("DNS = %s, resolvers %v, %v", report.DNS, report.Resolvers, report.DNSErr)
+	}
+}
+
+func TestLeakTester_UnreachableProbeIsUnknown(t *testing.T) {
+	s := newLeakStandIn(t)
+	s.endpoints.EgressURL = "http://" + closedAddr(t, "tcp") + "/ip"
+	s.endpoints.DNSZone = "elsewhere.test"
+	report := LeakTester{
+		Endpoints: s.endpoints,
+		Tunnel:    s.pathFrom("127.0.0.1"),
+		Direct:    s.pathFrom("127.0.0.2"),
+		Timeout:   5 * time.Second,
+	}.Run(context.Background())
+
+	if report.IP != LeakUnknown || report.IPErr == nil {
+		t.Fatalf("IP = %s, %v", report.IP, report.IPErr)
+	}
+	if report.DNS != LeakUnknown || !errors.Is(report.DNSErr, ErrLeakProbeUnanswered) {
+		t.Fatalf("DNS = %s, %v", report.DNS, report.DNSErr)
+	}
+}
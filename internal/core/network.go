@@ -0,0 +1,216 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNetworkDebounce = 2 * time.Second
+	// resumeCheckInterval — как часто сверяются настенные часы с
+	// монотонными: во время сна монотонные стоят.
+	resumeCheckInterval = 5 * time.Second
+	// resumeThreshold — расхождение часов, после которого считаем,
+	// что устройство спало.
+	resumeThreshold = 10 * time.Second
+)
+
+var ErrNetworkMonitorUnsupported = errors.New("network monitor is not supported on this platform")
+
+// NetworkEventSource — источник сырых уведомлений ОС об изменениях
+// маршрутов, адресов и интерфейсов.
+type NetworkEventSource interface {
+	// Events получает значение на каждое уведомление; закрывается
+	// вместе с источником.
+	Events() <-chan struct{}
+	// Fingerprint возвращает отпечаток маршрута по умолчанию: одинаковый
+	// в одной сети и разный в разных. Пустая строка — маршрута нет.
+	Fingerprint() (string, error)
+	Close() error
+}
+
+// NetworkChange — событие смены сети.
+type NetworkChange struct {
+	Fingerprint string
+	Previous    string
+	// Resumed — устройство проснулось; сеть могла остаться прежней,
+	// но соединения туннеля после сна обычно мертвы.
+	Resumed bool
+	At      time.Time
+}
+
+// NetworkMonitor собирает уведомления источника в пачки (debounce) и
+// сообщает о смене сети, только если изменился отпечаток маршрута по
+// умолчанию или устройство проснулось.
+type NetworkMonitor struct {
+	source   NetworkEventSource
+	debounce time.Duration
+	// wall и uptime — настенные и монотонные часы; в тестах подменяются.
+	wall   func() time.Time
+	uptime func() time.Duration
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex
+	fingerprint string
+	lastWall    time.Time
+	lastUptime  time.Duration
+
+	updates broadcaster[NetworkChange]
+}
+
+// NewNetworkMonitor запускает монитор. debounce <= 0 означает значение по
+// умолчанию. Close останавливает монитор и закрывает источник.
+func NewNetworkMonitor(source NetworkEventSource, debounce time.Duration) *NetworkMonitor {
+	if debounce <= 0 {
+		debounce = defaultNetworkDebounce
+	}
+	started := time.Now()
+	m := &NetworkMonitor{
+		source:   source,
+		debounce: debounce,
+		wall:     func() time.Time { return time.Now().Round(0) },
+		uptime:   func() time.Duration { return time.Since(started) },
+		done:     make(chan struct{}),
+	}
+	m.fingerprint, _ = source.Fingerprint()
+	m.lastWall, m.lastUptime = m.wall(), m.uptime()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run()
+	}()
+	return m
+}
+
+// Fingerprint возвращает отпечаток текущей сети.
+func (m *NetworkMonitor) Fingerprint() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fingerprint
+}
+
+// Subscribe подписывает на смены сети.
+func (m *NetworkMonitor) Subscribe() (<-chan NetworkChange, func()) {
+	return m.updates.subscribe()
+}
+
+// Close останавливает монитор.
+func (m *NetworkMonitor) Close() error {
+	var err error
+	m.stopOnce.Do(func() {
+		close(m.done)
+		err = m.source.Close()
+	})
+	m.wg.Wait()
+	return err
+}
+
+func (m *NetworkMonitor) run() {
+	events := m.source.Events()
+	ticker := time.NewTicker(resumeCheckInterval)
+	defer ticker.Stop()
+
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			// Переключение сети порождает десятки уведомлений: оцениваем
+			// итог, когда они утихнут.
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(m.debounce)
+			timerC = timer.C
+		case <-timerC:
+			timer, timerC = nil, nil
+			m.evaluate(false)
+		case <-ticker.C:
+			if m.checkResume() {
+				m.evaluate(true)
+			}
+		}
+	}
+}
+
+// evaluate сравнивает отпечаток с последним известным и сообщает о смене.
+func (m *NetworkMonitor) evaluate(resumed bool) {
+	fingerprint, err := m.source.Fingerprint()
+	if err != nil {
+		// Таблица маршрутов недоступна: судить о смене сети не по чему.
+		return
+	}
+	m.mu.Lock()
+	previous := m.fingerprint
+	m.fingerprint = fingerprint
+	m.mu.Unlock()
+	if fingerprint == previous && !resumed {
+		return
+	}
+	m.updates.publish(NetworkChange{
+		Fingerprint: fingerprint,
+		Previous:    previous,
+		Resumed:     resumed,
+		At:          m.wall(),
+	})
+}
+
+// checkResume сообщает, что с прошлой проверки настенные часы ушли
+// заметно дальше монотонных, то есть устройство спало.
+func (m *NetworkMonitor) checkResume() bool {
+	wall, uptime := m.wall(), m.uptime()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	slept := wall.Sub(m.lastWall) - (uptime - m.lastUptime)
+	m.lastWall, m.lastUptime = wall, uptime
+	return slept > resumeThreshold
+}
+
+// FollowNetwork направляет смены сети тем, кто от неё зависит: стратегия
+// Auto запоминает транспорты по отпечатку сети, замеры задержек после сна
+// устаревают, а супервизор переподключает туннель. Возвращает функцию,
+// которая прекращает слежение.
+func FollowNetwork(m *NetworkMonitor, supervisor *Supervisor, auto *AutoStrategy, ranking *ServerRanking) func() {
+	changes, unsubscribe := m.Subscribe()
+	if auto != nil {
+		auto.SetNetworkID(m.Fingerprint())
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for change := range changes {
+			if auto != nil {
+				auto.SetNetworkID(change.Fingerprint)
+			}
+			if ranking != nil && change.Resumed {
+				ranking.Invalidate(change.Fingerprint)
+			}
+			// Без маршрута по умолчанию переподключаться некуда: ждём
+			// следующей смены.
+			if supervisor != nil && change.Fingerprint != "" {
+				supervisor.NotifyNetworkChanged()
+			}
+		}
+	}()
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
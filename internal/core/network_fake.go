@@ -0,0 +1,55 @@
+package core
+
+import "sync"
+
+// FakeNetworkSource — NetworkEventSource для тестов: уведомления и
+// отпечаток сети задаются из теста.
+type FakeNetworkSource struct {
+	events    chan struct{}
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	fingerprint string
+	err         error
+}
+
+func NewFakeNetworkSource(fingerprint string) *FakeNetworkSource {
+	return &FakeNetworkSource{events: make(chan struct{}, 64), fingerprint: fingerprint}
+}
+
+// Emit отправляет сырое уведомление, как будто изменился маршрут,
+// адрес или интерфейс.
+func (f *FakeNetworkSource) Emit() {
+	f.events <- struct{}{}
+}
+
+// SetFingerprint задаёт отпечаток, который увидит следующая проверка.
+func (f *FakeNetworkSource) SetFingerprint(fingerprint string) {
+	f.mu.Lock()
+	f.fingerprint = fingerprint
+	f.mu.Unlock()
+}
+
+// SetError заставляет Fingerprint возвращать err; nil снимает ошибку.
+func (f *FakeNetworkSource) SetError(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+func (f *FakeNetworkSource) Events() <-chan struct{} {
+	return f.events
+}
+
+func (f *FakeNetworkSource) Fingerprint() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fingerprint, f.err
+}
+
+func (f *FakeNetworkSource) Close() error {
+	f.closeOnce.Do(func() { close(f.events) })
+	return nil
+}
+
+var _ NetworkEventSource = (*FakeNetworkSource)(nil)
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func nextChange(t *testing.T, ch <-chan NetworkChange) NetworkChange {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("no network change")
+		return NetworkChange{}
+	}
+}
+
+func noChange(t *testing.T, ch <-chan NetworkChange, wait time.Duration) {
+	t.Helper()
+	select {
+	case c := <-ch:
+		t.Fatalf("unexpected change: %+v", c)
+	case <-time.After(wait):
+	}
+}
+
+func TestNetworkMonitor_DebouncesBurstIntoOneChange(t *testing.T) {
+	source := NewFakeNetworkSource("wifi")
+	monitor := NewNetworkMonitor(source, 20*time.Millisecond)
+	defer monitor.Close()
+	changes, unsubscribe := monitor.Subscribe()
+	defer unsubscribe()
+
+	// Переход с Wi‑Fi на Ethernet: интерфейс, адрес и маршрут меняются
+	// несколькими уведомлениями подряд.
+	source.Emit()
+	source.SetFingerprint("")
+	source.Emit()
+	source.SetFingerprint("ethernet")
+	source.Emit()
+	source.Emit()
+
+	c := nextChange(t, changes)
+	if c.Previous != "wifi" || c.Fingerprint != "ethernet" || c.Resumed {
+		t.Fatalf("change = %+v", c)
+	}
+	noChange(t, changes, 60*time.Millisecond)
+	if got := monitor.Fingerprint(); got != "ethernet" {
+		t.Fatalf("Fingerprint = %q", got)
+	}
+}
+
+func TestNetworkMonitor_IgnoresEventsWithSameDefaultRoute(t *testing.T) {
+	source := NewFakeNetworkSource("wifi")
+	monitor := NewNetworkMonitor(source, 10*time.Millisecond)
+	defer monitor.Close()
+	changes, unsubscribe := monitor.Subscribe()
+	defer unsubscribe()
+
+	// Например, поднялся интерфейс самого туннеля.
+	source.Emit()
+	noChange(t, changes, 60*time.Millisecond)
+
+	// Ошибка чтения маршрутов не считается сменой сети.
+	source.SetError(errors.New("netlink busy"))
+	source.SetFingerprint("ethernet")
+	source.Emit()
+	noChange(t, changes, 60*time.Millisecond)
+}
+
+func TestNetworkMonitor_DetectsResumeFromClocks(t *testing.T) {
+	wall := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var uptime time.Duration
+	m := &NetworkMonitor{
+		wall:     func() time.Time { return wall },
+		uptime:   func() time.Duration { return uptime },
+		lastWall: wall,
+	}
+
+	wall, uptime = wall.Add(resumeCheckInterval), uptime+resumeCheckInterval
+	if m.checkResume() {
+		t.Fatal("regular tick detected as resume")
+	}
+	// Час сна: настенные часы ушли вперёд, монотонные — на один тик.
+	wall, uptime = wall.Add(time.Hour), uptime+resumeCheckInterval
+	if !m.checkResume() {
+		t.Fatal("sleep not detected")
+	}
+}
+
+func TestFollowNetwork_ReconnectsAndTracksNetworkID(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	sup := NewSupervisor(conn, testPolicy(time.Hour, 5))
+	defer sup.Close()
+	auto := NewAutoStrategy(HandshakeProber{}, 0)
+
+	source := NewFakeNetworkSource("wifi")
+	monitor := NewNetworkMonitor(source, 10*time.Millisecond)
+	defer monitor.Close()
+	stop := FollowNetwork(monitor, sup, auto, nil)
+	defer stop()
+	if got := auto.NetworkID(); got != "wifi" {
+		t.Fatalf("NetworkID = %q, want wifi", got)
+	}
+
+	connectForTest(t, conn)
+	source.SetFingerprint("ethernet")
+	source.Emit()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(engine.Starts()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel was not reconnected after network change")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waitState(t, conn, StateConnected)
+	if got := auto.NetworkID(); got != "ethernet" {
+		t.Fatalf("NetworkID = %q, want ethernet", got)
+	}
+}
@@ -0,0 +1,385 @@
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// Значения Profile.Security.
+const (
+	SecurityReality = "reality"
+	SecurityTLS     = "tls"
+)
+
+// Значения Profile.Network.
+const (
+	NetworkTCP  = "tcp"
+	NetworkGRPC = "grpc"
+	NetworkWS   = "ws"
+)
+
+const FlowVision = "xtls-rprx-vision"
+
+var ErrEmptyProfile = errors.New("vpn profile is empty")
+
+// Profile — разобранный VLESS‑профиль сервера.
+// Содержит учётные данные (UUID), поэтому String() их маскирует.
+type Profile struct {
+	Name    string
+	Address string
+	Port    int
+	UUID    string
+	Flow    string
+
+	Network  string
+	Security string
+
+	ServerName  string
+	Fingerprint string
+	// Параметры Reality.
+	PublicKey string
+	ShortID   string
+	SpiderX   string
+	// Параметры транспорта ws/grpc.
+	Path        string
+	Host        string
+	ServiceName string
+
+	// Chain — следующие серверы цепочки (multi-hop): устройство
+	// подключается к этому серверу (вход), а в сеть трафик выходит через
+	// последний сервер Chain (выход). Пусто — подключение к одному серверу.
+	Chain []Profile
+}
+
+// maxChainHops ограничивает число серверов в цепочке вместе со входом.
+const maxChainHops = 4
+
+var ErrDuplicateHop = errors.New("chain hops must be distinct servers")
+
+// String возвращает безопасное для логов представление без UUID и ключей.
+func (p Profile) String() string {
+	s := fmt.Sprintf("vless://***@%s (%s/%s)", net.JoinHostPort(p.Address, strconv.Itoa(p.Port)), p.Network, p.Security)
+	for _, hop := range p.Chain {
+		s += " -> " + hop.String()
+	}
+	return s
+}
+
+// IsReality сообщает, что профиль использует VLESS Reality; у цепочки —
+// что Reality используют все её серверы.
+func (p Profile) IsReality() bool {
+	for _, hop := range p.Hops() {
+		if hop.Security != SecurityReality {
+			return false
+		}
+	}
+	return true
+}
+
+// Hops возвращает серверы профиля от входа к выходу; у профиля без
+// цепочки это он сам.
+func (p Profile) Hops() []Profile {
+	entry := p
+	entry.Chain = nil
+	return append([]Profile{entry}, p.Chain...)
+}
+
+// Exit возвращает сервер, через который трафик выходит в сеть.
+func (p Profile) Exit() Profile {
+	if len(p.Chain) == 0 {
+		return p
+	}
+	return p.Chain[len(p.Chain)-1]
+}
+
+// ServerID идентифицирует сервер профиля: адрес, а у цепочки — адреса
+// серверов от входа к выходу через ">".
+func (p Profile) ServerID() string {
+	id := p.Address
+	for _, hop := range p.Chain {
+		id += ">" + hop.Address
+	}
+	return id
+}
+
+// ParseProfiles разбирает VPN‑профиль из ответа активации: одна или
+// несколько vless:// ссылок, по одной на строку. Несколько ссылок в одной
+// строке через пробел — цепочка серверов от входа к выходу. Пустые
+// строки пропускаются.
+func ParseProfiles(raw string) ([]Profile, error) {
+	var out []Profile
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		p, err := parseChain(line)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	if len(out) == 0 {
+		return nil, ErrEmptyProfile
+	}
+	return out, nil
+}
+
+// ProfileForMode возвращает первый профиль, допустимый в режиме mode.
+func ProfileForMode(profiles []Profile, mode settings.ConnectionMode) (Profile, error) {
+	for _, p := range profiles {
+		if mode == settings.ConnectionModeVLESSRealityOnly && !p.IsReality() {
+			continue
+		}
+		return p, nil
+	}
+	return Profile{}, ErrProfileModeMismatch
+}
+
+// ParseProfile разбирает и валидирует одну vless:// ссылку.
+// Ошибки не содержат исходной строки, чтобы не раскрывать UUID.
+func ParseProfile(raw string) (Profile, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Profile{}, ErrEmptyProfile
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Profile{}, errors.New("malformed vless link")
+	}
+	if u.Scheme != "vless" {
+		return Profile{}, errors.New("unsupported profile scheme")
+	}
+	if u.User == nil {
+		return Profile{}, errors.New("vless link has no user id")
+	}
+
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return Profile{}, errors.New("invalid server port")
+	}
+
+	q := u.Query()
+	p := Profile{
+		Name:        u.Fragment,
+		Address:     u.Hostname(),
+		Port:        port,
+		UUID:        u.User.Username(),
+		Flow:        q.Get("flow"),
+		Network:     q.Get("type"),
+		Security:    q.Get("security"),
+		ServerName:  q.Get("sni"),
+		Fingerprint: q.Get("fp"),
+		PublicKey:   q.Get("pbk"),
+		ShortID:     q.Get("sid"),
+		SpiderX:     q.Get("spx"),
+		Path:        q.Get("path"),
+		Host:        q.Get("host"),
+		ServiceName: q.Get("serviceName"),
+	}
+	if p.Network == "" {
+		p.Network = NetworkTCP
+	}
+	if enc := q.Get("encryption"); enc != "" && enc != "none" {
+		return Profile{}, errors.New("unsupported vless encryption")
+	}
+
+	if err := p.Validate(); err != nil {
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+// parseChain разбирает строку из одной или нескольких ссылок. Ссылка
+// начинается с vless:// после пробела: имя сервера во фрагменте может
+// содержать пробелы, поэтому строка не делится по каждому из них.
+func parseChain(line string) (Profile, error) {
+	var links []string
+	start := 0
+	for i := 1; i < len(line); i++ {
+		if (line[i-1] == ' ' || line[i-1] == '\t') && strings.HasPrefix(line[i:], "vless://") {
+			links = append(links, line[start:i])
+			start = i
+		}
+	}
+	links = append(links, line[start:])
+
+	var hops []Profile
+	for _, link := range links {
+		hop, err := ParseProfile(link)
+		if err != nil {
+			return Profile{}, err
+		}
+		hops = append(hops, hop)
+	}
+	p := hops[0]
+	if len(hops) == 1 {
+		return p, nil
+	}
+	p.Chain = hops[1:]
+	if err := p.Validate(); err != nil {
+		return Profile{}, err
+	}
+	return p, nil
+}
+
+// Validate проверяет профиль целиком вместе с цепочкой: каждый сервер
+// по отдельности и то, что серверы цепочки различны.
+func (p Profile) Validate() error {
+	if err := p.validateServer(); err != nil {
+		return err
+	}
+	if len(p.Chain) == 0 {
+		return nil
+	}
+	if len(p.Chain)+1 > maxChainHops {
+		return fmt.Errorf("chain has more than %d hops", maxChainHops)
+	}
+	seen := map[string]bool{hostKey(p.Address): true}
+	for i, hop := range p.Chain {
+		if len(hop.Chain) > 0 {
+			return fmt.Errorf("chain hop %d: nested chain", i+2)
+		}
+		if err := hop.validateServer(); err != nil {
+			return fmt.Errorf("chain hop %d: %w", i+2, err)
+		}
+		key := hostKey(hop.Address)
+		if seen[key] {
+			return fmt.Errorf("chain hop %d: %w", i+2, ErrDuplicateHop)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// hostKey приводит адрес сервера к виду для сравнения: IPv4 в IPv6 и
+// регистр букв имени не делают серверы разными.
+func hostKey(host string) string {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return strings.ToLower(host)
+}
+
+// validateServer проверяет параметры одного сервера без цепочки.
+func (p Profile) validateServer() error {
+	if !isValidServerAddress(p.Address) {
+		return errors.New("invalid server address")
+	}
+	if p.Port < 1 || p.Port > 65535 {
+		return errors.New("invalid server port")
+	}
+	if !isValidUUID(p.UUID) {
+		return errors.New("invalid user id")
+	}
+	if p.Flow != "" && p.Flow != FlowVision {
+		return errors.New("unsupported flow")
+	}
+
+	switch p.Network {
+	case NetworkTCP:
+	case NetworkGRPC:
+		if p.ServiceName == "" {
+			return errors.New("grpc transport requires service name")
+		}
+	case NetworkWS:
+		if p.Security == SecurityReality {
+			return errors.New("reality does not support websocket transport")
+		}
+		if !strings.HasPrefix(p.Path, "/") {
+			return errors.New("websocket transport requires path")
+		}
+	default:
+		return errors.New("unsupported transport")
+	}
+	if p.Flow == FlowVision && p.Network != NetworkTCP {
+		return errors.New("vision flow requires tcp transport")
+	}
+
+	switch p.Security {
+	case SecurityReality:
+		if p.ServerName == "" {
+			return errors.New("reality requires server name")
+		}
+		if !isValidRealityPublicKey(p.PublicKey) {
+			return errors.New("invalid reality public key")
+		}
+		if !isValidShortID(p.ShortID) {
+			return errors.New("invalid reality short id")
+		}
+	case SecurityTLS:
+		if p.ServerName == "" && net.ParseIP(p.Address) != nil {
+			return errors.New("tls requires server name")
+		}
+	default:
+		return errors.New("unsupported profile security")
+	}
+	return nil
+}
+
+func isValidServerAddress(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '.' {
+			continue
+		}
+		return false
+	}
+	return !strings.HasPrefix(host, ".") && !strings.HasSuffix(host, "-")
+}
+
+func isValidUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isValidRealityPublicKey(s string) bool {
+	key, err := base64.RawURLEncoding.DecodeString(s)
+	return err == nil && len(key) == 32
+}
+
+func isValidShortID(s string) bool {
+	if len(s) > 16 || len(s)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
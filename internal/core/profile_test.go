@@ -0,0 +1,113 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Тестовые ссылки содержат заведомо фиктивные UUID и ключи.
+const (
+	testRealityLink = "vless://11111111-2222-3333-4444-555555555555@203.0.113.10:443" +
+		"?type=tcp&security=reality&flow=xtls-rprx-vision&sni=www.example.com" +
+		"&pbk=AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8&sid=0a1b&fp=chrome#Test%20Reality"
+	testWSLink = "vless://11111111-2222-3333-4444-555555555555@edge.example.com:443" +
+		"?type=ws&security=tls&sni=edge.example.com&path=%2Fws&host=edge.example.com#Test%20WS"
+)
+
+func TestParseProfile_Reality(t *testing.T) {
+	p, err := ParseProfile(testRealityLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	if p.Address != "203.0.113.10" || p.Port != 443 || !p.IsReality() {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+	if p.Flow != FlowVision || p.ShortID != "0a1b" || p.Name != "Test Reality" {
+		t.Fatalf("unexpected profile fields: %+v", p)
+	}
+	if strings.Contains(p.String(), p.UUID) || strings.Contains(p.String(), p.PublicKey) {
+		t.Fatalf("String() leaks secrets: %s", p)
+	}
+}
+
+func TestParseProfiles_MultiLine(t *testing.T) {
+	profiles, err := ParseProfiles(testRealityLink + "\n\n" + testWSLink + "\n")
+	if err != nil {
+		t.Fatalf("ParseProfiles: %v", err)
+	}
+	if len(profiles) != 2 || profiles[1].Network != NetworkWS || profiles[1].Path != "/ws" {
+		t.Fatalf("unexpected profiles: %+v", profiles)
+	}
+
+	if _, err := ParseProfiles("  \n "); !errors.Is(err, ErrEmptyProfile) {
+		t.Fatalf("empty input error = %v, want ErrEmptyProfile", err)
+	}
+}
+
+func TestParseProfile_Rejects(t *testing.T) {
+	cases := map[string]string{
+		"scheme":     strings.Replace(testRealityLink, "vless://", "vmess://", 1),
+		"uuid":       strings.Replace(testRealityLink, "11111111-2222", "not-a-uuid", 1),
+		"port":       strings.Replace(testRealityLink, ":443", ":70000", 1),
+		"public key": strings.Replace(testRealityLink, "pbk=AAEC", "pbk=zz", 1),
+		"short id":   strings.Replace(testRealityLink, "sid=0a1b", "sid=xyz", 1),
+		"security":   strings.Replace(testRealityLink, "security=reality", "security=none", 1),
+		"flow":       strings.Replace(testRealityLink, "type=tcp", "type=grpc&serviceName=svc", 1),
+		"ws path":    strings.Replace(testWSLink, "&path=%2Fws", "", 1),
+	}
+	for name, link := range cases {
+		if _, err := ParseProfile(link); err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if strings.Contains(err.Error(), "11111111") {
+			t.Errorf("%s: error leaks user id: %v", name, err)
+		}
+	}
+}
+
+func TestParseProfiles_Chain(t *testing.T) {
+	exit := strings.Replace(testRealityLink, "203.0.113.10", "198.51.100.20", 1)
+	exit = strings.Replace(exit, "#Test%20Reality", "#Exit Node", 1)
+
+	profiles, err := ParseProfiles(testRealityLink + " " + exit + "\n" + testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfiles: %v", err)
+	}
+	if len(profiles) != 2 || len(profiles[1].Chain) != 0 {
+		t.Fatalf("unexpected profiles: %+v", profiles)
+	}
+	chain := profiles[0]
+	if chain.Address != "203.0.113.10" || len(chain.Hops()) != 2 {
+		t.Fatalf("unexpected chain: %+v", chain)
+	}
+	if got := chain.Exit(); got.Address != "198.51.100.20" || got.Name != "Exit Node" {
+		t.Fatalf("exit = %+v", got)
+	}
+	if got := chain.ServerID(); got != "203.0.113.10>198.51.100.20" {
+		t.Fatalf("ServerID = %q", got)
+	}
+	if strings.Contains(chain.String(), chain.UUID) {
+		t.Fatalf("String() leaks secrets: %s", chain)
+	}
+
+	cases := map[string]string{
+		"same address":   testRealityLink + " " + testRealityLink,
+		"mapped address": testRealityLink + " " + strings.Replace(testRealityLink, "@203.0.113.10:", "@[::ffff:203.0.113.10]:", 1),
+		"case of name":   testWSLink + " " + strings.Replace(testWSLink, "@edge.example.com", "@EDGE.example.com", 1),
+		"duplicate exit": testRealityLink + " " + exit + " " + exit,
+	}
+	for name, line := range cases {
+		if _, err := ParseProfiles(line); !errors.Is(err, ErrDuplicateHop) {
+			t.Errorf("%s: error = %v, want ErrDuplicateHop", name, err)
+		}
+	}
+
+	long := testRealityLink
+	for i := 1; i < maxChainHops+1; i++ {
+		long += " " + strings.Replace(testRealityLink, "203.0.113.10", fmt.Sprintf("198.51.100.%d", i), 1)
+	}
+	if _, err := ParseProfiles(long); err == nil {
+		t.Fatal("expected error for too many hops")
+	}
+}
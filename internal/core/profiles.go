@@ -0,0 +1,450 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/voltavpn/volta-client/internal/secretstore"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// ReasonProfileSwitch — переподключение при смене ключа доступа.
+const ReasonProfileSwitch TransitionReason = "access_profile_switch"
+
+const (
+	maxProfileNameLength = 64
+	// defaultProfileName — имя профиля, перенесённого из единственной
+	// сессии старых версий, и основа имён новых профилей.
+	defaultProfileName = "Ключ"
+)
+
+var (
+	ErrAccessProfileNotFound = errors.New("access profile not found")
+	ErrInvalidProfileName    = errors.New("invalid access profile name")
+	ErrDuplicateProfileName  = errors.New("access profile name is already used")
+
+	errProfilesCorrupted = errors.New("cached session is corrupted")
+)
+
+// AccessProfile — ключ доступа под именем, которое выбрал пользователь
+// (например, «Личный» и «Рабочий»): сессия, полученные по ней серверы и
+// последний выбранный сервер.
+type AccessProfile struct {
+	// ID не меняется при переименовании; на него указывает
+	// settings.AccessSettings.ActiveProfile.
+	ID      string        `json:"id"`
+	Name    string        `json:"name"`
+	Session CachedSession `json:"session"`
+	// LastServer — сервер, выбранный вручную (Profile.ServerID); пусто — Auto.
+	LastServer string `json:"last_server,omitempty"`
+}
+
+// Result возвращает результат активации профиля.
+func (p AccessProfile) Result() ActivateResult {
+	return p.Session.result()
+}
+
+// Candidates возвращает серверы профиля для подключения: выбранный вручную
+// сервер, если он ещё есть в профиле, и последний удачный транспорт первым.
+func (p AccessProfile) Candidates() ([]Profile, error) {
+	profiles, err := ParseProfiles(p.Session.VPNProfile)
+	if err != nil {
+		return nil, err
+	}
+	return preferTransport(PreferServer(profiles, p.LastServer), p.Session.LastGoodTransport), nil
+}
+
+// PreferServer оставляет профили сервера address (Profile.ServerID); если
+// таких нет или address пуст, возвращает все.
+func PreferServer(profiles []Profile, address string) []Profile {
+	if address == "" {
+		return profiles
+	}
+	var out []Profile
+	for _, p := range profiles {
+		if p.ServerID() == address {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return profiles
+	}
+	return out
+}
+
+// SetPersistent включает или выключает запись профилей в хранилище.
+// При выключении профили и ключ устройства удаляются из хранилища, но
+// остаются в памяти до выхода; при включении записываются снова.
+func (c *SessionCache) SetPersistent(persist bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.persist == persist {
+		return nil
+	}
+	if persist {
+		c.persist = true
+		if !c.loaded {
+			return nil
+		}
+		return c.writeLocked()
+	}
+
+	// Профили, ещё не прочитанные из хранилища, сохраняются в памяти.
+	loadErr := c.loadLocked()
+	c.persist = false
+	if key, err := c.store.Get(deviceKeyKey); err == nil && c.ephemeralKey == nil {
+		c.ephemeralKey = key
+	}
+	return errors.Join(
+		loadErr,
+		ignoreNotFound(c.store.Delete(profilesKey)),
+		ignoreNotFound(c.store.Delete(deviceKeyKey)),
+	)
+}
+
+// Profiles возвращает профили в порядке добавления.
+func (c *SessionCache) Profiles() ([]AccessProfile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(c.profiles), nil
+}
+
+// Active возвращает активный профиль.
+func (c *SessionCache) Active() (AccessProfile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loadLocked() != nil {
+		return AccessProfile{}, false
+	}
+	i := c.indexLocked(c.active)
+	if i < 0 {
+		return AccessProfile{}, false
+	}
+	return c.profiles[i], true
+}
+
+// Select делает профиль id активным. Туннель не трогает: для этого есть
+// SwitchAccessProfile.
+func (c *SessionCache) Select(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	if c.indexLocked(id) < 0 {
+		return ErrAccessProfileNotFound
+	}
+	c.active = id
+	return nil
+}
+
+// AddProfile добавляет профиль с результатом активации. Пустое имя
+// заменяется на «Ключ N». Активный профиль не меняется. Если тот же ключ
+// уже сохранён (например, после входа по устаревшей сессии), обновляется
+// его сессия, а имя профиля остаётся прежним.
+func (c *SessionCache) AddProfile(name string, result ActivateResult) (AccessProfile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return AccessProfile{}, err
+	}
+	session := CachedSession{
+		SessionToken: result.SessionToken,
+		VPNProfile:   result.VPNProfile,
+		ProfileURL:   result.ProfileURL,
+		SavedAt:      c.now(),
+	}
+	if i := slices.IndexFunc(c.profiles, func(p AccessProfile) bool { return sameAccessKey(p.Session, session) }); i >= 0 {
+		c.profiles[i].Session = session
+		return c.profiles[i], c.writeLocked()
+	}
+	if strings.TrimSpace(name) == "" {
+		name = c.defaultNameLocked()
+	}
+	return c.addLocked(name, session)
+}
+
+// sameAccessKey сообщает, что сессии выданы по одному ключу: у них
+// совпадает профиль подключения (в нём UUID пользователя) или адрес профиля.
+func sameAccessKey(a, b CachedSession) bool {
+	return a.VPNProfile != "" && a.VPNProfile == b.VPNProfile ||
+		a.ProfileURL != "" && a.ProfileURL == b.ProfileURL
+}
+
+// RenameProfile меняет имя профиля. Имена уникальны без учёта регистра.
+func (c *SessionCache) RenameProfile(id, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	i := c.indexLocked(id)
+	if i < 0 {
+		return ErrAccessProfileNotFound
+	}
+	name, err := c.checkNameLocked(name, id)
+	if err != nil {
+		return err
+	}
+	c.profiles[i].Name = name
+	return c.writeLocked()
+}
+
+// RemoveProfile удаляет профиль. Если он был активным, активного профиля
+// не остаётся.
+func (c *SessionCache) RemoveProfile(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	if c.indexLocked(id) < 0 {
+		return ErrAccessProfileNotFound
+	}
+	return c.removeLocked(id)
+}
+
+// SetLastServer запоминает сервер, выбранный в активном профиле; пустой
+// адрес — режим Auto.
+func (c *SessionCache) SetLastServer(address string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	i := c.indexLocked(c.active)
+	if i < 0 {
+		return ErrAccessProfileNotFound
+	}
+	if c.profiles[i].LastServer == address {
+		return nil
+	}
+	c.profiles[i].LastServer = address
+	return c.writeLocked()
+}
+
+// launchProfile делает активным профиль id, а если его нет — первый
+// сохранённый. Без профилей возвращает secretstore.ErrNotFound.
+func (c *SessionCache) launchProfile(id string) (AccessProfile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return AccessProfile{}, err
+	}
+	i := c.indexLocked(id)
+	if i < 0 && len(c.profiles) > 0 {
+		i = 0
+	}
+	if i < 0 {
+		return AccessProfile{}, secretstore.ErrNotFound
+	}
+	c.active = c.profiles[i].ID
+	return c.profiles[i], nil
+}
+
+// loadLocked читает профили из хранилища один раз. Повреждённый список
+// удаляется, чтобы следующий запуск начался с чистого листа.
+func (c *SessionCache) loadLocked() error {
+	if c.loaded {
+		return nil
+	}
+	if !c.persist {
+		c.loaded = true
+		return nil
+	}
+	data, err := c.store.Get(profilesKey)
+	if errors.Is(err, secretstore.ErrNotFound) {
+		return c.migrateLocked()
+	}
+	if err != nil {
+		return err
+	}
+	var profiles []AccessProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		c.loaded = true
+		_ = c.store.Delete(profilesKey)
+		return errProfilesCorrupted
+	}
+	c.profiles, c.loaded = profiles, true
+	return nil
+}
+
+// migrateLocked переносит единственную сессию старых версий в профиль.
+func (c *SessionCache) migrateLocked() error {
+	data, err := c.store.Get(sessionKey)
+	if errors.Is(err, secretstore.ErrNotFound) {
+		c.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.loaded = true
+	var session CachedSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		_ = c.store.Delete(sessionKey)
+		return errProfilesCorrupted
+	}
+	if _, err := c.addLocked(defaultProfileName+" 1", session); err != nil {
+		return err
+	}
+	return c.store.Delete(sessionKey)
+}
+
+func (c *SessionCache) addLocked(name string, session CachedSession) (AccessProfile, error) {
+	name, err := c.checkNameLocked(name, "")
+	if err != nil {
+		return AccessProfile{}, err
+	}
+	id, err := newProfileID()
+	if err != nil {
+		return AccessProfile{}, err
+	}
+	profile := AccessProfile{ID: id, Name: name, Session: session}
+	c.profiles = append(c.profiles, profile)
+	if err := c.writeLocked(); err != nil {
+		c.profiles = c.profiles[:len(c.profiles)-1]
+		return AccessProfile{}, err
+	}
+	return profile, nil
+}
+
+func (c *SessionCache) removeLocked(id string) error {
+	i := c.indexLocked(id)
+	if i < 0 {
+		return nil
+	}
+	c.profiles = slices.Delete(c.profiles, i, i+1)
+	if c.active == id {
+		c.active = ""
+	}
+	return c.writeLocked()
+}
+
+func (c *SessionCache) writeLocked() error {
+	if !c.persist {
+		return nil
+	}
+	if len(c.profiles) == 0 {
+		return ignoreNotFound(c.store.Delete(profilesKey))
+	}
+	data, err := json.Marshal(c.profiles)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(profilesKey, data)
+}
+
+func (c *SessionCache) indexLocked(id string) int {
+	if id == "" {
+		return -1
+	}
+	return slices.IndexFunc(c.profiles, func(p AccessProfile) bool { return p.ID == id })
+}
+
+// checkNameLocked нормализует имя и проверяет, что его не носит другой
+// профиль (кроме self).
+func (c *SessionCache) checkNameLocked(name, self string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxProfileNameLength || strings.ContainsAny(name, "\r\n\t") {
+		return "", ErrInvalidProfileName
+	}
+	for _, p := range c.profiles {
+		if p.ID != self && strings.EqualFold(p.Name, name) {
+			return "", ErrDuplicateProfileName
+		}
+	}
+	return name, nil
+}
+
+func (c *SessionCache) defaultNameLocked() string {
+	for n := len(c.profiles) + 1; ; n++ {
+		name := fmt.Sprintf("%s %d", defaultProfileName, n)
+		if _, err := c.checkNameLocked(name, ""); err == nil {
+			return name
+		}
+	}
+}
+
+func newProfileID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, secretstore.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// SwitchAccessProfile делает профиль id активным и, если туннель поднят
+// или переподключается, перезапускает его с серверами нового профиля.
+// Профиль проверяется до того, как туннель будет затронут: с непригодным
+// профилем рабочее подключение остаётся как есть. Смена идёт через
+// Reconnecting, поэтому kill switch не снимается.
+func SwitchAccessProfile(ctx context.Context, conn *Connection, cache *SessionCache, id string, mode settings.ConnectionMode) (AccessProfile, error) {
+	profiles, err := cache.Profiles()
+	if err != nil {
+		return AccessProfile{}, err
+	}
+	i := slices.IndexFunc(profiles, func(p AccessProfile) bool { return p.ID == id })
+	if i < 0 {
+		return AccessProfile{}, ErrAccessProfileNotFound
+	}
+	target := profiles[i]
+	candidates, err := target.Candidates()
+	if err != nil {
+		return AccessProfile{}, err
+	}
+	if _, err := ProfileForMode(candidates, mode); err != nil {
+		return AccessProfile{}, err
+	}
+	if err := cache.Select(id); err != nil {
+		return AccessProfile{}, err
+	}
+
+	state, err := waitSettled(ctx, conn)
+	if err != nil {
+		return target, err
+	}
+	if state == StateDisconnected {
+		// Подключаться не просили; старые серверы не должны всплыть при
+		// следующем Reconnect.
+		_ = conn.ForgetProfiles()
+		return target, nil
+	}
+	return target, conn.SwitchProfiles(ctx, candidates, ReasonProfileSwitch)
+}
+
+// waitSettled дожидается конца идущего подключения или отключения: из
+// Connecting и Disconnecting перейти в Reconnecting нельзя, а прерывать
+// попытку через Disconnected значит снять kill switch.
+func waitSettled(ctx context.Context, conn *Connection) (ConnectionState, error) {
+	events, unsubscribe := conn.Subscribe()
+	defer unsubscribe()
+	for {
+		state := conn.State()
+		if state != StateConnecting && state != StateDisconnecting {
+			return state, nil
+		}
+		select {
+		case <-events:
+		case <-ctx.Done():
+			return state, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/secretstore"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// testWorkLink — Reality‑профиль второго ключа на другом сервере.
+var testWorkLink = strings.Replace(testRealityLink, "203.0.113.10", "203.0.113.20", 1)
+
+func TestSessionCache_ProfileOperations(t *testing.T) {
+	cache, store := newTestSessionCache(time.Now())
+
+	personal, err := cache.AddProfile("Личный", ActivateResult{SessionToken: "dummy-personal", VPNProfile: testRealityLink})
+	if err != nil {
+		t.Fatalf("AddProfile: %v", err)
+	}
+	work, err := cache.AddProfile("", ActivateResult{SessionToken: "dummy-work", VPNProfile: testWorkLink})
+	if err != nil || work.Name != "Ключ 2" {
+		t.Fatalf("AddProfile default name = %q, %v", work.Name, err)
+	}
+	if _, ok := cache.Active(); ok {
+		t.Fatal("AddProfile changed the active profile")
+	}
+
+	if _, err := cache.AddProfile(" личный ", ActivateResult{}); !errors.Is(err, ErrDuplicateProfileName) {
+		t.Fatalf("duplicate name = %v", err)
+	}
+	if err := cache.RenameProfile(work.ID, "  "); !errors.Is(err, ErrInvalidProfileName) {
+		t.Fatalf("empty name = %v", err)
+	}
+	if err := cache.RenameProfile(work.ID, "Рабочий"); err != nil {
+		t.Fatalf("RenameProfile: %v", err)
+	}
+	if err := cache.Select(work.ID); err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if err := cache.SetLastServer("203.0.113.20"); err != nil {
+		t.Fatalf("SetLastServer: %v", err)
+	}
+
+	// Профили переживают перезапуск; активный хранится в настройках.
+	restarted := NewSessionCache(store)
+	profiles, err := restarted.Profiles()
+	if err != nil || len(profiles) != 2 {
+		t.Fatalf("Profiles after restart = %v, %v", profiles, err)
+	}
+	if profiles[1].Name != "Рабочий" || profiles[1].LastServer != "203.0.113.20" || profiles[1].Session.SessionToken != "dummy-work" {
+		t.Fatalf("work profile = %+v", profiles[1])
+	}
+
+	if err := restarted.RemoveProfile(personal.ID); err != nil {
+		t.Fatalf("RemoveProfile: %v", err)
+	}
+	if err := restarted.Select(personal.ID); !errors.Is(err, ErrAccessProfileNotFound) {
+		t.Fatalf("Select removed = %v", err)
+	}
+	if profiles, _ := NewSessionCache(store).Profiles(); len(profiles) != 1 || profiles[0].ID != work.ID {
+		t.Fatalf("profiles after remove = %+v", profiles)
+	}
+}
+
+func TestSessionCache_MigratesSingleSession(t *testing.T) {
+	store := secretstore.NewMemory()
+	legacy := `{"session_token":"dummy-token","vpn_profile":"` + testRealityLink + `","saved_at":"2026-01-10T12:00:00Z"}`
+	_ = store.Set(sessionKey, []byte(legacy))
+	cache := NewSessionCache(store)
+	cache.now = func() time.Time { return time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC) }
+
+	plan := PlanLaunch(cache, launchSettings(false))
+	if plan.Screen != LaunchMain || plan.Session.SessionToken != "dummy-token" || plan.AccessProfile == "" {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if _, err := store.Get(sessionKey); err == nil {
+		t.Fatal("legacy session key kept after migration")
+	}
+	profiles, _ := NewSessionCache(store).Profiles()
+	if len(profiles) != 1 || profiles[0].Name != "Ключ 1" {
+		t.Fatalf("migrated profiles = %+v", profiles)
+	}
+}
+
+func TestPlanLaunch_UsesActiveProfileFromSettings(t *testing.T) {
+	cache, _ := newTestSessionCache(time.Now())
+	_, _ = cache.AddProfile("Личный", ActivateResult{SessionToken: "dummy-personal", VPNProfile: testRealityLink})
+	work, _ := cache.AddProfile("Рабочий", ActivateResult{SessionToken: "dummy-work", VPNProfile: testWorkLink})
+
+	s := launchSettings(false)
+	s.Access.ActiveProfile = work.ID
+	plan := PlanLaunch(cache, s)
+	if plan.AccessProfile != work.ID || plan.Session.SessionToken != "dummy-work" {
+		t.Fatalf("plan = %+v", plan)
+	}
+
+	// Указатель на удалённый профиль — берётся первый.
+	s.Access.ActiveProfile = "0123456789abcdef"
+	if plan := PlanLaunch(cache, s); plan.Session.SessionToken != "dummy-personal" {
+		t.Fatalf("plan with stale pointer = %+v", plan)
+	}
+}
+
+func TestSessionCache_SetPersistentKeepsProfilesInMemory(t *testing.T) {
+	cache, store := newTestSessionCache(time.Now())
+	profile, _ := cache.AddProfile("Личный", ActivateResult{SessionToken: "dummy-session", VPNProfile: testRealityLink})
+	id, _ := cache.DeviceID(true)
+
+	if err := cache.SetPersistent(false); err != nil {
+		t.Fatalf("SetPersistent(false): %v", err)
+	}
+	for _, key := range []string{profilesKey, deviceKeyKey} {
+		if _, err := store.Get(key); err == nil {
+			t.Fatalf("%s kept in store without RememberDevice", key)
+		}
+	}
+	if profiles, _ := cache.Profiles(); len(profiles) != 1 || profiles[0].ID != profile.ID {
+		t.Fatalf("in-memory profiles = %+v", profiles)
+	}
+	if again, _ := cache.DeviceID(false); again != id {
+		t.Fatal("device ID changed when RememberDevice was turned off")
+	}
+	if _, err := cache.AddProfile("Рабочий", ActivateResult{VPNProfile: testWorkLink}); err != nil {
+		t.Fatalf("AddProfile: %v", err)
+	}
+	if _, err := store.Get(profilesKey); err == nil {
+		t.Fatal("profile written to store without RememberDevice")
+	}
+
+	if err := cache.SetPersistent(true); err != nil {
+		t.Fatalf("SetPersistent(true): %v", err)
+	}
+	if profiles, _ := NewSessionCache(store).Profiles(); len(profiles) != 2 {
+		t.Fatalf("profiles after re-enabling = %+v", profiles)
+	}
+}
+
+func TestSwitchAccessProfile_ReconnectsWithoutDroppingKillSwitch(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	fw := &fakeFirewall{}
+	killSwitch := NewKillSwitch(conn, fw, true)
+	defer killSwitch.Close()
+	statuses, unsubscribe := killSwitch.Subscribe()
+	defer unsubscribe()
+
+	cache, _ := newTestSessionCache(time.Now())
+	personal, _ := cache.AddProfile("Личный", ActivateResult{SessionToken: "dummy-personal", VPNProfile: testRealityLink})
+	work, _ := cache.AddProfile("Рабочий", ActivateResult{SessionToken: "dummy-work", VPNProfile: testWorkLink})
+	_ = cache.Select(personal.ID)
+	connectForTest(t, conn)
+	waitKillSwitch(t, killSwitch, KillSwitchArmed)
+	transitions, stopTransitions := conn.Subscribe()
+	defer stopTransitions()
+
+	got, err := SwitchAccessProfile(context.Background(), conn, cache, work.ID, settings.ConnectionModeAuto)
+	if err != nil || got.ID != work.ID {
+		t.Fatalf("SwitchAccessProfile = %+v, %v", got, err)
+	}
+	waitState(t, conn, StateConnected)
+	if active, _ := conn.ActiveProfile(); active.Address != "203.0.113.20" {
+		t.Fatalf("active server = %s", active.Address)
+	}
+	if active, _ := cache.Active(); active.ID != work.ID {
+		t.Fatalf("active access profile = %+v", active)
+	}
+	if first := <-transitions; first.To != StateReconnecting || first.Reason != ReasonProfileSwitch {
+		t.Fatalf("first transition = %+v, want reconnect for profile switch", first)
+	}
+
+	// Правила ставятся заново с адресом нового сервера.
+	want := netip.MustParseAddrPort("203.0.113.20:443")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rules, _, active := fw.snapshot()
+		last := rules[len(rules)-1].Endpoints
+		if active && len(last) == 1 && last[0] == want {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("firewall endpoints = %v (active %v), want %v", last, active, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waitKillSwitch(t, killSwitch, KillSwitchArmed)
+	for {
+		select {
+		case st := <-statuses:
+			if st.State == KillSwitchOff {
+				t.Fatal("kill switch dropped while switching profiles")
+			}
+			continue
+		default:
+		}
+		break
+	}
+}
+
+func TestSwitchAccessProfile_KeepsTunnelOnUnusableProfile(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	cache, _ := newTestSessionCache(time.Now())
+	personal, _ := cache.AddProfile("Личный", ActivateResult{VPNProfile: testRealityLink})
+	broken, _ := cache.AddProfile("Старый", ActivateResult{VPNProfile: testWSLink})
+	_ = cache.Select(personal.ID)
+	connectForTest(t, conn)
+
+	_, err := SwitchAccessProfile(context.Background(), conn, cache, broken.ID, settings.ConnectionModeVLESSRealityOnly)
+	if !errors.Is(err, ErrProfileModeMismatch) {
+		t.Fatalf("SwitchAccessProfile = %v, want mode mismatch", err)
+	}
+	if conn.State() != StateConnected || len(engine.Starts()) != 1 {
+		t.Fatalf("tunnel touched: state %s, starts %d", conn.State(), len(engine.Starts()))
+	}
+	if active, _ := cache.Active(); active.ID != personal.ID {
+		t.Fatal("active profile changed despite failed switch")
+	}
+}
+
+func TestSwitchAccessProfile_WhileDisconnectedOnlySelects(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	connectForTest(t, conn)
+	_ = conn.Disconnect(context.Background(), ReasonUserRequest)
+
+	cache, _ := newTestSessionCache(time.Now())
+	work, _ := cache.AddProfile("Рабочий", ActivateResult{VPNProfile: testWorkLink})
+	if _, err := SwitchAccessProfile(context.Background(), conn, cache, work.ID, settings.ConnectionModeAuto); err != nil {
+		t.Fatalf("SwitchAccessProfile: %v", err)
+	}
+	if conn.State() != StateDisconnected || len(engine.Starts()) != 1 || len(conn.Candidates()) != 0 {
+		t.Fatalf("state %s, starts %d, candidates %v", conn.State(), len(engine.Starts()), conn.Candidates())
+	}
+}
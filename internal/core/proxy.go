@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// ProxyCredentials — логин и пароль локальных прокси на одно подключение:
+// без них другие пользователи компьютера не могут пользоваться туннелем.
+type ProxyCredentials struct {
+	Username string
+	Password string
+}
+
+// NewProxyCredentials создаёт случайные учётные данные.
+func NewProxyCredentials() (ProxyCredentials, error) {
+	user := make([]byte, 4)
+	pass := make([]byte, 18)
+	if _, err := rand.Read(user); err != nil {
+		return ProxyCredentials{}, err
+	}
+	if _, err := rand.Read(pass); err != nil {
+		return ProxyCredentials{}, err
+	}
+	return ProxyCredentials{
+		Username: "volta-" + hex.EncodeToString(user),
+		Password: base64.RawURLEncoding.EncodeToString(pass),
+	}, nil
+}
+
+// String не раскрывает пароль, чтобы учётные данные не попали в логи.
+func (c ProxyCredentials) String() string {
+	return c.Username + ":" + redactedValue
+}
+
+// LocalProxyEndpoints — адреса локальных прокси ядра.
+type LocalProxyEndpoints struct {
+	SOCKS string
+	HTTP  string
+	// Auth — учётные данные; nil, если прокси открыты без пароля.
+	Auth *ProxyCredentials
+}
+
+// LocalProxies возвращает адреса SOCKS5‑ и HTTP‑входов ядра, через которые
+// приложения и локальные службы (например, DNS‑заглушка) отправляют трафик
+// в туннель. В режиме TUN входов нет: трафик попадает в туннель по маршрутам.
+func LocalProxies(opts EngineOptions) (LocalProxyEndpoints, bool) {
+	if opts.Inbound == InboundTUN {
+		return LocalProxyEndpoints{}, false
+	}
+	return LocalProxyEndpoints{
+		SOCKS: net.JoinHostPort(localProxyListen, strconv.Itoa(localSOCKSPort)),
+		HTTP:  net.JoinHostPort(localProxyListen, strconv.Itoa(localHTTPPort)),
+		Auth:  opts.ProxyAuth,
+	}, true
+}
+
+// TunnelHTTPClient — HTTP‑клиент для проверок через туннель с параметрами
+// opts: в режиме TUN запросы идут по маршрутам, иначе — через HTTP‑вход
+// ядра.
+func TunnelHTTPClient(opts EngineOptions) *http.Client {
+	var proxy func(*http.Request) (*url.URL, error)
+	if proxies, ok := LocalProxies(opts); ok {
+		proxyURL := &url.URL{Scheme: "http", Host: proxies.HTTP}
+		if proxies.Auth != nil {
+			proxyURL.User = url.UserPassword(proxies.Auth.Username, proxies.Auth.Password)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	var dialer net.Dialer
+	return probeHTTPClient(dialer.DialContext, proxy)
+}
+
+// probeHTTPClient — клиент для проверок: без прокси из окружения (он
+// исказил бы результат) и без повторного использования соединений.
+func probeHTTPClient(dial func(context.Context, string, string) (net.Conn, error), proxy func(*http.Request) (*url.URL, error)) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:             proxy,
+			DialContext:       dial,
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+// NewEngineOptions собирает параметры подключения из настроек. Для каждого
+// вызова создаются новые учётные данные прокси: в режиме ProxyOnly — если
+// включён ProxyAuth, в режиме TUN — всегда, для внутреннего входа ядра.
+func NewEngineOptions(s settings.Settings) (EngineOptions, error) {
+	opts := EngineOptions{Settings: s, Inbound: InboundProxy}
+	proxyOnly := s.Connection.Mode == settings.ConnectionModeProxyOnly
+	if s.Connection.TUN && !proxyOnly {
+		opts.Inbound = InboundTUN
+	}
+	if opts.Inbound == InboundTUN || proxyOnly && s.Connection.ProxyAuth {
+		creds, err := NewProxyCredentials()
+		if err != nil {
+			return EngineOptions{}, err
+		}
+		opts.ProxyAuth = &creds
+	}
+	return opts, nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+func proxyOnlyOptions() EngineOptions {
+	opts := testOptions()
+	opts.Settings.Connection.Mode = settings.ConnectionModeProxyOnly
+	opts.ProxyAuth = &ProxyCredentials{Username: "volta-test", Password: "dummy-password"}
+	return opts
+}
+
+func TestNewEngineOptions_ProxyCredentialsPerSession(t *testing.T) {
+	s := settings.Default()
+	s.Connection.Mode = settings.ConnectionModeProxyOnly
+
+	first, err := NewEngineOptions(s)
+	if err != nil {
+		t.Fatalf("NewEngineOptions: %v", err)
+	}
+	second, _ := NewEngineOptions(s)
+	if first.ProxyAuth == nil || second.ProxyAuth == nil {
+		t.Fatal("proxy-only mode with ProxyAuth must create credentials")
+	}
+	if *first.ProxyAuth == *second.ProxyAuth || len(first.ProxyAuth.Password) < 20 {
+		t.Fatalf("credentials are not fresh per session: %v / %v", first.ProxyAuth, second.ProxyAuth)
+	}
+	if strings.Contains(first.ProxyAuth.String(), first.ProxyAuth.Password) {
+		t.Fatal("String() reveals the password")
+	}
+
+	s.Connection.ProxyAuth = false
+	if opts, _ := NewEngineOptions(s); opts.ProxyAuth != nil {
+		t.Fatal("ProxyAuth off must leave the proxies open")
+	}
+	s.Connection.Mode = settings.ConnectionModeAuto
+	s.Connection.ProxyAuth = true
+	if opts, _ := NewEngineOptions(s); opts.ProxyAuth != nil {
+		t.Fatal("credentials are only used in proxy-only mode")
+	}
+}
+
+func TestBuildEngineConfig_ProxyOnlyWithAuth(t *testing.T) {
+	ws, err := ParseProfile(testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	opts := proxyOnlyOptions()
+
+	got, err := BuildEngineConfig(ws, opts)
+	if err != nil {
+		t.Fatalf("BuildEngineConfig: %v", err)
+	}
+	checkGolden(t, "config_proxy_only_auth.golden.json", got)
+
+	redacted, err := RedactedEngineConfig(ws, opts)
+	if err != nil {
+		t.Fatalf("RedactedEngineConfig: %v", err)
+	}
+	if strings.Contains(string(redacted), "dummy-password") {
+		t.Fatal("redacted config contains the proxy password")
+	}
+
+	opts.Inbound = InboundTUN
+	if _, err := BuildEngineConfig(ws, opts); err == nil {
+		t.Fatal("proxy-only mode accepted a TUN inbound")
+	}
+}
+
+func TestLocalProxies(t *testing.T) {
+	opts := proxyOnlyOptions()
+	proxies, ok := LocalProxies(opts)
+	if !ok || proxies.SOCKS != "127.0.0.1:10808" || proxies.HTTP != "127.0.0.1:10809" || proxies.Auth != opts.ProxyAuth {
+		t.Fatalf("LocalProxies = %+v, %v", proxies, ok)
+	}
+	opts.Inbound = InboundTUN
+	if _, ok := LocalProxies(opts); ok {
+		t.Fatal("TUN inbound has no local proxies")
+	}
+}
+
+func TestKillSwitch_InactiveInProxyOnlyMode(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	fw := &fakeFirewall{}
+	ks := NewKillSwitch(conn, fw, true)
+	defer ks.Close()
+
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, proxyOnlyOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if rules, _, active := fw.snapshot(); len(rules) != 0 || active {
+		t.Fatalf("firewall touched in proxy-only mode: %+v", rules)
+	}
+	if st := ks.Status(); st.State != KillSwitchOff {
+		t.Fatalf("kill switch state = %v, want off", st.State)
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/api"
+)
+
+// ReasonKeyReset — отключение при сбросе ключа доступа.
+const ReasonKeyReset TransitionReason = "key_reset"
+
+const defaultRevokeTimeout = 5 * time.Second
+
+// ResetStep — шаг сброса ключа.
+type ResetStep string
+
+const (
+	ResetStepDisconnect ResetStep = "disconnect"
+	// ResetStepRevoke — отзыв сессии на сервере; выполняется по
+	// возможности: без сети сессия истечёт сама.
+	ResetStepRevoke ResetStep = "revoke_session"
+	// ResetStepWipeSecrets — удаление сессии и ключа устройства из
+	// хранилища секретов.
+	ResetStepWipeSecrets ResetStep = "wipe_secrets"
+	// ResetStepForgetProfiles — удаление профилей и всего, что о них
+	// запомнено: кандидатов подключения, удачных транспортов, замеров.
+	ResetStepForgetProfiles ResetStep = "forget_profiles"
+)
+
+// ResetStepResult — итог одного шага.
+type ResetStepResult struct {
+	Step ResetStep
+	// Skipped — шаг не понадобился, например туннель не был поднят.
+	Skipped bool
+	Err     error
+}
+
+// KeyResetReport — итоги шагов в порядке выполнения.
+type KeyResetReport struct {
+	Steps []ResetStepResult
+}
+
+// Err объединяет ошибки шагов, кроме отзыва сессии: он не обязателен.
+func (r KeyResetReport) Err() error {
+	var errs []error
+	for _, step := range r.Steps {
+		if step.Step != ResetStepRevoke && step.Err != nil {
+			errs = append(errs, step.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// KeyReset сбрасывает ключ доступа: отключает туннель, отзывает сессию на
+// сервере и забывает всё, что было получено по ключу. Nil‑поля означают,
+// что соответствующего компонента нет и шаг пропускается.
+type KeyReset struct {
+	Conn     *Connection
+	Client   api.APIClient
+	Sessions *SessionCache
+	Auto     *AutoStrategy
+	Ranking  *ServerRanking
+	// RevokeTimeout ограничивает отзыв сессии; 0 — значение по умолчанию.
+	RevokeTimeout time.Duration
+}
+
+// Run выполняет все шаги по порядку. Сбой одного шага не останавливает
+// остальные: локальные данные удаляются в любом случае. Результат
+// активации session после этого использовать нельзя.
+func (k KeyReset) Run(ctx context.Context, session ActivateResult) KeyResetReport {
+	var report KeyResetReport
+	add := func(step ResetStep, skipped bool, err error) {
+		report.Steps = append(report.Steps, ResetStepResult{Step: step, Skipped: skipped, Err: err})
+	}
+
+	if k.Conn == nil || k.Conn.State() == StateDisconnected {
+		add(ResetStepDisconnect, true, nil)
+	} else {
+		add(ResetStepDisconnect, false, k.Conn.Disconnect(ctx, ReasonKeyReset))
+	}
+
+	if k.Client == nil || session.SessionToken == "" {
+		add(ResetStepRevoke, true, nil)
+	} else {
+		timeout := k.RevokeTimeout
+		if timeout <= 0 {
+			timeout = defaultRevokeTimeout
+		}
+		revokeCtx, cancel := context.WithTimeout(ctx, timeout)
+		add(ResetStepRevoke, false, k.Client.Revoke(revokeCtx, session.SessionToken))
+		cancel()
+	}
+
+	if k.Sessions == nil {
+		add(ResetStepWipeSecrets, true, nil)
+	} else {
+		add(ResetStepWipeSecrets, false, k.Sessions.Wipe())
+	}
+
+	var forgetErr error
+	if k.Conn != nil {
+		forgetErr = k.Conn.ForgetProfiles()
+	}
+	if k.Auto != nil {
+		k.Auto.Forget()
+	}
+	if k.Ranking != nil {
+		k.Ranking.Clear()
+	}
+	add(ResetStepForgetProfiles, false, forgetErr)
+
+	return report
+}
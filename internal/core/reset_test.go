@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/api"
+	"github.com/voltavpn/volta-client/internal/secretstore"
+)
+
+// fakeAPI записывает отозванные сессии; revokeErr имитирует недоступный
+// сервер.
+type fakeAPI struct {
+	revoked   []string
+	revokeErr error
+}
+
+func (f *fakeAPI) Activate(context.Context, api.ActivateRequest) (*api.ActivateResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeAPI) Revoke(_ context.Context, sessionToken string) error {
+	f.revoked = append(f.revoked, sessionToken)
+	return f.revokeErr
+}
+
+// failingWipeStore — хранилище, которое не может удалить секреты.
+type failingWipeStore struct {
+	*secretstore.Memory
+}
+
+func (failingWipeStore) Wipe() error { return errors.New("keyring locked") }
+
+func stepResult(t *testing.T, report KeyResetReport, step ResetStep) ResetStepResult {
+	t.Helper()
+	for _, r := range report.Steps {
+		if r.Step == step {
+			return r
+		}
+	}
+	t.Fatalf("step %s missing from report %+v", step, report.Steps)
+	return ResetStepResult{}
+}
+
+func TestKeyReset_RunsAllStepsInOrder(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	connectForTest(t, conn)
+
+	sessions, store := newTestSessionCache(time.Now())
+	session := ActivateResult{SessionToken: "dummy-session", VPNProfile: testRealityLink}
+	if err := sessions.Save(session); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := sessions.DeviceID(true); err != nil {
+		t.Fatalf("DeviceID: %v", err)
+	}
+	auto := NewAutoStrategy(HandshakeProber{}, 0)
+	auto.RememberTransport("wifi", TransportKey(testProfile(t)))
+	ranking := NewServerRanking(LatencyProber{}, 0)
+	ranking.byNetwork["wifi"] = rankingEntry{results: []ServerLatency{{}}, measuredAt: time.Now()}
+	client := &fakeAPI{}
+
+	report := KeyReset{Conn: conn, Client: client, Sessions: sessions, Auto: auto, Ranking: ranking}.Run(context.Background(), session)
+
+	var order []ResetStep
+	for _, r := range report.Steps {
+		order = append(order, r.Step)
+		if r.Skipped || r.Err != nil {
+			t.Fatalf("step %+v", r)
+		}
+	}
+	want := []ResetStep{ResetStepDisconnect, ResetStepRevoke, ResetStepWipeSecrets, ResetStepForgetProfiles}
+	if len(order) != len(want) {
+		t.Fatalf("steps = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("steps = %v, want %v", order, want)
+		}
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+
+	if conn.State() != StateDisconnected || conn.LastTransition().Reason != ReasonKeyReset {
+		t.Fatalf("connection = %s (%s)", conn.State(), conn.LastTransition().Reason)
+	}
+	if len(conn.Candidates()) != 0 {
+		t.Fatal("connection still has candidates")
+	}
+	if err := conn.Reconnect(context.Background(), ReasonUserRequest); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Reconnect after reset = %v", err)
+	}
+	if len(client.revoked) != 1 || client.revoked[0] != "dummy-session" {
+		t.Fatalf("revoked = %v", client.revoked)
+	}
+	if _, err := sessions.Load(); err == nil {
+		t.Fatal("session survived reset")
+	}
+	if _, err := store.Get(deviceKeyKey); err == nil {
+		t.Fatal("device key survived reset")
+	}
+	if _, ok := auto.RememberedTransport("wifi"); ok {
+		t.Fatal("remembered transport survived reset")
+	}
+	if _, ok := ranking.Cached("wifi"); ok {
+		t.Fatal("latency cache survived reset")
+	}
+}
+
+func TestKeyReset_RevokeFailureIsBestEffort(t *testing.T) {
+	sessions, _ := newTestSessionCache(time.Now())
+	_ = sessions.Save(ActivateResult{SessionToken: "dummy-session", VPNProfile: testRealityLink})
+	client := &fakeAPI{revokeErr: errors.New("network unreachable")}
+
+	report := KeyReset{Conn: NewConnection(NewFakeEngine()), Client: client, Sessions: sessions}.Run(context.Background(), ActivateResult{SessionToken: "dummy-session"})
+
+	if r := stepResult(t, report, ResetStepDisconnect); !r.Skipped {
+		t.Fatalf("disconnect = %+v, want skipped when not connected", r)
+	}
+	if r := stepResult(t, report, ResetStepRevoke); r.Err == nil {
+		t.Fatalf("revoke = %+v, want error", r)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Err = %v, revoke failure must not fail the reset", err)
+	}
+	if _, err := sessions.Load(); err == nil {
+		t.Fatal("session kept after failed revoke")
+	}
+}
+
+func TestKeyReset_ReportsWipeFailureAndContinues(t *testing.T) {
+	sessions := NewSessionCache(failingWipeStore{secretstore.NewMemory()})
+	auto := NewAutoStrategy(HandshakeProber{}, 0)
+	auto.RememberTransport("wifi", "reality")
+
+	report := KeyReset{Sessions: sessions, Auto: auto}.Run(context.Background(), ActivateResult{})
+
+	if r := stepResult(t, report, ResetStepRevoke); !r.Skipped {
+		t.Fatalf("revoke = %+v, want skipped without session token", r)
+	}
+	if r := stepResult(t, report, ResetStepWipeSecrets); r.Err == nil {
+		t.Fatalf("wipe = %+v, want error", r)
+	}
+	if report.Err() == nil {
+		t.Fatal("Err = nil, want wipe failure")
+	}
+	if _, ok := auto.RememberedTransport("wifi"); ok {
+		t.Fatal("later steps did not run after wipe failure")
+	}
+}
@@ -0,0 +1,325 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/secretstore"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// ReasonLaunch — подключение при запуске по настройке AutoConnectOnLaunch.
+const ReasonLaunch TransitionReason = "auto_connect_on_launch"
+
+// sessionKey — ключ единственной сессии в хранилище секретов до появления
+// профилей; при первом чтении она переносится в профиль.
+const sessionKey = "session"
+
+// profilesKey — ключ списка профилей в хранилище секретов.
+const profilesKey = "access_profiles"
+
+// deviceKeyKey — ключ устройства в хранилище секретов.
+const deviceKeyKey = "device_key"
+
+const (
+	deviceKeySize = 32
+	deviceIDLabel = "voltavpn device id v1"
+)
+
+// sessionMaxAge — после этого срока сохранённая сессия не используется.
+const sessionMaxAge = 30 * 24 * time.Hour
+
+// CachedSession — сессия, переживающая перезапуск приложения.
+type CachedSession struct {
+	SessionToken string `json:"session_token"`
+	VPNProfile   string `json:"vpn_profile"`
+	ProfileURL   string `json:"profile_url"`
+	// LastGoodTransport — TransportKey профиля последнего успешного подключения.
+	LastGoodTransport string `json:"last_good_transport,omitempty"`
+	// SavedAt — время входа или последнего удачного подключения.
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// SessionCache хранит ключи доступа пользователя — именованные профили
+// (см. AccessProfile) — в хранилище секретов. Один из профилей активен:
+// Save, Load и MarkProfileGood работают с ним.
+type SessionCache struct {
+	store secretstore.Store
+	now   func() time.Time
+
+	mu sync.Mutex
+	// ephemeralKey — ключ устройства, когда его нельзя сохранять.
+	ephemeralKey []byte
+	// persist — записывать профили в хранилище (RememberDevice);
+	// иначе они живут только в памяти до выхода.
+	persist  bool
+	loaded   bool
+	profiles []AccessProfile
+	active   string
+}
+
+func NewSessionCache(store secretstore.Store) *SessionCache {
+	return &SessionCache{store: store, now: time.Now, persist: true}
+}
+
+// Save сохраняет результат активации в активный профиль; прежний удачный
+// транспорт забывается. Если активного профиля нет, создаётся новый.
+func (c *SessionCache) Save(result ActivateResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	session := CachedSession{
+		SessionToken: result.SessionToken,
+		VPNProfile:   result.VPNProfile,
+		ProfileURL:   result.ProfileURL,
+		SavedAt:      c.now(),
+	}
+	if i := c.indexLocked(c.active); i >= 0 {
+		c.profiles[i].Session = session
+		return c.writeLocked()
+	}
+	profile, err := c.addLocked(c.defaultNameLocked(), session)
+	if err != nil {
+		return err
+	}
+	c.active = profile.ID
+	return nil
+}
+
+// MarkProfileGood запоминает профиль, с которым подключение удалось, и
+// продлевает сессию: срок sessionMaxAge отсчитывается от последнего
+// удачного подключения.
+func (c *SessionCache) MarkProfileGood(p Profile) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	i := c.indexLocked(c.active)
+	if i < 0 {
+		return secretstore.ErrNotFound
+	}
+	c.profiles[i].Session.LastGoodTransport = TransportKey(p)
+	c.profiles[i].Session.SavedAt = c.now()
+	return c.writeLocked()
+}
+
+// Load возвращает сессию активного профиля. Если его нет, возвращает
+// secretstore.ErrNotFound.
+func (c *SessionCache) Load() (CachedSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return CachedSession{}, err
+	}
+	i := c.indexLocked(c.active)
+	if i < 0 {
+		return CachedSession{}, secretstore.ErrNotFound
+	}
+	return c.profiles[i].Session, nil
+}
+
+// Clear удаляет активный профиль.
+func (c *SessionCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	return c.removeLocked(c.active)
+}
+
+// Wipe удаляет из хранилища сессию, ключ устройства и остальные секреты
+// приложения.
+func (c *SessionCache) Wipe() error {
+	c.mu.Lock()
+	clear(c.ephemeralKey)
+	c.ephemeralKey = nil
+	c.profiles, c.active = nil, ""
+	c.loaded = true
+	c.mu.Unlock()
+	return c.store.Wipe()
+}
+
+// DeviceID возвращает идентификатор установки для сервера. Он выводится из
+// случайного ключа устройства, сам ключ хранилище не покидает. Без persist
+// (RememberDevice выключен) ключ живёт только в памяти до выхода.
+func (c *SessionCache) DeviceID(persist bool) (string, error) {
+	key, err := c.deviceKey(persist)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(deviceIDLabel))
+	return hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+func (c *SessionCache) deviceKey(persist bool) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !persist {
+		if c.ephemeralKey == nil {
+			key, err := newDeviceKey()
+			if err != nil {
+				return nil, err
+			}
+			c.ephemeralKey = key
+		}
+		return c.ephemeralKey, nil
+	}
+
+	key, err := c.store.Get(deviceKeyKey)
+	if err == nil && len(key) == deviceKeySize {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, secretstore.ErrNotFound) {
+		return nil, err
+	}
+	// Ключ прошлого запуска без сохранения становится постоянным:
+	// идентификатор не меняется от переключения RememberDevice.
+	key = c.ephemeralKey
+	if key == nil {
+		if key, err = newDeviceKey(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.store.Set(deviceKeyKey, key); err != nil {
+		return nil, err
+	}
+	c.ephemeralKey = nil
+	return key, nil
+}
+
+func newDeviceKey() ([]byte, error) {
+	key := make([]byte, deviceKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// LaunchScreen — экран, с которого начинается работа приложения.
+type LaunchScreen int
+
+const (
+	LaunchLogin LaunchScreen = iota
+	LaunchMain
+)
+
+// LaunchPlan — решение о том, как стартовать приложение.
+type LaunchPlan struct {
+	Screen  LaunchScreen
+	Session ActivateResult
+	// AccessProfile — ID профиля, с которого начинается работа; может
+	// отличаться от settings.AccessSettings.ActiveProfile, если тот удалён.
+	AccessProfile string
+	// Server — сервер, выбранный в профиле вручную; пусто — Auto.
+	Server string
+	// Profiles — кандидаты для подключения; последний удачный идёт первым.
+	Profiles []Profile
+	// PreferredTransport — TransportKey последнего удачного подключения.
+	PreferredTransport string
+	AutoConnect        bool
+	// FallbackReason объясняет пользователю, почему показан вход,
+	// хотя сессия была сохранена. Пусто, если объяснять нечего.
+	FallbackReason string
+	// Err — ошибка чтения хранилища секретов. Сохранённые профили при ней
+	// не удаляются: хранилище может быть временно недоступно.
+	Err error
+}
+
+// PlanLaunch решает по активному профилю и настройкам, показывать ли вход
+// или сразу главный экран (и подключаться ли). Удаляется только
+// повреждённый список профилей: с устаревшей сессией или нечитаемым
+// профилем показывается вход, а профиль с его именем остаётся и
+// обновляется при входе. При ошибке самого хранилища ошибка возвращается
+// в LaunchPlan.Err.
+func PlanLaunch(cache *SessionCache, s settings.Settings) LaunchPlan {
+	if cache == nil || !s.Privacy.RememberDevice {
+		return LaunchPlan{Screen: LaunchLogin}
+	}
+
+	profile, err := cache.launchProfile(s.Access.ActiveProfile)
+	if errors.Is(err, secretstore.ErrNotFound) {
+		return LaunchPlan{Screen: LaunchLogin}
+	}
+	login := func(reason string) LaunchPlan {
+		return LaunchPlan{Screen: LaunchLogin, FallbackReason: reason}
+	}
+	if errors.Is(err, errProfilesCorrupted) {
+		// Повреждённый список loadLocked уже удалил из хранилища.
+		return LaunchPlan{Screen: LaunchLogin, FallbackReason: "Сохранённые данные повреждены. Войдите заново."}
+	}
+	if err != nil {
+		return LaunchPlan{
+			Screen:         LaunchLogin,
+			FallbackReason: "Хранилище секретов недоступно. Сохранённый профиль не удалён.",
+			Err:            err,
+		}
+	}
+	session := profile.Session
+	if session.SavedAt.IsZero() || cache.now().Sub(session.SavedAt) > sessionMaxAge {
+		return login("Сохранённая сессия устарела. Войдите заново.")
+	}
+
+	profiles, err := profile.Candidates()
+	if err != nil {
+		return login("Сохранённый профиль не читается. Войдите заново.")
+	}
+	if _, err := ProfileForMode(profiles, s.Connection.Mode); err != nil {
+		// Профиль цел, просто не подходит к режиму — сессию не удаляем.
+		return LaunchPlan{
+			Screen:         LaunchMain,
+			Session:        session.result(),
+			AccessProfile:  profile.ID,
+			Server:         profile.LastServer,
+			Profiles:       profiles,
+			FallbackReason: "Сохранённый профиль не подходит для выбранного режима подключения.",
+		}
+	}
+
+	return LaunchPlan{
+		Screen:             LaunchMain,
+		Session:            session.result(),
+		AccessProfile:      profile.ID,
+		Server:             profile.LastServer,
+		Profiles:           profiles,
+		PreferredTransport: session.LastGoodTransport,
+		AutoConnect:        s.Connection.AutoConnectOnLaunch,
+	}
+}
+
+func (s CachedSession) result() ActivateResult {
+	return ActivateResult{
+		SessionToken: s.SessionToken,
+		VPNProfile:   s.VPNProfile,
+		ProfileURL:   s.ProfileURL,
+	}
+}
+
+// preferTransport ставит профиль с ключом key первым, сохраняя порядок остальных.
+func preferTransport(profiles []Profile, key string) []Profile {
+	if key == "" {
+		return profiles
+	}
+	ordered := make([]Profile, 0, len(profiles))
+	for _, p := range profiles {
+		if TransportKey(p) == key {
+			ordered = append(ordered, p)
+		}
+	}
+	for _, p := range profiles {
+		if TransportKey(p) != key {
+			ordered = append(ordered, p)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,247 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/secretstore"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+func newTestSessionCache(now time.Time) (*SessionCache, *secretstore.Memory) {
+	store := secretstore.NewMemory()
+	cache := NewSessionCache(store)
+	cache.now = func() time.Time { return now }
+	return cache, store
+}
+
+func launchSettings(autoConnect bool) settings.Settings {
+	s := settings.Default()
+	s.Connection.AutoConnectOnLaunch = autoConnect
+	return s
+}
+
+func TestPlanLaunch_AutoConnectWithCachedSession(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	cache, _ := newTestSessionCache(now)
+	raw := testWSLink + "\n" + testRealityLink
+	if err := cache.Save(ActivateResult{SessionToken: "dummy-token", VPNProfile: raw}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	profiles, _ := ParseProfiles(raw)
+	if err := cache.MarkProfileGood(profiles[1]); err != nil {
+		t.Fatalf("MarkProfileGood: %v", err)
+	}
+
+	plan := PlanLaunch(cache, launchSettings(true))
+	if plan.Screen != LaunchMain || !plan.AutoConnect || plan.FallbackReason != "" {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if plan.Session.SessionToken != "dummy-token" {
+		t.Fatalf("session token not restored")
+	}
+	if len(plan.Profiles) != 2 || TransportKey(plan.Profiles[0]) != TransportKey(profiles[1]) {
+		t.Fatalf("last good profile is not first: %v", plan.Profiles)
+	}
+
+	if plan := PlanLaunch(cache, launchSettings(false)); plan.Screen != LaunchMain || plan.AutoConnect {
+		t.Fatalf("plan without auto-connect = %+v", plan)
+	}
+}
+
+func TestPlanLaunch_FallsBackToLogin(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("no session", func(t *testing.T) {
+		cache, _ := newTestSessionCache(now)
+		if plan := PlanLaunch(cache, launchSettings(true)); plan.Screen != LaunchLogin || plan.FallbackReason != "" {
+			t.Fatalf("plan = %+v", plan)
+		}
+	})
+
+	t.Run("remember device off", func(t *testing.T) {
+		cache, _ := newTestSessionCache(now)
+		_ = cache.Save(ActivateResult{VPNProfile: testRealityLink})
+		s := launchSettings(true)
+		s.Privacy.RememberDevice = false
+		if plan := PlanLaunch(cache, s); plan.Screen != LaunchLogin {
+			t.Fatalf("plan = %+v", plan)
+		}
+	})
+
+	cases := []struct {
+		name  string
+		setup func(*SessionCache, *secretstore.Memory)
+		// kept — профиль остаётся: он цел, устарела только сессия.
+		kept bool
+	}{
+		{"corrupted", func(_ *SessionCache, store *secretstore.Memory) {
+			_ = store.Set(sessionKey, []byte("{not json"))
+		}, false},
+		{"corrupted profiles", func(_ *SessionCache, store *secretstore.Memory) {
+			_ = store.Set(profilesKey, []byte("{not json"))
+		}, false},
+		{"expired", func(c *SessionCache, _ *secretstore.Memory) {
+			c.now = func() time.Time { return now.Add(-sessionMaxAge - time.Hour) }
+			_ = c.Save(ActivateResult{VPNProfile: testRealityLink})
+			c.now = func() time.Time { return now }
+		}, true},
+		{"bad profile", func(c *SessionCache, _ *secretstore.Memory) {
+			_ = c.Save(ActivateResult{VPNProfile: "vless://broken"})
+		}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cache, store := newTestSessionCache(now)
+			tc.setup(cache, store)
+			plan := PlanLaunch(cache, launchSettings(true))
+			if plan.Screen != LaunchLogin || plan.FallbackReason == "" {
+				t.Fatalf("plan = %+v", plan)
+			}
+			if _, err := store.Get(sessionKey); err == nil {
+				t.Fatal("legacy session left in the store")
+			}
+			if _, err := store.Get(profilesKey); (err == nil) != tc.kept {
+				t.Fatalf("profile kept = %v, want %v", err == nil, tc.kept)
+			}
+		})
+	}
+}
+
+// Вход после устаревшей сессии обновляет тот же профиль, а удачное
+// подключение продлевает сессию.
+func TestPlanLaunch_ExpiredSessionKeepsProfile(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	cache, _ := newTestSessionCache(now.Add(-sessionMaxAge - time.Hour))
+	if err := cache.Save(ActivateResult{SessionToken: "dummy-old-token", VPNProfile: testRealityLink}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	active, _ := cache.Active()
+	if err := cache.RenameProfile(active.ID, "Дом"); err != nil {
+		t.Fatalf("RenameProfile: %v", err)
+	}
+	cache.now = func() time.Time { return now }
+
+	if plan := PlanLaunch(cache, launchSettings(true)); plan.Screen != LaunchLogin {
+		t.Fatalf("plan = %+v", plan)
+	}
+	// Повторный вход тем же ключом обновляет сохранённый профиль.
+	if _, err := cache.AddProfile("", ActivateResult{SessionToken: "dummy-new-token", VPNProfile: testRealityLink}); err != nil {
+		t.Fatalf("AddProfile after login: %v", err)
+	}
+	profiles, err := cache.Profiles()
+	if err != nil || len(profiles) != 1 || profiles[0].Name != "Дом" || profiles[0].Session.SessionToken != "dummy-new-token" {
+		t.Fatalf("profiles after login = %+v, %v", profiles, err)
+	}
+
+	later := now.Add(sessionMaxAge - time.Hour)
+	cache.now = func() time.Time { return later }
+	if err := cache.MarkProfileGood(testProfile(t)); err != nil {
+		t.Fatalf("MarkProfileGood: %v", err)
+	}
+	cache.now = func() time.Time { return later.Add(sessionMaxAge - time.Hour) }
+	if plan := PlanLaunch(cache, launchSettings(true)); plan.Screen != LaunchMain {
+		t.Fatalf("session not extended by a successful connect: %+v", plan)
+	}
+}
+
+// unavailableStore — хранилище, которое временно не отвечает на чтение.
+type unavailableStore struct {
+	*secretstore.Memory
+	err error
+}
+
+func (s unavailableStore) Get(key string) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Memory.Get(key)
+}
+
+func TestPlanLaunch_KeepsProfileOnStoreError(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	saved, memory := newTestSessionCache(now)
+	if err := saved.Save(ActivateResult{SessionToken: "dummy-token", VPNProfile: testRealityLink}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	storeErr := errors.New("session bus is not available")
+	cache := NewSessionCache(unavailableStore{Memory: memory, err: storeErr})
+	cache.now = func() time.Time { return now }
+	plan := PlanLaunch(cache, launchSettings(true))
+	if plan.Screen != LaunchLogin || plan.FallbackReason == "" || !errors.Is(plan.Err, storeErr) {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if _, err := memory.Get(profilesKey); err != nil {
+		t.Fatalf("profile removed after store error: %v", err)
+	}
+
+	// Когда хранилище снова доступно, сохранённая сессия подхватывается.
+	cache = NewSessionCache(unavailableStore{Memory: memory})
+	cache.now = func() time.Time { return now }
+	if plan := PlanLaunch(cache, launchSettings(true)); plan.Screen != LaunchMain || plan.Err != nil {
+		t.Fatalf("plan after recovery = %+v", plan)
+	}
+}
+
+func TestPlanLaunch_ModeMismatchSkipsAutoConnect(t *testing.T) {
+	cache, _ := newTestSessionCache(time.Now())
+	_ = cache.Save(ActivateResult{VPNProfile: testWSLink})
+	s := launchSettings(true)
+	s.Connection.Mode = settings.ConnectionModeVLESSRealityOnly
+
+	plan := PlanLaunch(cache, s)
+	if plan.Screen != LaunchMain || plan.AutoConnect || plan.FallbackReason == "" {
+		t.Fatalf("plan = %+v", plan)
+	}
+}
+
+func TestSessionCache_DeviceIDPersistsOnlyWhenRemembered(t *testing.T) {
+	cache, store := newTestSessionCache(time.Now())
+
+	ephemeral, err := cache.DeviceID(false)
+	if err != nil || len(ephemeral) != 32 {
+		t.Fatalf("DeviceID = %q, %v", ephemeral, err)
+	}
+	if _, err := store.Get(deviceKeyKey); err == nil {
+		t.Fatal("device key stored without RememberDevice")
+	}
+	if again, _ := cache.DeviceID(false); again != ephemeral {
+		t.Fatalf("DeviceID changed within a run: %q != %q", again, ephemeral)
+	}
+
+	// Включение RememberDevice сохраняет тот же ключ.
+	remembered, err := cache.DeviceID(true)
+	if err != nil || remembered != ephemeral {
+		t.Fatalf("DeviceID(persist) = %q, %v; want %q", remembered, err, ephemeral)
+	}
+	key, err := store.Get(deviceKeyKey)
+	if err != nil || len(key) != deviceKeySize {
+		t.Fatalf("stored key = %d bytes, %v", len(key), err)
+	}
+	if restarted, _ := NewSessionCache(store).DeviceID(true); restarted != remembered {
+		t.Fatalf("DeviceID after restart = %q, want %q", restarted, remembered)
+	}
+}
+
+func TestSessionCache_WipeForgetsSessionAndDeviceKey(t *testing.T) {
+	cache, store := newTestSessionCache(time.Now())
+	if err := cache.Save(ActivateResult{SessionToken: "dummy-session", VPNProfile: "dummy-profile"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	before, _ := cache.DeviceID(true)
+
+	if err := cache.Wipe(); err != nil {
+		t.Fatalf("Wipe: %v", err)
+	}
+	if _, err := cache.Load(); err == nil {
+		t.Fatal("session survived Wipe")
+	}
+	if _, err := store.Get(deviceKeyKey); err == nil {
+		t.Fatal("device key survived Wipe")
+	}
+	if after, _ := cache.DeviceID(true); after == before {
+		t.Fatal("DeviceID unchanged after Wipe")
+	}
+}
@@ -0,0 +1,311 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+const (
+	ReasonAutoReconnect TransitionReason = "auto_reconnect"
+	ReasonNetworkChange TransitionReason = "network_changed"
+	ReasonTunnelStalled TransitionReason = "tunnel_stalled"
+)
+
+const (
+	defaultMaxReconnectInterval = 5 * time.Minute
+	defaultMaxReconnectAttempts = 8
+	reconnectAttemptTimeout     = time.Minute
+)
+
+// ReconnectPolicy — параметры автопереподключения.
+type ReconnectPolicy struct {
+	Enabled bool
+	// BaseInterval — задержка перед первой попыткой; далее удваивается.
+	BaseInterval time.Duration
+	// MaxInterval ограничивает задержку; 0 — без ограничения.
+	MaxInterval time.Duration
+	// MaxAttempts — после стольких неудач подряд супервизор сдаётся.
+	MaxAttempts int
+}
+
+// ReconnectPolicyFromSettings строит политику из пользовательских настроек.
+func ReconnectPolicyFromSettings(s settings.ConnectionSettings) ReconnectPolicy {
+	return ReconnectPolicy{
+		Enabled:      s.AutoReconnect,
+		BaseInterval: time.Duration(s.ReconnectIntervalSecs) * time.Second,
+		MaxInterval:  defaultMaxReconnectInterval,
+		MaxAttempts:  defaultMaxReconnectAttempts,
+	}
+}
+
+// Delay возвращает задержку перед попыткой с номером attempt (с 1).
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := p.BaseInterval
+	for i := 1; i < attempt && (p.MaxInterval <= 0 || d < p.MaxInterval); i++ {
+		if d <= 0 || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxInterval > 0 && d > p.MaxInterval {
+		d = p.MaxInterval
+	}
+	return d
+}
+
+// SupervisorStatus — состояние автопереподключения для UI.
+type SupervisorStatus struct {
+	Enabled bool
+	// Attempts — число неудачных попыток подряд.
+	Attempts    int
+	MaxAttempts int
+	LastError   error
+	// NextRetryAt — время запланированной попытки; нулевое, если её нет.
+	NextRetryAt time.Time
+	GaveUp      bool
+}
+
+// Supervisor следит за подключением и переподключает его после сбоев
+// с экспоненциальной задержкой. Смена сети вызывает немедленную попытку.
+type Supervisor struct {
+	conn *Connection
+
+	policyCh  chan ReconnectPolicy
+	networkCh chan struct{}
+	stalledCh chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+
+	mu     sync.Mutex
+	status SupervisorStatus
+
+	updates broadcaster[SupervisorStatus]
+}
+
+// NewSupervisor запускает супервизор. Close останавливает его.
+func NewSupervisor(conn *Connection, policy ReconnectPolicy) *Supervisor {
+	s := &Supervisor{
+		conn:      conn,
+		policyCh:  make(chan ReconnectPolicy, 1),
+		networkCh: make(chan struct{}, 1),
+		stalledCh: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		status:    SupervisorStatus{Enabled: policy.Enabled, MaxAttempts: policy.MaxAttempts},
+	}
+
+	events, unsubscribe := conn.Subscribe()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer unsubscribe()
+		s.run(events, policy)
+	}()
+	return s
+}
+
+// Close останавливает супервизор и ждёт завершения текущей попытки.
+func (s *Supervisor) Close() {
+	s.stopOnce.Do(func() { close(s.done) })
+	s.wg.Wait()
+}
+
+// UpdatePolicy применяет новую политику без перезапуска.
+func (s *Supervisor) UpdatePolicy(policy ReconnectPolicy) {
+	// Канал на одно значение: более новая политика вытесняет старую.
+	for {
+		select {
+		case s.policyCh <- policy:
+			return
+		default:
+		}
+		select {
+		case <-s.policyCh:
+		default:
+		}
+	}
+}
+
+// NotifyNetworkChanged сообщает о смене сети.
+func (s *Supervisor) NotifyNetworkChanged() {
+	select {
+	case s.networkCh <- struct{}{}:
+	default:
+	}
+}
+
+// NotifyStalled сообщает, что поднятый туннель не пропускает трафик.
+// Туннель переподключается, только если автопереподключение включено.
+func (s *Supervisor) NotifyStalled() {
+	select {
+	case s.stalledCh <- struct{}{}:
+	default:
+	}
+}
+
+// Status возвращает текущее состояние автопереподключения.
+func (s *Supervisor) Status() SupervisorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Subscribe подписывает на изменения SupervisorStatus.
+func (s *Supervisor) Subscribe() (<-chan SupervisorStatus, func()) {
+	return s.updates.subscribe()
+}
+
+func (s *Supervisor) run(events <-chan Transition, policy ReconnectPolicy) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.done
+		cancel()
+	}()
+
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, timerC = nil, nil
+	}
+	defer stopTimer()
+
+	schedule := func() {
+		stopTimer()
+		st := s.Status()
+		if !policy.Enabled || st.GaveUp {
+			return
+		}
+		delay := policy.Delay(st.Attempts + 1)
+		timer = time.NewTimer(delay)
+		timerC = timer.C
+		s.update(func(st *SupervisorStatus) { st.NextRetryAt = time.Now().Add(delay) })
+	}
+	attempt := func(reason TransitionReason) {
+		stopTimer()
+		s.update(func(st *SupervisorStatus) { st.NextRetryAt = time.Time{} })
+		attemptCtx, cancelAttempt := context.WithTimeout(ctx, reconnectAttemptTimeout)
+		defer cancelAttempt()
+		_ = s.conn.Reconnect(attemptCtx, reason)
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case t, ok := <-events:
+			if !ok {
+				return
+			}
+			switch t.To {
+			case StateConnected:
+				stopTimer()
+				s.reset(policy)
+			case StateDisconnected:
+				stopTimer()
+				s.reset(policy)
+			case StateFailed:
+				if !isRetryableFailure(t) {
+					stopTimer()
+					s.update(func(st *SupervisorStatus) { st.LastError = t.Err })
+					continue
+				}
+				s.update(func(st *SupervisorStatus) {
+					// Сбой установленного туннеля — первый в серии, а не
+					// продолжение предыдущих попыток.
+					if t.From == StateConnected {
+						st.Attempts = 0
+						st.GaveUp = false
+					}
+					if t.From == StateReconnecting {
+						st.Attempts++
+					}
+					st.LastError = t.Err
+					if policy.MaxAttempts > 0 && st.Attempts >= policy.MaxAttempts {
+						st.GaveUp = true
+					}
+				})
+				schedule()
+			}
+
+		case <-timerC:
+			timer, timerC = nil, nil
+			if s.conn.State() == StateFailed {
+				attempt(ReasonAutoReconnect)
+			}
+
+		case <-s.networkCh:
+			switch s.conn.State() {
+			case StateConnected:
+				attempt(ReasonNetworkChange)
+			case StateFailed:
+				if !policy.Enabled {
+					continue
+				}
+				// Новая сеть — новый шанс: счётчик сбрасывается.
+				s.reset(policy)
+				attempt(ReasonNetworkChange)
+			}
+
+		case <-s.stalledCh:
+			if policy.Enabled && s.conn.State() == StateConnected {
+				attempt(ReasonTunnelStalled)
+			}
+
+		case p := <-s.policyCh:
+			policy = p
+			s.update(func(st *SupervisorStatus) {
+				st.Enabled = p.Enabled
+				st.MaxAttempts = p.MaxAttempts
+			})
+			if !policy.Enabled {
+				stopTimer()
+				s.update(func(st *SupervisorStatus) { st.NextRetryAt = time.Time{} })
+			} else if timer != nil || (s.conn.State() == StateFailed && isRetryableFailure(s.conn.LastTransition())) {
+				// Перепланируем с новым интервалом.
+				schedule()
+			}
+		}
+	}
+}
+
+func (s *Supervisor) reset(policy ReconnectPolicy) {
+	s.update(func(st *SupervisorStatus) {
+		*st = SupervisorStatus{Enabled: policy.Enabled, MaxAttempts: policy.MaxAttempts}
+	})
+}
+
+func (s *Supervisor) update(change func(*SupervisorStatus)) {
+	s.mu.Lock()
+	change(&s.status)
+	st := s.status
+	s.mu.Unlock()
+	s.updates.publish(st)
+}
+
+// isRetryableFailure отделяет сбои, которые имеет смысл повторять,
+// от отмены пользователем и постоянных ошибок конфигурации.
+func isRetryableFailure(t Transition) bool {
+	if t.To != StateFailed {
+		return false
+	}
+	switch t.Reason {
+	case ReasonCancelled, ReasonNoEngine:
+		return false
+	}
+	return !errors.Is(t.Err, ErrProfileModeMismatch) &&
+		!errors.Is(t.Err, ErrCoreUnavailable) &&
+		!errors.Is(t.Err, ErrEmptyProfile)
+}
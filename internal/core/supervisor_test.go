@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testPolicy(base time.Duration, maxAttempts int) ReconnectPolicy {
+	return ReconnectPolicy{
+		Enabled:      true,
+		BaseInterval: base,
+		MaxInterval:  8 * base,
+		MaxAttempts:  maxAttempts,
+	}
+}
+
+func connectForTest(t *testing.T, conn *Connection) {
+	t.Helper()
+	if err := conn.Connect(context.Background(), []Profile{testProfile(t)}, testOptions(), ReasonUserRequest); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+}
+
+func waitStatus(t *testing.T, sup *Supervisor, cond func(SupervisorStatus) bool) SupervisorStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		st := sup.Status()
+		if cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status condition not met: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReconnectPolicy_Delay(t *testing.T) {
+	p := ReconnectPolicy{BaseInterval: 10 * time.Second, MaxInterval: time.Minute}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestReconnectPolicy_DelayWithoutCap(t *testing.T) {
+	p := ReconnectPolicy{BaseInterval: time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+	// Удвоение не переполняет time.Duration.
+	if got := p.Delay(100); got <= 0 {
+		t.Errorf("Delay(100) = %v, want positive", got)
+	}
+}
+
+func TestSupervisor_ReconnectsAfterEngineFailure(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	sup := NewSupervisor(conn, testPolicy(10*time.Millisecond, 5))
+	defer sup.Close()
+
+	connectForTest(t, conn)
+	engine.Fail(errors.New("tunnel dropped"))
+
+	waitState(t, conn, StateFailed)
+	waitState(t, conn, StateConnected)
+	if got := len(engine.Starts()); got != 2 {
+		t.Fatalf("engine starts = %d, want 2", got)
+	}
+	st := waitStatus(t, sup, func(st SupervisorStatus) bool { return st.Attempts == 0 && st.NextRetryAt.IsZero() })
+	if st.GaveUp {
+		t.Fatalf("status = %+v", st)
+	}
+}
+
+func TestSupervisor_BacksOffAndGivesUp(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	sup := NewSupervisor(conn, testPolicy(5*time.Millisecond, 3))
+	defer sup.Close()
+
+	connectForTest(t, conn)
+	startErr := errors.New("handshake failed")
+	engine.QueueStartResults(startErr, startErr, startErr, startErr)
+	engine.Fail(errors.New("tunnel dropped"))
+
+	st := waitStatus(t, sup, func(st SupervisorStatus) bool { return st.GaveUp })
+	if st.Attempts != 3 || !errors.Is(st.LastError, startErr) {
+		t.Fatalf("status = %+v", st)
+	}
+
+	// После отказа новых попыток нет.
+	time.Sleep(50 * time.Millisecond)
+	if got := len(engine.Starts()); got != 4 {
+		t.Fatalf("engine starts = %d, want 1 connect + 3 retries", got)
+	}
+	if conn.State() != StateFailed {
+		t.Fatalf("state = %s, want failed", conn.State())
+	}
+}
+
+func TestSupervisor_DisabledThenEnabledLive(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	policy := testPolicy(5*time.Millisecond, 5)
+	policy.Enabled = false
+	sup := NewSupervisor(conn, policy)
+	defer sup.Close()
+
+	connectForTest(t, conn)
+	engine.Fail(errors.New("tunnel dropped"))
+	waitState(t, conn, StateFailed)
+
+	time.Sleep(30 * time.Millisecond)
+	if got := len(engine.Starts()); got != 1 {
+		t.Fatalf("engine restarted while auto-reconnect is off: %d starts", got)
+	}
+
+	policy.Enabled = true
+	sup.UpdatePolicy(policy)
+	waitState(t, conn, StateConnected)
+}
+
+func TestSupervisor_NetworkChangeRetriesImmediately(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	sup := NewSupervisor(conn, testPolicy(time.Hour, 5))
+	defer sup.Close()
+
+	connectForTest(t, conn)
+	engine.Fail(errors.New("tunnel dropped"))
+	waitStatus(t, sup, func(st SupervisorStatus) bool { return !st.NextRetryAt.IsZero() })
+
+	sup.NotifyNetworkChanged()
+	waitState(t, conn, StateConnected)
+	if last := conn.LastTransition(); last.Reason != ReasonEngineReady {
+		t.Fatalf("last transition = %+v", last)
+	}
+}
+
+func TestSupervisor_IgnoresUserDisconnectAndCancel(t *testing.T) {
+	engine := NewFakeEngine()
+	conn := NewConnection(engine)
+	sup := NewSupervisor(conn, testPolicy(5*time.Millisecond, 5))
+	defer sup.Close()
+
+	connectForTest(t, conn)
+	if err := conn.Disconnect(context.Background(), ReasonUserRequest); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = conn.Connect(ctx, []Profile{testProfile(t)}, testOptions(), ReasonUserRequest)
+
+	time.Sleep(30 * time.Millisecond)
+	if got := conn.State(); got != StateFailed {
+		t.Fatalf("state = %s, want failed (cancelled connect is not retried)", got)
+	}
+	if got := len(engine.Starts()); got != 2 {
+		t.Fatalf("engine starts = %d, want 2", got)
+	}
+}
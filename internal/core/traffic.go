@@ -0,0 +1,288 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+const (
+	defaultTrafficInterval = time.Second
+	// minTrafficInterval ограничивает частоту публикации обновлений.
+	minTrafficInterval    = 250 * time.Millisecond
+	defaultTrafficHistory = 60
+	// trafficSmoothing — вес нового замера в экспоненциальном сглаживании.
+	trafficSmoothing = 0.3
+	// trafficSaveInterval — как часто сохранять общий объём, пока туннель поднят.
+	trafficSaveInterval = time.Minute
+)
+
+// TrafficTotalsStore хранит общий объём трафика между запусками
+// (см. settings.TrafficFile).
+type TrafficTotalsStore interface {
+	Load() (settings.TrafficTotals, error)
+	Save(settings.TrafficTotals) error
+}
+
+// TrafficSample — одна точка истории скоростей.
+type TrafficSample struct {
+	At       time.Time
+	UpRate   float64
+	DownRate float64
+}
+
+// TrafficSnapshot — текущее состояние счётчиков трафика.
+type TrafficSnapshot struct {
+	At time.Time
+	// Active — туннель поднят и счётчики движка растут.
+	Active bool
+	// UpRate и DownRate — сглаженные скорости в байтах в секунду.
+	UpRate   float64
+	DownRate float64
+	// Session* — объём текущей (или последней) сессии.
+	SessionUp   uint64
+	SessionDown uint64
+	// Lifetime* — объём за всё время. Переживает перезапуск, если задано
+	// хранилище (см. TrafficStats.PersistTotals); иначе — с запуска процесса.
+	LifetimeUp   uint64
+	LifetimeDown uint64
+}
+
+// TrafficStats периодически опрашивает счётчики движка, сглаживает
+// скорости и хранит историю фиксированного размера.
+type TrafficStats struct {
+	engine   TunnelEngine
+	interval time.Duration
+
+	mu           sync.Mutex
+	sessionStart time.Time
+	lastUp       uint64
+	lastDown     uint64
+	lastAt       time.Time
+	snapshot     TrafficSnapshot
+	history      []TrafficSample
+	next         int
+	full         bool
+
+	// store сохраняет общий объём; saved и savedAt — последняя запись.
+	store   TrafficTotalsStore
+	saved   settings.TrafficTotals
+	savedAt time.Time
+
+	updates  broadcaster[TrafficSnapshot]
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewTrafficStats запускает сбор статистики. interval <= 0 и historySize <= 0
+// означают значения по умолчанию; interval не может быть меньше 250 мс.
+// Close останавливает сбор.
+func NewTrafficStats(engine TunnelEngine, interval time.Duration, historySize int) *TrafficStats {
+	t := newTrafficStats(engine, interval, historySize)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case now := <-ticker.C:
+				t.sample(now)
+			}
+		}
+	}()
+	return t
+}
+
+func newTrafficStats(engine TunnelEngine, interval time.Duration, historySize int) *TrafficStats {
+	if interval <= 0 {
+		interval = defaultTrafficInterval
+	}
+	if interval < minTrafficInterval {
+		interval = minTrafficInterval
+	}
+	if historySize <= 0 {
+		historySize = defaultTrafficHistory
+	}
+	return &TrafficStats{
+		engine:   engine,
+		interval: interval,
+		history:  make([]TrafficSample, historySize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Close останавливает сбор статистики и сохраняет общий объём.
+func (t *TrafficStats) Close() {
+	t.stopOnce.Do(func() { close(t.done) })
+	t.wg.Wait()
+
+	t.mu.Lock()
+	totals, save := t.totalsToSaveLocked(time.Now(), true)
+	store := t.store
+	t.mu.Unlock()
+	if save {
+		_ = store.Save(totals)
+	}
+}
+
+// PersistTotals подключает хранилище общего объёма: сохранённый объём
+// прибавляется к счётчикам, а новый записывается при остановке туннеля,
+// раз в минуту во время работы и в Close. Если прочитать хранилище не
+// удалось, оно не подключается, чтобы не затереть сохранённый объём.
+func (t *TrafficStats) PersistTotals(store TrafficTotalsStore) error {
+	loaded, err := store.Load()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.snapshot.LifetimeUp += loaded.Up
+	t.snapshot.LifetimeDown += loaded.Down
+	t.store, t.saved = store, loaded
+	return nil
+}
+
+// ResetTotals обнуляет общий объём, например после удаления локальных
+// данных; хранилище при этом не перезаписывается.
+func (t *TrafficStats) ResetTotals() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.snapshot.LifetimeUp, t.snapshot.LifetimeDown = 0, 0
+	t.saved = settings.TrafficTotals{}
+}
+
+// totalsToSaveLocked решает, пора ли записать общий объём: при изменении
+// и если туннель остановлен, прошёл trafficSaveInterval или force.
+func (t *TrafficStats) totalsToSaveLocked(now time.Time, force bool) (settings.TrafficTotals, bool) {
+	totals := settings.TrafficTotals{Up: t.snapshot.LifetimeUp, Down: t.snapshot.LifetimeDown}
+	if t.store == nil || totals == t.saved {
+		return totals, false
+	}
+	if !force && t.snapshot.Active && now.Sub(t.savedAt) < trafficSaveInterval {
+		return totals, false
+	}
+	t.saved, t.savedAt = totals, now
+	return totals, true
+}
+
+// Snapshot возвращает последние вычисленные значения.
+func (t *TrafficStats) Snapshot() TrafficSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.snapshot
+}
+
+// History возвращает историю скоростей от старых к новым.
+func (t *TrafficStats) History() []TrafficSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full {
+		return append([]TrafficSample(nil), t.history[:t.next]...)
+	}
+	out := make([]TrafficSample, 0, len(t.history))
+	out = append(out, t.history[t.next:]...)
+	return append(out, t.history[:t.next]...)
+}
+
+// Subscribe подписывает на обновления; они приходят не чаще раза за интервал
+// опроса и только при изменениях.
+func (t *TrafficStats) Subscribe() (<-chan TrafficSnapshot, func()) {
+	return t.updates.subscribe()
+}
+
+func (t *TrafficStats) sample(now time.Time) {
+	st := t.engine.Stats()
+
+	t.mu.Lock()
+	prev := t.snapshot
+	s := prev
+	s.At = now
+
+	if st.StartedAt.IsZero() {
+		// Туннель остановлен: объём сессии сохраняем до следующего запуска.
+		s.Active = false
+		s.UpRate, s.DownRate = 0, 0
+		t.sessionStart = time.Time{}
+		t.lastAt = time.Time{}
+	} else {
+		if !st.StartedAt.Equal(t.sessionStart) || st.BytesUp < t.lastUp || st.BytesDown < t.lastDown {
+			// Новая сессия: счётчики движка начинаются с нуля.
+			t.sessionStart = st.StartedAt
+			t.lastUp, t.lastDown = 0, 0
+			t.lastAt = time.Time{}
+			s.UpRate, s.DownRate = 0, 0
+		}
+		deltaUp := st.BytesUp - t.lastUp
+		deltaDown := st.BytesDown - t.lastDown
+		if !t.lastAt.IsZero() {
+			if elapsed := now.Sub(t.lastAt).Seconds(); elapsed > 0 {
+				s.UpRate = smoothRate(s.UpRate, float64(deltaUp)/elapsed)
+				s.DownRate = smoothRate(s.DownRate, float64(deltaDown)/elapsed)
+			}
+		}
+		s.Active = true
+		s.SessionUp, s.SessionDown = st.BytesUp, st.BytesDown
+		s.LifetimeUp += deltaUp
+		s.LifetimeDown += deltaDown
+		t.lastUp, t.lastDown, t.lastAt = st.BytesUp, st.BytesDown, now
+	}
+
+	t.snapshot = s
+	t.history[t.next] = TrafficSample{At: now, UpRate: s.UpRate, DownRate: s.DownRate}
+	t.next = (t.next + 1) % len(t.history)
+	if t.next == 0 {
+		t.full = true
+	}
+	totals, save := t.totalsToSaveLocked(now, false)
+	store := t.store
+	t.mu.Unlock()
+
+	if save {
+		_ = store.Save(totals)
+	}
+
+	if s.Active || s.Active != prev.Active || s.UpRate != prev.UpRate || s.DownRate != prev.DownRate {
+		t.updates.publish(s)
+	}
+}
+
+// smoothRate сглаживает скорость; первый замер после простоя берётся как есть.
+func smoothRate(prev, current float64) float64 {
+	if prev == 0 {
+		return current
+	}
+	return trafficSmoothing*current + (1-trafficSmoothing)*prev
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// FormatBytes форматирует объём в удобных единицах (по основанию 1024).
+func FormatBytes(n uint64) string {
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f %s", value, byteUnits[unit])
+	}
+	return fmt.Sprintf("%.0f %s", value, byteUnits[unit])
+}
+
+// FormatRate форматирует скорость в байтах в секунду.
+func FormatRate(bytesPerSecond float64) string {
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	return FormatBytes(uint64(bytesPerSecond+0.5)) + "/s"
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+func TestTrafficStats_RatesAndTotals(t *testing.T) {
+	engine := NewFakeEngine()
+	stats := newTrafficStats(engine, time.Second, 4)
+	base := time.Unix(1000, 0)
+
+	if err := engine.Start(context.Background(), testProfile(t), testOptions()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	stats.sample(base)
+
+	engine.AddTraffic(1000, 4000)
+	stats.sample(base.Add(time.Second))
+	s := stats.Snapshot()
+	if !s.Active || s.UpRate != 1000 || s.DownRate != 4000 {
+		t.Fatalf("first rates = %+v", s)
+	}
+
+	engine.AddTraffic(2000, 0)
+	stats.sample(base.Add(2 * time.Second))
+	s = stats.Snapshot()
+	// 0.3*2000 + 0.7*1000 и 0.3*0 + 0.7*4000.
+	if s.UpRate != 1300 || s.DownRate != 2800 {
+		t.Fatalf("smoothed rates = %v / %v", s.UpRate, s.DownRate)
+	}
+	if s.SessionUp != 3000 || s.SessionDown != 4000 {
+		t.Fatalf("session totals = %d / %d", s.SessionUp, s.SessionDown)
+	}
+
+	// Остановка обнуляет скорости, но не объём сессии.
+	_ = engine.Stop(context.Background())
+	stats.sample(base.Add(3 * time.Second))
+	s = stats.Snapshot()
+	if s.Active || s.UpRate != 0 || s.SessionUp != 3000 {
+		t.Fatalf("after stop = %+v", s)
+	}
+
+	// Новая сессия начинает свой счёт, общий объём продолжает расти.
+	_ = engine.Start(context.Background(), testProfile(t), testOptions())
+	engine.AddTraffic(500, 500)
+	stats.sample(base.Add(4 * time.Second))
+	s = stats.Snapshot()
+	if s.SessionUp != 500 || s.LifetimeUp != 3500 || s.LifetimeDown != 4500 {
+		t.Fatalf("second session = %+v", s)
+	}
+}
+
+func TestTrafficStats_HistoryRing(t *testing.T) {
+	engine := NewFakeEngine()
+	_ = engine.Start(context.Background(), testProfile(t), testOptions())
+	stats := newTrafficStats(engine, time.Second, 3)
+	base := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		stats.sample(base.Add(time.Duration(i) * time.Second))
+	}
+
+	history := stats.History()
+	if len(history) != 3 {
+		t.Fatalf("history length = %d, want 3", len(history))
+	}
+	for i, sample := range history {
+		if want := base.Add(time.Duration(i+2) * time.Second); !sample.At.Equal(want) {
+			t.Fatalf("history[%d].At = %v, want %v", i, sample.At, want)
+		}
+	}
+}
+
+func TestTrafficStats_PublishesOnlyChanges(t *testing.T) {
+	engine := NewFakeEngine()
+	stats := newTrafficStats(engine, time.Second, 0)
+	updates, unsubscribe := stats.Subscribe()
+	defer unsubscribe()
+
+	base := time.Unix(1000, 0)
+	stats.sample(base)
+	stats.sample(base.Add(time.Second))
+	select {
+	case s := <-updates:
+		t.Fatalf("idle tunnel published %+v", s)
+	default:
+	}
+
+	_ = engine.Start(context.Background(), testProfile(t), testOptions())
+	stats.sample(base.Add(2 * time.Second))
+	select {
+	case s := <-updates:
+		if !s.Active {
+			t.Fatalf("update = %+v", s)
+		}
+	default:
+		t.Fatal("no update after tunnel start")
+	}
+}
+
+// memoryTotals — хранилище общего объёма в памяти.
+type memoryTotals struct {
+	totals settings.TrafficTotals
+	saves  int
+}
+
+func (m *memoryTotals) Load() (settings.TrafficTotals, error) { return m.totals, nil }
+
+func (m *memoryTotals) Save(t settings.TrafficTotals) error {
+	m.totals = t
+	m.saves++
+	return nil
+}
+
+func TestTrafficStats_PersistTotals(t *testing.T) {
+	engine := NewFakeEngine()
+	store := &memoryTotals{totals: settings.TrafficTotals{Up: 100, Down: 200}}
+	stats := newTrafficStats(engine, time.Second, 0)
+	if err := stats.PersistTotals(store); err != nil {
+		t.Fatalf("PersistTotals: %v", err)
+	}
+	if s := stats.Snapshot(); s.LifetimeUp != 100 || s.LifetimeDown != 200 {
+		t.Fatalf("loaded totals = %+v", s)
+	}
+
+	base := time.Unix(1000, 0)
+	_ = engine.Start(context.Background(), testProfile(t), testOptions())
+	stats.sample(base)
+	engine.AddTraffic(10, 20)
+	stats.sample(base.Add(time.Second))
+	if store.saves != 1 || store.totals != (settings.TrafficTotals{Up: 110, Down: 220}) {
+		t.Fatalf("first save = %+v (%d saves)", store.totals, store.saves)
+	}
+
+	// Во время работы объём пишется не чаще trafficSaveInterval.
+	engine.AddTraffic(10, 20)
+	stats.sample(base.Add(2 * time.Second))
+	if store.saves != 1 {
+		t.Fatalf("saved %d times within the interval", store.saves)
+	}
+	engine.AddTraffic(10, 20)
+	stats.sample(base.Add(time.Second + trafficSaveInterval))
+	if store.saves != 2 || store.totals.Up != 130 {
+		t.Fatalf("periodic save = %+v (%d saves)", store.totals, store.saves)
+	}
+
+	// Остановка туннеля сохраняет объём сразу, но только один раз.
+	engine.AddTraffic(5, 5)
+	stats.sample(base.Add(trafficSaveInterval + 2*time.Second))
+	_ = engine.Stop(context.Background())
+	stats.sample(base.Add(trafficSaveInterval + 3*time.Second))
+	stats.sample(base.Add(trafficSaveInterval + 4*time.Second))
+	if store.saves != 3 || store.totals != (settings.TrafficTotals{Up: 135, Down: 265}) {
+		t.Fatalf("save on stop = %+v (%d saves)", store.totals, store.saves)
+	}
+	stats.Close()
+	if store.saves != 3 {
+		t.Fatalf("Close rewrote unchanged totals: %d saves", store.saves)
+	}
+}
+
+func TestTrafficStats_CloseSavesTotals(t *testing.T) {
+	engine := NewFakeEngine()
+	store := &memoryTotals{}
+	stats := newTrafficStats(engine, time.Second, 0)
+	if err := stats.PersistTotals(store); err != nil {
+		t.Fatalf("PersistTotals: %v", err)
+	}
+	base := time.Unix(1000, 0)
+	_ = engine.Start(context.Background(), testProfile(t), testOptions())
+	stats.sample(base)
+	engine.AddTraffic(10, 20)
+	stats.sample(base.Add(time.Second))
+	engine.AddTraffic(1, 2)
+	stats.sample(base.Add(2 * time.Second))
+
+	stats.Close()
+	if store.totals != (settings.TrafficTotals{Up: 11, Down: 22}) {
+		t.Fatalf("totals after Close = %+v", store.totals)
+	}
+}
+
+func TestTrafficStats_MinimumInterval(t *testing.T) {
+	stats := newTrafficStats(NewFakeEngine(), time.Millisecond, 0)
+	if stats.interval != minTrafficInterval {
+		t.Fatalf("interval = %v, want %v", stats.interval, minTrafficInterval)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[uint64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1536:        "1.5 KB",
+		20 * 1024:   "20 KB",
+		5 << 30:     "5.0 GB",
+		3 << 20 / 2: "1.5 MB",
+	}
+	for in, want := range cases {
+		if got := FormatBytes(in); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", in, got, want)
+		}
+	}
+	if got := FormatRate(1536); got != "1.5 KB/s" {
+		t.Errorf("FormatRate = %q", got)
+	}
+}
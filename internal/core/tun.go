@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/voltavpn/volta-client/internal/dnsstub"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+var ErrTUNUnsupported = errors.New("tun mode is not supported on this platform")
+
+// TUNConfig — параметры виртуального интерфейса режима TUN.
+type TUNConfig struct {
+	Name string
+	MTU  int
+	// SOCKS — вход ядра, которому пользовательский сетевой стек передаёт
+	// TCP‑ и UDP‑потоки с интерфейса.
+	SOCKS string
+	Auth  *ProxyCredentials
+	// Exclude — адреса VPN‑серверов: трафик к ним идёт мимо интерфейса,
+	// иначе туннель завернул бы сам себя.
+	Exclude []netip.Addr
+	// IPv6 — направить IPv6 в интерфейс, заблокировать маршрутом или
+	// оставить маршрутам системы.
+	IPv6 settings.IPv6Policy
+	// BypassApps — исполняемые файлы приложений, трафик которых идёт мимо
+	// интерфейса; BypassMark — метка их пакетов для правил маршрутизации.
+	BypassApps []string
+	BypassMark uint32
+	// DNS — локальная DNS‑заглушка. Если задана, системный резолвер
+	// направляется на адрес интерфейса, а запросы к нему передаются
+	// заглушке; при закрытии прежние настройки DNS возвращаются.
+	DNS netip.AddrPort
+}
+
+// TUNDevice — поднятый интерфейс с маршрутами. Close возвращает маршруты
+// и правила в исходное состояние и удаляет интерфейс.
+type TUNDevice interface {
+	Close() error
+}
+
+// TUNOpener поднимает интерфейс по конфигурации.
+type TUNOpener func(cfg TUNConfig) (TUNDevice, error)
+
+// TUNEngine — TunnelEngine, который в режиме InboundTUN после запуска
+// ядра поднимает интерфейс и направляет в него трафик устройства.
+// В остальных режимах он прозрачно передаёт вызовы внутреннему движку.
+type TUNEngine struct {
+	inner   TunnelEngine
+	open    TUNOpener
+	resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	mu     sync.Mutex
+	device TUNDevice
+}
+
+// NewTUNEngine оборачивает inner; open вызывается при каждом запуске в режиме TUN.
+func NewTUNEngine(inner TunnelEngine, open TUNOpener) *TUNEngine {
+	return &TUNEngine{
+		inner: inner,
+		open:  open,
+		resolve: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+}
+
+func (e *TUNEngine) Start(ctx context.Context, profile Profile, opts EngineOptions) error {
+	if opts.Inbound != InboundTUN {
+		return e.inner.Start(ctx, profile, opts)
+	}
+
+	// Адрес сервера резолвим до поднятия маршрутов: потом DNS пойдёт в туннель.
+	exclude, err := e.serverAddrs(ctx, profile)
+	if err != nil {
+		return err
+	}
+	if err := e.inner.Start(ctx, profile, opts); err != nil {
+		return err
+	}
+	cfg := TUNConfig{
+		Name:    tunInterfaceName,
+		MTU:     tunMTU,
+		SOCKS:   tunSOCKSAddress(),
+		Auth:    opts.ProxyAuth,
+		Exclude: exclude,
+		IPv6:    opts.Settings.Privacy.IPv6,
+	}
+	if opts.Settings.Privacy.DNSLeakProtection {
+		cfg.DNS = netip.MustParseAddrPort(dnsstub.DefaultAddr)
+	}
+	if apps := opts.Settings.Routing.BypassApps; len(apps) > 0 {
+		cfg.BypassApps = apps
+		cfg.BypassMark = tunBypassMark
+	}
+	device, err := e.open(cfg)
+	if err != nil {
+		_ = e.inner.Stop(context.Background())
+		return err
+	}
+
+	e.mu.Lock()
+	e.device = device
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *TUNEngine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	device := e.device
+	e.device = nil
+	e.mu.Unlock()
+
+	// Сначала возвращаем маршруты: без ядра трафик в интерфейсе пропадал бы.
+	var err error
+	if device != nil {
+		err = device.Close()
+	}
+	return errors.Join(err, e.inner.Stop(ctx))
+}
+
+func (e *TUNEngine) Stats() TunnelStats {
+	return e.inner.Stats()
+}
+
+func (e *TUNEngine) Events() <-chan EngineEvent {
+	return e.inner.Events()
+}
+
+func (e *TUNEngine) serverAddrs(ctx context.Context, p Profile) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(p.Address); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+	addrs, err := e.resolve(ctx, p.Address)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]netip.Addr, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, a.Unmap())
+	}
+	return out, nil
+}
+
+// tunSOCKSAddress — внутренний SOCKS5‑вход ядра для потоков из TUN.
+func tunSOCKSAddress() string {
+	return net.JoinHostPort(localProxyListen, strconv.Itoa(localTUNSOCKSPort))
+}
+
+var _ TunnelEngine = (*TUNEngine)(nil)
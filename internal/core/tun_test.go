@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+type fakeTUN struct {
+	configs []TUNConfig
+	closed  int
+	openErr error
+	// engine — чтобы проверить, что интерфейс закрыт до остановки ядра.
+	engine       *FakeEngine
+	stopsAtClose []int
+}
+
+func (f *fakeTUN) open(cfg TUNConfig) (TUNDevice, error) {
+	if f.openErr != nil {
+		return nil, f.openErr
+	}
+	f.configs = append(f.configs, cfg)
+	return f, nil
+}
+
+func (f *fakeTUN) Close() error {
+	f.closed++
+	f.stopsAtClose = append(f.stopsAtClose, f.engine.Stops())
+	return nil
+}
+
+func tunOptions(t *testing.T) EngineOptions {
+	t.Helper()
+	s := testOptions().Settings
+	s.Connection.TUN = true
+	opts, err := NewEngineOptions(s)
+	if err != nil {
+		t.Fatalf("NewEngineOptions: %v", err)
+	}
+	return opts
+}
+
+func TestTUNEngine_OpensDeviceAfterCore(t *testing.T) {
+	inner := NewFakeEngine()
+	tun := &fakeTUN{engine: inner}
+	engine := NewTUNEngine(inner, tun.open)
+	engine.resolve = func(context.Context, string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("::ffff:203.0.113.7")}, nil
+	}
+
+	opts := tunOptions(t)
+	if opts.Inbound != InboundTUN || opts.ProxyAuth == nil {
+		t.Fatalf("options = %+v, want TUN inbound with credentials", opts)
+	}
+	profile := testProfile(t)
+	profile.Address = "vpn.example.com"
+	if err := engine.Start(context.Background(), profile, opts); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(tun.configs) != 1 {
+		t.Fatalf("device opened %d times", len(tun.configs))
+	}
+	cfg := tun.configs[0]
+	if cfg.Name != "volta0" || cfg.SOCKS != "127.0.0.1:10807" || cfg.Auth != opts.ProxyAuth || cfg.IPv6 != settings.IPv6Block {
+		t.Fatalf("config = %+v", cfg)
+	}
+	if len(cfg.Exclude) != 1 || cfg.Exclude[0] != netip.MustParseAddr("203.0.113.7") {
+		t.Fatalf("exclude = %v", cfg.Exclude)
+	}
+	if len(cfg.BypassApps) != 0 || cfg.BypassMark != 0 {
+		t.Fatalf("bypass without apps in settings: %v, mark %#x", cfg.BypassApps, cfg.BypassMark)
+	}
+
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if tun.closed != 1 || tun.stopsAtClose[0] != 0 || inner.Stops() != 1 {
+		t.Fatalf("device must close before the core stops: closed=%d stopsAtClose=%v", tun.closed, tun.stopsAtClose)
+	}
+	if err := engine.Stop(context.Background()); err != nil || tun.closed != 1 {
+		t.Fatalf("second Stop: %v, closed=%d", err, tun.closed)
+	}
+}
+
+func TestTUNEngine_OpenFailureStopsCore(t *testing.T) {
+	inner := NewFakeEngine()
+	openErr := errors.New("operation not permitted")
+	engine := NewTUNEngine(inner, (&fakeTUN{engine: inner, openErr: openErr}).open)
+
+	err := engine.Start(context.Background(), testProfile(t), tunOptions(t))
+	if !errors.Is(err, openErr) {
+		t.Fatalf("Start error = %v", err)
+	}
+	if inner.Stops() != 1 {
+		t.Fatalf("core stops = %d, want 1", inner.Stops())
+	}
+}
+
+func TestTUNEngine_ProxyInboundPassesThrough(t *testing.T) {
+	inner := NewFakeEngine()
+	tun := &fakeTUN{engine: inner}
+	engine := NewTUNEngine(inner, tun.open)
+
+	if err := engine.Start(context.Background(), testProfile(t), testOptions()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if len(tun.configs) != 0 || len(inner.Starts()) != 1 {
+		t.Fatalf("proxy inbound opened a device: %+v", tun.configs)
+	}
+}
+
+func TestTUNEngine_PassesBypassApps(t *testing.T) {
+	inner := NewFakeEngine()
+	tun := &fakeTUN{engine: inner}
+	engine := NewTUNEngine(inner, tun.open)
+
+	opts := tunOptions(t)
+	opts.Settings.Routing.BypassApps = []string{"/usr/bin/apt", "/opt/ide/bin/ide"}
+	if err := engine.Start(context.Background(), testProfile(t), opts); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	cfg := tun.configs[0]
+	if !slices.Equal(cfg.BypassApps, opts.Settings.Routing.BypassApps) || cfg.BypassMark != tunBypassMark {
+		t.Fatalf("bypass = %v, mark %#x", cfg.BypassApps, cfg.BypassMark)
+	}
+}
+
+func TestTUNEngine_PassesDNSStub(t *testing.T) {
+	for _, protect := range []bool{true, false} {
+		inner := NewFakeEngine()
+		tun := &fakeTUN{engine: inner}
+		engine := NewTUNEngine(inner, tun.open)
+
+		opts := tunOptions(t)
+		opts.Settings.Privacy.DNSLeakProtection = protect
+		if err := engine.Start(context.Background(), testProfile(t), opts); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		want := netip.AddrPort{}
+		if protect {
+			want = netip.MustParseAddrPort("127.0.0.1:10853")
+		}
+		if got := tun.configs[0].DNS; got != want {
+			t.Fatalf("DNSLeakProtection=%v: DNS = %v, want %v", protect, got, want)
+		}
+	}
+}
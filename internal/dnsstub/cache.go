@@ -0,0 +1,166 @@
+package dnsstub
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultCacheSize = 1024
+	maxPositiveTTL   = time.Hour
+	maxNegativeTTL   = 15 * time.Minute
+	// defaultNegativeTTL — для отрицательных ответов без SOA (RFC 2308 §5).
+	defaultNegativeTTL = 30 * time.Second
+)
+
+type cacheKey struct {
+	name  string
+	qtype dnsmessage.Type
+	class dnsmessage.Class
+	do    bool
+}
+
+func newCacheKey(q dnsmessage.Question, do bool) cacheKey {
+	return cacheKey{name: strings.ToLower(q.Name.String()), qtype: q.Type, class: q.Class, do: do}
+}
+
+type cacheEntry struct {
+	msg      dnsmessage.Message
+	storedAt time.Time
+	expires  time.Time
+}
+
+// cache хранит ответы апстрима с учётом TTL, включая отрицательные
+// (NXDOMAIN и NODATA) по правилам RFC 2308.
+type cache struct {
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+func newCache(size int) *cache {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	return &cache{size: size, now: time.Now, entries: make(map[cacheKey]cacheEntry)}
+}
+
+// get возвращает копию ответа с уменьшенными TTL.
+func (c *cache) get(key cacheKey) (dnsmessage.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return dnsmessage.Message{}, false
+	}
+	now := c.now()
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return dnsmessage.Message{}, false
+	}
+	elapsed := uint32(now.Sub(entry.storedAt) / time.Second)
+	msg := cloneMessage(entry.msg)
+	ageResources(msg.Answers, elapsed)
+	ageResources(msg.Authorities, elapsed)
+	ageResources(msg.Additionals, elapsed)
+	return msg, true
+}
+
+// put кэширует копию ответа, если он кэшируемый: вызывающий дальше
+// упаковывает свой ответ, а Pack пишет в заголовки записей.
+func (c *cache) put(key cacheKey, msg dnsmessage.Message) {
+	ttl, ok := cacheTTL(msg)
+	if !ok || ttl <= 0 {
+		return
+	}
+	msg = cloneMessage(msg)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if len(c.entries) >= c.size {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Если просроченных нет, вытесняем произвольную запись.
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{msg: msg, storedAt: now, expires: now.Add(ttl)}
+}
+
+func (c *cache) clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.mu.Unlock()
+}
+
+// cacheTTL определяет срок хранения ответа: минимальный TTL записей для
+// положительных ответов и TTL SOA (не больше его MINIMUM) для отрицательных.
+func cacheTTL(msg dnsmessage.Message) (time.Duration, bool) {
+	if msg.Truncated {
+		return 0, false
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+		if len(msg.Answers) > 0 {
+			ttl := msg.Answers[0].Header.TTL
+			for _, rr := range msg.Answers[1:] {
+				ttl = min(ttl, rr.Header.TTL)
+			}
+			return min(time.Duration(ttl)*time.Second, maxPositiveTTL), true
+		}
+		return negativeTTL(msg), true
+	case dnsmessage.RCodeNameError:
+		return negativeTTL(msg), true
+	default:
+		return 0, false
+	}
+}
+
+func negativeTTL(msg dnsmessage.Message) time.Duration {
+	for _, rr := range msg.Authorities {
+		if soa, ok := rr.Body.(*dnsmessage.SOAResource); ok {
+			ttl := min(rr.Header.TTL, soa.MinTTL)
+			return min(time.Duration(ttl)*time.Second, maxNegativeTTL)
+		}
+	}
+	return defaultNegativeTTL
+}
+
+// cloneMessage копирует срезы вопросов и записей, чтобы копия не делила
+// с оригиналом их массивы. Тела записей только читаются и не копируются.
+func cloneMessage(msg dnsmessage.Message) dnsmessage.Message {
+	msg.Questions = slices.Clone(msg.Questions)
+	msg.Answers = slices.Clone(msg.Answers)
+	msg.Authorities = slices.Clone(msg.Authorities)
+	msg.Additionals = slices.Clone(msg.Additionals)
+	return msg
+}
+
+// ageResources уменьшает TTL записей на elapsed секунд.
+func ageResources(rrs []dnsmessage.Resource, elapsed uint32) {
+	for i := range rrs {
+		if rrs[i].Header.Type == dnsmessage.TypeOPT {
+			continue
+		}
+		if rrs[i].Header.TTL > elapsed {
+			rrs[i].Header.TTL -= elapsed
+		} else {
+			rrs[i].Header.TTL = 0
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// Package dnsstub implements a loopback DNS stub resolver. It answers
+// UDP and TCP queries from the local system and forwards them to upstreams
+// (DoH, DoT or plain DNS over TCP) that are dialled through the tunnel, so
+// DNS does not leak to the resolver configured by the network. Queries for
+// configured domains go to their own upstreams, and static host entries
+// are answered locally.
+package dnsstub
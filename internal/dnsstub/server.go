@@ -0,0 +1,475 @@
+package dnsstub
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultAddr — адрес заглушки по умолчанию, рядом с локальными
+	// портами прокси ядра.
+	DefaultAddr = "127.0.0.1:10853"
+
+	// upstreamUDPSize — размер EDNS‑буфера, который объявляем апстриму и
+	// клиентам (рекомендация DNS Flag Day 2020).
+	upstreamUDPSize = 1232
+	// legacyUDPSize — ограничение ответа по UDP для клиентов без EDNS.
+	legacyUDPSize = 512
+
+	// hostsTTL — TTL ответов из статических записей.
+	hostsTTL = 60
+
+	tcpIdleTimeout    = 10 * time.Second
+	maxUDPInFlight    = 64
+	queryTotalTimeout = 10 * time.Second
+)
+
+var ErrNoUpstream = errors.New("no DNS upstream configured")
+
+// Config — параметры заглушки.
+type Config struct {
+	// Addr — адрес на loopback; порт 0 выбирает свободный.
+	Addr string
+	// Upstreams — апстримы, до которых соединение идёт через туннель.
+	Upstreams []Upstream
+	// Fallback — апстримы без туннеля; используются, пока туннель не поднят
+	// и строгий режим выключен.
+	Fallback []Upstream
+	// Domains — свои апстримы для доменов и их поддоменов; первое
+	// совпадение побеждает. Остальные имена идут в Upstreams и Fallback.
+	Domains []DomainUpstreams
+	// Hosts — статические адреса по имени (в нижнем регистре, без точки в
+	// конце): на A и AAAA для этих имён заглушка отвечает сама.
+	Hosts map[string][]netip.Addr
+	// Strict — пока туннель не поднят, отвечать REFUSED.
+	Strict bool
+	// FilterAAAA — отвечать на запросы AAAA пустым ответом, когда IPv6
+	// заблокирован: приложение не ждёт недоступного адреса и идёт по IPv4.
+	FilterAAAA bool
+	// TunnelUp сообщает, поднят ли туннель; nil означает «всегда поднят».
+	TunnelUp  func() bool
+	CacheSize int
+}
+
+// DomainUpstreams — апстримы для домена Domain (в нижнем регистре, без
+// точки в конце) и его поддоменов; поля как у Config.
+type DomainUpstreams struct {
+	Domain    string
+	Upstreams []Upstream
+	Fallback  []Upstream
+}
+
+// Server — DNS‑заглушка на loopback (UDP и TCP на одном порту).
+type Server struct {
+	cfg        Config
+	cache      *cache
+	strict     atomic.Bool
+	filterAAAA atomic.Bool
+
+	mu     sync.Mutex
+	udp    net.PacketConn
+	tcp    net.Listener
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+	s := &Server{cfg: cfg, cache: newCache(cfg.CacheSize)}
+	s.strict.Store(cfg.Strict)
+	s.filterAAAA.Store(cfg.FilterAAAA)
+	return s
+}
+
+// Start открывает UDP‑ и TCP‑сокеты и начинает отвечать на запросы.
+func (s *Server) Start() error {
+	host, _, err := net.SplitHostPort(s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return errors.New("dns stub must listen on loopback")
+	}
+
+	udp, err := net.ListenPacket("udp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	// TCP — на том же порту, что выбран для UDP.
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		_ = udp.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.udp, s.tcp = udp, tcp
+	s.mu.Unlock()
+
+	s.wg.Add(2)
+	go s.serveUDP(udp)
+	go s.serveTCP(tcp)
+	return nil
+}
+
+// Addr возвращает фактический адрес заглушки после Start.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.udp == nil {
+		return s.cfg.Addr
+	}
+	return s.udp.LocalAddr().String()
+}
+
+// Close останавливает заглушку и ждёт завершения обработчиков.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	udp, tcp := s.udp, s.tcp
+	s.mu.Unlock()
+
+	var errs []error
+	if udp != nil {
+		errs = append(errs, udp.Close())
+	}
+	if tcp != nil {
+		errs = append(errs, tcp.Close())
+	}
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// SetStrict включает или выключает строгий режим на ходу.
+func (s *Server) SetStrict(strict bool) {
+	s.strict.Store(strict)
+}
+
+// SetFilterAAAA включает или выключает фильтрацию AAAA на ходу.
+func (s *Server) SetFilterAAAA(filter bool) {
+	s.filterAAAA.Store(filter)
+}
+
+// FlushCache сбрасывает кэш, например после смены сети.
+func (s *Server) FlushCache() {
+	s.cache.clear()
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	defer s.wg.Done()
+	sem := make(chan struct{}, maxUDPInFlight)
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		sem <- struct{}{}
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			defer func() { <-sem }()
+			if resp := s.handle(query, true); resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP(ln net.Listener) {
+	defer s.wg.Done()
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	defer func() {
+		mu.Lock()
+		for c := range conns {
+			_ = c.Close()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				_ = conn.Close()
+			}()
+			for {
+				_ = conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				resp := s.handle(query, false)
+				if resp == nil {
+					return
+				}
+				if err := writeTCPMessage(conn, resp); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle отвечает на один запрос. nil означает, что отвечать не нужно
+// (запрос не разбирается даже как заголовок).
+func (s *Server) handle(raw []byte, udp bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(raw); err != nil {
+		var p dnsmessage.Parser
+		header, herr := p.Start(raw)
+		if herr != nil || header.Response {
+			return nil
+		}
+		return s.reply(dnsmessage.Message{Header: header}, errorResponse(header, dnsmessage.RCodeFormatError), udp)
+	}
+	if query.Header.Response {
+		return nil
+	}
+	if query.Header.OpCode != 0 {
+		return s.reply(query, errorResponse(query.Header, dnsmessage.RCodeNotImplemented), udp)
+	}
+	if len(query.Questions) != 1 {
+		return s.reply(query, errorResponse(query.Header, dnsmessage.RCodeFormatError), udp)
+	}
+
+	if query.Questions[0].Type == dnsmessage.TypeAAAA && s.filterAAAA.Load() {
+		// NOERROR без записей: имя есть, но адресов IPv6 у него нет.
+		return s.reply(query, dnsmessage.Message{}, udp)
+	}
+
+	if resp, ok := s.hostsAnswer(query.Questions[0]); ok {
+		return s.reply(query, resp, udp)
+	}
+
+	_, do := clientEDNS(query)
+	key := newCacheKey(query.Questions[0], do)
+	if cached, ok := s.cache.get(key); ok {
+		return s.reply(query, cached, udp)
+	}
+
+	upstreams, rcode := s.route(questionName(query.Questions[0]))
+	if rcode != dnsmessage.RCodeSuccess {
+		return s.reply(query, errorResponse(query.Header, rcode), udp)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTotalTimeout)
+	defer cancel()
+	resp, err := s.forward(ctx, upstreams, query.Questions[0], do)
+	if err != nil {
+		return s.reply(query, errorResponse(query.Header, dnsmessage.RCodeServerFailure), udp)
+	}
+	s.cache.put(key, resp)
+	return s.reply(query, resp, udp)
+}
+
+// hostsAnswer отвечает на A и AAAA из статических записей. Имя без
+// адресов нужного семейства получает NOERROR без записей.
+func (s *Server) hostsAnswer(q dnsmessage.Question) (dnsmessage.Message, bool) {
+	if q.Type != dnsmessage.TypeA && q.Type != dnsmessage.TypeAAAA {
+		return dnsmessage.Message{}, false
+	}
+	addrs, ok := s.cfg.Hosts[questionName(q)]
+	if !ok {
+		return dnsmessage.Message{}, false
+	}
+	var resp dnsmessage.Message
+	for _, addr := range addrs {
+		header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: hostsTTL}
+		switch {
+		case q.Type == dnsmessage.TypeA && addr.Is4():
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: addr.As4()}})
+		case q.Type == dnsmessage.TypeAAAA && addr.Is6():
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	return resp, true
+}
+
+// route выбирает апстримы для имени по правилам доменов, состоянию
+// туннеля и строгому режиму.
+func (s *Server) route(name string) ([]Upstream, dnsmessage.RCode) {
+	upstreams, fallback := s.cfg.Upstreams, s.cfg.Fallback
+	for _, d := range s.cfg.Domains {
+		if name == d.Domain || strings.HasSuffix(name, "."+d.Domain) {
+			upstreams, fallback = d.Upstreams, d.Fallback
+			break
+		}
+	}
+
+	up := s.cfg.TunnelUp == nil || s.cfg.TunnelUp()
+	switch {
+	case up && len(upstreams) > 0:
+		return upstreams, dnsmessage.RCodeSuccess
+	case up:
+		return nil, dnsmessage.RCodeServerFailure
+	case s.strict.Load() || len(fallback) == 0:
+		return nil, dnsmessage.RCodeRefused
+	default:
+		return fallback, dnsmessage.RCodeSuccess
+	}
+}
+
+// forward отправляет запрос апстримам по очереди до первого годного ответа.
+// Опции EDNS клиента (в том числе Client Subnet) апстриму не передаются.
+func (s *Server) forward(ctx context.Context, upstreams []Upstream, q dnsmessage.Question, do bool) (dnsmessage.Message, error) {
+	upstreamQuery := dnsmessage.Message{
+		// ID 0 рекомендован для DoH (RFC 8484 §4.1) и кэшей на пути.
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	var opt dnsmessage.Resource
+	if err := opt.Header.SetEDNS0(upstreamUDPSize, dnsmessage.RCodeSuccess, do); err != nil {
+		return dnsmessage.Message{}, err
+	}
+	opt.Body = &dnsmessage.OPTResource{}
+	upstreamQuery.Additionals = []dnsmessage.Resource{opt}
+	packed, err := upstreamQuery.Pack()
+	if err != nil {
+		return dnsmessage.Message{}, err
+	}
+
+	var errs []error
+	for _, u := range upstreams {
+		raw, err := u.Exchange(ctx, packed)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(raw); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !resp.Header.Response || resp.Header.ID != 0 || len(resp.Questions) != 1 ||
+			!sameQuestion(resp.Questions[0], q) {
+			errs = append(errs, errors.New("mismatched DNS response"))
+			continue
+		}
+		if resp.RCode == dnsmessage.RCodeServerFailure || resp.RCode == dnsmessage.RCodeRefused {
+			errs = append(errs, errors.New("upstream returned "+resp.RCode.String()))
+			continue
+		}
+		return resp, nil
+	}
+	if len(errs) == 0 {
+		return dnsmessage.Message{}, ErrNoUpstream
+	}
+	return dnsmessage.Message{}, errors.Join(errs...)
+}
+
+// reply подгоняет ответ под клиента: ID и флаги запроса, EDNS только если
+// клиент его прислал, усечение по размеру UDP‑буфера клиента.
+func (s *Server) reply(query, resp dnsmessage.Message, udp bool) []byte {
+	clientOPT, do := clientEDNS(query)
+
+	resp.Header.ID = query.Header.ID
+	resp.Header.Response = true
+	resp.Header.OpCode = query.Header.OpCode
+	resp.Header.RecursionDesired = query.Header.RecursionDesired
+	resp.Header.RecursionAvailable = true
+	resp.Header.Authoritative = false
+	if len(resp.Questions) == 0 {
+		resp.Questions = query.Questions
+	}
+
+	var additionals []dnsmessage.Resource
+	for _, rr := range resp.Additionals {
+		if rr.Header.Type != dnsmessage.TypeOPT {
+			additionals = append(additionals, rr)
+		}
+	}
+	limit := legacyUDPSize
+	if clientOPT != nil {
+		var opt dnsmessage.Resource
+		_ = opt.Header.SetEDNS0(upstreamUDPSize, dnsmessage.RCodeSuccess, do)
+		opt.Body = &dnsmessage.OPTResource{}
+		additionals = append(additionals, opt)
+		limit = min(max(int(clientOPT.Header.Class), legacyUDPSize), upstreamUDPSize)
+	}
+	resp.Additionals = additionals
+
+	packed, err := resp.Pack()
+	if err != nil {
+		failure := errorResponse(query.Header, dnsmessage.RCodeServerFailure)
+		packed, _ = failure.Pack()
+		return packed
+	}
+	if !udp || len(packed) <= limit {
+		return packed
+	}
+
+	// Ответ не помещается в UDP: отдаём пустой ответ с TC, клиент
+	// повторит запрос по TCP.
+	resp.Header.Truncated = true
+	resp.Answers, resp.Authorities = nil, nil
+	var opts []dnsmessage.Resource
+	for _, rr := range resp.Additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT {
+			opts = append(opts, rr)
+		}
+	}
+	resp.Additionals = opts
+	packed, _ = resp.Pack()
+	return packed
+}
+
+// clientEDNS возвращает OPT‑запись запроса и бит DO.
+func clientEDNS(msg dnsmessage.Message) (*dnsmessage.Resource, bool) {
+	for i := range msg.Additionals {
+		if msg.Additionals[i].Header.Type == dnsmessage.TypeOPT {
+			rr := &msg.Additionals[i]
+			return rr, rr.Header.DNSSECAllowed()
+		}
+	}
+	return nil, false
+}
+
+func errorResponse(h dnsmessage.Header, rcode dnsmessage.RCode) dnsmessage.Message {
+	return dnsmessage.Message{Header: dnsmessage.Header{ID: h.ID, Response: true, RCode: rcode}}
+}
+
+// questionName — имя вопроса в нижнем регистре без точки в конце.
+func questionName(q dnsmessage.Question) string {
+	return strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+}
+
+func sameQuestion(a, b dnsmessage.Question) bool {
+	return a.Type == b.Type && a.Class == b.Class && strings.EqualFold(a.Name.String(), b.Name.String())
+}
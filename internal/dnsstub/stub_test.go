@@ -0,0 +1,470 @@
+package dnsstub
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeResolver отвечает по таблице: a.example — A‑запись, nx.example —
+// NXDOMAIN с SOA, big.example — ответ больше 512 байт.
+type fakeResolver struct {
+	mu      sync.Mutex
+	queries []dnsmessage.Message
+}
+
+func (f *fakeResolver) answer(raw []byte) ([]byte, error) {
+	var q dnsmessage.Message
+	if err := q.Unpack(raw); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.queries = append(f.queries, q)
+	f.mu.Unlock()
+
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: q.Header.ID, Response: true, RecursionAvailable: true},
+		Questions: q.Questions,
+	}
+	name := q.Questions[0].Name
+	switch strings.ToLower(name.String()) {
+	case "a.example.":
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}},
+		}}
+	case "nx.example.":
+		resp.RCode = dnsmessage.RCodeNameError
+		resp.Authorities = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example."), Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 600},
+			Body: &dnsmessage.SOAResource{
+				NS: dnsmessage.MustNewName("ns.example."), MBox: dnsmessage.MustNewName("admin.example."),
+				Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: 120,
+			},
+		}}
+	case "big.example.":
+		for i := 0; i < 10; i++ {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.TXTResource{TXT: []string{strings.Repeat("x", 100)}},
+			})
+		}
+	default:
+		resp.RCode = dnsmessage.RCodeServerFailure
+	}
+	return resp.Pack()
+}
+
+func (f *fakeResolver) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queries)
+}
+
+func (f *fakeResolver) last() dnsmessage.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries[len(f.queries)-1]
+}
+
+// newFakeDoH поднимает DoH‑сервер на loopback.
+func newFakeDoH(t *testing.T, f *fakeResolver) (string, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		resp, err := f.answer(body)
+		if err != nil {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(resp)
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return srv.URL + "/dns-query", pool
+}
+
+// newFakeDoT поднимает DoT‑сервер на loopback с сертификатом httptest.
+func newFakeDoT(t *testing.T, f *fakeResolver) (string, *x509.CertPool) {
+	t.Helper()
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	certSrv.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certSrv.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serveTCPResolver(ln, f)
+	pool := x509.NewCertPool()
+	pool.AddCert(certSrv.Certificate())
+	return ln.Addr().String(), pool
+}
+
+// newFakePlain поднимает обычный DNS‑сервер по TCP на loopback.
+func newFakePlain(t *testing.T, f *fakeResolver) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serveTCPResolver(ln, f)
+	return ln.Addr().String()
+}
+
+// serveTCPResolver отвечает на одно сообщение в каждом соединении.
+func serveTCPResolver(ln net.Listener, f *fakeResolver) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			query, err := readTCPMessage(conn)
+			if err != nil {
+				return
+			}
+			resp, err := f.answer(query)
+			if err != nil {
+				return
+			}
+			_ = writeTCPMessage(conn, resp)
+		}()
+	}
+}
+
+type failingUpstream struct{}
+
+func (failingUpstream) Exchange(context.Context, []byte) ([]byte, error) {
+	return nil, errors.New("unreachable")
+}
+
+func (failingUpstream) String() string { return "failing" }
+
+func startStub(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	return startStubWithClock(t, cfg, nil)
+}
+
+// startStubWithClock запускает заглушку с часами кэша now; часы задаются
+// до Start, пока их никто не читает.
+func startStubWithClock(t *testing.T, cfg Config, now func() time.Time) *Server {
+	t.Helper()
+	cfg.Addr = "127.0.0.1:0"
+	s := NewServer(cfg)
+	if now != nil {
+		s.cache.now = now
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func buildQuery(t *testing.T, name string, qtype dnsmessage.Type, edns bool) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 0xBEEF, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET,
+		}},
+	}
+	if edns {
+		var opt dnsmessage.Resource
+		_ = opt.Header.SetEDNS0(4096, dnsmessage.RCodeSuccess, false)
+		// Client Subnet (код 8) не должен уйти апстриму.
+		opt.Body = &dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: 8, Data: []byte{0, 1, 24, 0, 198, 51, 100}}}}
+		msg.Additionals = []dnsmessage.Resource{opt}
+	}
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	return raw
+}
+
+func queryUDP(t *testing.T, addr string, raw []byte) dnsmessage.Message {
+	t.Helper()
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(raw); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil {
+		t.Fatalf("unpack: %v", err)
+	}
+	return resp
+}
+
+func queryTCP(t *testing.T, addr string, raw []byte) dnsmessage.Message {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := writeTCPMessage(conn, raw); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	data, err := readTCPMessage(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(data); err != nil {
+		t.Fatalf("unpack: %v", err)
+	}
+	return resp
+}
+
+func TestStub_ForwardsOverDoHAndCaches(t *testing.T) {
+	resolver := &fakeResolver{}
+	endpoint, pool := newFakeDoH(t, resolver)
+	doh, err := NewDoH(endpoint, nil, pool)
+	if err != nil {
+		t.Fatalf("NewDoH: %v", err)
+	}
+	stub := startStub(t, Config{Upstreams: []Upstream{doh}})
+
+	resp := queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeA, true))
+	if resp.Header.ID != 0xBEEF || resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 {
+		t.Fatalf("response = %+v", resp)
+	}
+	if a := resp.Answers[0].Body.(*dnsmessage.AResource); a.A != [4]byte{192, 0, 2, 10} {
+		t.Fatalf("answer = %v", a.A)
+	}
+	if opt, _ := clientEDNS(resp); opt == nil {
+		t.Fatal("EDNS client got no OPT in response")
+	}
+
+	upstreamQuery := resolver.last()
+	if upstreamQuery.Header.ID != 0 {
+		t.Fatalf("upstream query ID = %d, want 0", upstreamQuery.Header.ID)
+	}
+	opt, _ := clientEDNS(upstreamQuery)
+	if opt == nil || len(opt.Body.(*dnsmessage.OPTResource).Options) != 0 {
+		t.Fatalf("client EDNS options leaked upstream: %+v", opt)
+	}
+
+	// Повтор (в другом регистре и по TCP) — из кэша.
+	resp = queryTCP(t, stub.Addr(), buildQuery(t, "A.Example.", dnsmessage.TypeA, true))
+	if len(resp.Answers) != 1 || resp.Answers[0].Header.TTL > 300 {
+		t.Fatalf("cached response = %+v", resp)
+	}
+	if got := resolver.count(); got != 1 {
+		t.Fatalf("upstream queries = %d, want 1", got)
+	}
+}
+
+func TestStub_NegativeCachingOverDoT(t *testing.T) {
+	resolver := &fakeResolver{}
+	addr, pool := newFakeDoT(t, resolver)
+	dot, err := NewDoT(addr, "example.com", nil, pool)
+	if err != nil {
+		t.Fatalf("NewDoT: %v", err)
+	}
+	var skew atomic.Int64
+	stub := startStubWithClock(t, Config{Upstreams: []Upstream{dot}}, func() time.Time {
+		return time.Now().Add(time.Duration(skew.Load()))
+	})
+
+	for i := 0; i < 2; i++ {
+		resp := queryUDP(t, stub.Addr(), buildQuery(t, "nx.example.", dnsmessage.TypeA, false))
+		if resp.RCode != dnsmessage.RCodeNameError {
+			t.Fatalf("rcode = %v, want NXDOMAIN", resp.RCode)
+		}
+		if _, hasOPT := clientEDNS(resp); hasOPT || len(resp.Additionals) != 0 {
+			t.Fatalf("non-EDNS client got OPT: %+v", resp.Additionals)
+		}
+	}
+	if got := resolver.count(); got != 1 {
+		t.Fatalf("upstream queries = %d, want 1 (NXDOMAIN cached)", got)
+	}
+
+	// Срок отрицательного кэша — MINIMUM из SOA (120 с), а не TTL SOA.
+	skew.Store(int64(121 * time.Second))
+	queryUDP(t, stub.Addr(), buildQuery(t, "nx.example.", dnsmessage.TypeA, false))
+	if got := resolver.count(); got != 2 {
+		t.Fatalf("upstream queries = %d, want 2 after negative TTL", got)
+	}
+}
+
+func TestStub_TruncatesLargeUDPResponses(t *testing.T) {
+	resolver := &fakeResolver{}
+	endpoint, pool := newFakeDoH(t, resolver)
+	doh, _ := NewDoH(endpoint, nil, pool)
+	stub := startStub(t, Config{Upstreams: []Upstream{doh}})
+
+	resp := queryUDP(t, stub.Addr(), buildQuery(t, "big.example.", dnsmessage.TypeTXT, false))
+	if !resp.Header.Truncated || len(resp.Answers) != 0 {
+		t.Fatalf("UDP response without EDNS not truncated: tc=%v answers=%d", resp.Header.Truncated, len(resp.Answers))
+	}
+	resp = queryTCP(t, stub.Addr(), buildQuery(t, "big.example.", dnsmessage.TypeTXT, false))
+	if resp.Header.Truncated || len(resp.Answers) != 10 {
+		t.Fatalf("TCP response: tc=%v answers=%d", resp.Header.Truncated, len(resp.Answers))
+	}
+	resp = queryUDP(t, stub.Addr(), buildQuery(t, "big.example.", dnsmessage.TypeTXT, true))
+	if resp.Header.Truncated || len(resp.Answers) != 10 {
+		t.Fatalf("EDNS UDP response: tc=%v answers=%d", resp.Header.Truncated, len(resp.Answers))
+	}
+}
+
+func TestStub_StrictModeAndFailover(t *testing.T) {
+	resolver := &fakeResolver{}
+	endpoint, pool := newFakeDoH(t, resolver)
+	doh, _ := NewDoH(endpoint, nil, pool)
+
+	var mu sync.Mutex
+	tunnelUp := false
+	stub := startStub(t, Config{
+		Upstreams: []Upstream{failingUpstream{}, doh},
+		Fallback:  []Upstream{doh},
+		Strict:    true,
+		TunnelUp: func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return tunnelUp
+		},
+	})
+
+	resp := queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeA, false))
+	if resp.RCode != dnsmessage.RCodeRefused || resolver.count() != 0 {
+		t.Fatalf("strict mode without tunnel: rcode=%v upstream=%d", resp.RCode, resolver.count())
+	}
+
+	stub.SetStrict(false)
+	resp = queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeA, false))
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		t.Fatalf("fallback rcode = %v", resp.RCode)
+	}
+	stub.FlushCache()
+
+	mu.Lock()
+	tunnelUp = true
+	mu.Unlock()
+	stub.SetStrict(true)
+	resp = queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeA, false))
+	if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 {
+		t.Fatalf("tunnel up, first upstream failing: rcode=%v", resp.RCode)
+	}
+
+	resp = queryUDP(t, stub.Addr(), buildQuery(t, "servfail.example.", dnsmessage.TypeA, false))
+	if resp.RCode != dnsmessage.RCodeServerFailure {
+		t.Fatalf("rcode = %v, want SERVFAIL", resp.RCode)
+	}
+}
+
+func TestStub_FiltersAAAA(t *testing.T) {
+	resolver := &fakeResolver{}
+	endpoint, pool := newFakeDoH(t, resolver)
+	doh, _ := NewDoH(endpoint, nil, pool)
+	stub := startStub(t, Config{Upstreams: []Upstream{doh}, FilterAAAA: true})
+
+	resp := queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeAAAA, true))
+	if resp.Header.ID != 0xBEEF || resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 0 || len(resp.Questions) != 1 {
+		t.Fatalf("filtered AAAA response = %+v", resp)
+	}
+	if got := resolver.count(); got != 0 {
+		t.Fatalf("upstream queries = %d, want AAAA answered locally", got)
+	}
+	resp = queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeA, false))
+	if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 {
+		t.Fatalf("A response with AAAA filtered = %+v", resp)
+	}
+
+	stub.SetFilterAAAA(false)
+	queryUDP(t, stub.Addr(), buildQuery(t, "a.example.", dnsmessage.TypeAAAA, false))
+	if got := resolver.count(); got != 2 {
+		t.Fatalf("upstream queries = %d, want AAAA forwarded once filter is off", got)
+	}
+}
+
+func TestStub_DomainUpstreamsAndHosts(t *testing.T) {
+	public := &fakeResolver{}
+	endpoint, pool := newFakeDoH(t, public)
+	doh, _ := NewDoH(endpoint, nil, pool)
+	corp := &fakeResolver{}
+	plain, err := NewPlain(newFakePlain(t, corp), nil)
+	if err != nil {
+		t.Fatalf("NewPlain: %v", err)
+	}
+	stub := startStub(t, Config{
+		Upstreams: []Upstream{doh},
+		Domains:   []DomainUpstreams{{Domain: "a.example", Upstreams: []Upstream{plain}}},
+		Hosts: map[string][]netip.Addr{
+			"static.example": {netip.MustParseAddr("192.0.2.77"), netip.MustParseAddr("192.0.2.78")},
+		},
+	})
+
+	// Поддомен правила тоже идёт к своему серверу.
+	for _, name := range []string{"a.example.", "A.Example."} {
+		resp := queryUDP(t, stub.Addr(), buildQuery(t, name, dnsmessage.TypeA, false))
+		if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 1 {
+			t.Fatalf("%s via domain upstream = %+v", name, resp)
+		}
+	}
+	queryUDP(t, stub.Addr(), buildQuery(t, "x.a.example.", dnsmessage.TypeA, false))
+	queryUDP(t, stub.Addr(), buildQuery(t, "nx.example.", dnsmessage.TypeA, false))
+	if corp.count() != 2 || public.count() != 1 {
+		t.Fatalf("domain upstream queries = %d, default = %d; want 2 and 1", corp.count(), public.count())
+	}
+
+	resp := queryTCP(t, stub.Addr(), buildQuery(t, "Static.Example.", dnsmessage.TypeA, true))
+	if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 2 {
+		t.Fatalf("static A = %+v", resp)
+	}
+	if a := resp.Answers[0].Body.(*dnsmessage.AResource); a.A != [4]byte{192, 0, 2, 77} || resp.Answers[0].Header.TTL != hostsTTL {
+		t.Fatalf("static answer = %v, TTL %d", a.A, resp.Answers[0].Header.TTL)
+	}
+	resp = queryUDP(t, stub.Addr(), buildQuery(t, "static.example.", dnsmessage.TypeAAAA, false))
+	if resp.RCode != dnsmessage.RCodeSuccess || len(resp.Answers) != 0 {
+		t.Fatalf("static AAAA without IPv6 addresses = %+v", resp)
+	}
+	if corp.count() != 2 || public.count() != 1 {
+		t.Fatal("static names were forwarded upstream")
+	}
+}
+
+func TestStub_RejectsNonLoopback(t *testing.T) {
+	s := NewServer(Config{Addr: "0.0.0.0:0"})
+	if err := s.Start(); err == nil {
+		s.Close()
+		t.Fatal("stub listened on a non-loopback address")
+	}
+}
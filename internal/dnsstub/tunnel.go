@@ -0,0 +1,66 @@
+package dnsstub
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"golang.org/x/net/proxy"
+)
+
+// DefaultDoH — резолвер по умолчанию, совпадающий с DNS внутри туннеля.
+const DefaultDoH = "https://1.1.1.1/dns-query"
+
+// SOCKSEndpoint — адрес SOCKS5‑входа ядра и, если вход защищён паролем,
+// учётные данные.
+type SOCKSEndpoint struct {
+	Address  string
+	Username string
+	Password string
+}
+
+// SOCKSDialer открывает соединения через SOCKS5‑вход ядра. endpoint
+// вызывается при каждом подключении; если входа нет (режим TUN), трафик
+// идёт напрямую и попадает в туннель по маршрутам.
+func SOCKSDialer(endpoint func() (SOCKSEndpoint, bool)) DialFunc {
+	var direct net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		socks, ok := endpoint()
+		if !ok {
+			return direct.DialContext(ctx, network, addr)
+		}
+		var auth *proxy.Auth
+		if socks.Username != "" {
+			auth = &proxy.Auth{User: socks.Username, Password: socks.Password}
+		}
+		d, err := proxy.SOCKS5("tcp", socks.Address, auth, &direct)
+		if err != nil {
+			return nil, err
+		}
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.New("socks dialer does not support context")
+		}
+		return cd.DialContext(ctx, network, addr)
+	}
+}
+
+// TunnelConfig собирает конфигурацию заглушки: DoH через туннель, а пока
+// туннель не поднят — DoH напрямую (если не включён строгий режим).
+func TunnelConfig(tunnel DialFunc, strict bool, tunnelUp func() bool) (Config, error) {
+	viaTunnel, err := NewDoH(DefaultDoH, tunnel, nil)
+	if err != nil {
+		return Config{}, err
+	}
+	direct, err := NewDoH(DefaultDoH, nil, nil)
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		Addr:      DefaultAddr,
+		Upstreams: []Upstream{viaTunnel},
+		Fallback:  []Upstream{direct},
+		Strict:    strict,
+		TunnelUp:  tunnelUp,
+	}, nil
+}
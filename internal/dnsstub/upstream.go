@@ -0,0 +1,202 @@
+package dnsstub
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	maxMessageSize  = 65535
+	upstreamTimeout = 5 * time.Second
+)
+
+// DialFunc открывает соединение до апстрима: через туннель или напрямую.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Upstream пересылает DNS‑запрос в проводном формате и возвращает ответ.
+type Upstream interface {
+	Exchange(ctx context.Context, query []byte) ([]byte, error)
+	String() string
+}
+
+// DoH — апстрим DNS‑over‑HTTPS (RFC 8484, метод POST).
+type DoH struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoH создаёт DoH‑апстрим. dial задаёт путь до сервера (nil — напрямую),
+// rootCAs — доверенные корни (nil — системные).
+func NewDoH(endpoint string, dial DialFunc, rootCAs *x509.CertPool) (*DoH, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("invalid DoH endpoint")
+	}
+	transport := &http.Transport{
+		TLSClientConfig:     &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12},
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     30 * time.Second,
+		// Прокси окружения не используем: путь задаёт только dial.
+		Proxy: nil,
+	}
+	if dial != nil {
+		transport.DialContext = dial
+	}
+	return &DoH{
+		url:    u.String(),
+		client: &http.Client{Transport: transport, Timeout: upstreamTimeout},
+	}, nil
+}
+
+func (d *DoH) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+}
+
+func (d *DoH) String() string {
+	return "https://" + hostOf(d.url)
+}
+
+// DoT — апстрим DNS‑over‑TLS (RFC 7858). Каждый запрос идёт по новому
+// соединению: запросов мало, а кэш снимает основную нагрузку.
+type DoT struct {
+	address string
+	dial    DialFunc
+	tls     *tls.Config
+}
+
+// NewDoT создаёт DoT‑апстрим по адресу host:port; serverName проверяется
+// в сертификате.
+func NewDoT(address, serverName string, dial DialFunc, rootCAs *x509.CertPool) (*DoT, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, errors.New("invalid DoT address")
+	}
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	return &DoT{
+		address: address,
+		dial:    dial,
+		tls:     &tls.Config{ServerName: serverName, RootCAs: rootCAs, MinVersion: tls.VersionTLS12},
+	}, nil
+}
+
+func (d *DoT) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	raw, err := d.dial(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, err
+	}
+	conn := tls.Client(raw, d.tls)
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+func (d *DoT) String() string {
+	return "tls://" + d.address
+}
+
+// Plain — апстрим обычного DNS. Запросы идут по TCP (RFC 7766): SOCKS5‑вход
+// ядра, через который открываются соединения, UDP не пропускает.
+type Plain struct {
+	address string
+	dial    DialFunc
+}
+
+// NewPlain создаёт апстрим обычного DNS по адресу ip:port.
+func NewPlain(address string, dial DialFunc) (*Plain, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) == nil {
+		return nil, errors.New("invalid plain DNS address")
+	}
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	return &Plain{address: address, dial: dial}, nil
+}
+
+func (p *Plain) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	conn, err := p.dial(ctx, "tcp", p.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
+
+func (p *Plain) String() string {
+	return "tcp://" + p.address
+}
+
+// writeTCPMessage пишет сообщение с двухбайтовым префиксом длины.
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	if len(msg) > maxMessageSize {
+		return errors.New("dns message too large")
+	}
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -2,6 +2,8 @@ package gui
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -17,8 +19,13 @@ import (
 
 	"github.com/voltavpn/volta-client/internal/api"
 	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/dnsstub"
+	"github.com/voltavpn/volta-client/internal/killswitch"
+	"github.com/voltavpn/volta-client/internal/secretstore"
 	"github.com/voltavpn/volta-client/internal/settings"
+	"github.com/voltavpn/volta-client/internal/tun"
 	"github.com/voltavpn/volta-client/internal/ui/components"
+	"github.com/voltavpn/volta-client/internal/xray"
 )
 
 func Run() {
@@ -35,19 +42,75 @@ func Run() {
 		return
 	}
 
+	// Правила и маршруты TUN, оставшиеся после аварийного завершения.
+	_ = tun.Recover()
+	conn := core.NewConnection(core.NewTUNEngine(core.NewInProcessEngine(xray.New), tun.Open))
+	auto := core.NewAutoStrategy(core.HandshakeProber{}, 0)
+	ranking := core.NewServerRanking(core.LatencyProber{}, 0)
+	auto.SetServerRanking(ranking)
+	conn.SetProfileSelector(auto)
+	sessions := core.NewSessionCache(secretstore.OpenDefault())
+	_ = sessions.SetPersistent(appSettings.Privacy.RememberDevice)
+	state := newAppState(window, apiClient, &appSettings, conn, killswitch.New(), auto, ranking, sessions)
+	_ = state.applyDNS()
+	// Правила без баз geoip/geosite видны сразу, а не при подключении.
+	checkRouting(state)
+	state.watchNetwork()
+	setupTray(application, state)
+
 	// VOLTA_DEV_SKIP_LOGIN допускается только в dev-окружении.
 	if isDevEnvironment() && strings.TrimSpace(os.Getenv("VOLTA_DEV_SKIP_LOGIN")) == "1" {
-		showMainScreen(window, core.ActivateResult{}, &appSettings)
+		showMainScreen(state, core.ActivateResult{})
 	} else {
-		showLoginScreen(window, apiClient, &appSettings)
+		launch(state, core.PlanLaunch(sessions, appSettings))
 	}
 
+	window.SetOnClosed(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = state.conn.Disconnect(ctx, core.ReasonUserRequest)
+		state.closeNetwork()
+		state.stopFollowHealth()
+		state.health.Close()
+		state.supervisor.Close()
+		state.traffic.Close()
+		_ = state.killSwitch.Close()
+		state.closeDNS()
+	})
+
 	window.Resize(fyne.NewSize(560, 560))
 	window.CenterOnScreen()
 	window.ShowAndRun()
 }
 
-func showLoginScreen(window fyne.Window, apiClient api.APIClient, appSettings *settings.Settings) {
+// launch показывает первый экран по плану запуска и, если нужно, подключается.
+func launch(state *appState, plan core.LaunchPlan) {
+	if plan.Screen != core.LaunchMain {
+		showLoginScreen(state, plan.FallbackReason)
+		return
+	}
+
+	if active, ok := state.sessions.Active(); ok {
+		state.useAccessProfile(active)
+	}
+	showMainScreen(state, plan.Session)
+	if plan.FallbackReason != "" {
+		dialog.ShowInformation("Подключение", plan.FallbackReason, state.window)
+	}
+	if plan.PreferredTransport != "" {
+		state.auto.RememberTransport(state.auto.NetworkID(), plan.PreferredTransport)
+	}
+	if plan.AutoConnect {
+		startConnect(state, plan.Profiles, core.ReasonLaunch)
+	}
+}
+
+// showLoginScreen показывает вход; notice объясняет, почему сохранённая
+// сессия не подошла.
+func showLoginScreen(state *appState, notice string) {
+	window := state.window
+	state.bindScreen(screenView{})
+
 	titleLabel := canvas.NewText("VoltaVPN", components.ColorText())
 	titleLabel.TextSize = components.TextHeadline
 	titleLabel.TextStyle = fyne.TextStyle{Bold: true}
@@ -85,7 +148,7 @@ func showLoginScreen(window fyne.Window, apiClient api.APIClient, appSettings *s
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
 
-		result, _, ok := core.ActivateAccess(ctx, apiClient, accessURL)
+		result, _, ok := core.ActivateAccess(ctx, state.apiClient, accessURL, state.deviceID())
 		if !ok {
 			accessInputEntry.Enable()
 			continueButton.SetText("Продолжить")
@@ -94,7 +157,14 @@ func showLoginScreen(window fyne.Window, apiClient api.APIClient, appSettings *s
 			return
 		}
 
-		showMainScreen(window, result, appSettings)
+		addAccessProfile(state, result)
+	}
+
+	noticeLabel := canvas.NewText(notice, components.ColorTextMuted())
+	noticeLabel.TextSize = components.CaptionTextSize
+	noticeLabel.Alignment = fyne.TextAlignCenter
+	if notice == "" {
+		noticeLabel.Hide()
 	}
 
 	privacyCaption := canvas.NewText("Ключ не сохраняется в открытом виде", components.ColorTextMuted())
@@ -104,6 +174,7 @@ func showLoginScreen(window fyne.Window, apiClient api.APIClient, appSettings *s
 	form := container.NewVBox(
 		titleLabel,
 		components.NewVSpacer(components.Spacing8),
+		noticeLabel,
 		promptLabel,
 		components.NewVSpacer(components.Spacing8),
 		accessInputEntry,
@@ -112,6 +183,14 @@ func showLoginScreen(window fyne.Window, apiClient api.APIClient, appSettings *s
 		components.NewVSpacer(components.Spacing8),
 		privacyCaption,
 	)
+	// Вход открыт из списка ключей: можно вернуться, не добавляя новый.
+	if hasAnyActivationData(state.activation()) {
+		backButton := widget.NewButton("Назад", func() {
+			showMainScreen(state, state.activation())
+		})
+		backButton.Importance = widget.LowImportance
+		form.Add(backButton)
+	}
 
 	content := container.NewBorder(
 		nil,
@@ -150,7 +229,10 @@ func showErrorScreen(window fyne.Window, message string) {
 	window.SetContent(container.NewCenter(container.NewPadded(card)))
 }
 
-func showMainScreen(window fyne.Window, result core.ActivateResult, appSettings *settings.Settings) {
+func showMainScreen(state *appState, result core.ActivateResult) {
+	window := state.window
+	state.setActivation(result)
+
 	titleLabel := canvas.NewText("VoltaVPN", components.ColorText())
 	titleLabel.TextStyle = fyne.TextStyle{Bold: true}
 	titleLabel.TextSize = components.TextTitle
@@ -164,49 +246,207 @@ func showMainScreen(window fyne.Window, result core.ActivateResult, appSettings
 		userIDLabel.Text = "ID: available"
 	}
 
-	uploadLabel := canvas.NewText("↑ Upload: 0 B/s", components.ColorText())
+	profiles, _ := core.ParseProfiles(result.VPNProfile)
+	serverSelect := newServerSelect(state, profiles)
+
+	uploadLabel := canvas.NewText("", components.ColorText())
 	uploadLabel.TextSize = components.TextBody
-	downloadLabel := canvas.NewText("↓ Download: 0 B/s", components.ColorText())
+	downloadLabel := canvas.NewText("", components.ColorText())
 	downloadLabel.TextSize = components.TextBody
+	sessionLabel := canvas.NewText("", components.ColorTextMuted())
+	sessionLabel.TextSize = components.TextCaption
+	renderTraffic := func(s core.TrafficSnapshot) {
+		uploadLabel.Text = "↑ Upload: " + core.FormatRate(s.UpRate)
+		uploadLabel.Refresh()
+		downloadLabel.Text = "↓ Download: " + core.FormatRate(s.DownRate)
+		downloadLabel.Refresh()
+		sessionLabel.Text = trafficTotalsText(s)
+		sessionLabel.Refresh()
+	}
+	renderTraffic(state.traffic.Snapshot())
 
 	connectButton := components.NewPrimaryButton("CONNECT", nil)
 	connectButtonWrap := container.NewStack(
 		components.NewHSpacer(220),
 		connectButton,
 	)
-	isConnected := false
 	connectButton.OnTapped = func() {
-		isConnected = !isConnected
-		if isConnected {
-			connectButton.SetText("DISCONNECT")
-			statusLabel.Text = "Status: Connected"
-			statusLabel.Color = components.ColorStatusConnected()
-			statusLabel.Refresh()
+		toggleConnection(state)
+	}
+
+	leakTestButton := components.NewSecondaryButton("LEAK TEST", nil)
+	leakTestButton.OnTapped = func() {
+		leakTestButton.Disable()
+		go func() {
+			runLeakTest(state)
+			leakTestButton.Enable()
+		}()
+	}
+
+	renderState := func(current core.ConnectionState) {
+		statusLabel.Text = "Status: " + connectionStatusText(current)
+		statusLabel.Color = connectionStatusColor(current)
+		statusLabel.Refresh()
+		connectButton.SetText(connectButtonText(current))
+		if current == core.StateConnected {
+			leakTestButton.Show()
+		} else {
+			leakTestButton.Hide()
+		}
+	}
+	routeLabel := canvas.NewText("", components.ColorTextMuted())
+	routeLabel.TextSize = components.TextCaption
+	renderRoute := func() {
+		active, connected := state.conn.ActiveProfile()
+		latency, _ := state.ranking.Latency(state.auto.NetworkID(), active)
+		// Последняя удачная проба свежее записи в ranking: её записывает
+		// другой подписчик на статус проверки.
+		if st := state.health.Status(); connected && st.Failures == 0 && st.RTT > 0 {
+			latency.EndToEnd = st.RTT
+		}
+		routeLabel.Text = routeText(active, connected, latency)
+		routeLabel.Refresh()
+	}
+
+	reconnectLabel := canvas.NewText("", components.ColorTextMuted())
+	reconnectLabel.TextSize = components.TextCaption
+	renderReconnect := func(st core.SupervisorStatus) {
+		reconnectLabel.Text = reconnectStatusText(st, time.Now())
+		reconnectLabel.Refresh()
+	}
+
+	killSwitchLabel := canvas.NewText("", components.ColorTextMuted())
+	killSwitchLabel.TextSize = components.TextCaption
+	renderKillSwitch := func(st core.KillSwitchStatus) {
+		killSwitchLabel.Text = killSwitchStatusText(st)
+		killSwitchLabel.Refresh()
+	}
+
+	proxyLabel := canvas.NewText("", components.ColorTextMuted())
+	proxyLabel.TextSize = components.TextCaption
+	copyProxyButton := components.NewSecondaryButton("COPY PROXY PASSWORD", nil)
+	renderProxies := func(current core.ConnectionState) {
+		opts := state.conn.Options()
+		proxies, ok := core.LocalProxies(opts)
+		if current != core.StateConnected || !ok || opts.Settings.Connection.Mode != settings.ConnectionModeProxyOnly {
+			proxyLabel.Text = ""
+			proxyLabel.Refresh()
+			copyProxyButton.Hide()
 			return
 		}
-		connectButton.SetText("CONNECT")
-		statusLabel.Text = "Status: Disconnected"
-		statusLabel.Color = components.ColorStatusDisconnected()
-		statusLabel.Refresh()
+		proxyLabel.Text = localProxiesText(proxies)
+		proxyLabel.Refresh()
+		if proxies.Auth == nil {
+			copyProxyButton.Hide()
+			return
+		}
+		password := proxies.Auth.Password
+		copyProxyButton.OnTapped = func() {
+			window.Clipboard().SetContent(password)
+		}
+		copyProxyButton.Show()
+	}
+
+	connectivityLabel := widget.NewLabel("")
+	connectivityLabel.Wrapping = fyne.TextWrapWord
+	connectivityLabel.Hide()
+	portalButton := components.NewSecondaryButton("OPEN LOGIN PAGE", nil)
+	portalButton.Hide()
+	renderConnectivity := func(report core.ConnectivityReport) {
+		text := connectivityText(report)
+		connectivityLabel.SetText(text)
+		if text == "" {
+			connectivityLabel.Hide()
+		} else {
+			connectivityLabel.Show()
+		}
+		portal, err := url.Parse(report.PortalURL)
+		if report.Status != core.ConnectivityCaptivePortal || err != nil {
+			portalButton.Hide()
+			return
+		}
+		portalButton.OnTapped = func() {
+			_ = fyne.CurrentApp().OpenURL(portal)
+		}
+		portalButton.Show()
 	}
 
+	healthLabel := canvas.NewText("", components.ColorTextMuted())
+	healthLabel.TextSize = components.TextCaption
+	renderHealth := func(st core.HealthStatus) {
+		healthLabel.Text = healthStatusText(st)
+		healthLabel.Color = healthStatusColor(st)
+		healthLabel.Refresh()
+		renderRoute()
+	}
+	renderHealth(state.health.Status())
+
+	renderState(state.conn.State())
+	renderRoute()
+	renderProxies(state.conn.State())
+	renderReconnect(state.supervisor.Status())
+	renderKillSwitch(state.killSwitch.Status())
+	renderTransition := func(t core.Transition) {
+		renderState(t.To)
+		renderRoute()
+		renderProxies(t.To)
+		if t.To == core.StateConnected {
+			renderConnectivity(core.ConnectivityReport{Status: core.ConnectivityOK})
+		}
+		// Пока супервизор переподключает, не отвлекаем пользователя диалогами.
+		st := state.supervisor.Status()
+		willRetry := st.Enabled && !st.GaveUp && t.From != core.StateConnecting
+		if t.To == core.StateFailed && t.Reason != core.ReasonCancelled && !willRetry {
+			go explainFailure(state, t)
+		}
+	}
+	state.bindScreen(screenView{
+		connection:   renderTransition,
+		reconnect:    renderReconnect,
+		traffic:      renderTraffic,
+		killSwitch:   renderKillSwitch,
+		connectivity: renderConnectivity,
+		health:       renderHealth,
+	})
+
 	resetKeyButton := components.NewSecondaryButton("RESET KEY", func() {
-		dialog.ShowInformation("Reset key", "Сброс ключа будет доступен в следующей версии.", window)
+		confirmResetKey(state)
 	})
+	keysButton := components.NewSecondaryButton("KEYS", func() {
+		showAccessProfilesScreen(state)
+	})
+	keysRow := container.NewBorder(nil, nil, nil, keysButton)
+	if profileSelect := newAccessProfileSelect(state); profileSelect != nil {
+		keysRow.Add(profileSelect)
+	}
 
 	content := container.NewVBox(
 		titleLabel,
 		components.NewVSpacer(components.Spacing12),
 		statusLabel,
+		routeLabel,
+		reconnectLabel,
+		healthLabel,
+		killSwitchLabel,
+		proxyLabel,
+		copyProxyButton,
+		connectivityLabel,
+		portalButton,
 		components.NewVSpacer(components.Spacing8),
 		userIDLabel,
+		components.NewVSpacer(components.Spacing8),
+		keysRow,
+		components.NewVSpacer(components.Spacing8),
+		serverSelect,
 		components.NewVSpacer(components.Spacing16),
 		uploadLabel,
 		components.NewVSpacer(components.Spacing8),
 		downloadLabel,
+		sessionLabel,
 		components.NewVSpacer(components.Spacing20),
 		connectButtonWrap,
 		components.NewVSpacer(components.Spacing8),
+		leakTestButton,
 		resetKeyButton,
 	)
 
@@ -227,23 +467,27 @@ func hasAnyActivationData(result core.ActivateResult) bool {
 		strings.TrimSpace(result.ProfileURL) != ""
 }
 
-func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSettings *settings.Settings) {
+func showSettingsScreen(state *appState, result core.ActivateResult) {
+	window := state.window
+	appSettings := state.settings
+	state.bindScreen(screenView{})
+
 	titleLabel := canvas.NewText("Settings", components.ColorText())
 	titleLabel.TextStyle = fyne.TextStyle{Bold: true}
 	titleLabel.TextSize = components.TextTitle
 
 	backButton := widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
-		showMainScreen(window, result, appSettings)
+		showMainScreen(state, result)
 	})
 	backButton.Importance = widget.LowImportance
 
 	autoConnectToggle := components.NewToggleSwitch(appSettings.Connection.AutoConnectOnLaunch, func(checked bool) {
 		appSettings.Connection.AutoConnectOnLaunch = checked
-		_ = settings.Save(*appSettings)
+		state.saveSettings()
 	})
 	autoReconnectToggle := components.NewToggleSwitch(appSettings.Connection.AutoReconnect, func(checked bool) {
 		appSettings.Connection.AutoReconnect = checked
-		_ = settings.Save(*appSettings)
+		state.saveSettings()
 	})
 
 	intervalSelector := components.NewSegmentedControl(
@@ -262,7 +506,7 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 			default:
 				appSettings.Connection.ReconnectIntervalSecs = 10
 			}
-			_ = settings.Save(*appSettings)
+			state.saveSettings()
 		},
 	)
 	switch appSettings.Connection.ReconnectIntervalSecs {
@@ -274,33 +518,103 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 		intervalSelector.SetSelected("10")
 	}
 
+	healthCheckToggle := components.NewToggleSwitch(appSettings.Connection.HealthCheck, func(checked bool) {
+		appSettings.Connection.HealthCheck = checked
+		state.saveSettings()
+	})
+	healthIntervalSelector := components.NewSegmentedControl(
+		[]components.SegmentOption{
+			{ID: "10", Label: "10s"},
+			{ID: "30", Label: "30s"},
+			{ID: "60", Label: "60s"},
+		},
+		"30",
+		func(value string) {
+			switch value {
+			case "10":
+				appSettings.Connection.HealthIntervalSecs = 10
+			case "60":
+				appSettings.Connection.HealthIntervalSecs = 60
+			default:
+				appSettings.Connection.HealthIntervalSecs = 30
+			}
+			state.saveSettings()
+		},
+	)
+	switch appSettings.Connection.HealthIntervalSecs {
+	case 10:
+		healthIntervalSelector.SetSelected("10")
+	case 60:
+		healthIntervalSelector.SetSelected("60")
+	default:
+		healthIntervalSelector.SetSelected("30")
+	}
+
 	modeSelector := components.NewSegmentedControl(
 		[]components.SegmentOption{
 			{ID: string(settings.ConnectionModeAuto), Label: "Auto"},
 			{ID: string(settings.ConnectionModeVLESSRealityOnly), Label: "Reality"},
+			{ID: string(settings.ConnectionModeProxyOnly), Label: "Proxy"},
 		},
 		string(settings.ConnectionModeAuto),
 		func(value string) {
 			switch settings.ConnectionMode(value) {
 			case settings.ConnectionModeVLESSRealityOnly:
 				appSettings.Connection.Mode = settings.ConnectionModeVLESSRealityOnly
+			case settings.ConnectionModeProxyOnly:
+				appSettings.Connection.Mode = settings.ConnectionModeProxyOnly
 			default:
 				appSettings.Connection.Mode = settings.ConnectionModeAuto
 			}
-			_ = settings.Save(*appSettings)
+			state.saveSettings()
 		},
 	)
 	switch appSettings.Connection.Mode {
-	case settings.ConnectionModeVLESSRealityOnly:
-		modeSelector.SetSelected(string(settings.ConnectionModeVLESSRealityOnly))
+	case settings.ConnectionModeVLESSRealityOnly, settings.ConnectionModeProxyOnly:
+		modeSelector.SetSelected(string(appSettings.Connection.Mode))
 	default:
 		modeSelector.SetSelected(string(settings.ConnectionModeAuto))
 	}
 
+	fingerprintSelector := components.NewSegmentedControl(
+		[]components.SegmentOption{
+			{ID: string(settings.FingerprintChrome), Label: "Chrome"},
+			{ID: string(settings.FingerprintFirefox), Label: "Firefox"},
+			{ID: string(settings.FingerprintSafari), Label: "Safari"},
+			{ID: string(settings.FingerprintRandomized), Label: "Random"},
+		},
+		string(settings.FingerprintChrome),
+		func(value string) {
+			switch fp := settings.TLSFingerprint(value); fp {
+			case settings.FingerprintFirefox, settings.FingerprintSafari, settings.FingerprintRandomized:
+				appSettings.Connection.Fingerprint = fp
+			default:
+				appSettings.Connection.Fingerprint = settings.FingerprintChrome
+			}
+			state.saveSettings()
+		},
+	)
+	switch appSettings.Connection.Fingerprint {
+	case settings.FingerprintFirefox, settings.FingerprintSafari, settings.FingerprintRandomized:
+		fingerprintSelector.SetSelected(string(appSettings.Connection.Fingerprint))
+	default:
+		fingerprintSelector.SetSelected(string(settings.FingerprintChrome))
+	}
+
+	proxyAuthToggle := components.NewToggleSwitch(appSettings.Connection.ProxyAuth, func(checked bool) {
+		appSettings.Connection.ProxyAuth = checked
+		state.saveSettings()
+	})
+
+	tunToggle := components.NewToggleSwitch(appSettings.Connection.TUN, func(checked bool) {
+		appSettings.Connection.TUN = checked
+		state.saveSettings()
+	})
+
 	startWithWindowsToggle := components.NewToggleSwitch(appSettings.App.StartWithWindows, func(checked bool) {
 		// Stub only: OS autostart integration is implemented later.
 		appSettings.App.StartWithWindows = checked
-		_ = settings.Save(*appSettings)
+		state.saveSettings()
 	})
 	startWithWindowsToggle.Disable()
 
@@ -317,7 +631,7 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 			default:
 				appSettings.App.Language = settings.LanguageRU
 			}
-			_ = settings.Save(*appSettings)
+			state.saveSettings()
 		},
 	)
 	switch appSettings.App.Language {
@@ -329,13 +643,54 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 
 	rememberDeviceToggle := components.NewToggleSwitch(appSettings.Privacy.RememberDevice, func(checked bool) {
 		appSettings.Privacy.RememberDevice = checked
-		_ = settings.Save(*appSettings)
+		state.saveSettings()
+		// Выключение удаляет ключи из хранилища; до выхода они остаются в памяти.
+		_ = state.sessions.SetPersistent(checked)
+	})
+
+	killSwitchToggle := components.NewToggleSwitch(appSettings.Privacy.KillSwitch, func(checked bool) {
+		appSettings.Privacy.KillSwitch = checked
+		state.saveSettings()
+	})
+
+	strictDNSToggle := components.NewToggleSwitch(appSettings.Privacy.StrictDNS, func(checked bool) {
+		appSettings.Privacy.StrictDNS = checked
+		state.saveSettings()
+	})
+	ipv6Selector := components.NewSegmentedControl(
+		[]components.SegmentOption{
+			{ID: string(settings.IPv6Tunnel), Label: "Tunnel"},
+			{ID: string(settings.IPv6Block), Label: "Block"},
+			{ID: string(settings.IPv6Allow), Label: "Allow"},
+		},
+		string(settings.IPv6Block),
+		func(value string) {
+			switch policy := settings.IPv6Policy(value); policy {
+			case settings.IPv6Tunnel, settings.IPv6Allow:
+				appSettings.Privacy.IPv6 = policy
+			default:
+				appSettings.Privacy.IPv6 = settings.IPv6Block
+			}
+			state.saveSettings()
+		},
+	)
+	switch appSettings.Privacy.IPv6 {
+	case settings.IPv6Tunnel, settings.IPv6Allow:
+		ipv6Selector.SetSelected(string(appSettings.Privacy.IPv6))
+	default:
+		ipv6Selector.SetSelected(string(settings.IPv6Block))
+	}
+	dnsProtectionToggle := components.NewToggleSwitch(appSettings.Privacy.DNSLeakProtection, func(checked bool) {
+		appSettings.Privacy.DNSLeakProtection = checked
+		if err := state.saveSettings(); err != nil {
+			dialog.ShowError(fmt.Errorf("не удалось запустить локальный DNS %s: %w", dnsstub.DefaultAddr, err), window)
+		}
 	})
 
 	clearDataButton := components.NewDangerSecondaryButton("Clear local data", func() {
 		dialog.NewConfirm(
 			"Clear local data",
-			"Удалить локальные настройки и сбросить параметры по умолчанию?",
+			"Удалить локальные настройки, сохранённую сессию и счётчик трафика и сбросить параметры по умолчанию?",
 			func(confirm bool) {
 				if !confirm {
 					return
@@ -347,9 +702,23 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 				}
 
 				*appSettings = newDefaults
+				state.traffic.ResetTotals()
+				state.forgetSession()
+				_ = state.sessions.SetPersistent(appSettings.Privacy.RememberDevice)
+				state.applySettings()
 				autoConnectToggle.SetOn(appSettings.Connection.AutoConnectOnLaunch)
 				autoReconnectToggle.SetOn(appSettings.Connection.AutoReconnect)
+				healthCheckToggle.SetOn(appSettings.Connection.HealthCheck)
 				rememberDeviceToggle.SetOn(appSettings.Privacy.RememberDevice)
+				killSwitchToggle.SetOn(appSettings.Privacy.KillSwitch)
+				dnsProtectionToggle.SetOn(appSettings.Privacy.DNSLeakProtection)
+				strictDNSToggle.SetOn(appSettings.Privacy.StrictDNS)
+				switch appSettings.Privacy.IPv6 {
+				case settings.IPv6Tunnel, settings.IPv6Allow:
+					ipv6Selector.SetSelected(string(appSettings.Privacy.IPv6))
+				default:
+					ipv6Selector.SetSelected(string(settings.IPv6Block))
+				}
 				startWithWindowsToggle.SetOn(appSettings.App.StartWithWindows)
 
 				switch appSettings.Connection.ReconnectIntervalSecs {
@@ -360,12 +729,28 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 				default:
 					intervalSelector.SetSelected("10")
 				}
+				switch appSettings.Connection.HealthIntervalSecs {
+				case 10:
+					healthIntervalSelector.SetSelected("10")
+				case 60:
+					healthIntervalSelector.SetSelected("60")
+				default:
+					healthIntervalSelector.SetSelected("30")
+				}
 				switch appSettings.Connection.Mode {
-				case settings.ConnectionModeVLESSRealityOnly:
-					modeSelector.SetSelected(string(settings.ConnectionModeVLESSRealityOnly))
+				case settings.ConnectionModeVLESSRealityOnly, settings.ConnectionModeProxyOnly:
+					modeSelector.SetSelected(string(appSettings.Connection.Mode))
 				default:
 					modeSelector.SetSelected(string(settings.ConnectionModeAuto))
 				}
+				switch appSettings.Connection.Fingerprint {
+				case settings.FingerprintFirefox, settings.FingerprintSafari, settings.FingerprintRandomized:
+					fingerprintSelector.SetSelected(string(appSettings.Connection.Fingerprint))
+				default:
+					fingerprintSelector.SetSelected(string(settings.FingerprintChrome))
+				}
+				proxyAuthToggle.SetOn(appSettings.Connection.ProxyAuth)
+				tunToggle.SetOn(appSettings.Connection.TUN)
 				switch appSettings.App.Language {
 				case settings.LanguageEN:
 					languageSelector.SetSelected(string(settings.LanguageEN))
@@ -382,7 +767,12 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 		components.NewSettingRow("Auto-connect on launch", "", autoConnectToggle),
 		components.NewSettingRow("Auto-reconnect", "", autoReconnectToggle),
 		components.NewSettingRow("Reconnect interval", "", intervalSelector),
+		components.NewSettingRow("Tunnel health check", "Пробные запросы через туннель; зависший туннель переподключается.", healthCheckToggle),
+		components.NewSettingRow("Health check interval", "", healthIntervalSelector),
 		components.NewSettingRow("Connection mode", "", modeSelector),
+		components.NewSettingRow("TLS fingerprint", "Под какой браузер маскируется рукопожатие TLS.", fingerprintSelector),
+		components.NewSettingRow("Proxy password", "В режиме Proxy: новый логин и пароль для SOCKS5/HTTP на каждое подключение.", proxyAuthToggle),
+		components.NewSettingRow("TUN mode", "Весь трафик устройства через виртуальный интерфейс. Linux; нужны права администратора.", tunToggle),
 	)
 
 	appSection := makeSettingsCard(
@@ -394,7 +784,11 @@ func showSettingsScreen(window fyne.Window, result core.ActivateResult, appSetti
 	privacySection := makeSettingsCard(
 		"Privacy & Security",
 		components.NewSettingRow("Remember this device", "", rememberDeviceToggle),
-		components.NewSettingRow("Clear local data", "Удаляет локальные настройки.", clearDataButton),
+		components.NewSettingRow("Kill switch", "Блокирует трафик вне VPN, пока туннель не восстановлен.", killSwitchToggle),
+		components.NewSettingRow("DNS leak protection", "Локальный DNS "+dnsstub.DefaultAddr+" отвечает через туннель; в режиме TUN на него переключается системный DNS.", dnsProtectionToggle),
+		components.NewSettingRow("Strict DNS", "Без туннеля DNS‑запросы отклоняются.", strictDNSToggle),
+		components.NewSettingRow("IPv6", "Через туннель, заблокировать или мимо VPN. Действует со следующего подключения.", ipv6Selector),
+		components.NewSettingRow("Clear local data", "Удаляет локальные настройки и сохранённую сессию.", clearDataButton),
 	)
 
 	sections := container.NewVBox(
@@ -449,4 +843,3 @@ func isDevEnvironment() bool {
 		return false
 	}
 }
-
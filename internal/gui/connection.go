@@ -0,0 +1,258 @@
+package gui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"time"
+
+	"fyne.io/fyne/v2/dialog"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/ui/components"
+	"github.com/voltavpn/volta-client/internal/xray"
+)
+
+const (
+	connectTimeout      = 30 * time.Second
+	disconnectTimeout   = 10 * time.Second
+	connectivityTimeout = 10 * time.Second
+)
+
+// toggleConnection подключает или отключает туннель в зависимости от
+// текущего состояния. Вызовы core выполняются вне UI-потока. Из Failed
+// туннель отключается: kill switch держит правила до отключения, и это
+// единственный способ вернуть сеть без VPN.
+func toggleConnection(state *appState) {
+	switch state.conn.State() {
+	case core.StateDisconnected:
+		profiles, err := core.ParseProfiles(state.activation().VPNProfile)
+		if err != nil {
+			dialog.ShowInformation("Ошибка", "Профиль подключения недоступен. Повторите вход.", state.window)
+			return
+		}
+		profiles = core.PreferServer(profiles, state.server())
+		if _, err := core.ProfileForMode(profiles, state.settings.Connection.Mode); err != nil {
+			dialog.ShowInformation("Ошибка", "Профиль не поддерживает выбранный режим подключения.", state.window)
+			return
+		}
+		startConnect(state, profiles, core.ReasonUserRequest)
+	case core.StateDisconnecting:
+		// Отключение уже идёт.
+	default:
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+			defer cancel()
+			_ = state.conn.Disconnect(ctx, core.ReasonUserRequest)
+		}()
+	}
+}
+
+// startConnect запускает подключение к уже проверенным кандидатам.
+// Сначала проверяется сеть: без неё или за captive portal подключение
+// заведомо не пройдёт, и пользователю полезнее узнать причину сразу.
+func startConnect(state *appState, profiles []core.Profile, reason core.TransitionReason) {
+	opts, err := core.NewEngineOptions(*state.settings)
+	if err != nil {
+		dialog.ShowError(err, state.window)
+		return
+	}
+	if !checkRouting(state) {
+		return
+	}
+	go func() {
+		if report := checkConnectivity(state, profiles); report.BlocksConnect() {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+		defer cancel()
+		_ = state.conn.Connect(ctx, profiles, opts, reason)
+	}()
+}
+
+// checkRouting показывает ошибку, если правила маршрутизации ссылаются на
+// базы geoip или geosite, которых нет: ядро с такими правилами не запустится.
+func checkRouting(state *appState) bool {
+	err := xray.CheckRouting(state.settings.Routing)
+	if err == nil {
+		return true
+	}
+	dialog.ShowError(fmt.Errorf("правило маршрутизации требует geoip.dat или geosite.dat рядом с программой; удалите его или добавьте базы: %w", err), state.window)
+	return false
+}
+
+// checkConnectivity проверяет сеть и показывает результат на экране.
+// Пока kill switch блокирует трафик, проверка увидела бы «нет сети»,
+// поэтому она пропускается.
+func checkConnectivity(state *appState, profiles []core.Profile) core.ConnectivityReport {
+	if state.killSwitch.Status().State == core.KillSwitchBlocking {
+		return core.ConnectivityReport{Status: core.ConnectivityUnknown}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectivityTimeout)
+	defer cancel()
+	report := state.connectivity.Check(ctx, profiles)
+	state.showConnectivity(report)
+	return report
+}
+
+// explainFailure после неудачного подключения проверяет сеть и серверы
+// и показывает причину: проблему сети, если она найдена, иначе общую.
+func explainFailure(state *appState, t core.Transition) {
+	profiles, _ := core.ParseProfiles(state.activation().VPNProfile)
+	profiles = core.PreferServer(profiles, state.server())
+	message := connectionFailureText(t)
+	if text := connectivityText(checkConnectivity(state, profiles)); text != "" {
+		message = text
+	}
+	dialog.ShowInformation("Ошибка", message, state.window)
+}
+
+func connectionStatusText(s core.ConnectionState) string {
+	switch s {
+	case core.StateConnecting:
+		return "Connecting…"
+	case core.StateConnected:
+		return "Connected"
+	case core.StateReconnecting:
+		return "Reconnecting…"
+	case core.StateDisconnecting:
+		return "Disconnecting…"
+	case core.StateFailed:
+		return "Failed"
+	default:
+		return "Disconnected"
+	}
+}
+
+func connectionStatusColor(s core.ConnectionState) color.Color {
+	switch s {
+	case core.StateConnected:
+		return components.ColorStatusConnected()
+	case core.StateConnecting, core.StateReconnecting, core.StateDisconnecting:
+		return components.ColorStatusConnecting()
+	case core.StateFailed:
+		return components.ColorDanger()
+	default:
+		return components.ColorStatusDisconnected()
+	}
+}
+
+func connectButtonText(s core.ConnectionState) string {
+	switch s {
+	case core.StateConnecting, core.StateReconnecting:
+		return "CANCEL"
+	case core.StateConnected, core.StateDisconnecting, core.StateFailed:
+		return "DISCONNECT"
+	default:
+		return "CONNECT"
+	}
+}
+
+// connectionFailureText — сообщение для пользователя без технических деталей.
+func connectionFailureText(t core.Transition) string {
+	if errors.Is(t.Err, core.ErrNoEngine) || errors.Is(t.Err, core.ErrCoreUnavailable) {
+		return "Подключение пока недоступно в этой сборке."
+	}
+	if errors.Is(t.Err, core.ErrAllTransportsFailed) {
+		return "Сервер недоступен ни по одному из транспортов. Проверьте сеть и повторите попытку."
+	}
+	return "Не удалось установить подключение. Повторите попытку позже."
+}
+
+// connectivityText подсказывает, что сделать с найденной проблемой сети;
+// пустая строка, если проблем нет.
+func connectivityText(r core.ConnectivityReport) string {
+	switch r.Status {
+	case core.ConnectivityNoNetwork:
+		return "Нет подключения к сети. Проверьте Wi‑Fi или кабель и повторите попытку."
+	case core.ConnectivityCaptivePortal:
+		return "Сеть требует входа на странице авторизации (например, Wi‑Fi в отеле). Выполните вход и подключитесь снова."
+	case core.ConnectivityDNSBroken:
+		return "DNS в этой сети не отвечает. Переподключитесь к сети или укажите другой DNS‑сервер в системе."
+	case core.ConnectivityServerUnreachable:
+		return "Интернет работает, но сервер VPN недоступен. Выберите другой сервер или повторите попытку позже."
+	default:
+		return ""
+	}
+}
+
+// reconnectStatusText описывает работу автопереподключения; пустая строка,
+// если сообщать нечего.
+func reconnectStatusText(st core.SupervisorStatus, now time.Time) string {
+	switch {
+	case st.GaveUp:
+		return "Автопереподключение остановлено после нескольких неудач."
+	case !st.NextRetryAt.IsZero():
+		wait := st.NextRetryAt.Sub(now).Round(time.Second)
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return fmt.Sprintf("Повторная попытка через %s (%d/%d)", wait, st.Attempts+1, st.MaxAttempts)
+	default:
+		return ""
+	}
+}
+
+// healthStatusText — подпись проверки туннеля; пустая, пока проб не было.
+func healthStatusText(st core.HealthStatus) string {
+	switch st.State {
+	case core.HealthOK:
+		return fmt.Sprintf("Туннель работает · %d мс", st.RTT.Milliseconds())
+	case core.HealthDegraded:
+		if st.Failures > 0 {
+			return fmt.Sprintf("Туннель работает с перебоями: %d проб без ответа", st.Failures)
+		}
+		return fmt.Sprintf("Туннель работает медленно · %d мс", st.RTT.Milliseconds())
+	case core.HealthStalled:
+		return "Трафик через туннель не проходит"
+	default:
+		return ""
+	}
+}
+
+func healthStatusColor(st core.HealthStatus) color.Color {
+	switch st.State {
+	case core.HealthDegraded:
+		return components.ColorStatusConnecting()
+	case core.HealthStalled:
+		return components.ColorDanger()
+	default:
+		return components.ColorTextMuted()
+	}
+}
+
+// trafficTotalsText — подпись с объёмом сессии и общим объёмом.
+func trafficTotalsText(s core.TrafficSnapshot) string {
+	if s.LifetimeUp == 0 && s.LifetimeDown == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Session: ↑ %s ↓ %s · Total: ↑ %s ↓ %s",
+		core.FormatBytes(s.SessionUp), core.FormatBytes(s.SessionDown),
+		core.FormatBytes(s.LifetimeUp), core.FormatBytes(s.LifetimeDown))
+}
+
+// killSwitchStatusText — подпись kill switch на главном экране.
+func killSwitchStatusText(st core.KillSwitchStatus) string {
+	switch st.State {
+	case core.KillSwitchBlocking:
+		return "Kill switch: трафик вне VPN заблокирован"
+	case core.KillSwitchError:
+		if errors.Is(st.Err, core.ErrFirewallUnsupported) {
+			return "Kill switch недоступен на этой платформе"
+		}
+		return "Kill switch не сработал: трафик не защищён"
+	default:
+		return ""
+	}
+}
+
+// localProxiesText описывает локальные прокси режима Proxy; пароль не
+// показывается, его можно только скопировать.
+func localProxiesText(p core.LocalProxyEndpoints) string {
+	text := fmt.Sprintf("SOCKS5 %s · HTTP %s", p.SOCKS, p.HTTP)
+	if p.Auth != nil {
+		text += " · логин " + p.Auth.Username
+	}
+	return text
+}
@@ -0,0 +1,42 @@
+package gui
+
+import (
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// applyDNS запускает, останавливает или перенастраивает DNS‑заглушку.
+func (s *appState) applyDNS() error {
+	privacy := s.settings.Privacy
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case privacy.DNSLeakProtection && s.dns == nil:
+		stub, err := core.NewDNSStub(s.conn, privacy, s.settings.DNS)
+		if err != nil {
+			return err
+		}
+		if err := stub.Start(); err != nil {
+			return err
+		}
+		s.dns = stub
+	case !privacy.DNSLeakProtection && s.dns != nil:
+		err := s.dns.Close()
+		s.dns = nil
+		return err
+	case s.dns != nil:
+		s.dns.SetStrict(privacy.StrictDNS)
+		s.dns.SetFilterAAAA(privacy.IPv6 == settings.IPv6Block)
+	}
+	return nil
+}
+
+func (s *appState) closeDNS() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dns != nil {
+		_ = s.dns.Close()
+		s.dns = nil
+	}
+}
@@ -0,0 +1,103 @@
+package gui
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2/dialog"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+	"github.com/voltavpn/volta-client/internal/tun"
+)
+
+const leakTestTimeout = 15 * time.Second
+
+// runLeakTest проверяет утечки адреса, DNS и IPv6 и показывает отчёт.
+func runLeakTest(state *appState) {
+	ctx, cancel := context.WithTimeout(context.Background(), leakTestTimeout)
+	defer cancel()
+	report := newLeakTester(state).Run(ctx)
+	dialog.ShowInformation("Leak test", leakReportText(report), state.window)
+}
+
+// newLeakTester сравнивает путь приложений с путём в обход туннеля. В
+// режиме TUN обходной путь привязан к физическому интерфейсу; если его
+// нет, сравнение невозможно и отчёт покажет «не проверено».
+func newLeakTester(state *appState) core.LeakTester {
+	opts := state.conn.Options()
+	state.mu.Lock()
+	dnsAddr := ""
+	if state.dns != nil {
+		dnsAddr = state.dns.Addr()
+	}
+	state.mu.Unlock()
+
+	tester := core.LeakTester{
+		Tunnel:     core.TunnelLeakPath(opts, dnsAddr),
+		IPv6Policy: opts.Settings.Privacy.IPv6,
+	}
+	if opts.Inbound != core.InboundTUN {
+		tester.Direct = core.DirectLeakPath(&net.Dialer{})
+	} else if dialer, err := tun.BypassDialer(); err == nil {
+		tester.Direct = core.DirectLeakPath(dialer)
+	}
+	return tester
+}
+
+// leakReportText — вердикт каждой проверки с адресами, по которым он
+// вынесен.
+func leakReportText(report core.LeakReport) string {
+	lines := []string{
+		"IP: " + leakVerdictText(report.IP) + leakAddrs("через VPN", report.TunnelIP) + leakAddrs("без VPN", report.DirectIP),
+		"DNS: " + leakVerdictText(report.DNS) + leakAddrs("резолверы", report.Resolvers...),
+		"IPv6: " + ipv6VerdictText(report),
+	}
+	if len(report.LeakedResolvers) > 0 {
+		lines = append(lines, "", "DNS‑запросы уходят мимо туннеля. Включите защиту от утечек DNS в настройках.")
+	}
+	if report.IPv6 == core.LeakDetected && report.IPv6Policy != settings.IPv6Allow {
+		lines = append(lines, "", "Трафик IPv6 идёт мимо туннеля. Выберите для IPv6 «Tunnel» или «Block» в настройках.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func leakVerdictText(v core.LeakVerdict) string {
+	switch v {
+	case core.LeakNone:
+		return "утечки нет"
+	case core.LeakDetected:
+		return "УТЕЧКА"
+	default:
+		return "не проверено"
+	}
+}
+
+func ipv6VerdictText(report core.LeakReport) string {
+	switch {
+	case report.IPv6Blocked():
+		return "заблокирован"
+	case report.IPv6 == core.LeakNone && !report.TunnelIPv6.IsValid():
+		return "утечки нет (IPv6 недоступен)"
+	case report.IPv6 == core.LeakDetected && report.IPv6Policy == settings.IPv6Allow:
+		return "мимо VPN, разрешено настройкой" + leakAddrs("адрес", report.TunnelIPv6)
+	}
+	return leakVerdictText(report.IPv6) + leakAddrs("адрес", report.TunnelIPv6)
+}
+
+// leakAddrs — « (label: a, b)» для известных адресов, иначе пусто.
+func leakAddrs(label string, addrs ...netip.Addr) string {
+	var known []string
+	for _, a := range addrs {
+		if a.IsValid() {
+			known = append(known, a.String())
+		}
+	}
+	if len(known) == 0 {
+		return ""
+	}
+	return " (" + label + ": " + strings.Join(known, ", ") + ")"
+}
@@ -0,0 +1,25 @@
+package gui
+
+import (
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/netmon"
+)
+
+// watchNetwork запускает монитор сети: смена сети или пробуждение
+// переподключают туннель. Без монитора (другие ОС) остальное работает.
+func (s *appState) watchNetwork() {
+	source, err := netmon.New()
+	if err != nil {
+		return
+	}
+	s.network = core.NewNetworkMonitor(source, 0)
+	s.stopFollowNetwork = core.FollowNetwork(s.network, s.supervisor, s.auto, s.ranking)
+}
+
+func (s *appState) closeNetwork() {
+	if s.network == nil {
+		return
+	}
+	s.stopFollowNetwork()
+	_ = s.network.Close()
+}
@@ -0,0 +1,205 @@
+package gui
+
+import (
+	"context"
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/ui/components"
+)
+
+// newAccessProfileSelect — выбор ключа доступа на главном экране; nil,
+// если ключ один и выбирать не из чего.
+func newAccessProfileSelect(state *appState) *widget.Select {
+	profiles, _ := state.sessions.Profiles()
+	if len(profiles) < 2 {
+		return nil
+	}
+	active, _ := state.sessions.Active()
+	names := make([]string, len(profiles))
+	ids := make(map[string]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.Name
+		ids[p.Name] = p.ID
+	}
+	sel := widget.NewSelect(names, nil)
+	sel.SetSelected(active.Name)
+	sel.OnChanged = func(name string) {
+		if id := ids[name]; id != active.ID {
+			switchAccessProfile(state, id)
+		}
+	}
+	return sel
+}
+
+// addAccessProfile сохраняет новый ключ после входа и переключается на него.
+func addAccessProfile(state *appState, result core.ActivateResult) {
+	profile, err := state.sessions.AddProfile("", result)
+	if err != nil {
+		// Ключ работает, просто не запомнится.
+		showMainScreen(state, result)
+		return
+	}
+	switchAccessProfile(state, profile.ID)
+}
+
+// switchAccessProfile делает ключ активным. Поднятый туннель
+// перезапускается с серверами нового ключа, не снимая kill switch.
+func switchAccessProfile(state *appState, id string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+		defer cancel()
+		profile, err := core.SwitchAccessProfile(ctx, state.conn, state.sessions, id, state.settings.Connection.Mode)
+		if profile.ID == "" {
+			dialog.ShowInformation("Ошибка", accessProfileErrorText(err), state.window)
+			return
+		}
+		state.useAccessProfile(profile)
+		showMainScreen(state, profile.Result())
+	}()
+}
+
+// removeAccessProfile удаляет ключ и по возможности отзывает его сессию.
+// Туннель активного ключа отключается; активным становится первый из
+// оставшихся, а без ключей открывается вход.
+func removeAccessProfile(state *appState, profile core.AccessProfile) {
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectTimeout)
+	defer cancel()
+	active, _ := state.sessions.Active()
+	if profile.ID == active.ID {
+		_ = state.conn.Disconnect(ctx, core.ReasonUserRequest)
+		_ = state.conn.ForgetProfiles()
+	}
+	if err := state.sessions.RemoveProfile(profile.ID); err != nil {
+		dialog.ShowInformation("Ошибка", accessProfileErrorText(err), state.window)
+		return
+	}
+	if profile.Session.SessionToken != "" {
+		_ = state.apiClient.Revoke(ctx, profile.Session.SessionToken)
+	}
+	if profile.ID != active.ID {
+		showAccessProfilesScreen(state)
+		return
+	}
+
+	remaining, _ := state.sessions.Profiles()
+	if len(remaining) == 0 {
+		state.useAccessProfile(core.AccessProfile{})
+		showLoginScreen(state, "")
+		return
+	}
+	_ = state.sessions.Select(remaining[0].ID)
+	state.useAccessProfile(remaining[0])
+	showAccessProfilesScreen(state)
+}
+
+// showAccessProfilesScreen — список ключей: переключение, переименование,
+// удаление и добавление нового.
+func showAccessProfilesScreen(state *appState) {
+	window := state.window
+	state.bindScreen(screenView{})
+
+	titleLabel := canvas.NewText("Access keys", components.ColorText())
+	titleLabel.TextStyle = fyne.TextStyle{Bold: true}
+	titleLabel.TextSize = components.TextTitle
+
+	backButton := widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+		showMainScreen(state, state.activation())
+	})
+	backButton.Importance = widget.LowImportance
+
+	profiles, _ := state.sessions.Profiles()
+	active, _ := state.sessions.Active()
+	rows := make([]fyne.CanvasObject, 0, len(profiles))
+	for _, p := range profiles {
+		profile := p
+		subtitle := ""
+		if profile.ID == active.ID {
+			subtitle = "Используется"
+		}
+		useButton := components.NewSecondaryButton("USE", func() {
+			switchAccessProfile(state, profile.ID)
+		})
+		if profile.ID == active.ID {
+			useButton.Disable()
+		}
+		renameButton := components.NewSecondaryButton("RENAME", func() {
+			renameAccessProfile(state, profile)
+		})
+		removeButton := components.NewDangerSecondaryButton("REMOVE", func() {
+			dialog.NewConfirm(
+				"Remove key",
+				"Удалить ключ «"+profile.Name+"» с этого устройства и отозвать его сессию?",
+				func(confirm bool) {
+					if confirm {
+						go removeAccessProfile(state, profile)
+					}
+				},
+				window,
+			).Show()
+		})
+		rows = append(rows, components.NewSettingRow(profile.Name, subtitle,
+			container.NewHBox(useButton, renameButton, removeButton)))
+	}
+
+	addButton := components.NewPrimaryButton("ADD KEY", func() {
+		showLoginScreen(state, "")
+	})
+
+	header := components.NewHeaderBar(
+		container.NewStack(
+			components.NewHSpacer(components.Spacing40),
+			container.NewCenter(backButton),
+		),
+		titleLabel,
+		components.NewHSpacer(components.Spacing40),
+	)
+	list := makeSettingsCard("Keys", rows...)
+	content := container.NewVBox(list, components.NewVSpacer(components.Spacing16), addButton)
+
+	window.SetContent(container.NewBorder(header, nil, nil, nil,
+		container.NewVScroll(container.NewPadded(content))))
+}
+
+func renameAccessProfile(state *appState, profile core.AccessProfile) {
+	entry := widget.NewEntry()
+	entry.SetText(profile.Name)
+	dialog.ShowForm("Rename key", "Save", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Имя", entry)},
+		func(confirm bool) {
+			if !confirm {
+				return
+			}
+			if err := state.sessions.RenameProfile(profile.ID, entry.Text); err != nil {
+				dialog.ShowInformation("Ошибка", accessProfileErrorText(err), state.window)
+				return
+			}
+			showAccessProfilesScreen(state)
+		},
+		state.window,
+	)
+}
+
+func accessProfileErrorText(err error) string {
+	switch {
+	case errors.Is(err, core.ErrInvalidProfileName):
+		return "Имя ключа не может быть пустым или длиннее 64 символов."
+	case errors.Is(err, core.ErrDuplicateProfileName):
+		return "Ключ с таким именем уже есть."
+	case errors.Is(err, core.ErrAccessProfileNotFound):
+		return "Ключ не найден. Возможно, он уже удалён."
+	case errors.Is(err, core.ErrProfileModeMismatch):
+		return "Профиль этого ключа не поддерживает выбранный режим подключения."
+	case err == nil:
+		return ""
+	default:
+		return "Не удалось переключить ключ. Повторите попытку."
+	}
+}
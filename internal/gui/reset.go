@@ -0,0 +1,87 @@
+package gui
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2/dialog"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+const resetKeyTimeout = 20 * time.Second
+
+// confirmResetKey спрашивает подтверждение и сбрасывает ключ: туннель
+// отключается, сессия отзывается, локальные данные удаляются, и
+// открывается экран входа. Итог каждого шага показывается в диалоге.
+func confirmResetKey(state *appState) {
+	dialog.NewConfirm(
+		"Reset key",
+		"Отключить VPN, отозвать сессию и удалить сохранённый ключ с этого устройства?",
+		func(confirm bool) {
+			if !confirm {
+				return
+			}
+			go resetKey(state)
+		},
+		state.window,
+	).Show()
+}
+
+func resetKey(state *appState) {
+	ctx, cancel := context.WithTimeout(context.Background(), resetKeyTimeout)
+	defer cancel()
+	report := core.KeyReset{
+		Conn:     state.conn,
+		Client:   state.apiClient,
+		Sessions: state.sessions,
+		Auto:     state.auto,
+		Ranking:  state.ranking,
+	}.Run(ctx, state.activation())
+
+	state.useAccessProfile(core.AccessProfile{})
+	showLoginScreen(state, "")
+	dialog.ShowInformation("Reset key", resetReportText(report), state.window)
+}
+
+// resetReportText перечисляет шаги сброса с их итогами.
+func resetReportText(report core.KeyResetReport) string {
+	lines := make([]string, 0, len(report.Steps)+1)
+	for _, step := range report.Steps {
+		lines = append(lines, resetStepTitle(step.Step)+": "+resetStepOutcome(step))
+	}
+	if report.Err() != nil {
+		lines = append(lines, "", "Не все данные удалось удалить. Повторите сброс или очистите данные в настройках.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func resetStepTitle(step core.ResetStep) string {
+	switch step {
+	case core.ResetStepDisconnect:
+		return "Отключение VPN"
+	case core.ResetStepRevoke:
+		return "Отзыв сессии на сервере"
+	case core.ResetStepWipeSecrets:
+		return "Удаление ключа и сессии"
+	case core.ResetStepForgetProfiles:
+		return "Удаление профилей"
+	default:
+		return string(step)
+	}
+}
+
+func resetStepOutcome(step core.ResetStepResult) string {
+	switch {
+	case step.Skipped:
+		return "не требуется"
+	case step.Err == nil:
+		return "готово"
+	case step.Step == core.ResetStepRevoke:
+		// Без сети отозвать нельзя; сессия истечёт на сервере сама.
+		return "не удалось, сессия истечёт сама"
+	default:
+		return "ошибка"
+	}
+}
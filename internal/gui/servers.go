@@ -0,0 +1,124 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+const (
+	serverOptionAuto = "Auto (fastest)"
+	measureTimeout   = 20 * time.Second
+)
+
+// serverLabel — подпись сервера в списке выбора; у цепочки — вход и выход.
+func serverLabel(p core.Profile) string {
+	if len(p.Chain) > 0 {
+		return hopLabel(p) + " → " + hopLabel(p.Exit())
+	}
+	return hopLabel(p)
+}
+
+func hopLabel(p core.Profile) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Address
+}
+
+// routeText — строка главного экрана о подключённом сервере: у цепочки
+// видно, где трафик входит в VPN и где выходит в сеть, и задержки до
+// входа и через всю цепочку.
+func routeText(p core.Profile, connected bool, l core.ServerLatency) string {
+	var text string
+	switch {
+	case !connected:
+		return ""
+	case len(p.Chain) == 0:
+		text = "Server: " + hopLabel(p)
+	default:
+		text = fmt.Sprintf("Entry: %s → Exit: %s", hopLabel(p), hopLabel(p.Exit()))
+	}
+	if latency := latencyText(l); latency != "" {
+		text += " · " + latency
+	}
+	return text
+}
+
+func latencyLabel(l core.ServerLatency) string {
+	if !l.Reachable() {
+		return serverLabel(l.Profile) + " · недоступен"
+	}
+	return serverLabel(l.Profile) + " · " + latencyText(l)
+}
+
+// latencyText — задержки сервера: до входа (у цепочки замерен только он)
+// и через поднятый туннель; пустая, если замеров нет.
+func latencyText(l core.ServerLatency) string {
+	var parts []string
+	switch {
+	case !l.Reachable():
+	case len(l.Profile.Chain) > 0:
+		parts = append(parts, fmt.Sprintf("entry %d ms", l.RTT.Milliseconds()))
+	default:
+		parts = append(parts, fmt.Sprintf("%d ms", l.RTT.Milliseconds()))
+	}
+	if l.EndToEnd > 0 {
+		parts = append(parts, fmt.Sprintf("end-to-end %d ms", l.EndToEnd.Milliseconds()))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// newServerSelect строит список серверов и в фоне замеряет задержки;
+// после замеров подписи дополняются временем отклика.
+func newServerSelect(state *appState, profiles []core.Profile) *widget.Select {
+	var unique []core.Profile
+	seen := map[string]bool{}
+	for _, p := range profiles {
+		if !seen[p.ServerID()] {
+			seen[p.ServerID()] = true
+			unique = append(unique, p)
+		}
+	}
+
+	sel := widget.NewSelect(nil, nil)
+	apply := func(entries []core.Profile, label func(int) string) {
+		options := []string{serverOptionAuto}
+		addresses := map[string]string{serverOptionAuto: ""}
+		selected := serverOptionAuto
+		for i, p := range entries {
+			text := label(i)
+			options = append(options, text)
+			addresses[text] = p.ServerID()
+			if p.ServerID() == state.server() {
+				selected = text
+			}
+		}
+		sel.OnChanged = nil
+		sel.Options = options
+		sel.SetSelected(selected)
+		sel.OnChanged = func(value string) {
+			state.setServer(addresses[value])
+		}
+	}
+	apply(unique, func(i int) string { return serverLabel(unique[i]) })
+
+	if len(profiles) > 0 {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), measureTimeout)
+			defer cancel()
+			best := core.BestPerServer(state.ranking.Rank(ctx, state.auto.NetworkID(), profiles))
+			ranked := make([]core.Profile, len(best))
+			for i, l := range best {
+				ranked[i] = l.Profile
+			}
+			apply(ranked, func(i int) string { return latencyLabel(best[i]) })
+		}()
+	}
+	return sel
+}
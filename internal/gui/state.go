@@ -0,0 +1,251 @@
+package gui
+
+import (
+	"sync"
+
+	"fyne.io/fyne/v2"
+
+	"github.com/voltavpn/volta-client/internal/api"
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/dnsstub"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// screenView — обработчики событий core для текущего экрана; nil‑поля
+// означают, что экран это событие не показывает.
+type screenView struct {
+	connection func(core.Transition)
+	reconnect  func(core.SupervisorStatus)
+	traffic    func(core.TrafficSnapshot)
+	killSwitch func(core.KillSwitchStatus)
+	// connectivity показывает итог проверки сети.
+	connectivity func(core.ConnectivityReport)
+	health       func(core.HealthStatus)
+}
+
+// appState — общее состояние окна, которое разделяют экраны и трей.
+type appState struct {
+	window     fyne.Window
+	apiClient  api.APIClient
+	settings   *settings.Settings
+	conn       *core.Connection
+	supervisor *core.Supervisor
+	traffic    *core.TrafficStats
+	killSwitch *core.KillSwitch
+	auto       *core.AutoStrategy
+	ranking    *core.ServerRanking
+	// sessions хранит ключи доступа; между запусками — если включено
+	// RememberDevice.
+	sessions *core.SessionCache
+	// connectivity проверяет сеть до подключения и после неудачи.
+	connectivity core.ConnectivityChecker
+	// network следит за сменой сети; nil, если на платформе монитора нет.
+	network           *core.NetworkMonitor
+	stopFollowNetwork func()
+	// health проверяет поднятый туннель; зависший переподключает supervisor,
+	// а время ответа проб записывается в ranking как задержка через туннель.
+	health           *core.HealthMonitor
+	stopFollowHealth func()
+
+	mu     sync.Mutex
+	result core.ActivateResult
+	// dns — DNS‑заглушка; nil, если защита от утечек DNS выключена.
+	dns *dnsstub.Server
+	// serverAddress — выбранный пользователем сервер; пусто — режим Auto.
+	serverAddress string
+	// view — обработчики событий для текущего экрана.
+	view screenView
+	// trayView обновляет меню трея; живёт всё время работы приложения.
+	trayView func(core.Transition)
+}
+
+func newAppState(window fyne.Window, apiClient api.APIClient, appSettings *settings.Settings, conn *core.Connection, firewall core.Firewall, auto *core.AutoStrategy, ranking *core.ServerRanking, sessions *core.SessionCache) *appState {
+	state := &appState{
+		window:     window,
+		apiClient:  apiClient,
+		settings:   appSettings,
+		conn:       conn,
+		supervisor: core.NewSupervisor(conn, core.ReconnectPolicyFromSettings(appSettings.Connection)),
+		traffic:    core.NewTrafficStats(conn.Engine(), 0, 0),
+		killSwitch: core.NewKillSwitch(conn, firewall, appSettings.Privacy.KillSwitch),
+		auto:       auto,
+		ranking:    ranking,
+		sessions:   sessions,
+	}
+	// Без сохранённого объёма счёт просто начнётся с нуля.
+	_ = state.traffic.PersistTotals(settings.TrafficFile{})
+	state.health = core.NewHealthMonitor(conn, nil, core.HealthPolicyFromSettings(appSettings.Connection))
+	stopFollowHealth := core.FollowHealth(state.health, state.supervisor)
+	stopFollowEndToEnd := core.FollowEndToEnd(state.health, conn, ranking, auto.NetworkID)
+	state.stopFollowHealth = func() {
+		stopFollowHealth()
+		stopFollowEndToEnd()
+	}
+
+	events, _ := conn.Subscribe()
+	go func() {
+		for t := range events {
+			if t.To == core.StateConnected {
+				state.rememberGoodProfile()
+			}
+			state.mu.Lock()
+			views := []func(core.Transition){state.view.connection, state.trayView}
+			state.mu.Unlock()
+			for _, view := range views {
+				if view != nil {
+					view(t)
+				}
+			}
+		}
+	}()
+
+	reconnects, _ := state.supervisor.Subscribe()
+	go func() {
+		for st := range reconnects {
+			state.mu.Lock()
+			view := state.view.reconnect
+			state.mu.Unlock()
+			if view != nil {
+				view(st)
+			}
+		}
+	}()
+
+	traffic, _ := state.traffic.Subscribe()
+	go func() {
+		for snapshot := range traffic {
+			state.mu.Lock()
+			view := state.view.traffic
+			state.mu.Unlock()
+			if view != nil {
+				view(snapshot)
+			}
+		}
+	}()
+
+	killSwitch, _ := state.killSwitch.Subscribe()
+	go func() {
+		for st := range killSwitch {
+			state.mu.Lock()
+			view := state.view.killSwitch
+			state.mu.Unlock()
+			if view != nil {
+				view(st)
+			}
+		}
+	}()
+
+	health, _ := state.health.Subscribe()
+	go func() {
+		for st := range health {
+			state.mu.Lock()
+			view := state.view.health
+			state.mu.Unlock()
+			if view != nil {
+				view(st)
+			}
+		}
+	}()
+
+	return state
+}
+
+// saveSettings сохраняет настройки и применяет их к работающим сервисам.
+// Ошибку DNS‑заглушки возвращает applySettings; остальные сервисы
+// применяют настройки без ошибок.
+func (s *appState) saveSettings() error {
+	_ = settings.Save(*s.settings)
+	return s.applySettings()
+}
+
+// applySettings передаёт текущие настройки работающим сервисам без сохранения.
+func (s *appState) applySettings() error {
+	s.supervisor.UpdatePolicy(core.ReconnectPolicyFromSettings(s.settings.Connection))
+	s.health.UpdatePolicy(core.HealthPolicyFromSettings(s.settings.Connection))
+	s.killSwitch.SetEnabled(s.settings.Privacy.KillSwitch)
+	return s.applyDNS()
+}
+
+// useAccessProfile показывает в окне ключ profile и запоминает выбор
+// в настройках; пустой профиль означает, что ключей не осталось.
+func (s *appState) useAccessProfile(profile core.AccessProfile) {
+	s.mu.Lock()
+	s.result = profile.Result()
+	s.serverAddress = profile.LastServer
+	s.mu.Unlock()
+	if s.settings.Access.ActiveProfile != profile.ID {
+		s.settings.Access.ActiveProfile = profile.ID
+		s.saveSettings()
+	}
+}
+
+// forgetSession удаляет все ключи доступа и ключ устройства.
+func (s *appState) forgetSession() {
+	_ = s.sessions.Wipe()
+}
+
+// deviceID — идентификатор установки для активации; пустой, если ключ
+// устройства недоступен.
+func (s *appState) deviceID() string {
+	id, _ := s.sessions.DeviceID(s.settings.Privacy.RememberDevice)
+	return id
+}
+
+func (s *appState) rememberGoodProfile() {
+	if active, ok := s.conn.ActiveProfile(); ok {
+		_ = s.sessions.MarkProfileGood(active)
+	}
+}
+
+func (s *appState) activation() core.ActivateResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.result
+}
+
+func (s *appState) setActivation(result core.ActivateResult) {
+	s.mu.Lock()
+	if result.VPNProfile != s.result.VPNProfile {
+		s.serverAddress = ""
+	}
+	s.result = result
+	s.mu.Unlock()
+}
+
+func (s *appState) server() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serverAddress
+}
+
+// setServer выбирает сервер и запоминает его в активном ключе.
+func (s *appState) setServer(address string) {
+	s.mu.Lock()
+	s.serverAddress = address
+	s.mu.Unlock()
+	_ = s.sessions.SetLastServer(address)
+}
+
+// bindScreen назначает обработчики для текущего экрана;
+// пустой screenView отвязывает предыдущий экран.
+func (s *appState) bindScreen(view screenView) {
+	s.mu.Lock()
+	s.view = view
+	s.mu.Unlock()
+}
+
+// showConnectivity передаёт итог проверки сети текущему экрану.
+func (s *appState) showConnectivity(report core.ConnectivityReport) {
+	s.mu.Lock()
+	view := s.view.connectivity
+	s.mu.Unlock()
+	if view != nil {
+		view(report)
+	}
+}
+
+func (s *appState) bindTrayView(view func(core.Transition)) {
+	s.mu.Lock()
+	s.trayView = view
+	s.mu.Unlock()
+}
@@ -0,0 +1,49 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+// setupTray добавляет меню в системный трей, если платформа его поддерживает.
+// Трей управляет тем же core.Connection, что и главное окно.
+func setupTray(application fyne.App, state *appState) {
+	desk, ok := application.(desktop.App)
+	if !ok {
+		return
+	}
+
+	statusItem := fyne.NewMenuItem("Status: "+connectionStatusText(state.conn.State()), nil)
+	statusItem.Disabled = true
+
+	toggleItem := fyne.NewMenuItem(trayToggleText(state.conn.State()), func() {
+		if !hasAnyActivationData(state.activation()) {
+			state.window.Show()
+			return
+		}
+		toggleConnection(state)
+	})
+	showItem := fyne.NewMenuItem("Open VoltaVPN", func() {
+		state.window.Show()
+	})
+
+	menu := fyne.NewMenu("VoltaVPN", statusItem, fyne.NewMenuItemSeparator(), toggleItem, showItem)
+	desk.SetSystemTrayMenu(menu)
+
+	state.bindTrayView(func(t core.Transition) {
+		statusItem.Label = "Status: " + connectionStatusText(t.To)
+		toggleItem.Label = trayToggleText(t.To)
+		menu.Refresh()
+	})
+}
+
+func trayToggleText(s core.ConnectionState) string {
+	switch s {
+	case core.StateDisconnected:
+		return "Connect"
+	default:
+		return "Disconnect"
+	}
+}
@@ -0,0 +1,4 @@
+// Package killswitch implements core.Firewall with the operating system's
+// packet filter. On Linux it programs nftables over netlink; no external
+// commands are executed.
+package killswitch
@@ -0,0 +1,254 @@
+package killswitch
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// tableName — таблица kill switch; других таблиц пакет не трогает.
+const tableName = "voltavpn_killswitch"
+
+// NFTables — kill switch на nftables. Все правила живут в отдельной таблице
+// семейства inet и ставятся и снимаются одним пакетом netlink‑сообщений,
+// то есть атомарно.
+type NFTables struct {
+	// netnsFd — сетевое пространство имён для тестов; 0 — текущее.
+	netnsFd int
+
+	mu sync.Mutex
+}
+
+// New создаёт kill switch для текущего сетевого пространства имён.
+func New() *NFTables {
+	return &NFTables{}
+}
+
+// NewInNamespace создаёт kill switch для пространства имён с дескриптором fd.
+func NewInNamespace(fd int) *NFTables {
+	return &NFTables{netnsFd: fd}
+}
+
+func (n *NFTables) conn() (*nftables.Conn, error) {
+	if n.netnsFd != 0 {
+		return nftables.New(nftables.WithNetNSFd(n.netnsFd))
+	}
+	return nftables.New()
+}
+
+// Apply заменяет правила kill switch одним атомарным пакетом.
+func (n *NFTables) Apply(rules core.KillSwitchRules) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	c, err := n.conn()
+	if err != nil {
+		return err
+	}
+
+	table := &nftables.Table{Name: tableName, Family: nftables.TableFamilyINet}
+	// add + delete + add в одном пакете: таблица заменяется целиком,
+	// и промежутка без правил не возникает.
+	c.AddTable(table)
+	c.DelTable(table)
+	c.AddTable(table)
+
+	policy := nftables.ChainPolicyDrop
+	output := c.AddChain(&nftables.Chain{
+		Name:     "output",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookOutput,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	})
+	input := c.AddChain(&nftables.Chain{
+		Name:     "input",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookInput,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	})
+
+	for _, exprs := range outputRules(rules) {
+		c.AddRule(&nftables.Rule{Table: table, Chain: output, Exprs: exprs})
+	}
+	for _, exprs := range inputRules(rules) {
+		c.AddRule(&nftables.Rule{Table: table, Chain: input, Exprs: exprs})
+	}
+	return c.Flush()
+}
+
+// Remove удаляет таблицу kill switch, если она есть.
+func (n *NFTables) Remove() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	c, err := n.conn()
+	if err != nil {
+		return err
+	}
+	table := &nftables.Table{Name: tableName, Family: nftables.TableFamilyINet}
+	// add перед delete делает удаление идемпотентным.
+	c.AddTable(table)
+	c.DelTable(table)
+	return c.Flush()
+}
+
+// Installed сообщает, установлена ли таблица kill switch.
+func (n *NFTables) Installed() (bool, error) {
+	c, err := n.conn()
+	if err != nil {
+		return false, err
+	}
+	tables, err := c.ListTablesOfFamily(nftables.TableFamilyINet)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range tables {
+		if t.Name == tableName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// outputRules: адреса серверов разрешены при любой политике IPv6, а
+// запрет IPv6 стоит до разрешения интерфейса туннеля и приложений мимо
+// туннеля.
+func outputRules(rules core.KillSwitchRules) [][]expr.Any {
+	out := [][]expr.Any{
+		accept(ifname(expr.MetaKeyOIFNAME, "lo")),
+		// DHCP: без продления аренды адреса пропадёт и сама сеть.
+		accept(append(l4proto(unix.IPPROTO_UDP), port(0, 68, 2, 67)...)),
+	}
+	for _, ep := range rules.Endpoints {
+		for _, proto := range []byte{unix.IPPROTO_TCP, unix.IPPROTO_UDP} {
+			match := daddr(ep.Addr())
+			match = append(match, l4proto(proto)...)
+			match = append(match, port(2, ep.Port(), 0, 0)...)
+			out = append(out, accept(match))
+		}
+	}
+	if rule := ipv6Rule(rules.IPv6); rule != nil {
+		out = append(out, rule)
+	}
+	if rules.BypassMark != 0 {
+		// Метку ставит цепочка маршрутизации TUN, она раньше фильтра.
+		out = append(out, accept(mark(rules.BypassMark)))
+	}
+	if rules.TunnelInterface != "" {
+		out = append(out, accept(ifname(expr.MetaKeyOIFNAME, rules.TunnelInterface)))
+	}
+	return out
+}
+
+func inputRules(rules core.KillSwitchRules) [][]expr.Any {
+	in := [][]expr.Any{
+		accept(ifname(expr.MetaKeyIIFNAME, "lo")),
+		accept(ctEstablished()),
+	}
+	if rule := ipv6Rule(rules.IPv6); rule != nil {
+		in = append(in, rule)
+	}
+	if rules.TunnelInterface != "" {
+		in = append(in, accept(ifname(expr.MetaKeyIIFNAME, rules.TunnelInterface)))
+	}
+	return in
+}
+
+// ipv6Rule пропускает или отбрасывает весь IPv6 по политике; при
+// IPv6Tunnel отдельного правила нет.
+func ipv6Rule(policy settings.IPv6Policy) []expr.Any {
+	match := nfproto(unix.NFPROTO_IPV6)
+	switch policy {
+	case settings.IPv6Allow:
+		return accept(match)
+	case settings.IPv6Block:
+		return append(match, &expr.Verdict{Kind: expr.VerdictDrop})
+	default:
+		return nil
+	}
+}
+
+func accept(match []expr.Any) []expr.Any {
+	return append(match, &expr.Verdict{Kind: expr.VerdictAccept})
+}
+
+func nfproto(family byte) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{family}},
+	}
+}
+
+func mark(value uint32) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.NativeEndian.AppendUint32(nil, value)},
+	}
+}
+
+// ifname сравнивает имя интерфейса; ядро хранит его в буфере IFNAMSIZ.
+func ifname(key expr.MetaKey, name string) []expr.Any {
+	data := make([]byte, unix.IFNAMSIZ)
+	copy(data, name)
+	return []expr.Any{
+		&expr.Meta{Key: key, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: data},
+	}
+}
+
+func l4proto(proto byte) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+	}
+}
+
+// port сравнивает 16‑битное поле транспортного заголовка по смещению
+// offset; второй порт (если otherPort != 0) — по смещению otherOffset.
+func port(offset uint32, value uint16, otherOffset uint32, otherValue uint16) []expr.Any {
+	out := []expr.Any{
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: offset, Len: 2},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, value)},
+	}
+	if otherValue != 0 {
+		out = append(out,
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: otherOffset, Len: 2},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.BigEndian.AppendUint16(nil, otherValue)},
+		)
+	}
+	return out
+}
+
+// daddr сравнивает адрес назначения с учётом версии IP.
+func daddr(addr netip.Addr) []expr.Any {
+	family, offset, length := byte(unix.NFPROTO_IPV4), uint32(16), uint32(4)
+	if addr.Is6() {
+		family, offset, length = unix.NFPROTO_IPV6, 24, 16
+	}
+	return append(nfproto(family),
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: length},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: addr.AsSlice()},
+	)
+}
+
+func ctEstablished() []expr.Any {
+	mask := binary.NativeEndian.AppendUint32(nil, expr.CtStateBitESTABLISHED|expr.CtStateBitRELATED)
+	return []expr.Any{
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4, Mask: mask, Xor: []byte{0, 0, 0, 0}},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: []byte{0, 0, 0, 0}},
+	}
+}
+
+var _ core.InstalledFirewall = (*NFTables)(nil)
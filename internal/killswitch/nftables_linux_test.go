@@ -0,0 +1,251 @@
+package killswitch
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// withNetNS выполняет fn в новом сетевом пространстве имён с интерфейсом
+// dummy0 (TUN без читателя, 10.99.0.1/24 и fd99::1/64). Пакеты через dummy0 никуда не
+// уходят, поэтому заблокированная отправка отличается от разрешённой ошибкой EPERM.
+func withNetNS(t *testing.T, fn func(ns netns.NsHandle)) {
+	t.Helper()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skipf("netns unavailable: %v", err)
+	}
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("cannot create network namespace (needs CAP_SYS_ADMIN): %v", err)
+	}
+	defer func() {
+		_ = netns.Set(origin)
+		_ = ns.Close()
+	}()
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		t.Fatalf("netlink handle: %v", err)
+	}
+	defer h.Close()
+	lo, err := h.LinkByName("lo")
+	if err != nil {
+		t.Fatalf("lo: %v", err)
+	}
+	if err := h.LinkSetUp(lo); err != nil {
+		t.Fatalf("lo up: %v", err)
+	}
+	dummy := &netlink.Tuntap{LinkAttrs: netlink.LinkAttrs{Name: "dummy0"}, Mode: netlink.TUNTAP_MODE_TUN}
+	if err := h.LinkAdd(dummy); err != nil {
+		t.Fatalf("add dummy0: %v", err)
+	}
+	addr, _ := netlink.ParseAddr("10.99.0.1/24")
+	if err := h.AddrAdd(dummy, addr); err != nil {
+		t.Fatalf("addr: %v", err)
+	}
+	addr6, _ := netlink.ParseAddr("fd99::1/64")
+	// Без DAD адрес готов сразу, а не через секунду проверки.
+	addr6.Flags = unix.IFA_F_NODAD
+	if err := h.AddrAdd(dummy, addr6); err != nil {
+		t.Fatalf("addr6: %v", err)
+	}
+	if err := h.LinkSetUp(dummy); err != nil {
+		t.Fatalf("dummy0 up: %v", err)
+	}
+
+	fn(ns)
+}
+
+// sendErr отправляет UDP‑датаграмму: отброшенный в OUTPUT пакет даёт
+// EPERM сразу, тогда как TCP молча повторял бы SYN до таймаута.
+func sendErr(address string) error {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("probe"))
+	return err
+}
+
+func TestNFTables_BlocksEverythingButEndpointsAndLoopback(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer ln.Close()
+
+		if err := sendErr("10.99.0.2:80"); errors.Is(err, syscall.EPERM) {
+			t.Fatalf("blocked before kill switch: %v", err)
+		}
+
+		ks := NewInNamespace(int(ns))
+		rules := core.KillSwitchRules{
+			Endpoints: []netip.AddrPort{netip.MustParseAddrPort("10.99.0.3:443")},
+		}
+		if err := ks.Apply(rules); err != nil {
+			t.Skipf("nftables unavailable: %v", err)
+		}
+		// Повторное применение заменяет таблицу, а не добавляет правила.
+		if err := ks.Apply(rules); err != nil {
+			t.Fatalf("second Apply: %v", err)
+		}
+		if ok, err := ks.Installed(); err != nil || !ok {
+			t.Fatalf("Installed = %v, %v", ok, err)
+		}
+
+		if err := sendErr("10.99.0.2:80"); !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("raw network not blocked: %v", err)
+		}
+		if err := sendErr("10.99.0.3:443"); errors.Is(err, syscall.EPERM) {
+			t.Fatalf("VPN endpoint blocked: %v", err)
+		}
+		if err := sendErr("10.99.0.3:80"); !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("other port on endpoint host not blocked: %v", err)
+		}
+		if err := sendErr(ln.LocalAddr().String()); err != nil {
+			t.Fatalf("loopback blocked: %v", err)
+		}
+
+		if err := ks.Remove(); err != nil {
+			t.Fatalf("Remove: %v", err)
+		}
+		if err := ks.Remove(); err != nil {
+			t.Fatalf("second Remove: %v", err)
+		}
+		if ok, _ := ks.Installed(); ok {
+			t.Fatal("table still installed after Remove")
+		}
+		if err := sendErr("10.99.0.2:80"); errors.Is(err, syscall.EPERM) {
+			t.Fatalf("still blocked after Remove: %v", err)
+		}
+	})
+}
+
+// Таблица, оставшаяся после аварийного завершения, снимается при создании
+// kill switch, и сеть снова доступна без подключения.
+func TestNFTables_StaleTableRemovedAtStartup(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		stale := NewInNamespace(int(ns))
+		if err := stale.Apply(core.KillSwitchRules{}); err != nil {
+			t.Skipf("nftables unavailable: %v", err)
+		}
+
+		fw := NewInNamespace(int(ns))
+		ks := core.NewKillSwitch(core.NewConnection(core.NewFakeEngine()), fw, true)
+		defer ks.Close()
+		if ok, err := fw.Installed(); err != nil || ok {
+			t.Fatalf("Installed after startup = %v, %v", ok, err)
+		}
+		if err := sendErr("10.99.0.2:80"); errors.Is(err, syscall.EPERM) {
+			t.Fatalf("still blocked after startup: %v", err)
+		}
+	})
+}
+
+func TestNFTables_AllowsTunnelInterface(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		ks := NewInNamespace(int(ns))
+		if err := ks.Apply(core.KillSwitchRules{TunnelInterface: "dummy0"}); err != nil {
+			t.Skipf("nftables unavailable: %v", err)
+		}
+		defer ks.Remove()
+
+		if err := sendErr("10.99.0.2:53"); err != nil {
+			t.Fatalf("traffic into the tunnel blocked: %v", err)
+		}
+	})
+}
+
+func TestNFTables_IPv6Policy(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		ks := NewInNamespace(int(ns))
+		defer ks.Remove()
+		apply := func(rules core.KillSwitchRules) {
+			t.Helper()
+			if err := ks.Apply(rules); err != nil {
+				t.Skipf("nftables unavailable: %v", err)
+			}
+		}
+
+		// IPv6 через туннель: dummy0 играет роль интерфейса туннеля.
+		apply(core.KillSwitchRules{TunnelInterface: "dummy0", IPv6: settings.IPv6Tunnel})
+		if err := sendErr("[fd99::2]:53"); err != nil {
+			t.Fatalf("tunnel policy: IPv6 into the tunnel blocked: %v", err)
+		}
+
+		apply(core.KillSwitchRules{
+			TunnelInterface: "dummy0",
+			Endpoints:       []netip.AddrPort{netip.MustParseAddrPort("[fd99::3]:443")},
+			IPv6:            settings.IPv6Block,
+		})
+		if err := sendErr("[fd99::2]:53"); !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("block policy: IPv6 into the tunnel not blocked: %v", err)
+		}
+		if err := sendErr("10.99.0.2:53"); err != nil {
+			t.Fatalf("block policy: IPv4 into the tunnel blocked: %v", err)
+		}
+		if err := sendErr("[fd99::3]:443"); errors.Is(err, syscall.EPERM) {
+			t.Fatalf("block policy: IPv6 VPN endpoint blocked: %v", err)
+		}
+
+		// Без интерфейса туннеля dummy0 — обычная сеть.
+		apply(core.KillSwitchRules{IPv6: settings.IPv6Allow})
+		if err := sendErr("[fd99::2]:53"); err != nil {
+			t.Fatalf("allow policy: IPv6 blocked: %v", err)
+		}
+		if err := sendErr("10.99.0.2:53"); !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("allow policy: IPv4 outside the tunnel not blocked: %v", err)
+		}
+	})
+}
+
+func TestNFTables_AllowsBypassMark(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		ks := NewInNamespace(int(ns))
+		if err := ks.Apply(core.KillSwitchRules{BypassMark: 0x7575}); err != nil {
+			t.Skipf("nftables unavailable: %v", err)
+		}
+		defer ks.Remove()
+
+		// SO_MARK заменяет метку, которую в туннеле ставит цепочка TUN.
+		send := func(value int) error {
+			d := net.Dialer{Control: func(_, _ string, c syscall.RawConn) error {
+				var sockErr error
+				err := c.Control(func(fd uintptr) {
+					sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, value)
+				})
+				return errors.Join(err, sockErr)
+			}}
+			conn, err := d.Dial("udp", "10.99.0.2:80")
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			_, err = conn.Write([]byte("probe"))
+			return err
+		}
+		if err := send(0x7575); err != nil {
+			t.Fatalf("marked traffic blocked: %v", err)
+		}
+		if err := send(0x7576); !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("traffic with another mark not blocked: %v", err)
+		}
+	})
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package killswitch
+
+import "github.com/voltavpn/volta-client/internal/core"
+
+// NFTables на других платформах недоступен: Apply возвращает
+// core.ErrFirewallUnsupported.
+type NFTables struct{}
+
+func New() *NFTables {
+	return &NFTables{}
+}
+
+func (n *NFTables) Apply(core.KillSwitchRules) error {
+	return core.ErrFirewallUnsupported
+}
+
+func (n *NFTables) Remove() error {
+	return nil
+}
+
+var _ core.Firewall = (*NFTables)(nil)
@@ -0,0 +1,5 @@
+// Package netmon implements core.NetworkEventSource with the operating
+// system's network notifications. On Linux it subscribes to netlink route,
+// address and link events and fingerprints the default route of the main
+// routing table; no external commands are executed.
+package netmon
@@ -0,0 +1,172 @@
+package netmon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+// Source — уведомления netlink о маршрутах, адресах и интерфейсах
+// сетевого пространства имён, в котором он создан.
+type Source struct {
+	handle *netlink.Handle
+	events chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+}
+
+// New подписывается на уведомления в сетевом пространстве имён текущего потока.
+func New() (*Source, error) {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return nil, err
+	}
+	s := &Source{
+		handle: h,
+		// Уведомления нужны только как сигнал: лишние сливаются в одно.
+		events: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	routes := make(chan netlink.RouteUpdate)
+	addrs := make(chan netlink.AddrUpdate)
+	links := make(chan netlink.LinkUpdate)
+	err = netlink.RouteSubscribeWithOptions(routes, s.done, netlink.RouteSubscribeOptions{ErrorCallback: s.ignore})
+	if err == nil {
+		forward(s, routes)
+		err = netlink.AddrSubscribeWithOptions(addrs, s.done, netlink.AddrSubscribeOptions{ErrorCallback: s.ignore})
+	}
+	if err == nil {
+		forward(s, addrs)
+		err = netlink.LinkSubscribeWithOptions(links, s.done, netlink.LinkSubscribeOptions{ErrorCallback: s.ignore})
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	forward(s, links)
+	go func() {
+		s.wg.Wait()
+		close(s.events)
+	}()
+	return s, nil
+}
+
+// forward передаёт обновления одной подписки в общий канал событий.
+// Подписка закрывает канал сама, когда закрыт done.
+func forward[T any](s *Source, updates <-chan T) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for range updates {
+			select {
+			case s.events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
+
+// ignore — ErrorCallback подписок: переполнение буфера сокета теряет
+// уведомления, но следующее событие всё равно вызовет проверку маршрута.
+func (s *Source) ignore(error) {
+	select {
+	case s.events <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Source) Events() <-chan struct{} {
+	return s.events
+}
+
+// Fingerprint хеширует маршруты по умолчанию основной таблицы: интерфейс,
+// шлюз и адрес источника для IPv4 и IPv6. Маршруты туннеля живут в своей
+// таблице и отпечаток не меняют.
+func (s *Source) Fingerprint() (string, error) {
+	routes, err := s.handle.RouteListFiltered(netlink.FAMILY_ALL,
+		&netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return "", err
+	}
+	best := make(map[int]netlink.Route)
+	for _, r := range routes {
+		if !isDefault(r) {
+			continue
+		}
+		if cur, ok := best[r.Family]; !ok || r.Priority < cur.Priority {
+			best[r.Family] = r
+		}
+	}
+	if len(best) == 0 {
+		return "", nil
+	}
+
+	var parts []string
+	for family, r := range best {
+		name := ""
+		if link, err := s.handle.LinkByIndex(r.LinkIndex); err == nil {
+			name = link.Attrs().Name
+		}
+		src := r.Src
+		if src == nil {
+			src = s.firstAddr(r.LinkIndex, family)
+		}
+		parts = append(parts, strings.Join([]string{familyName(family), name, r.Gw.String(), src.String()}, " "))
+	}
+	slices.Sort(parts)
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+func (s *Source) firstAddr(linkIndex, family int) net.IP {
+	link, err := s.handle.LinkByIndex(linkIndex)
+	if err != nil {
+		return nil
+	}
+	addrs, err := s.handle.AddrList(link, family)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if a.IP.IsGlobalUnicast() {
+			return a.IP
+		}
+	}
+	return nil
+}
+
+func (s *Source) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.handle.Close()
+	})
+	return nil
+}
+
+func isDefault(r netlink.Route) bool {
+	if r.Dst == nil {
+		return true
+	}
+	ones, _ := r.Dst.Mask.Size()
+	return ones == 0
+}
+
+func familyName(family int) string {
+	if family == netlink.FAMILY_V6 {
+		return "6"
+	}
+	return "4"
+}
+
+var _ core.NetworkEventSource = (*Source)(nil)
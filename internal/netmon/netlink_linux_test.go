@@ -0,0 +1,147 @@
+package netmon
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+// withNetNS выполняет fn в новом сетевом пространстве имён, где с
+// маршрутами можно делать что угодно.
+func withNetNS(t *testing.T, fn func(h *netlink.Handle)) {
+	t.Helper()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skipf("netns unavailable: %v", err)
+	}
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("cannot create network namespace (needs CAP_SYS_ADMIN): %v", err)
+	}
+	defer func() {
+		_ = netns.Set(origin)
+		_ = ns.Close()
+	}()
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		t.Fatalf("netlink handle: %v", err)
+	}
+	defer h.Close()
+	fn(h)
+}
+
+// addUplink создаёт интерфейс с адресом, как будто подключился Wi‑Fi
+// или кабель. Это TUN без читателя: модуля dummy может не быть.
+func addUplink(t *testing.T, h *netlink.Handle, name, cidr string) netlink.Link {
+	t.Helper()
+	link := &netlink.Tuntap{LinkAttrs: netlink.LinkAttrs{Name: name}, Mode: netlink.TUNTAP_MODE_TUN}
+	if err := h.LinkAdd(link); err != nil {
+		t.Fatalf("add %s: %v", name, err)
+	}
+	addr, _ := netlink.ParseAddr(cidr)
+	if err := h.AddrAdd(link, addr); err != nil {
+		t.Fatalf("addr %s: %v", name, err)
+	}
+	if err := h.LinkSetUp(link); err != nil {
+		t.Fatalf("%s up: %v", name, err)
+	}
+	return link
+}
+
+func defaultVia(link netlink.Link, gw string) *netlink.Route {
+	return &netlink.Route{LinkIndex: link.Attrs().Index, Gw: net.ParseIP(gw)}
+}
+
+func nextChange(t *testing.T, ch <-chan core.NetworkChange) core.NetworkChange {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(3 * time.Second):
+		t.Fatal("no network change")
+		return core.NetworkChange{}
+	}
+}
+
+func TestSource_ReportsDefaultRouteChanges(t *testing.T) {
+	withNetNS(t, func(h *netlink.Handle) {
+		wifi := addUplink(t, h, "wlan0", "192.168.50.20/24")
+		if err := h.RouteAdd(defaultVia(wifi, "192.168.50.1")); err != nil {
+			t.Fatalf("default route: %v", err)
+		}
+
+		source, err := New()
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		initial, err := source.Fingerprint()
+		if err != nil || initial == "" {
+			t.Fatalf("Fingerprint = %q, %v", initial, err)
+		}
+		monitor := core.NewNetworkMonitor(source, 50*time.Millisecond)
+		defer monitor.Close()
+		changes, unsubscribe := monitor.Subscribe()
+		defer unsubscribe()
+
+		// Маршрут не по умолчанию сеть не меняет.
+		other := &netlink.Route{LinkIndex: wifi.Attrs().Index, Dst: &net.IPNet{IP: net.IPv4(10, 99, 0, 0), Mask: net.CIDRMask(24, 32)}, Gw: net.ParseIP("192.168.50.1")}
+		if err := h.RouteAdd(other); err != nil {
+			t.Fatalf("route: %v", err)
+		}
+		select {
+		case c := <-changes:
+			t.Fatalf("unexpected change: %+v", c)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		// Переключение на Ethernet.
+		ethernet := addUplink(t, h, "eth0", "10.20.0.5/24")
+		if err := h.RouteReplace(defaultVia(ethernet, "10.20.0.1")); err != nil {
+			t.Fatalf("replace default route: %v", err)
+		}
+		c := nextChange(t, changes)
+		if c.Previous != initial || c.Fingerprint == "" || c.Fingerprint == initial {
+			t.Fatalf("change = %+v, initial %q", c, initial)
+		}
+
+		// Кабель выдернули: маршрута по умолчанию нет.
+		if err := h.LinkSetDown(ethernet); err != nil {
+			t.Fatalf("eth0 down: %v", err)
+		}
+		if c := nextChange(t, changes); c.Fingerprint != "" {
+			t.Fatalf("change without default route = %+v", c)
+		}
+	})
+}
+
+func TestSource_CloseEndsEvents(t *testing.T) {
+	withNetNS(t, func(h *netlink.Handle) {
+		source, err := New()
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		_ = source.Close()
+		deadline := time.After(3 * time.Second)
+		for {
+			select {
+			case _, ok := <-source.Events():
+				if !ok {
+					return
+				}
+			case <-deadline:
+				t.Fatal("events channel not closed")
+			}
+		}
+	})
+}
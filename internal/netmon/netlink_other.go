@@ -0,0 +1,27 @@
+//go:build !linux
+
+package netmon
+
+import "github.com/voltavpn/volta-client/internal/core"
+
+// Source на других платформах недоступен: New возвращает
+// core.ErrNetworkMonitorUnsupported.
+type Source struct{}
+
+func New() (*Source, error) {
+	return nil, core.ErrNetworkMonitorUnsupported
+}
+
+func (s *Source) Events() <-chan struct{} {
+	return nil
+}
+
+func (s *Source) Fingerprint() (string, error) {
+	return "", core.ErrNetworkMonitorUnsupported
+}
+
+func (s *Source) Close() error {
+	return nil
+}
+
+var _ core.NetworkEventSource = (*Source)(nil)
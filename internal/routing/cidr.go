@@ -0,0 +1,59 @@
+package routing
+
+import "net/netip"
+
+// cidrTree — двоичное префиксное дерево по битам адреса. IPv4 и IPv6
+// хранятся в отдельных деревьях, чтобы 10.0.0.0/8 не совпадал с ::a00:0/104.
+type cidrTree struct {
+	v4, v6 cidrNode
+}
+
+type cidrNode struct {
+	children [2]*cidrNode
+	// rule — наименьший индекс правила, чья подсеть заканчивается здесь.
+	rule int
+}
+
+func newCIDRTree() *cidrTree {
+	return &cidrTree{v4: cidrNode{rule: noRule}, v6: cidrNode{rule: noRule}}
+}
+
+func (t *cidrTree) root(addr netip.Addr) *cidrNode {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+func (t *cidrTree) insert(prefix netip.Prefix, rule int) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap()
+	bytes := addr.AsSlice()
+	node := t.root(addr)
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		next := node.children[bit]
+		if next == nil {
+			next = &cidrNode{rule: noRule}
+			node.children[bit] = next
+		}
+		node = next
+	}
+	node.rule = min(node.rule, rule)
+}
+
+// lookup возвращает наименьший индекс правила среди подсетей, содержащих addr.
+func (t *cidrTree) lookup(addr netip.Addr) int {
+	addr = addr.Unmap()
+	bytes := addr.AsSlice()
+	node := t.root(addr)
+	best := node.rule
+	for i := 0; i < len(bytes)*8; i++ {
+		node = node.children[bytes[i/8]>>(7-i%8)&1]
+		if node == nil {
+			break
+		}
+		best = min(best, node.rule)
+	}
+	return best
+}
@@ -0,0 +1,5 @@
+// Package routing evaluates the split-tunnelling rules from settings
+// locally. The engine applies the same rules itself (see
+// core.BuildEngineConfig); this package answers "where would this
+// destination go and why" for the UI and CLI without starting the engine.
+package routing
@@ -0,0 +1,66 @@
+package routing
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+)
+
+// ErrUnknownGeoSet — для кода geoip или имени geosite нет локальных данных.
+var ErrUnknownGeoSet = errors.New("unknown geo set")
+
+// GeoData — источник наборов GeoIP (подсети страны) и geosite (домены).
+// Ядро использует собственные базы; локально доступно то, что даёт GeoData.
+type GeoData interface {
+	GeoIP(code string) ([]netip.Prefix, error)
+	// GeoSite возвращает суффиксы доменов набора.
+	GeoSite(name string) ([]string, error)
+}
+
+// StaticGeo — GeoData из заранее известных наборов. Набор "private"
+// (локальные и служебные сети) доступен всегда.
+type StaticGeo struct {
+	IP   map[string][]netip.Prefix
+	Site map[string][]string
+}
+
+func (g StaticGeo) GeoIP(code string) ([]netip.Prefix, error) {
+	if prefixes, ok := g.IP[code]; ok {
+		return prefixes, nil
+	}
+	if code == "private" {
+		return privatePrefixes, nil
+	}
+	return nil, ErrUnknownGeoSet
+}
+
+func (g StaticGeo) GeoSite(name string) ([]string, error) {
+	if domains, ok := g.Site[name]; ok {
+		return domains, nil
+	}
+	return nil, ErrUnknownGeoSet
+}
+
+// PrivatePrefixes возвращает набор private: локальные и служебные сети.
+func PrivatePrefixes() []netip.Prefix {
+	return slices.Clone(privatePrefixes)
+}
+
+// privatePrefixes соответствует geoip:private в базах ядра.
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
@@ -0,0 +1,192 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// Destination — адрес назначения: доменное имя, IP или оба сразу.
+type Destination struct {
+	Domain string
+	Addr   netip.Addr
+}
+
+// ParseDestination разбирает "host", "host:port", "[v6]:port" или IP.
+func ParseDestination(s string) (Destination, error) {
+	host := s
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return Destination{}, errors.New("empty destination")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return Destination{Addr: addr}, nil
+	}
+	return Destination{Domain: host}, nil
+}
+
+func (d Destination) String() string {
+	switch {
+	case d.Domain != "" && d.Addr.IsValid():
+		return d.Domain + " (" + d.Addr.String() + ")"
+	case d.Domain != "":
+		return d.Domain
+	default:
+		return d.Addr.String()
+	}
+}
+
+type patternRule struct {
+	index   int
+	keyword string
+	re      *regexp.Regexp
+}
+
+// Matcher — скомпилированный список правил. Суффиксы доменов и geosite
+// лежат в префиксном дереве меток, подсети и GeoIP — в дереве CIDR, так что
+// поиск не зависит от числа таких правил; ключевые слова и регулярные
+// выражения проверяются по порядку, пока они могут выиграть у найденного.
+// Matcher неизменяем и безопасен для параллельного использования.
+type Matcher struct {
+	rules    []settings.RoutingRule
+	final    settings.RuleAction
+	domains  *domainTrie
+	cidrs    *cidrTree
+	patterns []patternRule
+	// unresolved — правила geoip/geosite без локальных данных.
+	unresolved []int
+}
+
+// Compile проверяет правила и строит Matcher. geo может быть nil — тогда
+// доступен только geoip "private".
+func Compile(r settings.RoutingSettings, geo GeoData) (*Matcher, error) {
+	if err := settings.ValidateRouting(r); err != nil {
+		return nil, err
+	}
+	if geo == nil {
+		geo = StaticGeo{}
+	}
+
+	m := &Matcher{
+		rules:   append([]settings.RoutingRule(nil), r.Rules...),
+		final:   r.Final,
+		domains: newDomainTrie(),
+		cidrs:   newCIDRTree(),
+	}
+	for i, rule := range r.Rules {
+		switch rule.Kind {
+		case settings.RuleDomainSuffix:
+			m.domains.insert(normalizeDomain(rule.Value), i)
+		case settings.RuleDomainKeyword:
+			m.patterns = append(m.patterns, patternRule{index: i, keyword: strings.ToLower(rule.Value)})
+		case settings.RuleDomainRegex:
+			m.patterns = append(m.patterns, patternRule{index: i, re: regexp.MustCompile(rule.Value)})
+		case settings.RuleCIDR:
+			m.cidrs.insert(netip.MustParsePrefix(rule.Value), i)
+		case settings.RuleGeoIP:
+			prefixes, err := geo.GeoIP(rule.Value)
+			if errors.Is(err, ErrUnknownGeoSet) {
+				m.unresolved = append(m.unresolved, i)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %d: %w", i+1, err)
+			}
+			for _, p := range prefixes {
+				m.cidrs.insert(p, i)
+			}
+		case settings.RuleGeoSite:
+			domains, err := geo.GeoSite(rule.Value)
+			if errors.Is(err, ErrUnknownGeoSet) {
+				m.unresolved = append(m.unresolved, i)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %d: %w", i+1, err)
+			}
+			for _, d := range domains {
+				m.domains.insert(normalizeDomain(d), i)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Match возвращает действие для dest и индекс совпавшего правила;
+// -1 означает, что сработало действие по умолчанию (Final).
+// Правила для IP проверяются, только если у dest известен адрес.
+func (m *Matcher) Match(dest Destination) (settings.RuleAction, int) {
+	best := noRule
+	if dest.Addr.IsValid() {
+		best = m.cidrs.lookup(dest.Addr)
+	}
+	if domain := normalizeDomain(dest.Domain); domain != "" {
+		best = min(best, m.domains.lookup(domain))
+		for _, p := range m.patterns {
+			if p.index >= best {
+				break
+			}
+			if p.re != nil && p.re.MatchString(domain) || p.re == nil && strings.Contains(domain, p.keyword) {
+				best = p.index
+				break
+			}
+		}
+	}
+	if best == noRule {
+		return m.final, -1
+	}
+	return m.rules[best].Action, best
+}
+
+// Explanation — почему адрес назначения получил своё действие.
+type Explanation struct {
+	Destination Destination
+	Action      settings.RuleAction
+	// Index — номер совпавшего правила (с 0); -1 — сработал Final.
+	Index int
+	Rule  settings.RoutingRule
+	// Skipped — правила до совпавшего, которые нельзя проверить локально
+	// (нет данных geoip/geosite); ядро может решить иначе.
+	Skipped []settings.RoutingRule
+}
+
+// Explain сопоставляет dest с правилами и описывает результат.
+func (m *Matcher) Explain(dest Destination) Explanation {
+	action, index := m.Match(dest)
+	e := Explanation{Destination: dest, Action: action, Index: index}
+	if index >= 0 {
+		e.Rule = m.rules[index]
+	}
+	for _, i := range m.unresolved {
+		if index >= 0 && i > index {
+			break
+		}
+		e.Skipped = append(e.Skipped, m.rules[i])
+	}
+	return e
+}
+
+func (e Explanation) String() string {
+	var b strings.Builder
+	if e.Index >= 0 {
+		fmt.Fprintf(&b, "%s → %s: правило %d (%s %s)", e.Destination, e.Action, e.Index+1, e.Rule.Kind, e.Rule.Value)
+	} else {
+		fmt.Fprintf(&b, "%s → %s: ни одно правило не совпало, действие по умолчанию", e.Destination, e.Action)
+	}
+	for _, r := range e.Skipped {
+		fmt.Fprintf(&b, "\nне проверено локально: %s %s (нет данных)", r.Kind, r.Value)
+	}
+	return b.String()
+}
+
+func normalizeDomain(d string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(d), "."), ".")
+}
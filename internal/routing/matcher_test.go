@@ -0,0 +1,131 @@
+package routing
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+func rule(kind settings.RuleKind, value string, action settings.RuleAction) settings.RoutingRule {
+	return settings.RoutingRule{Kind: kind, Value: value, Action: action}
+}
+
+func compile(t *testing.T, final settings.RuleAction, geo GeoData, rules ...settings.RoutingRule) *Matcher {
+	t.Helper()
+	m, err := Compile(settings.RoutingSettings{Rules: rules, Final: final}, geo)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return m
+}
+
+func dest(t *testing.T, s string) Destination {
+	t.Helper()
+	d, err := ParseDestination(s)
+	if err != nil {
+		t.Fatalf("ParseDestination(%q): %v", s, err)
+	}
+	return d
+}
+
+func TestMatcher_FirstMatchingRuleWins(t *testing.T) {
+	m := compile(t, settings.RuleActionProxy, nil,
+		rule(settings.RuleDomainSuffix, "public.corp.example", settings.RuleActionProxy),
+		rule(settings.RuleDomainSuffix, "corp.example", settings.RuleActionDirect),
+		rule(settings.RuleDomainKeyword, "tracker", settings.RuleActionBlock),
+		rule(settings.RuleDomainRegex, `^git\.`, settings.RuleActionDirect),
+		rule(settings.RuleCIDR, "10.20.0.0/16", settings.RuleActionProxy),
+		rule(settings.RuleGeoIP, "private", settings.RuleActionDirect),
+		rule(settings.RuleCIDR, "2001:db8::/32", settings.RuleActionBlock),
+	)
+
+	cases := []struct {
+		dest   string
+		action settings.RuleAction
+		index  int
+	}{
+		{"wiki.corp.example", settings.RuleActionDirect, 1},
+		{"CORP.EXAMPLE.", settings.RuleActionDirect, 1},
+		{"www.public.corp.example:443", settings.RuleActionProxy, 0},
+		{"notcorp.example", settings.RuleActionProxy, -1},
+		{"tracker.corp.example", settings.RuleActionDirect, 1},
+		{"ads-tracker.example.net", settings.RuleActionBlock, 2},
+		{"git.example.org", settings.RuleActionDirect, 3},
+		{"10.20.3.4", settings.RuleActionProxy, 4},
+		{"10.21.3.4", settings.RuleActionDirect, 5},
+		{"[::ffff:192.168.1.1]:80", settings.RuleActionDirect, 5},
+		{"2001:db8::1", settings.RuleActionBlock, 6},
+		{"8.8.8.8", settings.RuleActionProxy, -1},
+	}
+	for _, tc := range cases {
+		action, index := m.Match(dest(t, tc.dest))
+		if action != tc.action || index != tc.index {
+			t.Errorf("Match(%s) = %s, %d; want %s, %d", tc.dest, action, index, tc.action, tc.index)
+		}
+	}
+}
+
+func TestMatcher_GeoSets(t *testing.T) {
+	geo := StaticGeo{
+		IP:   map[string][]netip.Prefix{"zz": {netip.MustParsePrefix("203.0.113.0/24")}},
+		Site: map[string][]string{"corp-internal": {"intra.example", "vpn-bypass.example"}},
+	}
+	m := compile(t, settings.RuleActionBlock, geo,
+		rule(settings.RuleGeoSite, "corp-internal", settings.RuleActionDirect),
+		rule(settings.RuleGeoIP, "zz", settings.RuleActionDirect),
+		rule(settings.RuleGeoIP, "yy", settings.RuleActionProxy),
+	)
+
+	if action, index := m.Match(dest(t, "mail.intra.example")); action != settings.RuleActionDirect || index != 0 {
+		t.Fatalf("geosite match = %s, %d", action, index)
+	}
+	if action, index := m.Match(dest(t, "203.0.113.9")); action != settings.RuleActionDirect || index != 1 {
+		t.Fatalf("geoip match = %s, %d", action, index)
+	}
+
+	e := m.Explain(dest(t, "198.51.100.1"))
+	if e.Action != settings.RuleActionBlock || e.Index != -1 {
+		t.Fatalf("explain = %+v", e)
+	}
+	if len(e.Skipped) != 1 || e.Skipped[0].Value != "yy" {
+		t.Fatalf("skipped = %+v, want the geoip rule without local data", e.Skipped)
+	}
+	if s := e.String(); !strings.Contains(s, "по умолчанию") || !strings.Contains(s, "geoip yy") {
+		t.Fatalf("explain text = %q", s)
+	}
+}
+
+func TestMatcher_ExplainNamesRule(t *testing.T) {
+	m := compile(t, settings.RuleActionProxy, nil,
+		rule(settings.RuleGeoSite, "unknown", settings.RuleActionBlock),
+		rule(settings.RuleDomainSuffix, "corp.example", settings.RuleActionDirect),
+	)
+	e := m.Explain(dest(t, "jira.corp.example"))
+	if e.Index != 1 || e.Rule.Value != "corp.example" || len(e.Skipped) != 1 {
+		t.Fatalf("explain = %+v", e)
+	}
+	if s := e.String(); !strings.Contains(s, "правило 2 (domain_suffix corp.example)") {
+		t.Fatalf("explain text = %q", s)
+	}
+}
+
+func TestCompile_RejectsInvalidRules(t *testing.T) {
+	bad := []settings.RoutingRule{
+		rule(settings.RuleCIDR, "10.0.0.0/33", settings.RuleActionDirect),
+		rule(settings.RuleDomainRegex, "(", settings.RuleActionDirect),
+		rule(settings.RuleDomainSuffix, "corp..example", settings.RuleActionDirect),
+		rule(settings.RuleGeoIP, "RU", settings.RuleActionDirect),
+		rule(settings.RuleDomainSuffix, "corp.example", "tunnel"),
+		rule("port", "443", settings.RuleActionDirect),
+	}
+	for _, r := range bad {
+		if _, err := Compile(settings.RoutingSettings{Rules: []settings.RoutingRule{r}, Final: settings.RuleActionProxy}, nil); err == nil {
+			t.Errorf("Compile accepted %+v", r)
+		}
+	}
+	if _, err := Compile(settings.RoutingSettings{}, nil); err == nil {
+		t.Error("Compile accepted an empty final action")
+	}
+}
@@ -0,0 +1,65 @@
+package routing
+
+import "strings"
+
+// noRule — индекс «правило не найдено»; больше любого настоящего индекса,
+// поэтому min() работает без проверок.
+const noRule = int(^uint(0) >> 1)
+
+// domainTrie хранит суффиксы доменов по меткам справа налево:
+// "corp.example.com" → com → example → corp.
+type domainTrie struct {
+	root trieNode
+}
+
+type trieNode struct {
+	children map[string]*trieNode
+	// rule — наименьший индекс правила, чей суффикс заканчивается здесь.
+	rule int
+}
+
+func newDomainTrie() *domainTrie {
+	return &domainTrie{root: trieNode{rule: noRule}}
+}
+
+func (t *domainTrie) insert(suffix string, rule int) {
+	node := &t.root
+	for rest := suffix; rest != ""; {
+		var label string
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			label, rest = rest[i+1:], rest[:i]
+		} else {
+			label, rest = rest, ""
+		}
+		next := node.children[label]
+		if next == nil {
+			if node.children == nil {
+				node.children = make(map[string]*trieNode)
+			}
+			next = &trieNode{rule: noRule}
+			node.children[label] = next
+		}
+		node = next
+	}
+	node.rule = min(node.rule, rule)
+}
+
+// lookup возвращает наименьший индекс правила среди всех суффиксов domain.
+func (t *domainTrie) lookup(domain string) int {
+	best := noRule
+	node := &t.root
+	for rest := domain; rest != ""; {
+		var label string
+		if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+			label, rest = rest[i+1:], rest[:i]
+		} else {
+			label, rest = rest, ""
+		}
+		node = node.children[label]
+		if node == nil {
+			break
+		}
+		best = min(best, node.rule)
+	}
+	return best
+}
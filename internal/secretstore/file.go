@@ -0,0 +1,221 @@
+package secretstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	fileFormatVersion byte = 1
+	fileAAD                = "voltavpn-secretstore-v1"
+)
+
+// EncryptedFile хранит секреты в одном файле, зашифрованном AES‑256‑GCM.
+// Защита не сильнее ключа: с ключом из DeriveOSKey она лишь не даёт
+// прочитать файл, скопированный на другую машину или под другого пользователя.
+type EncryptedFile struct {
+	path string
+	aead cipher.AEAD
+
+	mu sync.Mutex
+}
+
+// NewEncryptedFile создаёт хранилище в файле path с 32‑байтовым ключом.
+func NewEncryptedFile(path string, key []byte) (*EncryptedFile, error) {
+	if len(key) != 32 {
+		return nil, errors.New("secretstore key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFile{path: path, aead: aead}, nil
+}
+
+// DefaultFilePath возвращает путь к файлу секретов рядом с настройками.
+func DefaultFilePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "VoltaVPN", "secrets.bin"), nil
+}
+
+func (f *EncryptedFile) Get(key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (f *EncryptedFile) Set(key string, value []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	values[key] = append([]byte(nil), value...)
+	return f.store(values)
+}
+
+func (f *EncryptedFile) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[key]; !ok {
+		return nil
+	}
+	delete(values, key)
+	return f.store(values)
+}
+
+func (f *EncryptedFile) Wipe() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(f.path + ".tmp"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// load читает и расшифровывает файл. Отсутствующий файл — пустое хранилище;
+// повреждённый или чужой файл — ошибка (секреты не восстанавливаем).
+func (f *EncryptedFile) load() (map[string][]byte, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string][]byte), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := f.aead.NonceSize()
+	if len(data) < 1+nonceSize || data[0] != fileFormatVersion {
+		return nil, errors.New("unsupported secret file format")
+	}
+	nonce := data[1 : 1+nonceSize]
+	plain, err := f.aead.Open(nil, nonce, data[1+nonceSize:], []byte(fileAAD))
+	if err != nil {
+		return nil, errors.New("secret file cannot be decrypted")
+	}
+	defer clear(plain)
+
+	values := make(map[string][]byte)
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, errors.New("secret file is corrupted")
+	}
+	return values, nil
+}
+
+func (f *EncryptedFile) store(values map[string][]byte) error {
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	defer clear(plain)
+
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	out := make([]byte, 0, 1+len(nonce)+len(plain)+f.aead.Overhead())
+	out = append(out, fileFormatVersion)
+	out = append(out, nonce...)
+	out = f.aead.Seal(out, nonce, plain, []byte(fileAAD))
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	// Перезаписываем атомарно: пишем во временный файл и переименовываем.
+	tmpPath := f.path + ".tmp"
+	if err := os.WriteFile(tmpPath, out, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// OpenDefault открывает лучшее доступное хранилище: системное (Secret
+// Service на Linux), иначе файловое с ключом из DeriveOSKey, иначе —
+// только память процесса. Секреты, оставшиеся в файле с тех пор, когда
+// системного хранилища не было, переносятся в него.
+func OpenDefault() Store {
+	file := openDefaultFile()
+	if system, err := openSystem(); err == nil {
+		if file != nil {
+			_ = file.moveTo(system)
+		}
+		return system
+	}
+	if file != nil {
+		return file
+	}
+	return NewMemory()
+}
+
+func openDefaultFile() *EncryptedFile {
+	path, err := DefaultFilePath()
+	if err != nil {
+		return nil
+	}
+	key, err := DeriveOSKey()
+	if err != nil {
+		return nil
+	}
+	store, err := NewEncryptedFile(path, key)
+	if err != nil {
+		return nil
+	}
+	return store
+}
+
+// moveTo переносит все секреты в dst и удаляет файл, только если
+// перенос удался целиком.
+func (f *EncryptedFile) moveTo(dst Store) error {
+	f.mu.Lock()
+	values, err := f.load()
+	f.mu.Unlock()
+	if err != nil || len(values) == 0 {
+		return err
+	}
+	for key, value := range values {
+		err := dst.Set(key, value)
+		clear(value)
+		if err != nil {
+			return err
+		}
+	}
+	return f.Wipe()
+}
@@ -0,0 +1,95 @@
+package secretstore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestEncryptedFile_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.bin")
+	store, err := NewEncryptedFile(path, testKey(1))
+	if err != nil {
+		t.Fatalf("NewEncryptedFile: %v", err)
+	}
+
+	if _, err := store.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get on empty store = %v, want ErrNotFound", err)
+	}
+	if err := store.Set("session", []byte("token-value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if bytes.Contains(raw, []byte("token-value")) {
+		t.Fatal("secret stored in plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	reopened, _ := NewEncryptedFile(path, testKey(1))
+	got, err := reopened.Get("session")
+	if err != nil || string(got) != "token-value" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	if err := reopened.Delete("session"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := reopened.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEncryptedFile_WrongKeyAndTamper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.bin")
+	store, _ := NewEncryptedFile(path, testKey(1))
+	if err := store.Set("session", []byte("token-value")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	other, _ := NewEncryptedFile(path, testKey(2))
+	if _, err := other.Get("session"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get with wrong key = %v, want decrypt error", err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	raw[len(raw)-1] ^= 0xFF
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := store.Get("session"); err == nil {
+		t.Fatal("tampered file was accepted")
+	}
+
+	if err := store.Wipe(); err != nil {
+		t.Fatalf("Wipe: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file still exists after Wipe: %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	value := []byte("v")
+	_ = m.Set("k", value)
+	value[0] = 'x'
+	if got, _ := m.Get("k"); string(got) != "v" {
+		t.Fatalf("Get = %q, store must copy values", got)
+	}
+	_ = m.Wipe()
+	if _, err := m.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Wipe = %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package secretstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"os/user"
+	"strings"
+)
+
+const osKeyLabel = "VoltaVPN secretstore v1"
+
+// DeriveOSKey выводит ключ для EncryptedFile из идентификатора машины и
+// пользователя ОС. Ключ не секретен для процессов того же пользователя,
+// поэтому файл с таким ключом — лишь запасной вариант, когда системное
+// хранилище недоступно.
+func DeriveOSKey() ([]byte, error) {
+	machineID, err := machineID()
+	if err != nil {
+		return nil, err
+	}
+	machineID = strings.TrimSpace(machineID)
+	if machineID == "" {
+		return nil, errors.New("empty machine id")
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, []byte(osKeyLabel))
+	mac.Write([]byte(machineID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(u.Uid))
+	return mac.Sum(nil), nil
+}
@@ -0,0 +1,16 @@
+package secretstore
+
+import (
+	"errors"
+	"os"
+)
+
+func machineID() (string, error) {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return string(data), nil
+		}
+	}
+	return "", errors.New("machine id is not available")
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package secretstore
+
+import "os"
+
+// На остальных платформах устойчивого идентификатора без exec нет;
+// используем имя хоста.
+func machineID() (string, error) {
+	return os.Hostname()
+}
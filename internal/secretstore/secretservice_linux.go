@@ -0,0 +1,268 @@
+package secretstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName   = "org.freedesktop.secrets"
+	secretServicePath   = dbus.ObjectPath("/org/freedesktop/secrets")
+	defaultCollection   = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	noPrompt            = dbus.ObjectPath("/")
+	serviceInterface    = "org.freedesktop.Secret.Service"
+	collectionInterface = "org.freedesktop.Secret.Collection"
+	itemInterface       = "org.freedesktop.Secret.Item"
+	promptInterface     = "org.freedesktop.Secret.Prompt"
+
+	// Атрибуты, по которым ищутся наши записи; значения в них не попадают.
+	attrApplication = "application"
+	attrKey         = "key"
+	applicationName = "voltavpn"
+
+	secretServiceCallTimeout = 10 * time.Second
+	// secretServicePromptTimeout — сколько ждать, пока пользователь
+	// разблокирует связку ключей.
+	secretServicePromptTimeout = 2 * time.Minute
+)
+
+var errPromptDismissed = errors.New("secret service prompt dismissed")
+
+// secret — структура Secret из спецификации Secret Service.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService хранит секреты в системной связке ключей (GNOME Keyring,
+// KWallet) через D-Bus API Secret Service. Сеанс открывается с алгоритмом
+// "plain": значения идут по сеансовой шине пользователя без шифрования,
+// но доступ к ней есть только у процессов того же пользователя.
+type SecretService struct {
+	conn    *dbus.Conn
+	object  func(path dbus.ObjectPath) dbus.BusObject
+	prompt  func(ctx context.Context, path dbus.ObjectPath) error
+	session dbus.ObjectPath
+
+	mu sync.Mutex
+}
+
+// OpenSecretService подключается к сеансовой шине и открывает сеанс
+// Secret Service. Шина запускается только системой: без неё хранилище
+// недоступно.
+func OpenSecretService() (*SecretService, error) {
+	address, err := sessionBusAddress()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		return nil, err
+	}
+	s := &SecretService{
+		conn:   conn,
+		object: func(path dbus.ObjectPath) dbus.BusObject { return conn.Object(secretServiceName, path) },
+	}
+	s.prompt = s.waitPrompt
+	if err := s.openSession(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// sessionBusAddress находит сеансовую шину без запуска dbus-launch.
+func sessionBusAddress() (string, error) {
+	if address := os.Getenv("DBUS_SESSION_BUS_ADDRESS"); address != "" {
+		return address, nil
+	}
+	path := "/run/user/" + strconv.Itoa(os.Getuid()) + "/bus"
+	if _, err := os.Stat(path); err != nil {
+		return "", errors.New("session bus is not available")
+	}
+	return "unix:path=" + path, nil
+}
+
+func (s *SecretService) openSession() error {
+	ctx, cancel := context.WithTimeout(context.Background(), secretServiceCallTimeout)
+	defer cancel()
+	var output dbus.Variant
+	call := s.object(secretServicePath).CallWithContext(ctx, serviceInterface+".OpenSession", 0, "plain", dbus.MakeVariant(""))
+	return call.Store(&output, &s.session)
+}
+
+// Close закрывает соединение с шиной.
+func (s *SecretService) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *SecretService) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.search(map[string]string{attrApplication: applicationName, attrKey: key})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretServiceCallTimeout)
+	defer cancel()
+	var value secret
+	if err := s.object(items[0]).CallWithContext(ctx, itemInterface+".GetSecret", 0, s.session).Store(&value); err != nil {
+		return nil, err
+	}
+	return value.Value, nil
+}
+
+func (s *SecretService) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.unlock([]dbus.ObjectPath{defaultCollection}); err != nil {
+		return err
+	}
+	properties := map[string]dbus.Variant{
+		itemInterface + ".Label":      dbus.MakeVariant("VoltaVPN: " + key),
+		itemInterface + ".Attributes": dbus.MakeVariant(map[string]string{attrApplication: applicationName, attrKey: key}),
+	}
+	payload := secret{
+		Session:     s.session,
+		Parameters:  []byte{},
+		Value:       value,
+		ContentType: "application/octet-stream",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretServiceCallTimeout)
+	defer cancel()
+	var item, prompt dbus.ObjectPath
+	call := s.object(defaultCollection).CallWithContext(ctx, collectionInterface+".CreateItem", 0, properties, payload, true)
+	if err := call.Store(&item, &prompt); err != nil {
+		return err
+	}
+	return s.completePrompt(prompt)
+}
+
+func (s *SecretService) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteMatching(map[string]string{attrApplication: applicationName, attrKey: key})
+}
+
+// Wipe удаляет все записи приложения из связки ключей.
+func (s *SecretService) Wipe() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteMatching(map[string]string{attrApplication: applicationName})
+}
+
+func (s *SecretService) deleteMatching(attributes map[string]string) error {
+	items, err := s.search(attributes)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, item := range items {
+		ctx, cancel := context.WithTimeout(context.Background(), secretServiceCallTimeout)
+		var prompt dbus.ObjectPath
+		err := s.object(item).CallWithContext(ctx, itemInterface+".Delete", 0).Store(&prompt)
+		cancel()
+		if err == nil {
+			err = s.completePrompt(prompt)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// search возвращает записи с атрибутами, разблокируя заблокированные.
+func (s *SecretService) search(attributes map[string]string) ([]dbus.ObjectPath, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretServiceCallTimeout)
+	defer cancel()
+	var unlocked, locked []dbus.ObjectPath
+	call := s.object(secretServicePath).CallWithContext(ctx, serviceInterface+".SearchItems", 0, attributes)
+	if err := call.Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(locked); err != nil {
+			return nil, err
+		}
+	}
+	return append(unlocked, locked...), nil
+}
+
+func (s *SecretService) unlock(objects []dbus.ObjectPath) error {
+	ctx, cancel := context.WithTimeout(context.Background(), secretServiceCallTimeout)
+	defer cancel()
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := s.object(secretServicePath).CallWithContext(ctx, serviceInterface+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return err
+	}
+	return s.completePrompt(prompt)
+}
+
+// completePrompt показывает пользователю запрос связки ключей, если
+// сервис его вернул, и ждёт ответа.
+func (s *SecretService) completePrompt(prompt dbus.ObjectPath) error {
+	if prompt == noPrompt || prompt == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretServicePromptTimeout)
+	defer cancel()
+	return s.prompt(ctx, prompt)
+}
+
+func (s *SecretService) waitPrompt(ctx context.Context, path dbus.ObjectPath) error {
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(promptInterface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignalContext(ctx, match...); err != nil {
+		return err
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 4)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.object(path).CallWithContext(ctx, promptInterface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || sig.Name != promptInterface+".Completed" || len(sig.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return errPromptDismissed
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("secret service prompt: %w", ctx.Err())
+		}
+	}
+}
+
+// openSystem открывает системное хранилище секретов.
+func openSystem() (Store, error) {
+	return OpenSecretService()
+}
+
+var _ Store = (*SecretService)(nil)
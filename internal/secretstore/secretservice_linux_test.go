@@ -0,0 +1,272 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeKeyring — Secret Service в памяти: отвечает на вызовы D-Bus так же,
+// как GNOME Keyring, включая заблокированные записи и запросы разблокировки.
+type fakeKeyring struct {
+	mu      sync.Mutex
+	items   map[dbus.ObjectPath]*fakeItem
+	nextID  int
+	locked  bool
+	prompts int
+}
+
+type fakeItem struct {
+	attributes map[string]string
+	value      []byte
+	locked     bool
+}
+
+func newFakeSecretService(k *fakeKeyring) *SecretService {
+	s := &SecretService{
+		object: func(path dbus.ObjectPath) dbus.BusObject { return &fakeObject{keyring: k, path: path} },
+		prompt: func(ctx context.Context, path dbus.ObjectPath) error {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			k.prompts++
+			k.locked = false
+			for _, item := range k.items {
+				item.locked = false
+			}
+			return nil
+		},
+	}
+	if err := s.openSession(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// fakeObject — объект шины; неиспользуемые методы BusObject не реализованы.
+type fakeObject struct {
+	dbus.BusObject
+	keyring *fakeKeyring
+	path    dbus.ObjectPath
+}
+
+func (o *fakeObject) CallWithContext(_ context.Context, method string, _ dbus.Flags, args ...interface{}) *dbus.Call {
+	body, err := o.keyring.handle(o.path, method, args)
+	return &dbus.Call{Body: body, Err: err}
+}
+
+func (k *fakeKeyring) handle(path dbus.ObjectPath, method string, args []interface{}) ([]interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.items == nil {
+		k.items = make(map[dbus.ObjectPath]*fakeItem)
+	}
+
+	switch {
+	case method == serviceInterface+".OpenSession" && path == secretServicePath:
+		if args[0] != "plain" {
+			return nil, errors.New("unsupported algorithm")
+		}
+		return []interface{}{dbus.MakeVariant(""), dbus.ObjectPath("/org/freedesktop/secrets/session/1")}, nil
+
+	case method == serviceInterface+".SearchItems":
+		query := args[0].(map[string]string)
+		var unlocked, locked []dbus.ObjectPath
+		for p, item := range k.items {
+			if !matches(item.attributes, query) {
+				continue
+			}
+			if item.locked {
+				locked = append(locked, p)
+			} else {
+				unlocked = append(unlocked, p)
+			}
+		}
+		return []interface{}{unlocked, locked}, nil
+
+	case method == serviceInterface+".Unlock":
+		objects := args[0].([]dbus.ObjectPath)
+		needPrompt := false
+		for _, p := range objects {
+			if p == defaultCollection && k.locked {
+				needPrompt = true
+			}
+			if item, ok := k.items[p]; ok && item.locked {
+				needPrompt = true
+			}
+		}
+		if needPrompt {
+			return []interface{}{[]dbus.ObjectPath{}, dbus.ObjectPath("/org/freedesktop/secrets/prompt/1")}, nil
+		}
+		return []interface{}{objects, noPrompt}, nil
+
+	case method == collectionInterface+".CreateItem" && path == defaultCollection:
+		if k.locked {
+			return nil, errors.New("org.freedesktop.Secret.Error.IsLocked")
+		}
+		props := args[0].(map[string]dbus.Variant)
+		attributes := props[itemInterface+".Attributes"].Value().(map[string]string)
+		payload := args[1].(secret)
+		if payload.Session == "" {
+			return nil, errors.New("no session")
+		}
+		for p, item := range k.items {
+			if maps.Equal(item.attributes, attributes) && args[2].(bool) {
+				item.value = bytes.Clone(payload.Value)
+				return []interface{}{p, noPrompt}, nil
+			}
+		}
+		k.nextID++
+		p := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", k.nextID))
+		k.items[p] = &fakeItem{attributes: maps.Clone(attributes), value: bytes.Clone(payload.Value)}
+		return []interface{}{p, noPrompt}, nil
+
+	case method == itemInterface+".GetSecret":
+		item, ok := k.items[path]
+		if !ok {
+			return nil, errors.New("org.freedesktop.Secret.Error.NoSuchObject")
+		}
+		if item.locked {
+			return nil, errors.New("org.freedesktop.Secret.Error.IsLocked")
+		}
+		return []interface{}{secret{Session: args[0].(dbus.ObjectPath), Value: bytes.Clone(item.value), ContentType: "application/octet-stream"}}, nil
+
+	case method == itemInterface+".Delete":
+		if _, ok := k.items[path]; !ok {
+			return nil, errors.New("org.freedesktop.Secret.Error.NoSuchObject")
+		}
+		delete(k.items, path)
+		return []interface{}{noPrompt}, nil
+	}
+	return nil, fmt.Errorf("unexpected call %s on %s", method, path)
+}
+
+func matches(attributes, query map[string]string) bool {
+	for k, v := range query {
+		if attributes[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSecretService_RoundTrip(t *testing.T) {
+	keyring := &fakeKeyring{}
+	store := newFakeSecretService(keyring)
+
+	if _, err := store.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing = %v, want ErrNotFound", err)
+	}
+	if err := store.Set("session", []byte("dummy-session")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set("session", []byte("dummy-session-2")); err != nil {
+		t.Fatalf("Set replace: %v", err)
+	}
+	got, err := store.Get("session")
+	if err != nil || string(got) != "dummy-session-2" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	if len(keyring.items) != 1 {
+		t.Fatalf("items = %d, want replaced in place", len(keyring.items))
+	}
+	for _, item := range keyring.items {
+		if item.attributes[attrApplication] != applicationName || item.attributes[attrKey] != "session" {
+			t.Fatalf("attributes = %v", item.attributes)
+		}
+	}
+
+	if err := store.Delete("session"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after delete = %v", err)
+	}
+}
+
+func TestSecretService_UnlocksThroughPrompt(t *testing.T) {
+	keyring := &fakeKeyring{}
+	store := newFakeSecretService(keyring)
+	if err := store.Set("device_key", []byte("dummy-device-key")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Связка ключей заблокирована, например после сна.
+	keyring.locked = true
+	for _, item := range keyring.items {
+		item.locked = true
+	}
+	got, err := store.Get("device_key")
+	if err != nil || string(got) != "dummy-device-key" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	if keyring.prompts != 1 {
+		t.Fatalf("prompts = %d, want 1", keyring.prompts)
+	}
+
+	keyring.locked = true
+	if err := store.Set("session", []byte("dummy-session")); err != nil {
+		t.Fatalf("Set into locked collection: %v", err)
+	}
+	if keyring.prompts != 2 {
+		t.Fatalf("prompts = %d, want 2", keyring.prompts)
+	}
+}
+
+func TestSecretService_PromptDismissedFails(t *testing.T) {
+	keyring := &fakeKeyring{locked: true}
+	store := newFakeSecretService(keyring)
+	store.prompt = func(context.Context, dbus.ObjectPath) error { return errPromptDismissed }
+	if err := store.Set("session", []byte("dummy-session")); !errors.Is(err, errPromptDismissed) {
+		t.Fatalf("Set = %v, want dismissed", err)
+	}
+}
+
+func TestSecretService_WipeRemovesOnlyOwnItems(t *testing.T) {
+	keyring := &fakeKeyring{}
+	store := newFakeSecretService(keyring)
+	for _, key := range []string{"session", "device_key"} {
+		if err := store.Set(key, []byte("dummy-"+key)); err != nil {
+			t.Fatalf("Set %s: %v", key, err)
+		}
+	}
+	foreign := dbus.ObjectPath("/org/freedesktop/secrets/collection/login/99")
+	keyring.items[foreign] = &fakeItem{attributes: map[string]string{"application": "browser"}, value: []byte("dummy")}
+
+	if err := store.Wipe(); err != nil {
+		t.Fatalf("Wipe: %v", err)
+	}
+	if len(keyring.items) != 1 || keyring.items[foreign] == nil {
+		t.Fatalf("items after wipe = %v", keyring.items)
+	}
+}
+
+func TestEncryptedFile_MovesSecretsToSystemStore(t *testing.T) {
+	file, err := NewEncryptedFile(t.TempDir()+"/secrets.bin", bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewEncryptedFile: %v", err)
+	}
+	if err := file.Set("session", []byte("dummy-session")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	keyring := &fakeKeyring{}
+	system := newFakeSecretService(keyring)
+
+	if err := file.moveTo(system); err != nil {
+		t.Fatalf("moveTo: %v", err)
+	}
+	if got, err := system.Get("session"); err != nil || string(got) != "dummy-session" {
+		t.Fatalf("system Get = %q, %v", got, err)
+	}
+	if _, err := file.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("file still has session: %v", err)
+	}
+	if len(keyring.items) != 1 {
+		t.Fatalf("keyring items = %d, want 1", len(keyring.items))
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package secretstore
+
+import "errors"
+
+// openSystem открывает системное хранилище секретов; на этой платформе
+// его пока нет, и секреты хранятся в зашифрованном файле.
+func openSystem() (Store, error) {
+	return nil, errors.New("system secret store is not supported on this platform")
+}
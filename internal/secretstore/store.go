@@ -0,0 +1,68 @@
+// Package secretstore keeps small secrets (session tokens, device keys)
+// out of the plain settings file. Backends differ in how strongly the data
+// is protected at rest; callers only see the Store interface.
+package secretstore
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Store — хранилище секретов по строковому ключу.
+// Значения не должны попадать в логи и сообщения об ошибках.
+type Store interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+	// Wipe удаляет все секреты этого хранилища.
+	Wipe() error
+}
+
+// Memory хранит секреты только в памяти процесса.
+type Memory struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{values: make(map[string][]byte)}
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+func (m *Memory) Set(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.values[key]; ok {
+		clear(v)
+		delete(m.values, key)
+	}
+	return nil
+}
+
+func (m *Memory) Wipe() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, v := range m.values {
+		clear(v)
+		delete(m.values, k)
+	}
+	return nil
+}
@@ -3,12 +3,20 @@ package settings
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 // CurrentVersion — простая версия схемы файла настроек.
-const CurrentVersion = 1
+const CurrentVersion = 2
 
 // ConnectionMode описывает режим установления VPN‑подключения.
 type ConnectionMode string
@@ -16,6 +24,35 @@ type ConnectionMode string
 const (
 	ConnectionModeAuto             ConnectionMode = "auto"
 	ConnectionModeVLESSRealityOnly ConnectionMode = "vless_reality_only"
+	// ConnectionModeProxyOnly — только локальные SOCKS5 и HTTP‑прокси на
+	// 127.0.0.1, транспорты как в Auto. Не требует прав администратора:
+	// системная сеть не меняется, kill switch не применяется.
+	ConnectionModeProxyOnly ConnectionMode = "proxy_only"
+)
+
+// TLSFingerprint — браузер, под ClientHello которого маскируется
+// TLS‑рукопожатие с сервером.
+type TLSFingerprint string
+
+const (
+	FingerprintChrome  TLSFingerprint = "chrome"
+	FingerprintFirefox TLSFingerprint = "firefox"
+	FingerprintSafari  TLSFingerprint = "safari"
+	// FingerprintRandomized — случайные параметры на каждое подключение.
+	FingerprintRandomized TLSFingerprint = "randomized"
+)
+
+// IPv6Policy — что делать с трафиком IPv6, пока VPN включён.
+type IPv6Policy string
+
+const (
+	// IPv6Tunnel — IPv6 идёт в туннель вместе с IPv4.
+	IPv6Tunnel IPv6Policy = "tunnel"
+	// IPv6Block — IPv6 блокируется, а DNS не отдаёт записей AAAA:
+	// приложения сразу переходят на IPv4.
+	IPv6Block IPv6Policy = "block"
+	// IPv6Allow — IPv6 идёт мимо туннеля, как без VPN.
+	IPv6Allow IPv6Policy = "allow"
 )
 
 // Language — код языка интерфейса.
@@ -31,6 +68,9 @@ type Settings struct {
 
 	Connection ConnectionSettings `json:"connection"`
 	Privacy    PrivacySettings    `json:"privacy"`
+	Routing    RoutingSettings    `json:"routing"`
+	DNS        DNSSettings        `json:"dns"`
+	Access     AccessSettings     `json:"access"`
 	App        AppSettings        `json:"app"`
 }
 
@@ -39,11 +79,149 @@ type ConnectionSettings struct {
 	AutoReconnect         bool           `json:"auto_reconnect"`
 	ReconnectIntervalSecs int            `json:"reconnect_interval_secs"`
 	Mode                  ConnectionMode `json:"mode"`
+	// Fingerprint заменяет отпечаток TLS из ссылки профиля.
+	Fingerprint TLSFingerprint `json:"fingerprint"`
+	// ProxyAuth — в режиме ProxyOnly защищать локальные прокси логином и
+	// паролем, которые создаются заново на каждое подключение.
+	ProxyAuth bool `json:"proxy_auth"`
+	// TUN — направлять весь трафик устройства через виртуальный интерфейс
+	// (нужны права администратора). В режиме ProxyOnly не используется.
+	TUN bool `json:"tun"`
+	// HealthCheck — проверять поднятый туннель пробными запросами и
+	// переподключать его, если трафик перестал проходить.
+	HealthCheck        bool `json:"health_check"`
+	HealthIntervalSecs int  `json:"health_interval_secs"`
+	// HealthDegradedRTTMs — время ответа пробы, выше которого туннель
+	// считается деградировавшим.
+	HealthDegradedRTTMs int `json:"health_degraded_rtt_ms"`
+	// HealthStallFailures — столько неудачных проб подряд означают, что
+	// туннель завис.
+	HealthStallFailures int `json:"health_stall_failures"`
 }
 
 type PrivacySettings struct {
-	// RememberDevice — только флаг для UI, никакие секреты пока не хранятся.
+	// RememberDevice — сохранять сессию и ключ устройства между запусками
+	// (в хранилище секретов, не в этом файле).
 	RememberDevice bool `json:"remember_device"`
+	// KillSwitch — блокировать трафик вне туннеля, пока подключение не
+	// отключено пользователем.
+	KillSwitch bool `json:"kill_switch"`
+	// DNSLeakProtection — отвечать на DNS через локальную заглушку, которая
+	// пересылает запросы в туннель по DoH. В режиме TUN на заглушку
+	// направляется системный резолвер (через systemd-resolved); в режиме
+	// прокси её адрес указывают в приложениях вручную.
+	DNSLeakProtection bool `json:"dns_leak_protection"`
+	// StrictDNS — пока туннель не поднят, заглушка отказывает в ответе,
+	// а не идёт к резолверу напрямую.
+	StrictDNS bool `json:"strict_dns"`
+	// IPv6 — политика IPv6; её соблюдают маршруты TUN, kill switch и
+	// DNS‑заглушка.
+	IPv6 IPv6Policy `json:"ipv6"`
+}
+
+// RuleKind — чем правило маршрутизации сопоставляет адрес назначения.
+type RuleKind string
+
+const (
+	// RuleDomainSuffix — домен и все его поддомены.
+	RuleDomainSuffix RuleKind = "domain_suffix"
+	// RuleDomainKeyword — подстрока в имени домена.
+	RuleDomainKeyword RuleKind = "domain_keyword"
+	// RuleDomainRegex — регулярное выражение (синтаксис RE2) для имени домена.
+	RuleDomainRegex RuleKind = "domain_regex"
+	// RuleCIDR — IPv4/IPv6‑подсеть.
+	RuleCIDR RuleKind = "cidr"
+	// RuleGeoIP — набор подсетей страны (код ISO 3166) или "private".
+	RuleGeoIP RuleKind = "geoip"
+	// RuleGeoSite — именованный набор доменов, например "category-ads".
+	RuleGeoSite RuleKind = "geosite"
+)
+
+// RuleAction — куда направить трафик, совпавший с правилом.
+type RuleAction string
+
+const (
+	RuleActionProxy  RuleAction = "proxy"
+	RuleActionDirect RuleAction = "direct"
+	RuleActionBlock  RuleAction = "block"
+)
+
+// RoutingRule — одно правило раздельного туннелирования.
+type RoutingRule struct {
+	Kind   RuleKind   `json:"kind"`
+	Value  string     `json:"value"`
+	Action RuleAction `json:"action"`
+}
+
+// RoutingSettings — упорядоченный список правил: срабатывает первое
+// совпавшее, а если не совпало ни одно — Final.
+type RoutingSettings struct {
+	Rules []RoutingRule `json:"rules"`
+	Final RuleAction    `json:"final"`
+	// BypassApps — абсолютные пути к исполняемым файлам приложений, весь
+	// трафик которых идёт мимо туннеля. Действует в режиме TUN в Linux.
+	BypassApps []string `json:"bypass_apps"`
+}
+
+// DNSSettings — резолверы клиента. Адрес сервера:
+//
+//	10.0.0.53, 10.0.0.53:5353, [fd00::53]:53 — обычный DNS (порт 53);
+//	tls://dns.example, tls://9.9.9.9:853      — DNS‑over‑TLS (порт 853);
+//	https://dns.example/dns-query             — DNS‑over‑HTTPS.
+//
+// Запросы к серверам идут через туннель, кроме маршрутов мимо него
+// (например, к частным адресам).
+type DNSSettings struct {
+	// Servers — серверы по порядку; пусто — встроенный DoH‑резолвер.
+	Servers []string `json:"servers"`
+	// Domains — свои серверы для доменов; первое совпадение побеждает.
+	Domains []DNSDomainRule `json:"domains"`
+	// Hosts — статические адреса, как в файле hosts.
+	Hosts []DNSHost `json:"hosts"`
+}
+
+// DNSDomainRule направляет запросы о домене и его поддоменах серверам Servers.
+type DNSDomainRule struct {
+	Domain  string   `json:"domain"`
+	Servers []string `json:"servers"`
+}
+
+// DNSHost — статическая запись: имя (без поддоменов) и его адреса.
+type DNSHost struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+}
+
+// DNSProtocol — протокол DNS‑сервера.
+type DNSProtocol string
+
+const (
+	DNSPlain DNSProtocol = "plain"
+	DNSTLS   DNSProtocol = "tls"
+	DNSHTTPS DNSProtocol = "https"
+)
+
+// DNSServer — разобранный адрес DNS‑сервера.
+type DNSServer struct {
+	Protocol DNSProtocol
+	// Host — IP‑адрес (для обычного DNS только он) или имя сервера.
+	Host string
+	Port uint16
+	// URL — адрес DoH‑запросов; для других протоколов пуст.
+	URL string
+}
+
+// Address — host:port для подключения.
+func (d DNSServer) Address() string {
+	return net.JoinHostPort(d.Host, strconv.Itoa(int(d.Port)))
+}
+
+// AccessSettings — выбор среди сохранённых ключей доступа. Сами ключи и
+// сессии лежат в хранилище секретов, здесь только указатель.
+type AccessSettings struct {
+	// ActiveProfile — ID активного профиля ключа; пусто — первый
+	// сохранённый.
+	ActiveProfile string `json:"active_profile"`
 }
 
 type AppSettings struct {
@@ -60,9 +238,30 @@ func Default() Settings {
 			AutoReconnect:         true,
 			ReconnectIntervalSecs: 10,
 			Mode:                  ConnectionModeAuto,
+			Fingerprint:           FingerprintChrome,
+			ProxyAuth:             true,
+			TUN:                   false,
+			HealthCheck:           true,
+			HealthIntervalSecs:    30,
+			HealthDegradedRTTMs:   1500,
+			HealthStallFailures:   3,
 		},
 		Privacy: PrivacySettings{
-			RememberDevice: true,
+			RememberDevice:    true,
+			KillSwitch:        false,
+			DNSLeakProtection: true,
+			StrictDNS:         false,
+			IPv6:              IPv6Block,
+		},
+		Routing: RoutingSettings{
+			Rules:      []RoutingRule{},
+			Final:      RuleActionProxy,
+			BypassApps: []string{},
+		},
+		DNS: DNSSettings{
+			Servers: []string{},
+			Domains: []DNSDomainRule{},
+			Hosts:   []DNSHost{},
 		},
 		App: AppSettings{
 			StartWithWindows: false,
@@ -97,14 +296,17 @@ func Load() (Settings, error) {
 		return Default(), err
 	}
 
-	var s Settings
+	// Поля, которых нет в файле (он мог быть записан до их появления),
+	// сохраняют значения по умолчанию.
+	s := Default()
 	if err := json.Unmarshal(data, &s); err != nil {
 		return Default(), err
 	}
 
-	// Простая проверка версии: если версия не совпадает — откатываемся к значениям по умолчанию.
-	if s.Version != CurrentVersion {
-		return Default(), errors.New("settings version mismatch")
+	// Файлы прошлых версий переводятся на текущую схему; с неизвестной
+	// версией откатываемся к значениям по умолчанию.
+	if err := migrate(&s); err != nil {
+		return Default(), err
 	}
 	if err := validate(s); err != nil {
 		return Default(), err
@@ -113,6 +315,25 @@ func Load() (Settings, error) {
 	return s, nil
 }
 
+// migrations[v] переводит настройки версии v в версию v+1.
+var migrations = map[int]func(*Settings){
+	// Версия 1 не знала политики IPv6: IPv6 шёл мимо туннеля. Переводим
+	// на блокировку — серверы работают только по IPv4.
+	1: func(s *Settings) { s.Privacy.IPv6 = IPv6Block },
+}
+
+func migrate(s *Settings) error {
+	for s.Version != CurrentVersion {
+		step, ok := migrations[s.Version]
+		if !ok {
+			return errors.New("settings version mismatch")
+		}
+		step(s)
+		s.Version++
+	}
+	return nil
+}
+
 // LoadOrDefault возвращает настройки, никогда не падая: при ошибке Load вернёт Default.
 func LoadOrDefault() Settings {
 	s, err := Load()
@@ -143,7 +364,12 @@ func Save(s Settings) error {
 		return err
 	}
 
-	// Перезаписываем атомарно: пишем во временный файл и переименовываем.
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic перезаписывает файл атомарно: пишет во временный файл
+// и переименовывает его.
+func writeFileAtomic(path string, data []byte) error {
 	tmpPath := path + ".tmp"
 	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
 		return err
@@ -155,19 +381,20 @@ func Save(s Settings) error {
 	return nil
 }
 
-// Clear удаляет файл настроек и возвращает значения по умолчанию.
+// Clear удаляет файлы настроек и накопленного трафика и возвращает
+// значения по умолчанию.
 func Clear() (Settings, error) {
 	path, err := ConfigFilePath()
 	if err != nil {
 		return Default(), err
 	}
 
-	// Remove file if exists. Ignore "not exists" errors.
-	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return Default(), err
-	}
-	if err := os.Remove(path + ".tmp"); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return Default(), err
+	// Remove files if they exist. Ignore "not exists" errors.
+	traffic := filepath.Join(filepath.Dir(path), trafficFileName)
+	for _, p := range []string{path, path + ".tmp", traffic, traffic + ".tmp"} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Default(), err
+		}
 	}
 
 	return Default(), nil
@@ -180,12 +407,285 @@ func validate(s Settings) error {
 	if !isValidConnectionMode(s.Connection.Mode) {
 		return errors.New("invalid connection mode")
 	}
+	if !isValidFingerprint(s.Connection.Fingerprint) {
+		return errors.New("invalid TLS fingerprint")
+	}
+	if err := validateHealth(s.Connection); err != nil {
+		return err
+	}
+	if !isValidIPv6Policy(s.Privacy.IPv6) {
+		return errors.New("invalid IPv6 policy")
+	}
 	if !isValidLanguage(s.App.Language) {
 		return errors.New("invalid app language")
 	}
+	if err := ValidateRouting(s.Routing); err != nil {
+		return err
+	}
+	if err := ValidateDNS(s.DNS); err != nil {
+		return err
+	}
+	if !isValidProfileID(s.Access.ActiveProfile) {
+		return errors.New("invalid active access profile")
+	}
+	return nil
+}
+
+// ValidateRouting проверяет правила маршрутизации; ошибка указывает
+// номер первого некорректного правила (с 1).
+func ValidateRouting(r RoutingSettings) error {
+	if !isValidRuleAction(r.Final) {
+		return errors.New("invalid final routing action")
+	}
+	for i, rule := range r.Rules {
+		if err := validateRule(rule); err != nil {
+			return fmt.Errorf("routing rule %d: %w", i+1, err)
+		}
+	}
+	if len(r.BypassApps) > maxBypassApps {
+		return errors.New("too many bypass apps")
+	}
+	for i, app := range r.BypassApps {
+		if !isValidAppPath(app) || slices.Contains(r.BypassApps[:i], app) {
+			return fmt.Errorf("bypass app %d: invalid or duplicate path", i+1)
+		}
+	}
+	return nil
+}
+
+// Ограничения размера настроек DNS.
+const (
+	maxDNSServers = 8
+	maxDNSDomains = 64
+	maxDNSHosts   = 256
+)
+
+// ValidateDNS проверяет настройки DNS; ошибка указывает номер первого
+// некорректного сервера, правила или записи (с 1).
+func ValidateDNS(d DNSSettings) error {
+	if err := validateDNSServers(d.Servers, false); err != nil {
+		return err
+	}
+	if len(d.Domains) > maxDNSDomains {
+		return errors.New("too many DNS domain rules")
+	}
+	for i, rule := range d.Domains {
+		if !isDomainLike(rule.Domain) || slices.ContainsFunc(d.Domains[:i], func(r DNSDomainRule) bool {
+			return r.Domain == rule.Domain
+		}) {
+			return fmt.Errorf("dns domain rule %d: invalid or duplicate domain", i+1)
+		}
+		if err := validateDNSServers(rule.Servers, true); err != nil {
+			return fmt.Errorf("dns domain rule %d: %w", i+1, err)
+		}
+	}
+	if len(d.Hosts) > maxDNSHosts {
+		return errors.New("too many DNS hosts")
+	}
+	for i, host := range d.Hosts {
+		if !isDomainLike(host.Name) || slices.ContainsFunc(d.Hosts[:i], func(h DNSHost) bool {
+			return h.Name == host.Name
+		}) {
+			return fmt.Errorf("dns host %d: invalid or duplicate name", i+1)
+		}
+		if len(host.Addresses) == 0 {
+			return fmt.Errorf("dns host %d: no addresses", i+1)
+		}
+		for _, addr := range host.Addresses {
+			if a, err := netip.ParseAddr(addr); err != nil || a.Zone() != "" {
+				return fmt.Errorf("dns host %d: invalid address", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+func validateDNSServers(servers []string, required bool) error {
+	if required && len(servers) == 0 {
+		return errors.New("no dns servers")
+	}
+	if len(servers) > maxDNSServers {
+		return errors.New("too many dns servers")
+	}
+	for i, server := range servers {
+		if _, err := ParseDNSServer(server); err != nil {
+			return fmt.Errorf("dns server %d: %w", i+1, err)
+		}
+	}
 	return nil
 }
 
+// ParseDNSServer разбирает адрес DNS‑сервера из настроек (см. DNSSettings).
+func ParseDNSServer(v string) (DNSServer, error) {
+	scheme, _, ok := strings.Cut(v, "://")
+	if !ok {
+		// Обычный DNS: имя сервера резолвить было бы нечем.
+		ap, err := parseAddrPort(v, 53)
+		if err != nil {
+			return DNSServer{}, errors.New("invalid plain DNS address")
+		}
+		return DNSServer{Protocol: DNSPlain, Host: ap.Addr().String(), Port: ap.Port()}, nil
+	}
+
+	u, err := url.Parse(v)
+	if err != nil || u.User != nil || u.Fragment != "" || u.Opaque != "" || u.Hostname() == "" {
+		return DNSServer{}, errors.New("invalid DNS server URL")
+	}
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err != nil && !isDomainLike(host) {
+		return DNSServer{}, errors.New("invalid DNS server host")
+	}
+	port := uint16(0)
+	if p := u.Port(); p != "" {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil || n == 0 {
+			return DNSServer{}, errors.New("invalid DNS server port")
+		}
+		port = uint16(n)
+	}
+
+	switch scheme {
+	case "tls":
+		if u.Path != "" || u.RawQuery != "" {
+			return DNSServer{}, errors.New("DoT address must not have a path")
+		}
+		if port == 0 {
+			port = 853
+		}
+		return DNSServer{Protocol: DNSTLS, Host: host, Port: port}, nil
+	case "https":
+		if u.Path == "" || u.Path == "/" {
+			return DNSServer{}, errors.New("DoH address must have a path")
+		}
+		if port == 0 {
+			port = 443
+		}
+		return DNSServer{Protocol: DNSHTTPS, Host: host, Port: port, URL: u.String()}, nil
+	default:
+		return DNSServer{}, errors.New("unsupported DNS server scheme")
+	}
+}
+
+// parseAddrPort принимает IP‑адрес с портом или без него.
+func parseAddrPort(v string, defaultPort uint16) (netip.AddrPort, error) {
+	if addr, err := netip.ParseAddr(v); err == nil && addr.Zone() == "" {
+		return netip.AddrPortFrom(addr, defaultPort), nil
+	}
+	ap, err := netip.ParseAddrPort(v)
+	if err != nil || ap.Port() == 0 || ap.Addr().Zone() != "" {
+		return netip.AddrPort{}, errors.New("invalid address")
+	}
+	return ap, nil
+}
+
+// maxBypassApps ограничивает список приложений: каждое — лишний проход
+// по процессам системы.
+const maxBypassApps = 64
+
+// isValidAppPath допускает только абсолютные пути без «..», лишних
+// разделителей и управляющих символов.
+func isValidAppPath(v string) bool {
+	if !filepath.IsAbs(v) || filepath.Clean(v) != v || len(v) > 4096 {
+		return false
+	}
+	for _, c := range v {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func validateRule(r RoutingRule) error {
+	if !isValidRuleAction(r.Action) {
+		return errors.New("invalid action")
+	}
+	if r.Value == "" || strings.TrimSpace(r.Value) != r.Value {
+		return errors.New("empty or padded value")
+	}
+	switch r.Kind {
+	case RuleDomainSuffix:
+		if !isDomainLike(strings.TrimPrefix(r.Value, ".")) {
+			return errors.New("invalid domain suffix")
+		}
+	case RuleDomainKeyword:
+		if strings.ContainsAny(r.Value, " /:") {
+			return errors.New("invalid domain keyword")
+		}
+	case RuleDomainRegex:
+		if _, err := regexp.Compile(r.Value); err != nil {
+			return fmt.Errorf("invalid domain regex: %w", err)
+		}
+	case RuleCIDR:
+		if _, err := netip.ParsePrefix(r.Value); err != nil {
+			return fmt.Errorf("invalid cidr: %w", err)
+		}
+	case RuleGeoIP:
+		if r.Value != "private" && !isCountryCode(r.Value) {
+			return errors.New("invalid geoip code")
+		}
+	case RuleGeoSite:
+		if !isGeoSiteName(r.Value) {
+			return errors.New("invalid geosite name")
+		}
+	default:
+		return errors.New("invalid rule kind")
+	}
+	return nil
+}
+
+func isValidRuleAction(v RuleAction) bool {
+	switch v {
+	case RuleActionProxy, RuleActionDirect, RuleActionBlock:
+		return true
+	default:
+		return false
+	}
+}
+
+func isDomainLike(v string) bool {
+	if v == "" || len(v) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(v, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isCountryCode(v string) bool {
+	return len(v) == 2 && v[0] >= 'a' && v[0] <= 'z' && v[1] >= 'a' && v[1] <= 'z'
+}
+
+func isGeoSiteName(v string) bool {
+	for _, c := range v {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '!' || c == '@') {
+			return false
+		}
+	}
+	return v != ""
+}
+
+// isValidProfileID допускает пустой ID и шестнадцатеричные ID профилей.
+func isValidProfileID(v string) bool {
+	if len(v) > 32 {
+		return false
+	}
+	for _, c := range v {
+		if !(c >= 'a' && c <= 'f' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
 func isValidReconnectInterval(v int) bool {
 	switch v {
 	case 5, 10, 30:
@@ -195,9 +695,42 @@ func isValidReconnectInterval(v int) bool {
 	}
 }
 
+func isValidFingerprint(v TLSFingerprint) bool {
+	switch v {
+	case FingerprintChrome, FingerprintFirefox, FingerprintSafari, FingerprintRandomized:
+		return true
+	default:
+		return false
+	}
+}
+
+func isValidIPv6Policy(v IPv6Policy) bool {
+	switch v {
+	case IPv6Tunnel, IPv6Block, IPv6Allow:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateHealth(c ConnectionSettings) error {
+	switch c.HealthIntervalSecs {
+	case 10, 30, 60:
+	default:
+		return errors.New("invalid health check interval")
+	}
+	if c.HealthDegradedRTTMs < 100 || c.HealthDegradedRTTMs > 30000 {
+		return errors.New("invalid degraded RTT threshold")
+	}
+	if c.HealthStallFailures < 1 || c.HealthStallFailures > 10 {
+		return errors.New("invalid stall failure threshold")
+	}
+	return nil
+}
+
 func isValidConnectionMode(v ConnectionMode) bool {
 	switch v {
-	case ConnectionModeAuto, ConnectionModeVLESSRealityOnly:
+	case ConnectionModeAuto, ConnectionModeVLESSRealityOnly, ConnectionModeProxyOnly:
 		return true
 	default:
 		return false
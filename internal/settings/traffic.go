@@ -0,0 +1,65 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// trafficFileName — файл общего объёма трафика рядом с settings.json.
+const trafficFileName = "traffic.json"
+
+// TrafficTotals — объём трафика через туннель за всё время, в байтах.
+type TrafficTotals struct {
+	Up   uint64 `json:"up"`
+	Down uint64 `json:"down"`
+}
+
+// TrafficFile хранит TrafficTotals в каталоге настроек. Объём меняется
+// постоянно, поэтому лежит отдельно от настроек и не трогает их файл.
+type TrafficFile struct{}
+
+// Load читает объём; отсутствующий файл — нулевой объём.
+func (TrafficFile) Load() (TrafficTotals, error) {
+	path, err := trafficFilePath()
+	if err != nil {
+		return TrafficTotals{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return TrafficTotals{}, nil
+	}
+	if err != nil {
+		return TrafficTotals{}, err
+	}
+	var t TrafficTotals
+	if err := json.Unmarshal(data, &t); err != nil {
+		return TrafficTotals{}, err
+	}
+	return t, nil
+}
+
+// Save записывает объём, создавая каталог при необходимости.
+func (TrafficFile) Save(t TrafficTotals) error {
+	path, err := trafficFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func trafficFilePath() (string, error) {
+	path, err := ConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), trafficFileName), nil
+}
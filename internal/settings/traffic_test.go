@@ -0,0 +1,39 @@
+package settings
+
+import (
+	"os"
+	"testing"
+)
+
+// useTempConfigDir направляет os.UserConfigDir во временный каталог.
+func useTempConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+}
+
+func TestTrafficFile_SaveLoadClear(t *testing.T) {
+	useTempConfigDir(t)
+	var file TrafficFile
+
+	if got, err := file.Load(); err != nil || got != (TrafficTotals{}) {
+		t.Fatalf("Load without file = %+v, %v", got, err)
+	}
+	want := TrafficTotals{Up: 1 << 40, Down: 42}
+	if err := file.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, err := file.Load(); err != nil || got != want {
+		t.Fatalf("Load = %+v, %v; want %+v", got, err, want)
+	}
+
+	if _, err := Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	path, _ := trafficFilePath()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("traffic file survived Clear: %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+package tun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// Приложения мимо туннеля. Процессы приложений из TUNConfig.BypassApps
+// переносятся в отдельную cgroup v2, их потомки рождаются в ней же.
+// Цепочка маршрутизации nftables помечает пакеты сокетов этой cgroup, и
+// правило rulePriorityApps отправляет помеченные пакеты в основную
+// таблицу. Адрес источника такие пакеты получили ещё до метки — адрес
+// TUN, — поэтому на выходе он заменяется адресом интерфейса (masquerade).
+//
+// Cgroup сокета запоминается при его создании: сокеты, открытые
+// приложением до переноса, остаются в туннеле.
+const (
+	appsTable  = "voltavpn_apps"
+	appsCgroup = "voltavpn-bypass"
+	// appsRescan — как часто искать новые процессы приложений.
+	appsRescan = 2 * time.Second
+)
+
+var errNoCgroup2 = errors.New("cgroup v2 is not mounted")
+
+// appSplit держит cgroup приложений и правила nftables для неё.
+type appSplit struct {
+	apps []string
+	mark uint32
+	nft  *nftables.Conn
+
+	// mountpoint и root — точка монтирования cgroup2 и путь её корня в
+	// иерархии; cgroup — путь cgroup приложений в иерархии.
+	mountpoint string
+	root       string
+	cgroup     string
+
+	mu sync.Mutex
+	// origin — исходная cgroup перенесённых процессов: при закрытии они
+	// возвращаются туда.
+	origin map[int]string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newAppSplit создаёт cgroup и правила в сетевом пространстве имён
+// текущего потока, переносит уже запущенные процессы приложений и
+// продолжает искать новые до close.
+func newAppSplit(apps []string, mark uint32) (*appSplit, error) {
+	mountpoint, root, err := cgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	a := &appSplit{
+		apps:       apps,
+		mark:       mark,
+		mountpoint: mountpoint,
+		root:       root,
+		cgroup:     path.Join(root, appsCgroup),
+		origin:     make(map[int]string),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	dir := a.dir(a.cgroup)
+	if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("create cgroup: %w", err)
+	}
+	// Процессы, оставшиеся после аварийного завершения, могут быть уже не
+	// в списке приложений; нужные place вернёт обратно.
+	if err := a.release(); err != nil {
+		return nil, err
+	}
+	// Идентификатор cgroup для nftables — номер inode её каталога.
+	var st unix.Stat_t
+	if err := unix.Stat(dir, &st); err != nil {
+		return nil, err
+	}
+
+	a.nft, err = nftables.New(nftables.AsLasting())
+	if err != nil {
+		_ = os.Remove(dir)
+		return nil, err
+	}
+	if err := a.installRules(st.Ino); err != nil {
+		_ = a.nft.CloseLasting()
+		_ = os.Remove(dir)
+		return nil, fmt.Errorf("install %s: %w", appsTable, err)
+	}
+	a.place()
+
+	go a.run()
+	return a, nil
+}
+
+// installRules ставит таблицу appsTable одним пакетом, как kill switch.
+// Уровень cgroup для socket cgroupv2 считается от корня иерархии.
+func (a *appSplit) installRules(id uint64) error {
+	table := &nftables.Table{Name: appsTable, Family: nftables.TableFamilyINet}
+	a.nft.AddTable(table)
+	a.nft.DelTable(table)
+	a.nft.AddTable(table)
+
+	// Цепочка типа route: после смены метки ядро заново выбирает маршрут.
+	output := a.nft.AddChain(&nftables.Chain{
+		Name:     "output",
+		Table:    table,
+		Type:     nftables.ChainTypeRoute,
+		Hooknum:  nftables.ChainHookOutput,
+		Priority: nftables.ChainPriorityMangle,
+	})
+	postrouting := a.nft.AddChain(&nftables.Chain{
+		Name:     "postrouting",
+		Table:    table,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookPostrouting,
+		Priority: nftables.ChainPriorityNATSource,
+	})
+
+	mark := binary.NativeEndian.AppendUint32(nil, a.mark)
+	a.nft.AddRule(&nftables.Rule{Table: table, Chain: output, Exprs: []expr.Any{
+		&expr.Socket{Key: expr.SocketKeyCgroupv2, Level: uint32(strings.Count(a.cgroup, "/")), Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binary.NativeEndian.AppendUint64(nil, id)},
+		&expr.Immediate{Register: 1, Data: mark},
+		&expr.Meta{Key: expr.MetaKeyMARK, SourceRegister: true, Register: 1},
+	}})
+	a.nft.AddRule(&nftables.Rule{Table: table, Chain: postrouting, Exprs: []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyMARK, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: mark},
+		&expr.Masq{},
+	}})
+	return a.nft.Flush()
+}
+
+func (a *appSplit) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(appsRescan)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.place()
+		}
+	}
+}
+
+// place переносит в cgroup запущенные процессы приложений. Процессы,
+// которые завершились или недоступны, пропускаются.
+func (a *appSplit) place() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid <= 1 {
+			continue
+		}
+		exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+		if err != nil {
+			continue
+		}
+		// После обновления пакета работает старый, уже удалённый файл.
+		if !slices.Contains(a.apps, strings.TrimSuffix(exe, " (deleted)")) {
+			continue
+		}
+		current, err := processCgroup(pid)
+		if err != nil || current == a.cgroup {
+			continue
+		}
+		if writePid(a.dir(a.cgroup), pid) == nil {
+			a.origin[pid] = current
+		}
+	}
+}
+
+// release возвращает процессы из cgroup приложений в исходные cgroup.
+// Потомок перенесённого процесса идёт туда же, куда предок; процесс без
+// известного предка — в корень иерархии.
+func (a *appSplit) release() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(a.dir(a.cgroup), "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		err = writePid(a.dir(a.originOf(pid)), pid)
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("release pid %d: %w", pid, err))
+		}
+	}
+	clear(a.origin)
+	return errors.Join(errs...)
+}
+
+func (a *appSplit) originOf(pid int) string {
+	// Глубина ограничена на случай цикла из‑за повторного использования PID.
+	for range 64 {
+		if origin, ok := a.origin[pid]; ok && strings.HasPrefix(origin, a.root) {
+			return origin
+		}
+		parent, err := parentPid(pid)
+		if err != nil || parent <= 1 {
+			break
+		}
+		pid = parent
+	}
+	return a.root
+}
+
+// dir — каталог cgroup с путём p в иерархии.
+func (a *appSplit) dir(p string) string {
+	return filepath.Join(a.mountpoint, strings.TrimPrefix(p, a.root))
+}
+
+// close останавливает поиск процессов, снимает правила, возвращает
+// процессы и удаляет cgroup.
+func (a *appSplit) close() error {
+	close(a.stop)
+	<-a.done
+
+	table := &nftables.Table{Name: appsTable, Family: nftables.TableFamilyINet}
+	a.nft.DelTable(table)
+	err := a.nft.Flush()
+	err = errors.Join(err, a.nft.CloseLasting())
+	if releaseErr := a.release(); releaseErr != nil {
+		return errors.Join(err, releaseErr)
+	}
+	return errors.Join(err, os.Remove(a.dir(a.cgroup)))
+}
+
+// removeAppsTable удаляет таблицу, оставшуюся после аварийного
+// завершения. Без nftables в ядре удалять нечего.
+func removeAppsTable() error {
+	c, err := nftables.New()
+	if err != nil {
+		return nil
+	}
+	tables, err := c.ListTablesOfFamily(nftables.TableFamilyINet)
+	if err != nil {
+		return nil
+	}
+	for _, t := range tables {
+		if t.Name == appsTable {
+			c.DelTable(t)
+			return c.Flush()
+		}
+	}
+	return nil
+}
+
+// cgroup2Mount находит в /proc/self/mountinfo точку монтирования cgroup2
+// и путь её корня в иерархии.
+func cgroup2Mount() (mountpoint, root string, err error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 36 35 0:30 / /sys/fs/cgroup rw,nosuid - cgroup2 cgroup2 rw
+		before, after, ok := strings.Cut(s.Text(), " - ")
+		fields := strings.Fields(before)
+		if !ok || len(fields) < 5 || !strings.HasPrefix(after, "cgroup2 ") {
+			continue
+		}
+		return fields[4], fields[3], nil
+	}
+	if err := s.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", errNoCgroup2
+}
+
+// processCgroup — путь cgroup v2 процесса в иерархии.
+func processCgroup(pid int) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return p, nil
+		}
+	}
+	return "", errNoCgroup2
+}
+
+// parentPid читает PPID процесса из /proc/<pid>/stat.
+func parentPid(pid int) (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	ppid, err := statParentPid(data)
+	if err != nil {
+		return 0, fmt.Errorf("pid %d: %w", pid, err)
+	}
+	return ppid, nil
+}
+
+// statParentPid достаёт PPID из строки /proc/<pid>/stat. Имя процесса в
+// скобках может содержать пробелы и «)», поэтому поля считаются от
+// последней закрывающей скобки.
+func statParentPid(data []byte) (int, error) {
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, errors.New("malformed stat")
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 2 {
+		return 0, errors.New("malformed stat")
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil || ppid < 0 {
+		return 0, errors.New("malformed stat")
+	}
+	return ppid, nil
+}
+
+func writePid(dir string, pid int) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644)
+}
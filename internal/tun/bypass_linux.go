@@ -0,0 +1,73 @@
+package tun
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var errNoDefaultRoute = errors.New("no default route in the main table")
+
+// BypassDialer возвращает Dialer, соединения которого идут мимо туннеля:
+// сокет привязывается (SO_BINDTODEVICE) к интерфейсу маршрута по умолчанию
+// основной таблицы. Правила клиента такой сокет пропускают — в таблице
+// туннеля нет маршрута через этот интерфейс, и поиск доходит до main.
+// Интерфейс выбирается в момент вызова; после смены сети Dialer нужно
+// получить заново.
+func BypassDialer() (*net.Dialer, error) {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	name, err := defaultInterface(h)
+	if err != nil {
+		return nil, err
+	}
+	return &net.Dialer{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, name)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}, nil
+}
+
+// defaultInterface — имя интерфейса IPv4‑маршрута по умолчанию основной
+// таблицы с наименьшей метрикой. Туннель заворачивает только IPv4, поэтому
+// этого интерфейса достаточно и для IPv6.
+func defaultInterface(h *netlink.Handle) (string, error) {
+	routes, err := h.RouteListFiltered(netlink.FAMILY_V4,
+		&netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return "", err
+	}
+	var best *netlink.Route
+	for i, r := range routes {
+		if r.Dst != nil {
+			if ones, _ := r.Dst.Mask.Size(); ones != 0 {
+				continue
+			}
+		}
+		if best == nil || r.Priority < best.Priority {
+			best = &routes[i]
+		}
+	}
+	if best == nil {
+		return "", errNoDefaultRoute
+	}
+	link, err := h.LinkByIndex(best.LinkIndex)
+	if err != nil {
+		return "", err
+	}
+	return link.Attrs().Name, nil
+}
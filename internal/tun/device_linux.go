@@ -0,0 +1,156 @@
+package tun
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+// Device — поднятый TUN‑интерфейс со стеком и маршрутами.
+type Device struct {
+	handle *netlink.Handle
+	file   *os.File
+	stack  *netStack
+	apps   *appSplit
+	// resolved — DNS интерфейса в systemd-resolved; nil, если заглушка не
+	// задана или resolved недоступен.
+	resolved *resolvedLink
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Open реализует core.TUNOpener: потоки передаются SOCKS5‑входу cfg.SOCKS.
+func Open(cfg core.TUNConfig) (core.TUNDevice, error) {
+	return OpenWithHandler(cfg, &SOCKSHandler{Address: cfg.SOCKS, Auth: cfg.Auth})
+}
+
+// OpenWithHandler поднимает интерфейс в сетевом пространстве имён
+// текущего потока и передаёт принятые потоки handler.
+func OpenWithHandler(cfg core.TUNConfig, handler Handler) (*Device, error) {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return nil, err
+	}
+	// Остатки от аварийно завершённого запуска мешали бы новым правилам.
+	if err := cleanup(h, cfg.Name); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	tuntap := &netlink.Tuntap{
+		LinkAttrs:  netlink.LinkAttrs{Name: cfg.Name, MTU: cfg.MTU},
+		Mode:       netlink.TUNTAP_MODE_TUN,
+		Flags:      netlink.TUNTAP_NO_PI,
+		Queues:     1,
+		NonPersist: true,
+	}
+	if err := h.LinkAdd(tuntap); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("create %s: %w", cfg.Name, err)
+	}
+	d := &Device{handle: h, file: tuntap.Fds[0]}
+
+	if err := d.configure(cfg, withDNS(handler, cfg.DNS)); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Device) configure(cfg core.TUNConfig, handler Handler) error {
+	link, err := d.handle.LinkByName(cfg.Name)
+	if err != nil {
+		return err
+	}
+	addr := &netlink.Addr{IPNet: prefixIPNet(interfacePrefix)}
+	if err := d.handle.AddrAdd(link, addr); err != nil {
+		return err
+	}
+
+	d.stack, err = newNetStack(d.file, uint32(cfg.MTU), handler)
+	if err != nil {
+		return err
+	}
+
+	if err := d.handle.LinkSetUp(link); err != nil {
+		return err
+	}
+	if err := installRoutes(d.handle, link, cfg.Exclude, cfg.IPv6, cfg.BypassMark); err != nil {
+		return err
+	}
+	if len(cfg.BypassApps) > 0 {
+		if d.apps, err = newAppSplit(cfg.BypassApps, cfg.BypassMark); err != nil {
+			return err
+		}
+	}
+	if cfg.DNS.IsValid() {
+		// Без systemd-resolved туннель всё равно поднимается: заглушка
+		// остаётся доступной приложениям, настроенным на неё явно.
+		d.resolved, _ = configureResolved(link.Attrs().Index)
+	}
+	return nil
+}
+
+// Close возвращает маршруты, останавливает стек и удаляет интерфейс.
+func (d *Device) Close() error {
+	d.closeOnce.Do(func() {
+		// Сначала DNS и правила: пока стек останавливается, запросы и
+		// трафик уже идут по обычным маршрутам.
+		var err error
+		if d.resolved != nil {
+			err = d.resolved.revert()
+		}
+		err = errors.Join(err, removeRoutes(d.handle))
+		if d.apps != nil {
+			err = errors.Join(err, d.apps.close())
+		}
+		// Интерфейс не постоянный: ядро удалит его вместе с дескриптором,
+		// который стек закрывает при остановке.
+		if d.stack != nil {
+			err = errors.Join(err, d.stack.close())
+		} else {
+			err = errors.Join(err, d.file.Close())
+		}
+		d.closeErr = err
+		d.handle.Close()
+	})
+	return d.closeErr
+}
+
+// Recover удаляет правила и маршруты, оставшиеся после аварийного
+// завершения. Вызывать при запуске приложения.
+func Recover() error {
+	h, err := netlink.NewHandle()
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	return cleanup(h, "")
+}
+
+func cleanup(h *netlink.Handle, name string) error {
+	err := errors.Join(removeRoutes(h), removeAppsTable())
+	if name == "" {
+		return err
+	}
+	// Постоянный интерфейс с тем же именем (например, созданный вручную)
+	// не даст создать свой.
+	if link, linkErr := h.LinkByName(name); linkErr == nil {
+		err = errors.Join(err, h.LinkDel(link))
+	}
+	return err
+}
+
+func prefixIPNet(p netip.Prefix) *net.IPNet {
+	return &net.IPNet{IP: p.Addr().AsSlice(), Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen())}
+}
+
+var _ core.TUNOpener = Open
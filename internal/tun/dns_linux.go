@@ -0,0 +1,173 @@
+package tun
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	resolvedName        = "org.freedesktop.resolve1"
+	resolvedPath        = dbus.ObjectPath("/org/freedesktop/resolve1")
+	resolvedManager     = "org.freedesktop.resolve1.Manager"
+	resolvedCallTimeout = 5 * time.Second
+)
+
+// resolverAddr — адрес резолвера на интерфейсе, соседний с адресом
+// интерфейса: systemd-resolved шлёт запросы сюда, а стек передаёт их
+// DNS‑заглушке.
+var resolverAddr = netip.AddrPortFrom(interfacePrefix.Addr().Next(), 53)
+
+// dnsHandler передаёт потоки к resolverAddr заглушке stub, остальные —
+// next.
+type dnsHandler struct {
+	next Handler
+	stub netip.AddrPort
+	dial DialFunc
+}
+
+// withDNS оборачивает handler, если задана заглушка. Заглушка слушает
+// там же, где вход ядра, поэтому соединения к ней открываются тем же
+// способом, что и у SOCKSHandler.
+func withDNS(handler Handler, stub netip.AddrPort) Handler {
+	if !stub.IsValid() {
+		return handler
+	}
+	h := &dnsHandler{next: handler, stub: stub}
+	if socks, ok := handler.(*SOCKSHandler); ok {
+		h.dial = socks.dial
+	} else {
+		var d net.Dialer
+		h.dial = d.DialContext
+	}
+	return h
+}
+
+func (h *dnsHandler) HandleTCP(conn net.Conn, dst netip.AddrPort) {
+	if dst != resolverAddr {
+		h.next.HandleTCP(conn, dst)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	stub, err := h.dial(ctx, "tcp", h.stub.String())
+	cancel()
+	if err != nil {
+		return
+	}
+	defer stub.Close()
+	relay(conn, stub)
+}
+
+func (h *dnsHandler) HandleUDP(conn net.Conn, dst netip.AddrPort) {
+	if dst != resolverAddr {
+		h.next.HandleUDP(conn, dst)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	stub, err := h.dial(ctx, "udp", h.stub.String())
+	cancel()
+	if err != nil {
+		return
+	}
+	defer stub.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer conn.Close()
+		copyDatagrams(conn, stub)
+	}()
+	copyDatagrams(stub, conn)
+	stub.Close()
+	wg.Wait()
+}
+
+// copyDatagrams пересылает датаграммы из src в dst, пока поток не
+// простаивает дольше udpIdleTimeout.
+func copyDatagrams(dst, src net.Conn) {
+	buf := make([]byte, maxDatagram)
+	for {
+		_ = src.SetReadDeadline(time.Now().Add(udpIdleTimeout))
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+// resolvedAddress и resolvedDomain — структуры (iay) и (sb) из API
+// systemd-resolved.
+type resolvedAddress struct {
+	Family  int32
+	Address []byte
+}
+
+type resolvedDomain struct {
+	Domain      string
+	RoutingOnly bool
+}
+
+// resolvedLink — настройки DNS интерфейса в systemd-resolved.
+type resolvedLink struct {
+	conn   *dbus.Conn
+	object dbus.BusObject
+	index  int32
+}
+
+// configureResolved направляет системный резолвер на resolverAddr через
+// интерфейс index: домен "~." забирает у остальных интерфейсов все имена,
+// для которых нет более точного домена.
+func configureResolved(index int) (*resolvedLink, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	l := &resolvedLink{conn: conn, object: conn.Object(resolvedName, resolvedPath), index: int32(index)}
+	if err := l.apply(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *resolvedLink) apply() error {
+	server := resolvedAddress{Family: unix.AF_INET, Address: resolverAddr.Addr().AsSlice()}
+	if err := l.call("SetLinkDNS", l.index, []resolvedAddress{server}); err != nil {
+		return err
+	}
+	if err := l.call("SetLinkDomains", l.index, []resolvedDomain{{Domain: ".", RoutingOnly: true}}); err != nil {
+		_ = l.call("RevertLink", l.index)
+		return err
+	}
+	// SetLinkDefaultRoute появился в systemd 240; без него хватает "~.".
+	_ = l.call("SetLinkDefaultRoute", l.index, true)
+	return nil
+}
+
+// revert возвращает интерфейсу настройки по умолчанию. Интерфейс и так
+// удаляется при закрытии, но так resolved перестаёт слать на него запросы
+// сразу, а не когда заметит удаление.
+func (l *resolvedLink) revert() error {
+	err := l.call("RevertLink", l.index)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	return err
+}
+
+func (l *resolvedLink) call(method string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), resolvedCallTimeout)
+	defer cancel()
+	return l.object.CallWithContext(ctx, resolvedManager+"."+method, 0, args...).Err
+}
@@ -0,0 +1,27 @@
+// Package tun implements core.TUNOpener. On Linux it creates a TUN
+// interface over netlink, routes the device's IPv4 traffic into it with
+// policy rules, and terminates the packets in a userspace TCP/IP stack
+// (gVisor netstack). IPv6 follows the IPv6 policy: the same rules send it
+// into the interface, an unreachable route blocks it, or it is left to the
+// system routes. Every TCP connection and UDP flow from the stack is
+// handed to the tunnel engine through its loopback SOCKS5 inbound.
+//
+// Applications listed in the settings bypass the tunnel: their processes
+// are moved into a dedicated cgroup v2, an nftables socket cgroupv2 match
+// marks their packets, and a fwmark policy rule sends marked packets to
+// the main table. Processes are found through /proc; nothing is executed.
+//
+// Routes and rules are removed on Close. A crashed process leaves only the
+// policy rules behind (the interface is not persistent and disappears with
+// its file descriptor); Recover removes them and runs before every Open.
+//
+// When the configuration names a DNS stub, the interface is registered
+// with systemd-resolved over D-Bus as the DNS server for all domains
+// ("~."), and queries to the interface's resolver address are relayed to
+// the stub. Close reverts the link's DNS settings; without systemd-resolved
+// the system resolver is left unchanged.
+//
+// BypassDialer opens sockets bound to the uplink interface, which the policy
+// rules let past the tunnel; diagnostics use it to see the network as it is
+// without the VPN.
+package tun
@@ -0,0 +1,152 @@
+package tun
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+const (
+	// udpIdleTimeout — UDP‑поток без трафика в обе стороны закрывается.
+	udpIdleTimeout = time.Minute
+	dialTimeout    = 10 * time.Second
+	maxDatagram    = 65535
+)
+
+// Handler получает потоки, принятые сетевым стеком. dst — адрес, к
+// которому обращалось приложение. Handler владеет conn и закрывает его.
+type Handler interface {
+	HandleTCP(conn net.Conn, dst netip.AddrPort)
+	// HandleUDP получает поток датаграмм между одним источником и dst:
+	// Read возвращает датаграммы приложения, Write отправляет ответы.
+	HandleUDP(conn net.Conn, dst netip.AddrPort)
+}
+
+// DialFunc открывает соединение; в тестах — внутри другого сетевого
+// пространства имён.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// SOCKSHandler передаёт потоки SOCKS5‑входу ядра: TCP — командой CONNECT,
+// UDP — через UDP ASSOCIATE.
+type SOCKSHandler struct {
+	Address string
+	Auth    *core.ProxyCredentials
+	// Dial — чем открывать соединения к Address; nil — net.Dialer.
+	Dial DialFunc
+}
+
+func (h *SOCKSHandler) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if h.Dial != nil {
+		return h.Dial(ctx, network, address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+func (h *SOCKSHandler) auth() *proxy.Auth {
+	if h.Auth == nil {
+		return nil
+	}
+	return &proxy.Auth{User: h.Auth.Username, Password: h.Auth.Password}
+}
+
+// contextDialer приспосабливает DialFunc к x/net/proxy.
+type contextDialer DialFunc
+
+func (d contextDialer) Dial(network, address string) (net.Conn, error) {
+	return d(context.Background(), network, address)
+}
+
+func (d contextDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d(ctx, network, address)
+}
+
+func (h *SOCKSHandler) HandleTCP(conn net.Conn, dst netip.AddrPort) {
+	defer conn.Close()
+
+	d, err := proxy.SOCKS5("tcp", h.Address, h.auth(), contextDialer(h.dial))
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	upstream, err := d.(proxy.ContextDialer).DialContext(ctx, "tcp", dst.String())
+	cancel()
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	relay(conn, upstream)
+}
+
+func (h *SOCKSHandler) HandleUDP(conn net.Conn, dst netip.AddrPort) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	assoc, err := associate(ctx, h.dial, h.Address, h.auth())
+	cancel()
+	if err != nil {
+		return
+	}
+	defer assoc.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer conn.Close()
+		buf := make([]byte, maxDatagram)
+		for {
+			_ = assoc.SetReadDeadline(time.Now().Add(udpIdleTimeout))
+			n, _, err := assoc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(udpIdleTimeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		if _, err := assoc.WriteTo(buf[:n], dst); err != nil {
+			break
+		}
+	}
+	assoc.Close()
+	wg.Wait()
+}
+
+// relay копирует данные в обе стороны; полузакрытие передаётся дальше,
+// чтобы протоколы с EOF в одну сторону работали.
+func relay(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+		done <- struct{}{}
+	}
+	go pipe(a, b)
+	go pipe(b, a)
+	<-done
+	<-done
+}
+
+var errSOCKSReply = errors.New("socks5: unexpected reply")
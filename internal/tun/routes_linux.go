@@ -0,0 +1,179 @@
+package tun
+
+import (
+	"errors"
+	"net/netip"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// Маршрутизация по политикам, как у wg-quick: маршрут по умолчанию лежит в
+// отдельной таблице, а правила решают, когда в неё смотреть.
+//
+//	rulePriorityApps:    fwmark <метка> lookup main          — приложения мимо туннеля
+//	rulePriorityExclude: to <сервер> lookup main            — туннель не заворачивает сам себя
+//	rulePriorityMain:    lookup main suppress_prefixlength 0 — локальные сети как раньше
+//	rulePriorityTunnel:  lookup routeTable                   — остальное в TUN
+//
+// Для IPv6 те же правила ставятся, только если политика IPv6 — туннель
+// или блокировка; при блокировке маршрут по умолчанию в таблице —
+// unreachable.
+//
+// Диапазон приоритетов и номер таблицы принадлежат клиенту: Recover
+// удаляет всё, что в них осталось.
+const (
+	routeTable          = 7575
+	rulePriorityApps    = 7569
+	rulePriorityExclude = 7570
+	rulePriorityMain    = 7571
+	rulePriorityTunnel  = 7572
+)
+
+var (
+	// interfacePrefix — адрес интерфейса; пакеты приложений уходят с него.
+	interfacePrefix = netip.MustParsePrefix("172.19.0.1/30")
+	// interfacePrefix6 — адрес интерфейса для IPv6 в туннеле (RFC 4193).
+	interfacePrefix6 = netip.MustParsePrefix("fd75:7575::1/126")
+)
+
+// installRoutes ставит маршруты и правила; mark — метка пакетов
+// приложений мимо туннеля, 0 — правила для неё не нужно.
+func installRoutes(h *netlink.Handle, link netlink.Link, exclude []netip.Addr, ipv6 settings.IPv6Policy, mark uint32) error {
+	route := &netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       prefixIPNet(netip.PrefixFrom(netip.IPv4Unspecified(), 0)),
+		Src:       interfacePrefix.Addr().AsSlice(),
+		Table:     routeTable,
+		Scope:     netlink.SCOPE_LINK,
+	}
+	if err := installFamily(h, netlink.FAMILY_V4, route, exclude, mark); err != nil {
+		return err
+	}
+
+	route6 := &netlink.Route{
+		Dst:   prefixIPNet(netip.PrefixFrom(netip.IPv6Unspecified(), 0)),
+		Table: routeTable,
+	}
+	switch ipv6 {
+	case settings.IPv6Tunnel:
+		addr := &netlink.Addr{IPNet: prefixIPNet(interfacePrefix6), Flags: unix.IFA_F_NODAD}
+		if err := h.AddrAdd(link, addr); err != nil {
+			// IPv6 выключен в системе: направлять в туннель нечего.
+			if ipv6Unavailable(err) {
+				return nil
+			}
+			return err
+		}
+		route6.LinkIndex = link.Attrs().Index
+		route6.Src = interfacePrefix6.Addr().AsSlice()
+	case settings.IPv6Block:
+		// Приложение сразу получает ошибку и переходит на IPv4, не
+		// дожидаясь таймаута.
+		route6.Type = unix.RTN_UNREACHABLE
+	default:
+		return nil
+	}
+	err := installFamily(h, netlink.FAMILY_V6, route6, exclude, mark)
+	if ipv6Unavailable(err) {
+		return nil
+	}
+	return err
+}
+
+// installFamily ставит маршрут по умолчанию таблицы клиента и правила
+// для адресов одного семейства.
+func installFamily(h *netlink.Handle, family int, route *netlink.Route, exclude []netip.Addr, mark uint32) error {
+	if err := h.RouteReplace(route); err != nil {
+		return err
+	}
+
+	if mark != 0 {
+		apps := netlink.NewRule()
+		apps.Family = family
+		apps.Priority = rulePriorityApps
+		apps.Mark = mark
+		apps.Table = unix.RT_TABLE_MAIN
+		if err := h.RuleAdd(apps); err != nil {
+			return err
+		}
+	}
+
+	for _, addr := range exclude {
+		if addr.Is4() != (family == netlink.FAMILY_V4) {
+			continue
+		}
+		rule := netlink.NewRule()
+		rule.Family = family
+		rule.Priority = rulePriorityExclude
+		rule.Dst = prefixIPNet(netip.PrefixFrom(addr, addr.BitLen()))
+		rule.Table = unix.RT_TABLE_MAIN
+		if err := h.RuleAdd(rule); err != nil {
+			return err
+		}
+	}
+
+	main := netlink.NewRule()
+	main.Family = family
+	main.Priority = rulePriorityMain
+	main.Table = unix.RT_TABLE_MAIN
+	main.SuppressPrefixlen = 0
+	if err := h.RuleAdd(main); err != nil {
+		return err
+	}
+
+	tunnel := netlink.NewRule()
+	tunnel.Family = family
+	tunnel.Priority = rulePriorityTunnel
+	tunnel.Table = routeTable
+	return h.RuleAdd(tunnel)
+}
+
+// removeRoutes удаляет правила клиента и маршруты его таблицы в обоих
+// семействах. Отсутствие того, что удаляется, ошибкой не считается.
+func removeRoutes(h *netlink.Handle) error {
+	var errs []error
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		err := removeFamily(h, family)
+		if err != nil && !(family == netlink.FAMILY_V6 && ipv6Unavailable(err)) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func removeFamily(h *netlink.Handle, family int) error {
+	var errs []error
+	rules, err := h.RuleList(family)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if rule.Priority < rulePriorityApps || rule.Priority > rulePriorityTunnel {
+			continue
+		}
+		rule := rule
+		if err := h.RuleDel(&rule); err != nil && !errors.Is(err, unix.ENOENT) {
+			errs = append(errs, err)
+		}
+	}
+
+	routes, err := h.RouteListFiltered(family, &netlink.Route{Table: routeTable}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, route := range routes {
+		route := route
+		if err := h.RouteDel(&route); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ipv6Unavailable сообщает, что IPv6 выключен в ядре или на интерфейсах.
+func ipv6Unavailable(err error) bool {
+	return errors.Is(err, unix.EAFNOSUPPORT) || errors.Is(err, unix.EACCES)
+}
@@ -0,0 +1,208 @@
+package tun
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Константы SOCKS5 (RFC 1928, RFC 1929).
+const (
+	socksVersion       = 5
+	socksAuthNone      = 0
+	socksAuthPassword  = 2
+	socksNoAcceptable  = 0xff
+	socksCmdAssociate  = 3
+	socksAtypIPv4      = 1
+	socksAtypIPv6      = 4
+	socksPasswordVer   = 1
+	socksReplySuccess  = 0
+	socksUDPHeaderSize = 3
+)
+
+// udpAssociation — UDP ASSOCIATE (RFC 1928, §7): ассоциация живёт, пока
+// открыто управляющее TCP‑соединение; датаграммы идут через relay с
+// SOCKS‑заголовком, в котором указан адрес назначения.
+type udpAssociation struct {
+	control net.Conn
+	relay   net.Conn
+}
+
+func associate(ctx context.Context, dial DialFunc, server string, auth *proxy.Auth) (*udpAssociation, error) {
+	control, err := dial(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = control.SetDeadline(deadline)
+	}
+	relayAddr, err := socksAssociate(control, auth)
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+	_ = control.SetDeadline(time.Time{})
+
+	// Сервер может ответить 0.0.0.0 — тогда relay на том же хосте.
+	if relayAddr.Addr().IsUnspecified() {
+		host, _, _ := net.SplitHostPort(server)
+		if addr, err := netip.ParseAddr(host); err == nil {
+			relayAddr = netip.AddrPortFrom(addr, relayAddr.Port())
+		}
+	}
+	relay, err := dial(ctx, "udp", relayAddr.String())
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+
+	a := &udpAssociation{control: control, relay: relay}
+	go func() {
+		// Закрытие управляющего соединения сервером завершает ассоциацию.
+		_, _ = io.Copy(io.Discard, control)
+		relay.Close()
+	}()
+	return a, nil
+}
+
+func socksAssociate(conn net.Conn, auth *proxy.Auth) (netip.AddrPort, error) {
+	methods := []byte{socksVersion, 1, socksAuthNone}
+	if auth != nil {
+		methods = []byte{socksVersion, 2, socksAuthNone, socksAuthPassword}
+	}
+	if _, err := conn.Write(methods); err != nil {
+		return netip.AddrPort{}, err
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return netip.AddrPort{}, err
+	}
+	switch {
+	case choice[0] != socksVersion || choice[1] == socksNoAcceptable:
+		return netip.AddrPort{}, errors.New("socks5: no acceptable authentication method")
+	case choice[1] == socksAuthPassword:
+		if auth == nil {
+			return netip.AddrPort{}, errors.New("socks5: server requires a password")
+		}
+		req := []byte{socksPasswordVer, byte(len(auth.User))}
+		req = append(req, auth.User...)
+		req = append(req, byte(len(auth.Password)))
+		req = append(req, auth.Password...)
+		if _, err := conn.Write(req); err != nil {
+			return netip.AddrPort{}, err
+		}
+		var status [2]byte
+		if _, err := io.ReadFull(conn, status[:]); err != nil {
+			return netip.AddrPort{}, err
+		}
+		if status[1] != 0 {
+			return netip.AddrPort{}, errors.New("socks5: authentication failed")
+		}
+	case choice[1] != socksAuthNone:
+		return netip.AddrPort{}, errSOCKSReply
+	}
+
+	// Адрес клиента заранее неизвестен: 0.0.0.0:0.
+	if _, err := conn.Write([]byte{socksVersion, socksCmdAssociate, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0}); err != nil {
+		return netip.AddrPort{}, err
+	}
+	var head [3]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return netip.AddrPort{}, err
+	}
+	if head[0] != socksVersion || head[1] != socksReplySuccess {
+		return netip.AddrPort{}, errSOCKSReply
+	}
+	return readSOCKSAddr(conn)
+}
+
+// readSOCKSAddr читает ATYP, адрес и порт. Доменные имена в ответах
+// не поддерживаются: ядро всегда отвечает IP.
+func readSOCKSAddr(r io.Reader) (netip.AddrPort, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return netip.AddrPort{}, err
+	}
+	var size int
+	switch atyp[0] {
+	case socksAtypIPv4:
+		size = 4
+	case socksAtypIPv6:
+		size = 16
+	default:
+		return netip.AddrPort{}, errSOCKSReply
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return netip.AddrPort{}, err
+	}
+	addr, _ := netip.AddrFromSlice(buf[:size])
+	return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(buf[size:])), nil
+}
+
+func appendSOCKSAddr(b []byte, addr netip.AddrPort) []byte {
+	ip := addr.Addr().Unmap()
+	if ip.Is4() {
+		b = append(b, socksAtypIPv4)
+	} else {
+		b = append(b, socksAtypIPv6)
+	}
+	b = append(b, ip.AsSlice()...)
+	return binary.BigEndian.AppendUint16(b, addr.Port())
+}
+
+// WriteTo отправляет датаграмму для dst через relay.
+func (a *udpAssociation) WriteTo(p []byte, dst netip.AddrPort) (int, error) {
+	packet := appendSOCKSAddr(make([]byte, socksUDPHeaderSize, socksUDPHeaderSize+19+len(p)), dst)
+	packet = append(packet, p...)
+	if _, err := a.relay.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrom возвращает полезную нагрузку датаграммы от relay и её источник.
+// Фрагментированные датаграммы (FRAG != 0) отбрасываются, как разрешает RFC.
+func (a *udpAssociation) ReadFrom(p []byte) (int, netip.AddrPort, error) {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := a.relay.Read(buf)
+		if err != nil {
+			return 0, netip.AddrPort{}, err
+		}
+		if n < socksUDPHeaderSize+1 || buf[2] != 0 {
+			continue
+		}
+		r := &byteReader{b: buf[socksUDPHeaderSize:n]}
+		src, err := readSOCKSAddr(r)
+		if err != nil {
+			continue
+		}
+		return copy(p, r.b), src, nil
+	}
+}
+
+func (a *udpAssociation) SetReadDeadline(t time.Time) error {
+	return a.relay.SetReadDeadline(t)
+}
+
+func (a *udpAssociation) Close() error {
+	return errors.Join(a.relay.Close(), a.control.Close())
+}
+
+type byteReader struct{ b []byte }
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
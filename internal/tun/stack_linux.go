@@ -0,0 +1,170 @@
+package tun
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"sync"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+const (
+	nicID = 1
+	// maxPendingTCP — сколько соединений может одновременно ждать
+	// завершения рукопожатия в стеке.
+	maxPendingTCP = 1024
+	// outboundQueue — сколько пакетов стек может накопить до записи в TUN.
+	outboundQueue = 512
+)
+
+// netStack — пользовательский TCP/IP‑стек поверх дескриптора TUN. Он
+// принимает соединения на любые адреса (promiscuous + spoofing) и отдаёт
+// их Handler с исходным адресом назначения.
+//
+// Пакеты между дескриптором и стеком перекладывают собственные горутины,
+// а не fdbased: его остановка при снятии NIC может взаимно заблокироваться
+// с читающим потоком, если в этот момент приходит пакет.
+type netStack struct {
+	stack  *stack.Stack
+	link   *channel.Endpoint
+	file   *os.File
+	mtu    uint32
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newNetStack(file *os.File, mtu uint32, handler Handler) (*netStack, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol},
+	})
+	tcpForwarder := tcp.NewForwarder(s, 0, maxPendingTCP, func(r *tcp.ForwarderRequest) {
+		// ID читаем до Complete: после него запрос освобождается.
+		dst := endpointAddr(r.ID())
+		var wq waiter.Queue
+		ep, tcpErr := r.CreateEndpoint(&wq)
+		if tcpErr != nil {
+			r.Complete(true)
+			return
+		}
+		r.Complete(false)
+		go handler.HandleTCP(gonet.NewTCPConn(&wq, ep), dst)
+	})
+	s.SetTransportProtocolHandler(tcp.ProtocolNumber, tcpForwarder.HandlePacket)
+
+	udpForwarder := udp.NewForwarder(s, func(r *udp.ForwarderRequest) {
+		var wq waiter.Queue
+		ep, tcpErr := r.CreateEndpoint(&wq)
+		if tcpErr != nil {
+			return
+		}
+		dst := endpointAddr(r.ID())
+		go handler.HandleUDP(gonet.NewUDPConn(s, &wq, ep), dst)
+	})
+	s.SetTransportProtocolHandler(udp.ProtocolNumber, udpForwarder.HandlePacket)
+
+	// Обработчики протоколов ставятся до NIC: после его создания стек
+	// может сразу получить пакет.
+	link := channel.New(outboundQueue, mtu, "")
+	if tcpErr := s.CreateNIC(nicID, link); tcpErr != nil {
+		s.Destroy()
+		return nil, &stackError{tcpErr}
+	}
+	s.SetPromiscuousMode(nicID, true)
+	s.SetSpoofing(nicID, true)
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: nicID},
+		{Destination: header.IPv6EmptySubnet, NIC: nicID},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &netStack{stack: s, link: link, file: file, mtu: mtu, cancel: cancel}
+	n.wg.Add(2)
+	go n.readLoop()
+	go n.writeLoop(ctx)
+	return n, nil
+}
+
+// readLoop передаёт стеку пакеты, прочитанные из TUN, до закрытия файла.
+func (n *netStack) readLoop() {
+	defer n.wg.Done()
+	buf := make([]byte, n.mtu)
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+		if size == 0 {
+			continue
+		}
+		var proto tcpip.NetworkProtocolNumber
+		switch header.IPVersion(buf[:size]) {
+		case header.IPv4Version:
+			proto = header.IPv4ProtocolNumber
+		case header.IPv6Version:
+			proto = header.IPv6ProtocolNumber
+		default:
+			continue
+		}
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(append([]byte(nil), buf[:size]...)),
+		})
+		n.link.InjectInbound(proto, pkt)
+		pkt.DecRef()
+	}
+}
+
+// writeLoop записывает в TUN пакеты, которые отправляет стек.
+func (n *netStack) writeLoop(ctx context.Context) {
+	defer n.wg.Done()
+	for {
+		pkt := n.link.ReadContext(ctx)
+		if pkt.IsNil() {
+			return
+		}
+		view := pkt.ToView()
+		pkt.DecRef()
+		_, err := n.file.Write(view.AsSlice())
+		view.Release()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// endpointAddr — адрес назначения потока: для принятого соединения это
+// «локальная» сторона стека.
+func endpointAddr(id stack.TransportEndpointID) netip.AddrPort {
+	addr, _ := netip.AddrFromSlice(id.LocalAddress.AsSlice())
+	return netip.AddrPortFrom(addr.Unmap(), id.LocalPort)
+}
+
+// close останавливает обмен пакетами, закрывает файл TUN и стек.
+func (n *netStack) close() error {
+	n.cancel()
+	err := n.file.Close()
+	n.wg.Wait()
+	n.link.Close()
+	n.stack.Destroy()
+	return err
+}
+
+// stackError приспосабливает tcpip.Error к error.
+type stackError struct {
+	err tcpip.Error
+}
+
+func (e *stackError) Error() string {
+	return e.err.String()
+}
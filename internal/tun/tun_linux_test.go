@@ -0,0 +1,731 @@
+package tun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// Тесты создают отдельное сетевое пространство имён. Без root их можно
+// запустить в пространстве имён пользователя: unshare -rn go test ./internal/tun
+func withNetNS(t *testing.T, fn func(ns netns.NsHandle)) {
+	t.Helper()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skipf("netns unavailable: %v", err)
+	}
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("cannot create network namespace (needs CAP_SYS_ADMIN): %v", err)
+	}
+	defer func() {
+		_ = netns.Set(origin)
+		_ = ns.Close()
+	}()
+
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		t.Fatalf("lo: %v", err)
+	}
+	if err := netlink.LinkSetUp(lo); err != nil {
+		t.Fatalf("lo up: %v", err)
+	}
+	fn(ns)
+}
+
+// dialInNS открывает соединения в пространстве имён ns: горутины стека
+// выполняются на других потоках ОС, в исходном пространстве имён.
+func dialInNS(ns netns.NsHandle) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			runtime.LockOSThread()
+			origin, err := netns.Get()
+			if err != nil {
+				ch <- result{err: err}
+				return
+			}
+			defer origin.Close()
+			if err := netns.Set(ns); err != nil {
+				ch <- result{err: err}
+				return
+			}
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, address)
+			ch <- result{conn, err}
+			// Поток возвращается планировщику, только если удалось вернуть
+			// его в исходное пространство имён.
+			if netns.Set(origin) == nil {
+				runtime.UnlockOSThread()
+			}
+		}()
+		r := <-ch
+		return r.conn, r.err
+	}
+}
+
+// socksEcho — SOCKS5‑сервер с паролем, который отвечает эхом вместо
+// подключения к адресу назначения и запоминает запрошенные адреса.
+type socksEcho struct {
+	ln    net.Listener
+	relay *net.UDPConn
+	user  string
+	pass  string
+
+	mu    sync.Mutex
+	dests []string
+}
+
+func newSOCKSEcho(t *testing.T, creds core.ProxyCredentials) *socksEcho {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	s := &socksEcho{ln: ln, relay: relay, user: creds.Username, pass: creds.Password}
+	go s.serve()
+	go s.serveUDP()
+	t.Cleanup(func() {
+		ln.Close()
+		relay.Close()
+	})
+	return s
+}
+
+func (s *socksEcho) record(dst string) {
+	s.mu.Lock()
+	s.dests = append(s.dests, dst)
+	s.mu.Unlock()
+}
+
+func (s *socksEcho) destinations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dests...)
+}
+
+func (s *socksEcho) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *socksEcho) handle(conn net.Conn) {
+	defer conn.Close()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil || !bytes.Contains(methods, []byte{socksAuthPassword}) {
+		_, _ = conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return
+	}
+	_, _ = conn.Write([]byte{socksVersion, socksAuthPassword})
+
+	var ver, ulen [1]byte
+	_, _ = io.ReadFull(conn, ver[:])
+	_, _ = io.ReadFull(conn, ulen[:])
+	user := make([]byte, ulen[0])
+	_, _ = io.ReadFull(conn, user)
+	var plen [1]byte
+	_, _ = io.ReadFull(conn, plen[:])
+	pass := make([]byte, plen[0])
+	_, _ = io.ReadFull(conn, pass)
+	if string(user) != s.user || string(pass) != s.pass {
+		_, _ = conn.Write([]byte{socksPasswordVer, 1})
+		return
+	}
+	_, _ = conn.Write([]byte{socksPasswordVer, 0})
+
+	req := make([]byte, 3)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	dst, err := readSOCKSAddr(conn)
+	if err != nil {
+		return
+	}
+	switch req[1] {
+	case 1: // CONNECT
+		s.record("tcp " + dst.String())
+		reply := appendSOCKSAddr([]byte{socksVersion, socksReplySuccess, 0}, netip.MustParseAddrPort("127.0.0.1:1"))
+		_, _ = conn.Write(reply)
+		_, _ = io.Copy(conn, conn)
+	case socksCmdAssociate:
+		relay := s.relay.LocalAddr().(*net.UDPAddr).AddrPort()
+		_, _ = conn.Write(appendSOCKSAddr([]byte{socksVersion, socksReplySuccess, 0}, relay))
+		_, _ = io.Copy(io.Discard, conn)
+	}
+}
+
+func (s *socksEcho) serveUDP() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := s.relay.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		r := &byteReader{b: buf[socksUDPHeaderSize:n]}
+		dst, err := readSOCKSAddr(r)
+		if err != nil {
+			continue
+		}
+		s.record("udp " + dst.String())
+		// Эхо с тем же заголовком: ответ «пришёл» от адреса назначения.
+		_, _ = s.relay.WriteToUDP(buf[:n], from)
+	}
+}
+
+func rulePriorities(t *testing.T, family int) []int {
+	t.Helper()
+	rules, err := netlink.RuleList(family)
+	if err != nil {
+		t.Fatalf("rules: %v", err)
+	}
+	var out []int
+	for _, r := range rules {
+		if r.Priority >= rulePriorityApps && r.Priority <= rulePriorityTunnel {
+			out = append(out, r.Priority)
+		}
+	}
+	return out
+}
+
+func testConfig(creds *core.ProxyCredentials) core.TUNConfig {
+	return core.TUNConfig{
+		Name:    "volta-test0",
+		MTU:     1500,
+		Auth:    creds,
+		Exclude: []netip.Addr{netip.MustParseAddr("198.51.100.9")},
+	}
+}
+
+func TestDevice_ForwardsFlowsToSOCKS(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		creds := core.ProxyCredentials{Username: "volta-test", Password: "dummy-password"}
+		server := newSOCKSEcho(t, creds)
+
+		cfg := testConfig(&creds)
+		cfg.SOCKS = server.ln.Addr().String()
+		dev, err := OpenWithHandler(cfg, &SOCKSHandler{Address: cfg.SOCKS, Auth: cfg.Auth, Dial: dialInNS(ns)})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer dev.Close()
+
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 3 {
+			t.Fatalf("rule priorities = %v, want exclude, main and tunnel rules", got)
+		}
+
+		tcpConn, err := net.DialTimeout("tcp", "203.0.113.5:80", 5*time.Second)
+		if err != nil {
+			t.Fatalf("dial through tun: %v", err)
+		}
+		defer tcpConn.Close()
+		_ = tcpConn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := tcpConn.Write([]byte("ping")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		reply := make([]byte, 4)
+		if _, err := io.ReadFull(tcpConn, reply); err != nil || string(reply) != "ping" {
+			t.Fatalf("tcp echo = %q, %v", reply, err)
+		}
+
+		udpConn, err := net.Dial("udp", "203.0.113.6:5353")
+		if err != nil {
+			t.Fatalf("dial udp: %v", err)
+		}
+		defer udpConn.Close()
+		_ = udpConn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := udpConn.Write([]byte("hello")); err != nil {
+			t.Fatalf("write udp: %v", err)
+		}
+		buf := make([]byte, 64)
+		n, err := udpConn.Read(buf)
+		if err != nil || string(buf[:n]) != "hello" {
+			t.Fatalf("udp echo = %q, %v", buf[:n], err)
+		}
+
+		dests := server.destinations()
+		want := map[string]bool{"tcp 203.0.113.5:80": false, "udp 203.0.113.6:5353": false}
+		for _, d := range dests {
+			if _, ok := want[d]; ok {
+				want[d] = true
+			}
+		}
+		for d, seen := range want {
+			if !seen {
+				t.Fatalf("SOCKS server did not see %s; got %v", d, dests)
+			}
+		}
+
+		if err := dev.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 0 {
+			t.Fatalf("rules left after Close: %v", got)
+		}
+		if _, err := netlink.LinkByName(cfg.Name); err == nil {
+			t.Fatal("interface left after Close")
+		}
+	})
+}
+
+func TestRecover_RemovesRulesAfterCrash(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		dev, err := OpenWithHandler(testConfig(nil), &SOCKSHandler{Address: "127.0.0.1:1"})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		// Аварийное завершение: дескриптор закрывается ядром, правила остаются.
+		_ = dev.stack.close()
+		dev.handle.Close()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if _, err := netlink.LinkByName("volta-test0"); err != nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("non-persistent interface outlived its descriptor")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 3 {
+			t.Fatalf("rule priorities after crash = %v", got)
+		}
+
+		if err := Recover(); err != nil {
+			t.Fatalf("Recover: %v", err)
+		}
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 0 {
+			t.Fatalf("rules left after Recover: %v", got)
+		}
+
+		// Новый запуск после сбоя поднимается с чистыми правилами.
+		again, err := OpenWithHandler(testConfig(nil), &SOCKSHandler{Address: "127.0.0.1:1"})
+		if err != nil {
+			t.Fatalf("Open after recover: %v", err)
+		}
+		defer again.Close()
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 3 {
+			t.Fatalf("rule priorities = %v", got)
+		}
+	})
+}
+
+// addUplink создаёт «физический» интерфейс volta-up0 с маршрутами по
+// умолчанию через 10.9.0.1 и fd09::1 и возвращает его очередь: пакеты,
+// ушедшие в сеть, читаются из неё. Uplink — TUN: модуля dummy может не быть.
+func addUplink(t *testing.T) *os.File {
+	t.Helper()
+	uplink := &netlink.Tuntap{
+		LinkAttrs: netlink.LinkAttrs{Name: "volta-up0"},
+		Mode:      netlink.TUNTAP_MODE_TUN,
+		Flags:     netlink.TUNTAP_NO_PI,
+		Queues:    1,
+	}
+	if err := netlink.LinkAdd(uplink); err != nil {
+		t.Fatalf("add uplink: %v", err)
+	}
+	t.Cleanup(func() { _ = uplink.Fds[0].Close() })
+	addr, _ := netlink.ParseAddr("10.9.0.2/24")
+	if err := netlink.AddrAdd(uplink, addr); err != nil {
+		t.Fatalf("uplink addr: %v", err)
+	}
+	addr6, _ := netlink.ParseAddr("fd09::2/64")
+	addr6.Flags = unix.IFA_F_NODAD
+	if err := netlink.AddrAdd(uplink, addr6); err != nil {
+		t.Fatalf("uplink addr6: %v", err)
+	}
+	if err := netlink.LinkSetUp(uplink); err != nil {
+		t.Fatalf("uplink up: %v", err)
+	}
+	for _, gw := range []string{"10.9.0.1", "fd09::1"} {
+		if err := netlink.RouteAdd(&netlink.Route{LinkIndex: uplink.Attrs().Index, Gw: net.ParseIP(gw)}); err != nil {
+			t.Fatalf("default route via %s: %v", gw, err)
+		}
+	}
+	return uplink.Fds[0]
+}
+
+// udpSource возвращает адрес, с которого ушли бы пакеты к address: UDP‑
+// «соединение» ничего не отправляет, но выбирает маршрут.
+func udpSource(d *net.Dialer, address string) (string, error) {
+	conn, err := d.Dial("udp", address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+func TestDevice_IPv6Policy(t *testing.T) {
+	const target = "[2001:db8::5]:53"
+	cases := []struct {
+		policy settings.IPv6Policy
+		rules  int
+		// source — адрес источника для target; пусто — маршрута нет.
+		source string
+	}{
+		{policy: settings.IPv6Tunnel, rules: 3, source: interfacePrefix6.Addr().String()},
+		{policy: settings.IPv6Block, rules: 3},
+		{policy: settings.IPv6Allow, rules: 0, source: "fd09::2"},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			withNetNS(t, func(ns netns.NsHandle) {
+				addUplink(t)
+				creds := core.ProxyCredentials{Username: "volta-test", Password: "dummy-password"}
+				server := newSOCKSEcho(t, creds)
+				cfg := testConfig(&creds)
+				cfg.SOCKS = server.ln.Addr().String()
+				cfg.Exclude = append(cfg.Exclude, netip.MustParseAddr("2001:db8::9"))
+				cfg.IPv6 = tc.policy
+				dev, err := OpenWithHandler(cfg, &SOCKSHandler{Address: cfg.SOCKS, Auth: cfg.Auth, Dial: dialInNS(ns)})
+				if err != nil {
+					t.Fatalf("Open: %v", err)
+				}
+				defer dev.Close()
+
+				if got := rulePriorities(t, netlink.FAMILY_V6); len(got) != tc.rules {
+					t.Fatalf("IPv6 rule priorities = %v, want %d rules", got, tc.rules)
+				}
+				source, err := udpSource(&net.Dialer{}, target)
+				if tc.source == "" {
+					if err == nil {
+						t.Fatalf("IPv6 leaves from %s, want no route", source)
+					}
+				} else if source != tc.source {
+					t.Fatalf("IPv6 source = %s (%v), want %s", source, err, tc.source)
+				}
+				// Адрес сервера всегда идёт мимо туннеля.
+				if source, err := udpSource(&net.Dialer{}, "[2001:db8::9]:443"); source != "fd09::2" {
+					t.Fatalf("VPN server source = %s (%v), want the uplink", source, err)
+				}
+
+				if tc.policy == settings.IPv6Tunnel {
+					conn, err := net.DialTimeout("tcp", "[2001:db8::5]:80", 5*time.Second)
+					if err != nil {
+						t.Fatalf("dial IPv6 through tun: %v", err)
+					}
+					defer conn.Close()
+					_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+					reply := make([]byte, 4)
+					if _, err := conn.Write([]byte("ping")); err != nil {
+						t.Fatalf("write: %v", err)
+					}
+					if _, err := io.ReadFull(conn, reply); err != nil {
+						t.Fatalf("tcp echo: %v", err)
+					}
+					if dests := server.destinations(); len(dests) == 0 || dests[0] != "tcp [2001:db8::5]:80" {
+						t.Fatalf("SOCKS server saw %v", dests)
+					}
+				}
+
+				if err := dev.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				if got := rulePriorities(t, netlink.FAMILY_V6); len(got) != 0 {
+					t.Fatalf("IPv6 rules left after Close: %v", got)
+				}
+			})
+		})
+	}
+}
+
+func TestBypassDialer_LeavesThroughUplink(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		addUplink(t)
+
+		dev, err := OpenWithHandler(testConfig(nil), &SOCKSHandler{Address: "127.0.0.1:1"})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer dev.Close()
+
+		source := func(d *net.Dialer) string {
+			t.Helper()
+			source, err := udpSource(d, "203.0.113.5:53")
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			return source
+		}
+		if got := source(&net.Dialer{}); got != interfacePrefix.Addr().String() {
+			t.Fatalf("plain dialer source = %s, want the tunnel address", got)
+		}
+		bypass, err := BypassDialer()
+		if err != nil {
+			t.Fatalf("BypassDialer: %v", err)
+		}
+		if got := source(bypass); got != "10.9.0.2" {
+			t.Fatalf("bypass dialer source = %s, want the uplink address", got)
+		}
+	})
+}
+
+// readUDP читает из очереди интерфейса IPv4‑пакеты, пока не встретит UDP к
+// dst, и возвращает адрес его источника.
+func readUDP(t *testing.T, queue *os.File, dst netip.AddrPort) netip.Addr {
+	t.Helper()
+	_ = queue.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	for {
+		n, err := queue.Read(buf)
+		if err != nil {
+			t.Fatalf("read uplink: %v", err)
+		}
+		p := buf[:n]
+		if n < 28 || p[0]>>4 != 4 || p[9] != unix.IPPROTO_UDP {
+			continue
+		}
+		ihl := int(p[0]&0x0f) * 4
+		to := netip.AddrPortFrom(netip.AddrFrom4([4]byte(p[16:20])), uint16(p[ihl+2])<<8|uint16(p[ihl+3]))
+		if to == dst {
+			return netip.AddrFrom4([4]byte(p[12:16]))
+		}
+	}
+}
+
+func TestDevice_BypassAppsLeaveThroughUplink(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("executable: %v", err)
+	}
+	withNetNS(t, func(ns netns.NsHandle) {
+		uplink := addUplink(t)
+		before, err := processCgroup(os.Getpid())
+		if err != nil {
+			t.Skipf("cgroup v2 unavailable: %v", err)
+		}
+
+		// Приложение мимо туннеля — сам тестовый процесс.
+		cfg := testConfig(nil)
+		cfg.BypassApps = []string{exe}
+		cfg.BypassMark = 0x7575
+		dev, err := OpenWithHandler(cfg, &SOCKSHandler{Address: "127.0.0.1:1"})
+		if err != nil {
+			t.Skipf("per-app routing unavailable (needs root, cgroup v2 and nftables): %v", err)
+		}
+		defer dev.Close()
+
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 4 || got[0] != rulePriorityApps {
+			t.Fatalf("rule priorities = %v, want the apps rule first", got)
+		}
+		if got, _ := processCgroup(os.Getpid()); got != dev.apps.cgroup {
+			t.Fatalf("process cgroup = %s, want %s", got, dev.apps.cgroup)
+		}
+
+		// Маршрут выбран до метки: «соединение» получает адрес TUN, а
+		// пакет уходит через uplink с адресом uplink.
+		conn, err := net.Dial("udp", "203.0.113.5:53")
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("probe")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if src := readUDP(t, uplink, netip.MustParseAddrPort("203.0.113.5:53")); src != netip.MustParseAddr("10.9.0.2") {
+			t.Fatalf("bypass packet source = %s, want the uplink address", src)
+		}
+
+		if err := dev.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if got, _ := processCgroup(os.Getpid()); got != before {
+			t.Fatalf("process cgroup after Close = %s, want %s", got, before)
+		}
+		if _, err := os.Stat(dev.apps.dir(dev.apps.cgroup)); !os.IsNotExist(err) {
+			t.Fatalf("cgroup left after Close: %v", err)
+		}
+		if got := rulePriorities(t, netlink.FAMILY_V4); len(got) != 0 {
+			t.Fatalf("rules left after Close: %v", got)
+		}
+	})
+}
+
+func TestStatParentPid(t *testing.T) {
+	cases := []struct {
+		stat string
+		ppid int
+		ok   bool
+	}{
+		{"1234 (bash) S 1 1234 1234 0", 1, true},
+		{"1234 (a) b) c) R 42 1234", 42, true},
+		{"1234 (tab\tname) S 7 1", 7, true},
+		{"1234 bash S 1 1234", 0, false},
+		{"1234 (bash) S", 0, false},
+		{"1234 (bash) S x 1", 0, false},
+		{"1234 (bash) S -5 1", 0, false},
+		{"", 0, false},
+	}
+	for _, tc := range cases {
+		ppid, err := statParentPid([]byte(tc.stat))
+		if (err == nil) != tc.ok || ppid != tc.ppid {
+			t.Errorf("statParentPid(%q) = %d, %v", tc.stat, ppid, err)
+		}
+	}
+}
+
+// stubEcho — заглушка DNS: отвечает на датаграммы и TCP тем же содержимым
+// с префиксом "stub:".
+func stubEcho(t *testing.T) netip.AddrPort {
+	t.Helper()
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	addr := udp.LocalAddr().(*net.UDPAddr).AddrPort()
+	tcp, err := net.Listen("tcp", addr.String())
+	if err != nil {
+		udp.Close()
+		t.Fatalf("listen tcp: %v", err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = udp.WriteTo(append([]byte("stub:"), buf[:n]...), from)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 512)
+			n, _ := conn.Read(buf)
+			_, _ = conn.Write(append([]byte("stub:"), buf[:n]...))
+			conn.Close()
+		}
+	}()
+	return addr
+}
+
+func TestDevice_RelaysResolverToDNSStub(t *testing.T) {
+	withNetNS(t, func(ns netns.NsHandle) {
+		server := newSOCKSEcho(t, core.ProxyCredentials{})
+		cfg := testConfig(nil)
+		cfg.SOCKS = server.ln.Addr().String()
+		cfg.DNS = stubEcho(t)
+		dev, err := OpenWithHandler(cfg, &SOCKSHandler{Address: cfg.SOCKS, Dial: dialInNS(ns)})
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer dev.Close()
+
+		for _, network := range []string{"udp", "tcp"} {
+			conn, err := net.DialTimeout(network, resolverAddr.String(), 5*time.Second)
+			if err != nil {
+				t.Fatalf("dial %s resolver: %v", network, err)
+			}
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write([]byte("query")); err != nil {
+				t.Fatalf("write %s: %v", network, err)
+			}
+			buf := make([]byte, 64)
+			n, err := conn.Read(buf)
+			conn.Close()
+			if err != nil || string(buf[:n]) != "stub:query" {
+				t.Fatalf("%s reply = %q, %v", network, buf[:n], err)
+			}
+		}
+		if dests := server.destinations(); len(dests) != 0 {
+			t.Fatalf("resolver queries went to SOCKS: %v", dests)
+		}
+	})
+}
+
+// fakeResolved — systemd-resolved на шине: записывает вызовы.
+type fakeResolved struct {
+	dbus.BusObject
+	calls []string
+	args  [][]interface{}
+	fail  string
+}
+
+func (f *fakeResolved) CallWithContext(_ context.Context, method string, _ dbus.Flags, args ...interface{}) *dbus.Call {
+	f.calls = append(f.calls, strings.TrimPrefix(method, resolvedManager+"."))
+	f.args = append(f.args, args)
+	if strings.HasSuffix(method, "."+f.fail) {
+		return &dbus.Call{Err: errors.New("access denied")}
+	}
+	return &dbus.Call{}
+}
+
+func TestResolvedLink_ApplyAndRevert(t *testing.T) {
+	bus := &fakeResolved{}
+	link := &resolvedLink{object: bus, index: 7}
+	if err := link.apply(); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := link.revert(); err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	want := []string{"SetLinkDNS", "SetLinkDomains", "SetLinkDefaultRoute", "RevertLink"}
+	if !slices.Equal(bus.calls, want) {
+		t.Fatalf("calls = %v, want %v", bus.calls, want)
+	}
+	servers := bus.args[0][1].([]resolvedAddress)
+	if bus.args[0][0] != int32(7) || len(servers) != 1 || servers[0].Family != unix.AF_INET ||
+		!bytes.Equal(servers[0].Address, []byte{172, 19, 0, 2}) {
+		t.Fatalf("SetLinkDNS args = %v", bus.args[0])
+	}
+	if domains := bus.args[1][1].([]resolvedDomain); len(domains) != 1 || domains[0] != (resolvedDomain{Domain: ".", RoutingOnly: true}) {
+		t.Fatalf("SetLinkDomains args = %v", bus.args[1])
+	}
+}
+
+func TestResolvedLink_ApplyFailureReverts(t *testing.T) {
+	bus := &fakeResolved{fail: "SetLinkDomains"}
+	if err := (&resolvedLink{object: bus, index: 7}).apply(); err == nil {
+		t.Fatal("apply succeeded with a failing SetLinkDomains")
+	}
+	if got := bus.calls[len(bus.calls)-1]; got != "RevertLink" {
+		t.Fatalf("calls = %v, want RevertLink last", bus.calls)
+	}
+}
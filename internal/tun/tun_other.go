@@ -0,0 +1,27 @@
+//go:build !linux
+
+package tun
+
+import (
+	"net"
+
+	"github.com/voltavpn/volta-client/internal/core"
+)
+
+// Open на других платформах недоступен: режим TUN поддерживается только в Linux.
+func Open(core.TUNConfig) (core.TUNDevice, error) {
+	return nil, core.ErrTUNUnsupported
+}
+
+// Recover ничего не делает: на этих платформах клиент маршруты не меняет.
+func Recover() error {
+	return nil
+}
+
+var _ core.TUNOpener = Open
+
+// BypassDialer на других платформах не нужен: туннель не меняет маршруты,
+// и обычный Dialer уже идёт мимо него.
+func BypassDialer() (*net.Dialer, error) {
+	return &net.Dialer{}, nil
+}
@@ -0,0 +1,13 @@
+// Package xray links the Xray core into the client as a library and adapts
+// it to core.EmbeddedCore. Only the features used by the configuration
+// from core.BuildEngineConfig are registered, so the rest of the core is
+// not compiled into the client.
+//
+// Routing rules with GeoIP country codes or geosite categories need
+// geoip.dat and geosite.dat next to the executable (or in the directory
+// named by XRAY_LOCATION_ASSET); without them New returns
+// ErrGeoDataMissing. CheckRouting reports such rules from the settings
+// before a connection is attempted; the front ends run it on start and
+// before connecting. The private address set is passed as subnets and
+// needs no data files.
+package xray
@@ -0,0 +1,178 @@
+package xray
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xtls/xray-core/common/platform"
+	xraycore "github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/stats"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/infra/conf/serial"
+
+	// Возможности ядра, которые использует конфигурация движка.
+	_ "github.com/xtls/xray-core/app/dispatcher"
+	_ "github.com/xtls/xray-core/app/dns"
+	_ "github.com/xtls/xray-core/app/log"
+	_ "github.com/xtls/xray-core/app/policy"
+	_ "github.com/xtls/xray-core/app/proxyman/inbound"
+	_ "github.com/xtls/xray-core/app/proxyman/outbound"
+	_ "github.com/xtls/xray-core/app/router"
+	_ "github.com/xtls/xray-core/app/stats"
+	_ "github.com/xtls/xray-core/proxy/blackhole"
+	_ "github.com/xtls/xray-core/proxy/dns"
+	_ "github.com/xtls/xray-core/proxy/freedom"
+	_ "github.com/xtls/xray-core/proxy/http"
+	_ "github.com/xtls/xray-core/proxy/socks"
+	_ "github.com/xtls/xray-core/proxy/vless/outbound"
+	_ "github.com/xtls/xray-core/transport/internet/grpc"
+	_ "github.com/xtls/xray-core/transport/internet/reality"
+	_ "github.com/xtls/xray-core/transport/internet/tcp"
+	_ "github.com/xtls/xray-core/transport/internet/tls"
+	_ "github.com/xtls/xray-core/transport/internet/websocket"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+// proxyOutbound — тег исходящего, через который идёт трафик пользователя.
+const proxyOutbound = "proxy"
+
+var errInvalidConfig = errors.New("xray: engine config rejected")
+
+// ErrGeoDataMissing означает, что правила маршрутизации ссылаются на наборы
+// geoip или geosite, а файлов geoip.dat и geosite.dat рядом с программой
+// нет. Набор private в правила передаётся подсетями и баз не требует.
+var ErrGeoDataMissing = errors.New("xray: geoip.dat or geosite.dat not found")
+
+// Core — экземпляр ядра Xray.
+type Core struct {
+	instance *xraycore.Instance
+	uplink   stats.Counter
+	downlink stats.Counter
+}
+
+// New собирает ядро из конфигурации core.BuildEngineConfig; подходит как
+// core.CoreFactory. Ошибка разбора не передаёт текст ядра: он может
+// содержать UUID из конфигурации.
+func New(config []byte) (core.EmbeddedCore, error) {
+	if err := checkGeoData(config); err != nil {
+		return nil, err
+	}
+	cfg, err := serial.DecodeJSONConfig(bytes.NewReader(config))
+	if err != nil {
+		return nil, errInvalidConfig
+	}
+	// Счётчики исходящих нужны только Traffic, поэтому включаются здесь,
+	// а не в конфигурации движка.
+	cfg.Stats = &conf.StatsConfig{}
+	cfg.Policy = &conf.PolicyConfig{System: &conf.SystemPolicy{
+		StatsOutboundUplink:   true,
+		StatsOutboundDownlink: true,
+	}}
+	built, err := cfg.Build()
+	if err != nil {
+		return nil, errInvalidConfig
+	}
+	instance, err := xraycore.New(built)
+	if err != nil {
+		return nil, fmt.Errorf("xray: create core: %w", err)
+	}
+
+	c := &Core{instance: instance}
+	if manager, ok := instance.GetFeature(stats.ManagerType()).(stats.Manager); ok {
+		c.uplink = manager.GetCounter(counterName("uplink"))
+		c.downlink = manager.GetCounter(counterName("downlink"))
+	}
+	return c, nil
+}
+
+func (c *Core) Start() error {
+	return c.instance.Start()
+}
+
+func (c *Core) Close() error {
+	return c.instance.Close()
+}
+
+// Traffic возвращает байты, прошедшие через исходящий proxy.
+func (c *Core) Traffic() (uplink, downlink uint64) {
+	return counterValue(c.uplink), counterValue(c.downlink)
+}
+
+func counterName(direction string) string {
+	return "outbound>>>" + proxyOutbound + ">>>traffic>>>" + direction
+}
+
+func counterValue(c stats.Counter) uint64 {
+	if c == nil {
+		return 0
+	}
+	return uint64(max(c.Value(), 0))
+}
+
+// checkGeoData проверяет, что для правил с наборами geoip и geosite есть
+// файлы баз. Без проверки ядро отклонило бы конфигурацию с ошибкой,
+// неотличимой от ошибки в самих правилах.
+func checkGeoData(config []byte) error {
+	var doc struct {
+		Routing struct {
+			Rules []struct {
+				Domain []string `json:"domain"`
+				IP     []string `json:"ip"`
+			} `json:"rules"`
+		} `json:"routing"`
+	}
+	if err := json.Unmarshal(config, &doc); err != nil {
+		return errInvalidConfig
+	}
+	needed := map[string]bool{}
+	for _, rule := range doc.Routing.Rules {
+		for _, v := range rule.IP {
+			if strings.HasPrefix(v, "geoip:") {
+				needed["geoip.dat"] = true
+			}
+		}
+		for _, v := range rule.Domain {
+			if strings.HasPrefix(v, "geosite:") {
+				needed["geosite.dat"] = true
+			}
+		}
+	}
+	for file := range needed {
+		if !assetExists(file) {
+			return ErrGeoDataMissing
+		}
+	}
+	return nil
+}
+
+// CheckRouting проверяет правила из настроек до подключения: для наборов
+// geoip (кроме private) и geosite нужны файлы баз. Ошибка указывает номер
+// первого правила без базы (с 1) и оборачивает ErrGeoDataMissing.
+func CheckRouting(r settings.RoutingSettings) error {
+	for i, rule := range r.Rules {
+		var file string
+		switch {
+		case rule.Kind == settings.RuleGeoIP && rule.Value != "private":
+			file = "geoip.dat"
+		case rule.Kind == settings.RuleGeoSite:
+			file = "geosite.dat"
+		default:
+			continue
+		}
+		if !assetExists(file) {
+			return fmt.Errorf("routing rule %d (%s:%s): %w", i+1, rule.Kind, rule.Value, ErrGeoDataMissing)
+		}
+	}
+	return nil
+}
+
+func assetExists(file string) bool {
+	_, err := os.Stat(platform.GetAssetLocation(file))
+	return err == nil
+}
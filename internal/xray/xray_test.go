@@ -0,0 +1,127 @@
+package xray
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voltavpn/volta-client/internal/core"
+	"github.com/voltavpn/volta-client/internal/settings"
+)
+
+const testWSLink = "vless://11111111-2222-3333-4444-555555555555@edge.example.com:443" +
+	"?type=ws&security=tls&sni=edge.example.com&path=%2Fws&host=edge.example.com#Test%20WS"
+
+// Все конфигурации из эталонов core должны собираться в ядро; правила с
+// наборами geoip/geosite без файлов баз дают ErrGeoDataMissing.
+func TestNew_AcceptsEngineConfigs(t *testing.T) {
+	t.Setenv("XRAY_LOCATION_ASSET", t.TempDir())
+
+	paths, err := filepath.Glob(filepath.Join("..", "core", "testdata", "config_*.golden.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("golden configs: %v, %d found", err, len(paths))
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			config, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, err := New(config)
+			if strings.Contains(string(config), `"geosite:`) {
+				if !errors.Is(err, ErrGeoDataMissing) {
+					t.Fatalf("New without geo data = %v, want ErrGeoDataMissing", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if up, down := c.Traffic(); up != 0 || down != 0 {
+				t.Fatalf("traffic before start = %d/%d", up, down)
+			}
+			if err := c.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckRouting(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XRAY_LOCATION_ASSET", dir)
+	r := settings.RoutingSettings{Final: settings.RuleActionProxy, Rules: []settings.RoutingRule{
+		{Kind: settings.RuleGeoIP, Value: "private", Action: settings.RuleActionDirect},
+		{Kind: settings.RuleDomainSuffix, Value: "example.com", Action: settings.RuleActionDirect},
+		{Kind: settings.RuleGeoIP, Value: "ru", Action: settings.RuleActionDirect},
+		{Kind: settings.RuleGeoSite, Value: "category-ads", Action: settings.RuleActionBlock},
+	}}
+
+	// private передаётся подсетями и баз не требует.
+	if err := CheckRouting(settings.RoutingSettings{Rules: r.Rules[:2]}); err != nil {
+		t.Fatalf("private set without data files = %v", err)
+	}
+	err := CheckRouting(r)
+	if !errors.Is(err, ErrGeoDataMissing) || !strings.Contains(err.Error(), "routing rule 3") {
+		t.Fatalf("country set without geoip.dat = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "geoip.dat"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRouting(r); !errors.Is(err, ErrGeoDataMissing) || !strings.Contains(err.Error(), "routing rule 4") {
+		t.Fatalf("geosite without geosite.dat = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "geosite.dat"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRouting(r); err != nil {
+		t.Fatalf("with both data files = %v", err)
+	}
+}
+
+func TestNew_RejectsInvalidConfig(t *testing.T) {
+	if _, err := New([]byte(`{"outbounds":[{"protocol":"no-such-protocol"}]}`)); !errors.Is(err, errInvalidConfig) {
+		t.Fatalf("New = %v, want errInvalidConfig", err)
+	}
+}
+
+// Движок с настоящим ядром поднимает локальные прокси и снимает их на Stop.
+func TestInProcessEngine_RealCore(t *testing.T) {
+	profile, err := core.ParseProfile(testWSLink)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+	opts := core.EngineOptions{Settings: settings.Default()}
+	endpoints, ok := core.LocalProxies(opts)
+	if !ok {
+		t.Fatal("no local proxies in proxy mode")
+	}
+	socks := endpoints.SOCKS
+
+	engine := core.NewInProcessEngine(New)
+	if err := engine.Start(context.Background(), profile, opts); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if st := engine.Stats(); st.StartedAt.IsZero() || st.BytesUp != 0 || st.BytesDown != 0 {
+		t.Fatalf("stats after start = %+v", st)
+	}
+	conn, err := net.DialTimeout("tcp", socks, time.Second)
+	if err != nil {
+		t.Fatalf("SOCKS inbound is not listening: %v", err)
+	}
+	conn.Close()
+
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if conn, err := net.DialTimeout("tcp", socks, time.Second); err == nil {
+		conn.Close()
+		t.Fatal("SOCKS inbound still listening after Stop")
+	}
+}